@@ -2,23 +2,31 @@ package cli
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"os"
 	"runtime/debug"
+	"strings"
 
 	"github.com/alecthomas/kong"
+	"github.com/danielgtaylor/huma/v2"
 
 	"github.com/jh125486/batterdb/handlers"
+	"github.com/jh125486/batterdb/repository"
 )
 
 type Ctx struct {
 	*debug.BuildInfo
 	service *handlers.Service
 	io.Writer
-	Stop chan os.Signal
+	io.Reader
+	Stop     chan os.Signal
+	repoFile string
+	offline  bool
 }
 
 //nolint:govet
@@ -33,6 +41,11 @@ type (
 
 		OpenAPI OpenAPICmd `help:"Output the OpenAPI specification version." cmd:"" optional:""`
 
+		Examples ExamplesCmd `help:"Output example curl requests." cmd:""`
+
+		Export ExportCmd `help:"Output the persisted repository as JSON." cmd:""`
+		Import ImportCmd `help:"Write the persisted repository from JSON read from stdin." cmd:""`
+
 		Version kong.VersionFlag `short:"v" help:"Show version."`
 	}
 	ServerCmd struct {
@@ -40,6 +53,14 @@ type (
 	OpenAPICmd struct {
 		Spec string `default:"3.1" help:"OpenAPI specification version." enum:"3.1,3.0.3"`
 	}
+	ExamplesCmd struct {
+		Host string `default:"localhost" help:"Host of the server in the examples."`
+	}
+	ExportCmd struct {
+	}
+	ImportCmd struct {
+		Force bool `short:"f" help:"Overwrite an existing repository file."`
+	}
 )
 
 func New(args []string, opts ...kong.Option) (*kong.Context, error) {
@@ -60,6 +81,11 @@ func (cmd *CLI) Validate() error {
 }
 
 func (cmd *CLI) AfterApply(ctx *Ctx) error {
+	ctx.repoFile = cmd.RepoFile
+	if ctx.offline {
+		// the command works on the repository file, without the service.
+		return nil
+	}
 	ctx.service = handlers.New(
 		handlers.WithBuildInfo(ctx.BuildInfo),
 		handlers.WithPort(cmd.Port),
@@ -91,3 +117,129 @@ func (cmd *OpenAPICmd) Run(ctx *Ctx) error {
 	_, err := ctx.Write(ctx.service.OpenAPI(cmd.Spec))
 	return err
 }
+
+// BeforeApply marks the export as offline, so the service isn't created.
+func (cmd *ExportCmd) BeforeApply(ctx *Ctx) error {
+	ctx.offline = true
+	return nil
+}
+
+// Run writes every database of the repository file to the output as a JSON
+// array of database exports, the same documents as the export endpoint.
+func (cmd *ExportCmd) Run(ctx *Ctx) error {
+	r := repository.New()
+	if err := r.Load(ctx.repoFile); err != nil {
+		return fmt.Errorf("failed to load repository: %w", err)
+	}
+	dbs := r.SortDatabases()
+	exports := make([]repository.DatabaseExport, len(dbs))
+	for i, db := range dbs {
+		exports[i] = db.Export()
+	}
+	enc := json.NewEncoder(ctx)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(exports)
+}
+
+// BeforeApply marks the import as offline, so the service isn't created.
+func (cmd *ImportCmd) BeforeApply(ctx *Ctx) error {
+	ctx.offline = true
+	return nil
+}
+
+// Run reads a JSON array of database exports from the input and writes them
+// to a new repository file. An existing file is only replaced with Force.
+func (cmd *ImportCmd) Run(ctx *Ctx) error {
+	if _, err := os.Stat(ctx.repoFile); err == nil && !cmd.Force {
+		return fmt.Errorf("repository file %q already exists, use --force to overwrite it", ctx.repoFile)
+	}
+	var exports []repository.DatabaseExport
+	if err := json.NewDecoder(ctx).Decode(&exports); err != nil {
+		return fmt.Errorf("failed to decode import: %w", err)
+	}
+	r := repository.New()
+	for _, exp := range exports {
+		db, err := r.New(exp.Name, repository.WithMode(exp.Mode))
+		if err != nil {
+			return fmt.Errorf("failed to create database %q: %w", exp.Name, err)
+		}
+		if err := db.Import(exp, false); err != nil {
+			return fmt.Errorf("failed to import database %q: %w", exp.Name, err)
+		}
+	}
+
+	return r.Persist(ctx.repoFile)
+}
+
+// examples are the operations shown by the examples command, in order. The
+// method and path of each are looked up in the registered routes.
+var examples = []struct {
+	operationID string
+	query       string
+	body        string
+}{
+	{operationID: "post-database", query: "name=mydatabase"},
+	{operationID: "create-stack", query: "name=mystack"},
+	{operationID: "push-stack", body: `{"element":"hello"}`},
+	{operationID: "peek-stack"},
+	{operationID: "pop-stack"},
+}
+
+// exampleParams are the values used for path parameters in the examples.
+var exampleParams = strings.NewReplacer("{database}", "mydatabase", "{stack}", "mystack")
+
+func (cmd *ExamplesCmd) Run(ctx *Ctx) error {
+	scheme, insecure := "http", ""
+	if ctx.service.Secure() {
+		// the server uses a self-signed certificate.
+		scheme, insecure = "https", " -k"
+	}
+	baseURL := fmt.Sprintf("%s://%s:%d", scheme, cmd.Host, ctx.service.Port())
+
+	rs := routes(ctx.service.API.OpenAPI())
+	for _, ex := range examples {
+		r, ok := rs[ex.operationID]
+		if !ok {
+			continue
+		}
+		u := baseURL + exampleParams.Replace(r.path)
+		if ex.query != "" {
+			u += "?" + ex.query
+		}
+		var data string
+		if ex.body != "" {
+			data = fmt.Sprintf(" -H 'Content-Type: application/json' -d '%s'", ex.body)
+		}
+		if _, err := fmt.Fprintf(ctx, "# %s (%s %s)\ncurl%s -X %s '%s'%s\n\n",
+			r.description, r.method, r.path, insecure, r.method, u, data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type route struct {
+	method, path, description string
+}
+
+// routes indexes the routes of the OpenAPI spec by operation ID.
+func routes(oapi *huma.OpenAPI) map[string]route {
+	rs := make(map[string]route)
+	for path, item := range oapi.Paths {
+		for method, op := range map[string]*huma.Operation{
+			http.MethodGet:    item.Get,
+			http.MethodPut:    item.Put,
+			http.MethodPost:   item.Post,
+			http.MethodDelete: item.Delete,
+			http.MethodPatch:  item.Patch,
+		} {
+			if op != nil {
+				rs[op.OperationID] = route{method: method, path: path, description: op.Description}
+			}
+		}
+	}
+
+	return rs
+}
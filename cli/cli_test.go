@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"debug/buildinfo"
 	"os"
+	"path/filepath"
 	"runtime/debug"
 	"testing"
 	"time"
@@ -13,6 +14,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/jh125486/batterdb/cli"
+	"github.com/jh125486/batterdb/repository"
 )
 
 func TestNew(t *testing.T) {
@@ -146,3 +148,90 @@ func TestOpenAPICmd_Run(t *testing.T) {
 		})
 	}
 }
+
+func TestExamplesCmd_Run(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name   string
+		secure bool
+		want   []string
+	}{
+		{
+			name: "http",
+			want: []string{
+				"curl -X POST 'http://example.com:1205/databases?name=mydatabase'",
+				"curl -X POST 'http://example.com:1205/databases/mydatabase/stacks?name=mystack'",
+				`curl -X PUT 'http://example.com:1205/databases/mydatabase/stacks/mystack' -H 'Content-Type: application/json' -d '{"element":"hello"}'`,
+				"curl -X GET 'http://example.com:1205/databases/mydatabase/stacks/mystack/peek'",
+				"curl -X DELETE 'http://example.com:1205/databases/mydatabase/stacks/mystack'",
+			},
+		},
+		{
+			name:   "https",
+			secure: true,
+			want: []string{
+				"curl -k -X POST 'https://example.com:1205/databases?name=mydatabase'",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			out := new(bytes.Buffer)
+			ctx := &cli.Ctx{Writer: out}
+			c := cli.CLI{Port: 1205, Secure: tt.secure}
+			require.NoError(t, c.AfterApply(ctx))
+			cmd := &cli.ExamplesCmd{Host: "example.com"}
+			require.NoError(t, cmd.Run(ctx))
+			for _, want := range tt.want {
+				assert.Contains(t, out.String(), want)
+			}
+		})
+	}
+}
+
+func TestExportImportCmd_Run(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src.gob"), filepath.Join(dir, "dst.gob")
+
+	r := repository.New()
+	for _, name := range []string{"dbName123", "dbName456"} {
+		db, err := r.New(name)
+		require.NoError(t, err)
+		for _, stackName := range []string{"stackName123", "stackName456", "stackName789"} {
+			stack, err := db.New(stackName)
+			require.NoError(t, err)
+			require.NoError(t, stack.PushMany([]any{"first", "second"}))
+		}
+	}
+	require.NoError(t, r.Persist(src))
+
+	run := func(ctx *cli.Ctx, args ...string) error {
+		k, err := cli.New(args, kong.Vars{"RepoFile": ".batterdb.gob"}, kong.Bind(ctx))
+		if err != nil {
+			return err
+		}
+		return k.Run()
+	}
+
+	exported := new(bytes.Buffer)
+	require.NoError(t, run(&cli.Ctx{Writer: exported}, "--repo-file", src, "export"))
+	assert.Contains(t, exported.String(), `"name": "dbName123"`)
+
+	data := exported.Bytes()
+	require.NoError(t, run(&cli.Ctx{Reader: bytes.NewReader(data)}, "--repo-file", dst, "import"))
+	require.Error(t, run(&cli.Ctx{Reader: bytes.NewReader(data)}, "--repo-file", dst, "import"), "existing file")
+	require.NoError(t, run(&cli.Ctx{Reader: bytes.NewReader(data)}, "--repo-file", dst, "import", "--force"))
+
+	got := repository.New()
+	require.NoError(t, got.Load(dst))
+	require.Equal(t, 2, got.Len())
+	for _, db := range got.SortDatabases() {
+		require.Len(t, db.Stacks, 3)
+		for _, stack := range db.Stacks {
+			assert.Equal(t, "second", stack.Peek())
+			assert.Equal(t, 2, stack.Size())
+		}
+	}
+}
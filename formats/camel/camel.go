@@ -0,0 +1,211 @@
+// Package camel provides a JSON format that renders response struct fields
+// with camelCase keys instead of the snake_case keys declared in their `json`
+// tags, e.g. `number_of_databases` becomes `numberOfDatabases`.
+//
+// Only keys derived from struct fields are rewritten. Map keys and element
+// payloads (anything decoded from a client request) are emitted untouched.
+package camel
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"io"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/danielgtaylor/huma/v2"
+)
+
+// ContentType is the content type the camelCase JSON format is registered
+// under.
+const ContentType = "application/camel+json"
+
+// DefaultCamelJSONFormat is the camelCase JSON formatter. Unlike the text and
+// YAML formats it is not registered automatically, as it must be opted into.
+//
+//	config := huma.Config{}
+//	config.Formats = map[string]huma.Format{
+//		camel.ContentType: camel.DefaultCamelJSONFormat,
+//	}
+var DefaultCamelJSONFormat = huma.Format{
+	Marshal: func(w io.Writer, v any) error {
+		var bb bytes.Buffer
+		if err := encode(&bb, reflect.ValueOf(v)); err != nil {
+			return err
+		}
+		bb.WriteByte('\n')
+		_, err := w.Write(bb.Bytes())
+
+		return err
+	},
+	Unmarshal: json.Unmarshal,
+}
+
+var (
+	jsonMarshalerType = reflect.TypeFor[json.Marshaler]()
+	textMarshalerType = reflect.TypeFor[encoding.TextMarshaler]()
+)
+
+func encode(bb *bytes.Buffer, v reflect.Value) error {
+	if !v.IsValid() {
+		bb.WriteString("null")
+		return nil
+	}
+	if v.Type().Implements(jsonMarshalerType) || v.Type().Implements(textMarshalerType) {
+		return marshal(bb, v.Interface())
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			bb.WriteString("null")
+			return nil
+		}
+		return encode(bb, v.Elem())
+	case reflect.Struct:
+		return encodeStruct(bb, v)
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			bb.WriteString("null")
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			// []byte is base64 encoded.
+			return marshal(bb, v.Interface())
+		}
+		bb.WriteByte('[')
+		for i := range v.Len() {
+			if i > 0 {
+				bb.WriteByte(',')
+			}
+			if err := encode(bb, v.Index(i)); err != nil {
+				return err
+			}
+		}
+		bb.WriteByte(']')
+	case reflect.Map:
+		if v.IsNil() {
+			bb.WriteString("null")
+			return nil
+		}
+		if v.Type().Key().Kind() != reflect.String {
+			return marshal(bb, v.Interface())
+		}
+		// Map keys are data, not field names, so they are kept as-is.
+		bb.WriteByte('{')
+		for i, k := range sortedKeys(v) {
+			if i > 0 {
+				bb.WriteByte(',')
+			}
+			if err := marshal(bb, k); err != nil {
+				return err
+			}
+			bb.WriteByte(':')
+			if err := encode(bb, v.MapIndex(reflect.ValueOf(k).Convert(v.Type().Key()))); err != nil {
+				return err
+			}
+		}
+		bb.WriteByte('}')
+	default:
+		return marshal(bb, v.Interface())
+	}
+
+	return nil
+}
+
+func encodeStruct(bb *bytes.Buffer, v reflect.Value) error {
+	bb.WriteByte('{')
+	first := true
+	var walk func(v reflect.Value) error
+	walk = func(v reflect.Value) error {
+		t := v.Type()
+		for i := range t.NumField() {
+			f := t.Field(i)
+			tag := f.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			name, opts, _ := strings.Cut(tag, ",")
+			if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+				if err := walk(v.Field(i)); err != nil {
+					return err
+				}
+				continue
+			}
+			if !f.IsExported() {
+				continue
+			}
+			fv := v.Field(i)
+			if strings.Contains(opts, "omitempty") && isEmpty(fv) {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			if !first {
+				bb.WriteByte(',')
+			}
+			first = false
+			if err := marshal(bb, CamelCase(name)); err != nil {
+				return err
+			}
+			bb.WriteByte(':')
+			if err := encode(bb, fv); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+	if err := walk(v); err != nil {
+		return err
+	}
+	bb.WriteByte('}')
+
+	return nil
+}
+
+func marshal(bb *bytes.Buffer, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	bb.Write(b)
+
+	return nil
+}
+
+func sortedKeys(v reflect.Value) []string {
+	keys := make([]string, 0, v.Len())
+	for _, k := range v.MapKeys() {
+		keys = append(keys, k.String())
+	}
+	slices.Sort(keys)
+
+	return keys
+}
+
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Pointer, reflect.Interface:
+		return v.IsNil()
+	default:
+		return v.IsZero()
+	}
+}
+
+// CamelCase converts a snake_case key to camelCase.
+func CamelCase(s string) string {
+	parts := strings.Split(s, "_")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+
+	return strings.Join(parts, "")
+}
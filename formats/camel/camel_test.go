@@ -0,0 +1,94 @@
+package camel_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jh125486/batterdb/formats/camel"
+)
+
+type (
+	testBody struct {
+		CreatedAt time.Time `json:"created_at"`
+		Element   any       `json:"element"`
+		Inner     testInner `json:"inner_struct"`
+		Skipped   string    `json:"-"`
+		Empty     string    `json:"empty_value,omitempty"`
+		Items     []any     `json:"list_of_items"`
+		NoTag     int
+	}
+	testInner struct {
+		NumberOfStacks int `json:"number_of_stacks"`
+	}
+)
+
+func TestDefaultCamelJSONFormat(t *testing.T) {
+	t.Parallel()
+	format := camel.DefaultCamelJSONFormat
+	tests := []struct {
+		name     string
+		v        any
+		expected string
+	}{
+		{
+			name:     "nil",
+			v:        nil,
+			expected: `null`,
+		},
+		{
+			name: "struct",
+			v: testBody{
+				CreatedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+				Element:   map[string]any{"snake_key": 1},
+				Inner:     testInner{NumberOfStacks: 2},
+				Items:     []any{testInner{NumberOfStacks: 3}, "plain_value"},
+				NoTag:     4,
+			},
+			expected: `{
+			  "createdAt": "2024-01-02T03:04:05Z",
+			  "element": {"snake_key": 1},
+			  "innerStruct": {"numberOfStacks": 2},
+			  "listOfItems": [{"numberOfStacks": 3}, "plain_value"],
+			  "NoTag": 4
+			}`,
+		},
+		{
+			name:     "map keys untouched",
+			v:        map[string]any{"stack_a": testInner{NumberOfStacks: 1}},
+			expected: `{"stack_a": {"numberOfStacks": 1}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var bb bytes.Buffer
+			require.NoError(t, format.Marshal(&bb, tt.v))
+			assert.JSONEq(t, tt.expected, bb.String())
+		})
+	}
+}
+
+func TestCamelCase(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "name", want: "name"},
+		{in: "number_of_databases", want: "numberOfDatabases"},
+		{in: "go_version", want: "goVersion"},
+		{in: "trailing_", want: "trailing"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.want, camel.CamelCase(tt.in))
+		})
+	}
+}
@@ -2,6 +2,7 @@ package text
 
 import (
 	"encoding"
+	"encoding/json"
 	"fmt"
 	"io"
 
@@ -19,27 +20,69 @@ import (
 //	}
 var DefaultTextFormat = huma.Format{
 	Marshal: func(w io.Writer, v any) error {
-		if m, ok := v.(encoding.TextMarshaler); ok {
-			b, err := m.MarshalText()
-			if err != nil {
-				return err
-			}
-			_, err = w.Write(b)
-
+		b, err := Marshal(v)
+		if err != nil {
 			return err
 		}
-		_, err := w.Write([]byte(fmt.Sprint(v)))
+		_, err = w.Write(b)
 
 		return err
 	},
 	Unmarshal: func(data []byte, v any) error {
-		if m, ok := v.(encoding.TextUnmarshaler); ok {
-			return m.UnmarshalText(data)
+		switch v := v.(type) {
+		case encoding.TextUnmarshaler:
+			return v.UnmarshalText(data)
+		case *string:
+			*v = string(data)
+		case *any:
+			*v = string(data)
+		default:
+			return huma.Error501NotImplemented("text format not supported")
 		}
-		return huma.Error501NotImplemented("text format not supported")
+
+		return nil
 	},
 }
 
+// MarshalText returns v as text if it is a string or implements
+// encoding.TextMarshaler, ok is false for any other value.
+func MarshalText(v any) (b []byte, ok bool, err error) {
+	switch v := v.(type) {
+	case string:
+		return []byte(v), true, nil
+	case encoding.TextMarshaler:
+		b, err := v.MarshalText()
+		return b, true, err
+	default:
+		return nil, false, nil
+	}
+}
+
+// Marshal returns v as text if it is a string or implements
+// encoding.TextMarshaler, and as readable JSON otherwise.
+func Marshal(v any) ([]byte, error) {
+	b, ok, err := MarshalText(v)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		b = marshalReadable(v)
+	}
+
+	return b, nil
+}
+
+// marshalReadable returns v as JSON, which unlike fmt's Go syntax is readable
+// for objects and arrays, falling back to fmt for values JSON can't encode.
+func marshalReadable(v any) []byte {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return []byte(fmt.Sprint(v))
+	}
+
+	return b
+}
+
 func init() {
 	huma.DefaultFormats["plain/text"] = DefaultTextFormat
 	huma.DefaultFormats["text"] = DefaultTextFormat
@@ -82,6 +82,33 @@ func TestDefaultTextFormat_Marshal(t *testing.T) {
 			wantErr:  require.NoError,
 			expected: "666",
 		},
+		{
+			name: "map",
+			args: args{
+				w: new(bytes.Buffer),
+				v: map[string]any{"key": "value", "n": 1},
+			},
+			wantErr:  require.NoError,
+			expected: `{"key":"value","n":1}`,
+		},
+		{
+			name: "slice",
+			args: args{
+				w: new(bytes.Buffer),
+				v: []any{"a", 1, true},
+			},
+			wantErr:  require.NoError,
+			expected: `["a",1,true]`,
+		},
+		{
+			name: "not JSON encodable",
+			args: args{
+				w: new(bytes.Buffer),
+				v: complex(1, 2),
+			},
+			wantErr:  require.NoError,
+			expected: "(1+2i)",
+		},
 		{
 			name: "bad marshaler",
 			args: args{
@@ -114,6 +141,56 @@ func TestDefaultTextFormat_Marshal(t *testing.T) {
 	}
 }
 
+func TestMarshalText(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		v       any
+		want    string
+		wantOK  bool
+		wantErr require.ErrorAssertionFunc
+	}{
+		{name: "string", v: "hello", want: "hello", wantOK: true, wantErr: require.NoError},
+		{name: "text marshaler", v: TestStruct{V1: "key", V2: 1}, want: "key/1", wantOK: true, wantErr: require.NoError},
+		{name: "bad text marshaler", v: BadMarshaler{}, wantOK: true, wantErr: require.Error},
+		{name: "number", v: 1.5, wantOK: false, wantErr: require.NoError},
+		{name: "object", v: map[string]any{"key": "value"}, wantOK: false, wantErr: require.NoError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			b, ok, err := text.MarshalText(tt.v)
+			tt.wantErr(t, err)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, string(b))
+		})
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		v       any
+		want    string
+		wantErr require.ErrorAssertionFunc
+	}{
+		{name: "string", v: "hello", want: "hello", wantErr: require.NoError},
+		{name: "text marshaler", v: TestStruct{V1: "key", V2: 1}, want: "key/1", wantErr: require.NoError},
+		{name: "bad text marshaler", v: BadMarshaler{}, wantErr: require.Error},
+		{name: "number", v: 1.5, want: "1.5", wantErr: require.NoError},
+		{name: "object", v: map[string]any{"key": "value"}, want: `{"key":"value"}`, wantErr: require.NoError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			b, err := text.Marshal(tt.v)
+			tt.wantErr(t, err)
+			assert.Equal(t, tt.want, string(b))
+		})
+	}
+}
+
 func TestDefaultTextFormat_Unmarshal(t *testing.T) {
 	t.Parallel()
 	format := text.DefaultTextFormat
@@ -147,6 +224,24 @@ func TestDefaultTextFormat_Unmarshal(t *testing.T) {
 			},
 			wantErr: require.Error,
 		},
+		{
+			name: "string",
+			obj:  new(string),
+			args: args{
+				bytes: []byte("raw text"),
+			},
+			wantErr:  require.NoError,
+			expected: ptr("raw text"),
+		},
+		{
+			name: "any",
+			obj:  new(any),
+			args: args{
+				bytes: []byte("raw text"),
+			},
+			wantErr:  require.NoError,
+			expected: ptr[any]("raw text"),
+		},
 		{
 			name: "not an unmarshaler",
 			obj:  new(int),
@@ -167,3 +262,5 @@ func TestDefaultTextFormat_Unmarshal(t *testing.T) {
 		})
 	}
 }
+
+func ptr[T any](v T) *T { return &v }
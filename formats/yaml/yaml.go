@@ -23,6 +23,42 @@ var DefaultYAMLFormat = huma.Format{
 	Unmarshal: yaml.Unmarshal,
 }
 
+// DefaultYAMLFormatWithIndent is like DefaultYAMLFormat, but indents nested
+// values by n spaces instead of the encoder's default of 4.
+func DefaultYAMLFormatWithIndent(n int) huma.Format {
+	return huma.Format{
+		Marshal: func(w io.Writer, v any) error {
+			enc := yaml.NewEncoder(w)
+			enc.SetIndent(n)
+			return enc.Encode(v)
+		},
+		Unmarshal: yaml.Unmarshal,
+	}
+}
+
+// Depth returns how deep mappings and sequences are nested in the YAML
+// document data. Aliases aren't followed.
+func Depth(data []byte) (int, error) {
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return 0, err
+	}
+
+	return nodeDepth(&node), nil
+}
+
+func nodeDepth(node *yaml.Node) int {
+	var depth int
+	for _, child := range node.Content {
+		depth = max(depth, nodeDepth(child))
+	}
+	if node.Kind == yaml.MappingNode || node.Kind == yaml.SequenceNode {
+		depth++
+	}
+
+	return depth
+}
+
 func init() {
 	huma.DefaultFormats["application/yaml"] = DefaultYAMLFormat
 	huma.DefaultFormats["yaml"] = DefaultYAMLFormat
@@ -37,3 +37,52 @@ func TestDefaultYAMLFormat(t *testing.T) {
 		})
 	}
 }
+
+func TestDefaultYAMLFormatWithIndent(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		indent   int
+		expected string
+	}{
+		{name: "two", indent: 2, expected: "key:\n  nested: value\n"},
+		{name: "eight", indent: 8, expected: "key:\n        nested: value\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			format := yaml.DefaultYAMLFormatWithIndent(tt.indent)
+			v := map[string]any{"key": map[string]any{"nested": "value"}}
+			var bb bytes.Buffer
+			require.NoError(t, format.Marshal(&bb, v))
+			assert.Equal(t, tt.expected, bb.String())
+			var v2 any
+			require.NoError(t, format.Unmarshal(bb.Bytes(), &v2))
+			require.Equal(t, v, v2)
+		})
+	}
+}
+
+func TestDepth(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		data    string
+		want    int
+		wantErr require.ErrorAssertionFunc
+	}{
+		{name: "scalar", data: "value", want: 0, wantErr: require.NoError},
+		{name: "map", data: "key: value", want: 1, wantErr: require.NoError},
+		{name: "nested", data: "key:\n  - [1, {a: b}]\n", want: 4, wantErr: require.NoError},
+		{name: "deepest branch", data: "a: [[1]]\nb: 1\n", want: 3, wantErr: require.NoError},
+		{name: "malformed", data: "key: [", wantErr: require.Error},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := yaml.Depth([]byte(tt.data))
+			tt.wantErr(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime"
+	"sync"
+
+	"github.com/danielgtaylor/huma/v2"
+
+	"github.com/jh125486/batterdb/repository"
+)
+
+type (
+	BatchInput struct {
+		URLParamDatabaseID
+		Body struct {
+			Operations []BatchOperation `json:"operations" minItems:"1"`
+			Parallel   bool             `doc:"run operations on different stacks concurrently" json:"parallel,omitempty"`
+		}
+		LockDatabase bool `default:"false" doc:"run the batch in isolation, blocking all other operations on the database" query:"lockDatabase"`
+	}
+	BatchOperation struct {
+		Element any    `doc:"element to push" json:"element,omitempty"`
+		Op      string `enum:"push,pop,peek,flush" json:"op"`
+		Stack   string `doc:"can be the stack ID or name" json:"stack"`
+	}
+	BatchOutput struct {
+		Body struct {
+			Results []BatchResult `json:"results"`
+		}
+	}
+	BatchResult struct {
+		Element any    `json:"element,omitempty"`
+		Dropped any    `json:"dropped,omitempty"`
+		Error   string `json:"error,omitempty"`
+		ID      string `json:"id,omitempty"`
+		Status  int    `json:"status"`
+	}
+	// stackLookup looks up a stack of a database by ID or name.
+	stackLookup func(id string) (*repository.Stack, error)
+)
+
+// BatchOperationsHandler runs multiple stack operations of a database in one
+// request. Results are returned in the order of the operations, each with the
+// HTTP status the single operation would have had.
+//
+// Operations on the same stack always run in request order. By default all
+// operations run sequentially; with `parallel` operations on different stacks
+// run concurrently, so their relative order is undefined. Each operation is
+// atomic, but the batch as a whole is not isolated from other requests.
+//
+// With `lockDatabase` the batch holds the write lock of the database while it
+// runs, so it is isolated from other requests. This serializes it against all
+// other operations on the database, which wait for the whole batch to finish.
+func (s *Service) BatchOperationsHandler(_ context.Context, input *BatchInput) (*BatchOutput, error) {
+	if s.maxBatchSize > 0 && len(input.Body.Operations) > s.maxBatchSize {
+		return nil, huma.Error422UnprocessableEntity(fmt.Sprintf("batch must not contain more than %d operations", s.maxBatchSize))
+	}
+	db, err := s.database(input.DatabaseID)
+	if err != nil {
+		return nil, err
+	}
+
+	out := new(BatchOutput)
+	if !input.LockDatabase {
+		out.Body.Results = s.runBatch(db, db.Stack, input.Body.Operations, input.Body.Parallel)
+		return out, nil
+	}
+	db.Exclusive(func(lookup func(string) (*repository.Stack, error)) {
+		out.Body.Results = s.runBatch(db, lookup, input.Body.Operations, input.Body.Parallel)
+	})
+
+	return out, nil
+}
+
+// runBatch runs the operations, looking up their stacks with lookup.
+func (s *Service) runBatch(db *repository.Database, lookup stackLookup, ops []BatchOperation, parallel bool) []BatchResult {
+	results := make([]BatchResult, len(ops))
+	stacks := make([]*repository.Stack, len(ops))
+	for i, op := range ops {
+		if err := s.validateID(op.Stack); err != nil {
+			results[i] = BatchResult{Status: http.StatusBadRequest, Error: err.Error()}
+			s.metrics.observeOperation(op.Op, false)
+			continue
+		}
+		stack, err := lookup(op.Stack)
+		if err != nil {
+			results[i] = BatchResult{Status: http.StatusNotFound, Error: "stack not found"}
+			s.metrics.observeOperation(op.Op, false)
+			continue
+		}
+		stacks[i] = stack
+	}
+
+	if !parallel {
+		for i, op := range ops {
+			if stacks[i] != nil {
+				results[i] = s.applyBatchOperation(db, stacks[i], op)
+			}
+		}
+
+		return results
+	}
+
+	// Group the operations by stack, keeping their order within each stack.
+	groups := make(map[*repository.Stack][]int)
+	var order []*repository.Stack
+	for i, stack := range stacks {
+		if stack == nil {
+			continue
+		}
+		if _, ok := groups[stack]; !ok {
+			order = append(order, stack)
+		}
+		groups[stack] = append(groups[stack], i)
+	}
+
+	work := make(chan []int)
+	var wg sync.WaitGroup
+	for range min(runtime.GOMAXPROCS(0), len(order)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idxs := range work {
+				for _, i := range idxs {
+					results[i] = s.applyBatchOperation(db, stacks[i], ops[i])
+				}
+			}
+		}()
+	}
+	for _, stack := range order {
+		work <- groups[stack]
+	}
+	close(work)
+	wg.Wait()
+
+	return results
+}
+
+func (s *Service) applyBatchOperation(db *repository.Database, stack *repository.Stack, op BatchOperation) BatchResult {
+	res := s.batchOperation(db, stack, op)
+	s.metrics.observeOperation(op.Op, res.Status < http.StatusBadRequest)
+
+	return res
+}
+
+func (s *Service) batchOperation(db *repository.Database, stack *repository.Stack, op BatchOperation) BatchResult {
+	switch op.Op {
+	case "push":
+		element, err := s.prepareElement(op.Element)
+		if err != nil {
+			return BatchResult{Status: http.StatusUnprocessableEntity, Error: err.Error()}
+		}
+		if db.IsCounter() {
+			return BatchResult{Status: http.StatusUnprocessableEntity, Error: "can't push to a counter database"}
+		}
+		if element, err = s.decodeElement(stack, element); err != nil {
+			return BatchResult{Status: http.StatusUnprocessableEntity, Error: err.Error()}
+		}
+		id, dropped, err := s.push(stack, element)
+		if errors.Is(err, repository.ErrStackFull) {
+			return BatchResult{Status: http.StatusRequestEntityTooLarge, Error: err.Error()}
+		}
+		if err != nil {
+			return BatchResult{Status: http.StatusInternalServerError, Error: err.Error()}
+		}
+		s.pushed(db, stack, element)
+		return BatchResult{Status: http.StatusOK, Element: element, Dropped: dropped, ID: id}
+	case "pop":
+		return elementResult(stack.Pop())
+	case "peek":
+		return elementResult(stack.Peek())
+	case "flush":
+		stack.Flush()
+		return BatchResult{Status: http.StatusOK}
+	default:
+		return BatchResult{Status: http.StatusUnprocessableEntity, Error: "unknown operation"}
+	}
+}
+
+func elementResult(v any) BatchResult {
+	if v == nil {
+		return BatchResult{Status: http.StatusNoContent}
+	}
+
+	return BatchResult{Status: http.StatusOK, Element: v}
+}
@@ -0,0 +1,251 @@
+package handlers_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/danielgtaylor/huma/v2/humatest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jh125486/batterdb/handlers"
+)
+
+func TestService_BatchOperationsHandler(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name          string
+		opts          []handlers.Option
+		path          string
+		body          map[string]any
+		expStatusCode int
+		expBody       string
+	}{
+		{
+			name: "database dne",
+			path: "/databases/dne/batch",
+			body: map[string]any{
+				"operations": []map[string]any{{"op": "peek", "stack": "stackA123"}},
+			},
+			expStatusCode: http.StatusNotFound,
+			expBody: `{
+			  "title": "Not Found",
+			  "status": 404,
+			  "detail": "database not found",
+			  "errors": [
+				{
+				  "message": "not found"
+				}
+			  ]
+			}`,
+		},
+		{
+			name: "too many operations",
+			opts: []handlers.Option{handlers.WithMaxBatchSize(1)},
+			path: "/databases/dbName123/batch",
+			body: map[string]any{
+				"operations": []map[string]any{
+					{"op": "push", "stack": "stackA123", "element": "a1"},
+					{"op": "pop", "stack": "stackA123"},
+				},
+			},
+			expStatusCode: http.StatusUnprocessableEntity,
+			expBody: `{
+			  "title": "Unprocessable Entity",
+			  "status": 422,
+			  "detail": "batch must not contain more than 1 operations"
+			}`,
+		},
+		{
+			name: "sequential",
+			path: "/databases/dbName123/batch",
+			body: map[string]any{
+				"operations": []map[string]any{
+					{"op": "push", "stack": "stackA123", "element": "a1"},
+					{"op": "push", "stack": "stackA123", "element": "a2"},
+					{"op": "peek", "stack": "stackA123"},
+					{"op": "pop", "stack": "stackA123"},
+					{"op": "pop", "stack": "stackB123"},
+					{"op": "peek", "stack": "dne"},
+					{"op": "push", "stack": "stackB123", "element": "b1"},
+					{"op": "flush", "stack": "stackB123"},
+				},
+			},
+			expStatusCode: http.StatusOK,
+			expBody: `{
+			  "results": [
+				{"status": 200, "element": "a1"},
+				{"status": 200, "element": "a2"},
+				{"status": 200, "element": "a2"},
+				{"status": 200, "element": "a2"},
+				{"status": 204},
+				{"status": 404, "error": "stack not found"},
+				{"status": 200, "element": "b1"},
+				{"status": 200}
+			  ]
+			}`,
+		},
+		{
+			name: "parallel",
+			path: "/databases/dbName123/batch",
+			body: map[string]any{
+				"parallel": true,
+				"operations": []map[string]any{
+					{"op": "push", "stack": "stackA123", "element": "a1"},
+					{"op": "push", "stack": "stackB123", "element": "b1"},
+					{"op": "push", "stack": "stackA123", "element": "a2"},
+					{"op": "peek", "stack": "dne"},
+					{"op": "pop", "stack": "stackA123"},
+					{"op": "peek", "stack": "stackB123"},
+				},
+			},
+			expStatusCode: http.StatusOK,
+			expBody: `{
+			  "results": [
+				{"status": 200, "element": "a1"},
+				{"status": 200, "element": "b1"},
+				{"status": 200, "element": "a2"},
+				{"status": 404, "error": "stack not found"},
+				{"status": 200, "element": "a2"},
+				{"status": 200, "element": "b1"}
+			  ]
+			}`,
+		},
+		{
+			name: "lock database",
+			path: "/databases/dbName123/batch?lockDatabase=true",
+			body: map[string]any{
+				"parallel": true,
+				"operations": []map[string]any{
+					{"op": "push", "stack": "stackA123", "element": "a1"},
+					{"op": "push", "stack": "stackB123", "element": "b1"},
+					{"op": "peek", "stack": "dne"},
+					{"op": "pop", "stack": "stackA123"},
+				},
+			},
+			expStatusCode: http.StatusOK,
+			expBody: `{
+			  "results": [
+				{"status": 200, "element": "a1"},
+				{"status": 200, "element": "b1"},
+				{"status": 404, "error": "stack not found"},
+				{"status": 200, "element": "a1"}
+			  ]
+			}`,
+		},
+		{
+			name: "push too deep",
+			path: "/databases/dbName123/batch",
+			body: map[string]any{
+				"operations": []map[string]any{
+					{"op": "push", "stack": "stackA123", "element": nested(33)},
+				},
+			},
+			expStatusCode: http.StatusOK,
+			expBody: `{
+			  "results": [
+				{"status": 422, "error": "element must not be nested deeper than 32 levels"}
+			  ]
+			}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, api := humatest.New(t)
+			svc := handlers.New(tt.opts...)
+			svc.AddRoutes(api)
+			db, err := svc.Repository.New("dbName123")
+			require.NoError(t, err)
+			for _, n := range []string{"stackA123", "stackB123"} {
+				_, err := db.New(n)
+				require.NoError(t, err)
+			}
+
+			resp := api.Post(tt.path, tt.body)
+			require.Equal(t, tt.expStatusCode, resp.Code)
+			require.JSONEq(t, tt.expBody, resp.Body.String())
+		})
+	}
+}
+
+func TestService_BatchOperationsHandler_ParallelOrdering(t *testing.T) {
+	t.Parallel()
+	_, api := humatest.New(t)
+	svc := handlers.New()
+	svc.AddRoutes(api)
+	db, err := svc.Repository.New("dbName123")
+	require.NoError(t, err)
+	names := []string{"stackA123", "stackB123", "stackC123", "stackD123"}
+	for _, n := range names {
+		_, err := db.New(n)
+		require.NoError(t, err)
+	}
+
+	const perStack = 100
+	var ops []map[string]any
+	for i := range perStack {
+		for _, n := range names {
+			ops = append(ops, map[string]any{"op": "push", "stack": n, "element": i})
+		}
+	}
+	resp := api.Post("/databases/dbName123/batch", map[string]any{"parallel": true, "operations": ops})
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	for _, n := range names {
+		stack, err := db.Stack(n)
+		require.NoError(t, err)
+		require.Equal(t, perStack, stack.Size())
+		for i := perStack - 1; i >= 0; i-- {
+			assert.InDelta(t, i, stack.Pop(), 0, "pushes to the same stack must stay ordered")
+		}
+	}
+}
+
+func TestService_BatchOperationsHandler_Metrics(t *testing.T) {
+	t.Parallel()
+	_, api := humatest.New(t)
+	svc := handlers.New()
+	svc.AddRoutes(api)
+	db, err := svc.Repository.New("dbName123")
+	require.NoError(t, err)
+	_, err = db.New("stackA123")
+	require.NoError(t, err)
+
+	pushOK := operationCount(t, "batterdb_stack_operations_total", "push", "ok")
+	peekError := operationCount(t, "batterdb_stack_operations_total", "peek", "error")
+	resp := api.Post("/databases/dbName123/batch", map[string]any{
+		"operations": []map[string]any{
+			{"op": "push", "stack": "stackA123", "element": 1},
+			{"op": "push", "stack": "stackA123", "element": 2},
+			{"op": "peek", "stack": "dne"},
+		},
+	})
+	require.Equal(t, http.StatusOK, resp.Code)
+	// Other tests may run operations concurrently, so only a lower bound holds.
+	assert.GreaterOrEqual(t, operationCount(t, "batterdb_stack_operations_total", "push", "ok")-pushOK, 2.0)
+	assert.GreaterOrEqual(t, operationCount(t, "batterdb_stack_operations_total", "peek", "error")-peekError, 1.0)
+}
+
+func operationCount(t *testing.T, name, op, outcome string) float64 {
+	t.Helper()
+	mfs, err := prometheus.DefaultGatherer.Gather()
+	require.NoError(t, err)
+	for _, mf := range mfs {
+		if mf.GetName() != name {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			labels := make(map[string]string)
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			if labels["type"] == op && labels["outcome"] == outcome {
+				return m.GetCounter().GetValue()
+			}
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,267 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/jh125486/batterdb/rpc/pb"
+)
+
+const (
+	// maxCachedBodyBytes is the largest response body that is cached.
+	maxCachedBodyBytes = 1 << 20
+	// maxCacheEntries bounds the number of cached responses.
+	maxCacheEntries = 1024
+)
+
+type (
+	// responseCache caches GET responses under /databases. Every entry has a
+	// scope: the whole repository (""), a database ("<db ID>"), or a stack
+	// ("<db ID>/<stack ID>"), and a mutation of a scope invalidates the
+	// entries of that scope, of its parents, and of its children.
+	responseCache struct {
+		entries map[string]*cachedResponse
+		ttl     time.Duration
+		// gen is bumped on every invalidation, so a response that was
+		// rendered while a mutation happened isn't stored.
+		gen uint64
+		mx  sync.Mutex
+	}
+	cachedResponse struct {
+		expires time.Time
+		header  http.Header
+		scope   string
+		body    []byte
+		status  int
+	}
+	cacheResponseWriter struct {
+		http.ResponseWriter
+		body     bytes.Buffer
+		status   int
+		uncached bool
+	}
+)
+
+func newResponseCache(ttl time.Duration) *responseCache {
+	return &responseCache{
+		entries: make(map[string]*cachedResponse),
+		ttl:     ttl,
+	}
+}
+
+func (c *responseCache) get(key string) (*cachedResponse, uint64) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	e, ok := c.entries[key]
+	if ok && time.Now().After(e.expires) {
+		delete(c.entries, key)
+		e = nil
+	}
+
+	return e, c.gen
+}
+
+func (c *responseCache) put(key string, gen uint64, e *cachedResponse) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	if gen != c.gen {
+		return
+	}
+	if len(c.entries) >= maxCacheEntries {
+		now := time.Now()
+		for k, old := range c.entries {
+			if now.After(old.expires) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= maxCacheEntries {
+			return
+		}
+	}
+	e.expires = time.Now().Add(c.ttl)
+	c.entries[key] = e
+}
+
+func (c *responseCache) invalidate(scope string) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	c.gen++
+	for k, e := range c.entries {
+		if related(e.scope, scope) {
+			delete(c.entries, k)
+		}
+	}
+}
+
+// related reports whether one scope contains the other.
+func related(a, b string) bool {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+
+	return a == "" || a == b || strings.HasPrefix(b, a+"/")
+}
+
+func (w *cacheResponseWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *cacheResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if !w.uncached {
+		if w.body.Len()+len(b) > maxCachedBodyBytes {
+			w.uncached = true
+			w.body = bytes.Buffer{}
+		} else {
+			w.body.Write(b)
+		}
+	}
+
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush passes flushes through; a flushed response is a stream and isn't
+// cached.
+func (w *cacheResponseWriter) Flush() {
+	w.uncached = true
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the wrapped writer for http.ResponseController.
+func (w *cacheResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// CacheHandler serves repeated GET requests under /databases from the
+// response cache (WithResponseCache). Only 200 responses are cached, keyed by
+// the request URI and `Accept` header.
+//
+// Any other request invalidates the cache with per-stack granularity: a push,
+// pop or flush of a stack invalidates the responses of that stack, of its
+// database (e.g. stack listings) and of the database listing, but not of
+// other stacks. Dropping a database, or a batch, invalidates all of its
+// stacks. Cached reads don't update the stack's read time. Mutations over gRPC
+// invalidate the cache the same way, see CacheInterceptor.
+func (s *Service) CacheHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scope, ok := s.cacheScope(r.URL.Path)
+		if !ok {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if r.Method != http.MethodGet {
+			// Invalidate before and after, so that neither a response
+			// rendered before the mutation nor one during it lingers.
+			s.cache.invalidate(scope)
+			h.ServeHTTP(w, r)
+			s.cache.invalidate(scope)
+			return
+		}
+
+		key := r.URL.RequestURI() + "\x00" + r.Header.Get("Accept")
+		e, gen := s.cache.get(key)
+		if e != nil {
+			for k, v := range e.header {
+				w.Header()[k] = v
+			}
+			w.Header().Set("X-Cache", "HIT")
+			w.WriteHeader(e.status)
+			_, _ = w.Write(e.body)
+			return
+		}
+
+		w.Header().Set("X-Cache", "MISS")
+		cw := &cacheResponseWriter{ResponseWriter: w}
+		h.ServeHTTP(cw, r)
+		if cw.status != http.StatusOK || cw.uncached {
+			return
+		}
+		s.cache.put(key, gen, &cachedResponse{
+			header: w.Header().Clone(),
+			scope:  scope,
+			body:   bytes.Clone(cw.body.Bytes()),
+			status: cw.status,
+		})
+	})
+}
+
+// grpcReads are the gRPC methods that don't change the repository.
+var grpcReads = map[string]bool{
+	pb.BatterDB_ListDatabases_FullMethodName: true,
+	pb.BatterDB_ListStacks_FullMethodName:    true,
+	pb.BatterDB_Peek_FullMethodName:          true,
+}
+
+// CacheInterceptor invalidates the response cache on gRPC calls that change
+// the repository, with the same scopes as the HTTP mutations of CacheHandler.
+func (s *Service) CacheInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if grpcReads[info.FullMethod] {
+		return handler(ctx, req)
+	}
+	scope, _ := s.cacheScope(grpcPath(req))
+	s.cache.invalidate(scope)
+	resp, err := handler(ctx, req)
+	s.cache.invalidate(scope)
+
+	return resp, err
+}
+
+// grpcPath returns the HTTP path of the database or stack of a gRPC request,
+// for cacheScope.
+func grpcPath(req any) string {
+	path := "/databases"
+	switch r := req.(type) {
+	case *pb.CreateDatabaseRequest:
+		path += "/" + r.GetName()
+	case interface{ GetDatabase() string }:
+		path += "/" + r.GetDatabase()
+	}
+	if r, ok := req.(interface{ GetStack() string }); ok {
+		path += "/stacks/" + r.GetStack()
+	}
+
+	return path
+}
+
+// cacheScope returns the cache scope of a path, see responseCache. Databases
+// and stacks are resolved so that IDs and names share a scope.
+func (s *Service) cacheScope(path string) (string, bool) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if parts[0] != "databases" {
+		return "", false
+	}
+	if len(parts) < 2 {
+		return "", true
+	}
+	db, err := s.Repository.Database(parts[1])
+	if err != nil {
+		// nothing is cached for an unknown database, but creating it changes
+		// the database listing.
+		return "", true
+	}
+	scope := db.ID.String()
+	// a swap changes two stacks and a comparison reads two, so they're scoped
+	// to the database.
+	if len(parts) >= 4 && (parts[2] == "stacks" || parts[2] == "counters") &&
+		!slices.Contains(parts, "swapWith") && !slices.Contains(parts, "equals") {
+		if stack, err := db.Stack(parts[3]); err == nil {
+			scope += "/" + stack.ID.String()
+		}
+	}
+
+	return scope, true
+}
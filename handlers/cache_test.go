@@ -0,0 +1,220 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+
+	"github.com/jh125486/batterdb/handlers"
+	"github.com/jh125486/batterdb/rpc/pb"
+)
+
+func TestService_CacheHandler(t *testing.T) {
+	t.Parallel()
+	type step struct {
+		method    string
+		path      string
+		wantCache string
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "repeated read",
+			steps: []step{
+				{method: http.MethodGet, path: "/databases/db1/stacks/s1/peek", wantCache: "MISS"},
+				{method: http.MethodGet, path: "/databases/db1/stacks/s1/peek", wantCache: "HIT"},
+				{method: http.MethodGet, path: "/databases/db1/stacks/s1/peek?x=1", wantCache: "MISS"},
+			},
+		},
+		{
+			name: "push invalidates stack, database and listing",
+			steps: []step{
+				{method: http.MethodGet, path: "/databases/db1/stacks/s1/peek", wantCache: "MISS"},
+				{method: http.MethodGet, path: "/databases/db1/stacks", wantCache: "MISS"},
+				{method: http.MethodGet, path: "/databases", wantCache: "MISS"},
+				{method: http.MethodGet, path: "/databases/db1/stacks/s2/peek", wantCache: "MISS"},
+				{method: http.MethodPut, path: "/databases/db1/stacks/s1"},
+				{method: http.MethodGet, path: "/databases/db1/stacks/s1/peek", wantCache: "MISS"},
+				{method: http.MethodGet, path: "/databases/db1/stacks", wantCache: "MISS"},
+				{method: http.MethodGet, path: "/databases", wantCache: "MISS"},
+				{method: http.MethodGet, path: "/databases/db1/stacks/s2/peek", wantCache: "HIT"},
+			},
+		},
+		{
+			name: "push to the other stack invalidates a comparison",
+			steps: []step{
+				{method: http.MethodGet, path: "/databases/db1/stacks/s1/equals/s2", wantCache: "MISS"},
+				{method: http.MethodGet, path: "/databases/db1/stacks/s1/equals/s2", wantCache: "HIT"},
+				{method: http.MethodPut, path: "/databases/db1/stacks/s2"},
+				{method: http.MethodGet, path: "/databases/db1/stacks/s1/equals/s2", wantCache: "MISS"},
+			},
+		},
+		{
+			name: "names and IDs share a scope",
+			steps: []step{
+				{method: http.MethodGet, path: "/databases/db1/stacks/s1/peek", wantCache: "MISS"},
+				{method: http.MethodDelete, path: "/databases/{db1}/stacks/{s1}/flush"},
+				{method: http.MethodGet, path: "/databases/db1/stacks/s1/peek", wantCache: "MISS"},
+			},
+		},
+		{
+			name: "drop database invalidates its stacks",
+			steps: []step{
+				{method: http.MethodGet, path: "/databases/db1/stacks/s1/peek", wantCache: "MISS"},
+				{method: http.MethodGet, path: "/databases/db2/stacks/s1/peek", wantCache: "MISS"},
+				{method: http.MethodDelete, path: "/databases/db1"},
+				{method: http.MethodGet, path: "/databases/db1/stacks/s1/peek", wantCache: "MISS"},
+				{method: http.MethodGet, path: "/databases/db2/stacks/s1/peek", wantCache: "HIT"},
+			},
+		},
+		{
+			name: "not cached",
+			steps: []step{
+				{method: http.MethodGet, path: "/_status"},
+				{method: http.MethodGet, path: "/_status"},
+				{method: http.MethodGet, path: "/databases/db1/stacks/error/peek", wantCache: "MISS"},
+				{method: http.MethodGet, path: "/databases/db1/stacks/error/peek", wantCache: "MISS"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			svc := handlers.New(handlers.WithResponseCache(time.Minute))
+			ids := make(map[string]string)
+			for _, dbName := range []string{"db1", "db2"} {
+				db, err := svc.Repository.New(dbName)
+				require.NoError(t, err)
+				ids["{"+dbName+"}"] = db.ID.String()
+				for _, stackName := range []string{"s1", "s2", "error"} {
+					stack, err := db.New(stackName)
+					require.NoError(t, err)
+					ids["{"+stackName+"}"] = stack.ID.String()
+				}
+			}
+			var calls int
+			h := svc.CacheHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				if r.URL.Path == "/databases/db1/stacks/error/peek" {
+					w.WriteHeader(http.StatusInternalServerError)
+				}
+				_, _ = w.Write([]byte(strconv.Itoa(calls)))
+			}))
+
+			bodies := make(map[string]string)
+			for _, step := range tt.steps {
+				path := step.path
+				for k, v := range ids {
+					path = strings.ReplaceAll(path, k, v)
+				}
+				rr := httptest.NewRecorder()
+				h.ServeHTTP(rr, httptest.NewRequest(step.method, path, http.NoBody))
+				assert.Equal(t, step.wantCache, rr.Header().Get("X-Cache"), step.method+" "+step.path)
+				if step.wantCache == "HIT" {
+					assert.Equal(t, bodies[path], rr.Body.String(), "cached body")
+				}
+				bodies[path] = rr.Body.String()
+			}
+		})
+	}
+}
+
+func TestService_CacheHandler_Expires(t *testing.T) {
+	t.Parallel()
+	svc := handlers.New(handlers.WithResponseCache(10 * time.Millisecond))
+	h := svc.CacheHandler(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	get := func() string {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/databases", http.NoBody))
+		return rr.Header().Get("X-Cache")
+	}
+
+	assert.Equal(t, "MISS", get())
+	assert.Equal(t, "HIT", get())
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, "MISS", get())
+}
+
+func TestService_CacheInterceptor(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		method    string
+		req       any
+		wantCache []string
+	}{
+		{
+			name:      "peek keeps the cache",
+			method:    pb.BatterDB_Peek_FullMethodName,
+			req:       &pb.StackRequest{Database: "db1", Stack: "s1"},
+			wantCache: []string{"HIT", "HIT", "HIT"},
+		},
+		{
+			name:      "push invalidates the stack and listing",
+			method:    pb.BatterDB_Push_FullMethodName,
+			req:       &pb.PushRequest{Database: "db1", Stack: "s1"},
+			wantCache: []string{"MISS", "HIT", "MISS"},
+		},
+		{
+			name:      "pop of another stack",
+			method:    pb.BatterDB_Pop_FullMethodName,
+			req:       &pb.StackRequest{Database: "db1", Stack: "s2"},
+			wantCache: []string{"HIT", "MISS", "MISS"},
+		},
+		{
+			name:      "delete invalidates the database",
+			method:    pb.BatterDB_DeleteDatabase_FullMethodName,
+			req:       &pb.DatabaseRequest{Database: "db1"},
+			wantCache: []string{"MISS", "MISS", "MISS"},
+		},
+		{
+			name:      "create invalidates everything",
+			method:    pb.BatterDB_CreateDatabase_FullMethodName,
+			req:       &pb.CreateDatabaseRequest{Name: "db2"},
+			wantCache: []string{"MISS", "MISS", "MISS"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			svc := handlers.New(handlers.WithResponseCache(time.Minute))
+			db, err := svc.Repository.New("db1")
+			require.NoError(t, err)
+			for _, stackName := range []string{"s1", "s2"} {
+				_, err = db.New(stackName)
+				require.NoError(t, err)
+			}
+			h := svc.CacheHandler(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				_, _ = w.Write([]byte("ok"))
+			}))
+			paths := []string{"/databases/db1/stacks/s1/peek", "/databases/db1/stacks/s2/peek", "/databases"}
+			get := func(path string) string {
+				rr := httptest.NewRecorder()
+				h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, http.NoBody))
+				return rr.Header().Get("X-Cache")
+			}
+			for _, path := range paths {
+				require.Equal(t, "MISS", get(path))
+			}
+
+			_, err = svc.CacheInterceptor(context.Background(), tt.req, &grpc.UnaryServerInfo{FullMethod: tt.method},
+				func(context.Context, any) (any, error) { return nil, nil })
+			require.NoError(t, err)
+			for i, path := range paths {
+				assert.Equal(t, tt.wantCache[i], get(path), path)
+			}
+		})
+	}
+}
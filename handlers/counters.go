@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+
+	"github.com/danielgtaylor/huma/v2"
+
+	"github.com/jh125486/batterdb/repository"
+)
+
+type (
+	URLParamCounterID struct {
+		CounterID string `doc:"can be the counter ID or name" path:"counter"`
+	}
+	CounterInput struct {
+		URLParamDatabaseID
+		URLParamCounterID
+	}
+	CounterOutput struct {
+		Body Counter
+	}
+	Counter struct {
+		ID    string  `json:"id"`
+		Name  string  `json:"name"`
+		Value float64 `json:"value"`
+	}
+)
+
+func newCounter(stack *repository.Stack, v float64) Counter {
+	return Counter{
+		ID:    stack.ID.String(),
+		Name:  stack.Name,
+		Value: v,
+	}
+}
+
+func (s *Service) GetCounterHandler(_ context.Context, input *CounterInput) (*CounterOutput, error) {
+	stack, err := s.counter(input.DatabaseID, input.CounterID, false)
+	if err != nil {
+		return nil, err
+	}
+	v, err := stack.Counter()
+	if err != nil {
+		return nil, huma.Error422UnprocessableEntity("counter is not a number", err)
+	}
+
+	out := new(CounterOutput)
+	out.Body = newCounter(stack, v)
+
+	return out, nil
+}
+
+type SetCounterInput struct {
+	CounterInput
+	Body struct {
+		Value float64 `json:"value"`
+	}
+}
+
+func (s *Service) SetCounterHandler(_ context.Context, input *SetCounterInput) (*CounterOutput, error) {
+	stack, err := s.counter(input.DatabaseID, input.CounterID, true)
+	if err != nil {
+		return nil, err
+	}
+	stack.SetCounter(input.Body.Value)
+
+	out := new(CounterOutput)
+	out.Body = newCounter(stack, input.Body.Value)
+
+	return out, nil
+}
+
+type AddCounterInput struct {
+	CounterInput
+	By float64 `default:"1" doc:"amount to add or subtract" query:"by"`
+}
+
+func (s *Service) IncrCounterHandler(_ context.Context, input *AddCounterInput) (*CounterOutput, error) {
+	return s.addCounter(input.DatabaseID, input.CounterID, input.By)
+}
+
+func (s *Service) DecrCounterHandler(_ context.Context, input *AddCounterInput) (*CounterOutput, error) {
+	return s.addCounter(input.DatabaseID, input.CounterID, -input.By)
+}
+
+func (s *Service) addCounter(dbID, cID string, delta float64) (*CounterOutput, error) {
+	stack, err := s.counter(dbID, cID, true)
+	if err != nil {
+		return nil, err
+	}
+	v, err := stack.AddCounter(delta)
+	if err != nil {
+		return nil, huma.Error422UnprocessableEntity("counter is not a number", err)
+	}
+
+	out := new(CounterOutput)
+	out.Body = newCounter(stack, v)
+
+	return out, nil
+}
+
+// counter returns the stack backing a counter of a counter database,
+// optionally creating it.
+func (s *Service) counter(dbID, cID string, create bool) (*repository.Stack, error) {
+	db, err := s.database(dbID)
+	if err != nil {
+		return nil, err
+	}
+	if !db.IsCounter() {
+		return nil, huma.Error422UnprocessableEntity("database is not a counter database")
+	}
+	if err := s.validateID(cID); err != nil {
+		return nil, err
+	}
+	if stack, err := db.Stack(cID); err == nil {
+		return stack, nil
+	} else if !create {
+		return nil, huma.Error404NotFound("counter not found", err)
+	}
+	if err := s.validateName(cID); err != nil {
+		return nil, err
+	}
+	stack, err := db.New(cID)
+	if errors.Is(err, repository.ErrAlreadyExists) {
+		// lost a race with another creator.
+		return db.Stack(cID)
+	}
+	if err != nil {
+		return nil, s.createStackError(err)
+	}
+
+	return stack, nil
+}
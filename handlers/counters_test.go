@@ -0,0 +1,197 @@
+package handlers_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/danielgtaylor/huma/v2/humatest"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/sjson"
+
+	"github.com/jh125486/batterdb/handlers"
+	"github.com/jh125486/batterdb/repository"
+)
+
+func TestService_CountersHandlers(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name          string
+		mode          repository.Mode
+		setup         func(*repository.Database)
+		method        string
+		path          string
+		body          map[string]any
+		expStatusCode int
+		expBody       string
+	}{
+		{
+			name:          "get counter not a counter database",
+			method:        http.MethodGet,
+			path:          "/databases/{database}/counters/counter1",
+			expStatusCode: http.StatusUnprocessableEntity,
+			expBody: `{
+			  "title": "Unprocessable Entity",
+			  "status": 422,
+			  "detail": "database is not a counter database"
+			}`,
+		},
+		{
+			name:          "get counter dne",
+			mode:          repository.ModeCounter,
+			method:        http.MethodGet,
+			path:          "/databases/{database}/counters/counter1",
+			expStatusCode: http.StatusNotFound,
+			expBody: `{
+			  "title": "Not Found",
+			  "status": 404,
+			  "detail": "counter not found",
+			  "errors": [
+				{
+				  "message": "not found"
+				}
+			  ]
+			}`,
+		},
+		{
+			name: "get counter",
+			mode: repository.ModeCounter,
+			setup: func(db *repository.Database) {
+				stack, err := db.New("counter1")
+				require.NoError(t, err)
+				stack.SetCounter(41)
+			},
+			method:        http.MethodGet,
+			path:          "/databases/{database}/counters/counter1",
+			expStatusCode: http.StatusOK,
+			expBody: `{
+			  "id": "ID",
+			  "name": "counter1",
+			  "value": 41
+			}`,
+		},
+		{
+			name: "get counter not a number",
+			mode: repository.ModeCounter,
+			setup: func(db *repository.Database) {
+				stack, err := db.New("counter1")
+				require.NoError(t, err)
+				stack.Push("forty-one")
+			},
+			method:        http.MethodGet,
+			path:          "/databases/{database}/counters/counter1",
+			expStatusCode: http.StatusUnprocessableEntity,
+			expBody: `{
+			  "title": "Unprocessable Entity",
+			  "status": 422,
+			  "detail": "counter is not a number",
+			  "errors": [
+				{
+				  "message": "not a number"
+				}
+			  ]
+			}`,
+		},
+		{
+			name:          "set counter creates",
+			mode:          repository.ModeCounter,
+			method:        http.MethodPut,
+			path:          "/databases/{database}/counters/counter1",
+			body:          map[string]any{"value": 7},
+			expStatusCode: http.StatusOK,
+			expBody: `{
+			  "id": "ID",
+			  "name": "counter1",
+			  "value": 7
+			}`,
+		},
+		{
+			name:          "incr counter creates",
+			mode:          repository.ModeCounter,
+			method:        http.MethodPost,
+			path:          "/databases/{database}/counters/counter1/incr",
+			expStatusCode: http.StatusOK,
+			expBody: `{
+			  "id": "ID",
+			  "name": "counter1",
+			  "value": 1
+			}`,
+		},
+		{
+			name: "incr counter by",
+			mode: repository.ModeCounter,
+			setup: func(db *repository.Database) {
+				stack, err := db.New("counter1")
+				require.NoError(t, err)
+				stack.SetCounter(10)
+			},
+			method:        http.MethodPost,
+			path:          "/databases/{database}/counters/counter1/incr?by=2.5",
+			expStatusCode: http.StatusOK,
+			expBody: `{
+			  "id": "ID",
+			  "name": "counter1",
+			  "value": 12.5
+			}`,
+		},
+		{
+			name: "decr counter",
+			mode: repository.ModeCounter,
+			setup: func(db *repository.Database) {
+				stack, err := db.New("counter1")
+				require.NoError(t, err)
+				stack.SetCounter(10)
+			},
+			method:        http.MethodPost,
+			path:          "/databases/{database}/counters/counter1/decr?by=3",
+			expStatusCode: http.StatusOK,
+			expBody: `{
+			  "id": "ID",
+			  "name": "counter1",
+			  "value": 7
+			}`,
+		},
+		{
+			name: "push to counter database",
+			mode: repository.ModeCounter,
+			setup: func(db *repository.Database) {
+				_, err := db.New("counter1")
+				require.NoError(t, err)
+			},
+			method:        http.MethodPut,
+			path:          "/databases/{database}/stacks/counter1",
+			body:          map[string]any{"element": 1},
+			expStatusCode: http.StatusUnprocessableEntity,
+			expBody: `{
+			  "title": "Unprocessable Entity",
+			  "status": 422,
+			  "detail": "can't push to a counter database"
+			}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			// setup.
+			_, api := humatest.New(t)
+			svc := handlers.New()
+			svc.AddRoutes(api)
+			db, err := svc.Repository.New("dbName123", repository.WithMode(tt.mode))
+			require.NoError(t, err)
+			if tt.setup != nil {
+				tt.setup(db)
+			}
+			tt.path = strings.Replace(tt.path, "{database}", db.ID.String(), -1)
+
+			// test.
+			resp := api.Do(tt.method, tt.path, tt.body)
+			require.Equal(t, tt.expStatusCode, resp.Code)
+			body := resp.Body.String()
+			if resp.Code == http.StatusOK {
+				body, err = sjson.Set(body, "id", "ID")
+				require.NoError(t, err)
+			}
+			require.JSONEq(t, tt.expBody, body)
+		})
+	}
+}
@@ -3,8 +3,11 @@ package handlers
 import (
 	"context"
 	"errors"
+	"fmt"
+	"strings"
 
 	"github.com/danielgtaylor/huma/v2"
+	"github.com/google/uuid"
 
 	"github.com/jh125486/batterdb/repository"
 )
@@ -19,18 +22,30 @@ type (
 	Database struct {
 		ID             string `json:"id"`
 		Name           string `json:"name"`
+		Mode           string `json:"mode,omitempty"`
 		NumberOfStacks int    `json:"number_of_stacks"`
 	}
 )
 
-func (s *Service) ListDatabasesHandler(_ context.Context, _ *struct{}) (*DatabasesOutput, error) {
+type ListDatabasesInput struct {
+	Q string `doc:"only show databases whose name contains this, ignoring case" query:"q"`
+}
+
+// ListDatabasesHandler lists the databases sorted by name. The number of
+// databases is that of the repository, regardless of the filter.
+func (s *Service) ListDatabasesHandler(_ context.Context, input *ListDatabasesInput) (*DatabasesOutput, error) {
+	q := strings.ToLower(input.Q)
 	out := new(DatabasesOutput)
 	out.Body.NumberOfDatabases = s.Repository.Len()
 	out.Body.Databases = make([]Database, 0, out.Body.NumberOfDatabases)
 	for _, db := range s.Repository.SortDatabases() {
+		if !strings.Contains(strings.ToLower(db.Name), q) {
+			continue
+		}
 		out.Body.Databases = append(out.Body.Databases, Database{
 			ID:             db.ID.String(),
 			Name:           db.Name,
+			Mode:           string(db.Mode),
 			NumberOfStacks: db.Len(),
 		})
 	}
@@ -60,6 +75,7 @@ func (s *Service) ShowDatabaseHandler(_ context.Context, input *SingleDatabaseIn
 	out.Body = Database{
 		ID:             db.ID.String(),
 		Name:           db.Name,
+		Mode:           string(db.Mode),
 		NumberOfStacks: db.Len(),
 	}
 
@@ -69,6 +85,7 @@ func (s *Service) ShowDatabaseHandler(_ context.Context, input *SingleDatabaseIn
 type (
 	CreateDatabaseInput struct {
 		Name string `minLength:"7" query:"name" required:"true"`
+		Mode string `default:"stack" doc:"a counter database holds numeric counters instead of stacks" enum:"stack,counter" query:"mode"`
 	}
 	CreateDatabaseOutput struct {
 		Body Database
@@ -76,7 +93,14 @@ type (
 )
 
 func (s *Service) CreateDatabaseHandler(_ context.Context, input *CreateDatabaseInput) (*CreateDatabaseOutput, error) {
-	db, err := s.Repository.New(input.Name)
+	if err := s.validateName(input.Name); err != nil {
+		return nil, err
+	}
+	var opts []repository.DatabaseOption
+	if input.Mode == "counter" {
+		opts = append(opts, repository.WithMode(repository.ModeCounter))
+	}
+	db, err := s.Repository.New(input.Name, opts...)
 	if errors.Is(err, repository.ErrAlreadyExists) {
 		return nil, huma.Error409Conflict("database already exists", err)
 	}
@@ -85,12 +109,16 @@ func (s *Service) CreateDatabaseHandler(_ context.Context, input *CreateDatabase
 		Body: Database{
 			ID:             db.ID.String(),
 			Name:           db.Name,
+			Mode:           string(db.Mode),
 			NumberOfStacks: db.Len(),
 		},
 	}, nil
 }
 
 func (s *Service) DeleteDatabaseHandler(_ context.Context, input *SingleDatabaseInput) (*struct{}, error) {
+	if err := s.validateID(input.DatabaseID); err != nil {
+		return nil, err
+	}
 	if err := s.Repository.Drop(input.DatabaseID); err != nil {
 		return nil, huma.Error404NotFound("database not found", err)
 	}
@@ -98,7 +126,215 @@ func (s *Service) DeleteDatabaseHandler(_ context.Context, input *SingleDatabase
 	return nil, nil
 }
 
+type (
+	DatabasesStatusInput struct {
+		Body struct {
+			Databases []string `doc:"database IDs or names, all databases if empty" json:"databases,omitempty"`
+		} `required:"false"`
+	}
+	DatabasesStatusOutput struct {
+		Body struct {
+			Databases []DatabaseStatus `json:"databases"`
+		}
+	}
+	DatabaseStatus struct {
+		ID               string `json:"id,omitempty"`
+		Name             string `json:"name"`
+		Error            string `json:"error,omitempty"`
+		NumberOfStacks   int    `json:"number_of_stacks"`
+		NumberOfElements int    `json:"number_of_elements"`
+	}
+)
+
+func (s *Service) DatabasesStatusHandler(_ context.Context, input *DatabasesStatusInput) (*DatabasesStatusOutput, error) {
+	out := new(DatabasesStatusOutput)
+	if len(input.Body.Databases) == 0 {
+		dbs := s.Repository.SortDatabases()
+		out.Body.Databases = make([]DatabaseStatus, 0, len(dbs))
+		for _, db := range dbs {
+			out.Body.Databases = append(out.Body.Databases, newDatabaseStatus(db))
+		}
+
+		return out, nil
+	}
+
+	out.Body.Databases = make([]DatabaseStatus, 0, len(input.Body.Databases))
+	for _, id := range input.Body.Databases {
+		if err := s.validateID(id); err != nil {
+			out.Body.Databases = append(out.Body.Databases, DatabaseStatus{
+				Name:  id,
+				Error: "malformed ID",
+			})
+			continue
+		}
+		db, err := s.Repository.Database(id)
+		if err != nil {
+			out.Body.Databases = append(out.Body.Databases, DatabaseStatus{
+				Name:  id,
+				Error: "database not found",
+			})
+			continue
+		}
+		out.Body.Databases = append(out.Body.Databases, newDatabaseStatus(db))
+	}
+
+	return out, nil
+}
+
+func newDatabaseStatus(db *repository.Database) DatabaseStatus {
+	status := DatabaseStatus{
+		ID:   db.ID.String(),
+		Name: db.Name,
+	}
+	for _, stack := range db.SortStacks() {
+		status.NumberOfStacks++
+		status.NumberOfElements += stack.Size()
+	}
+
+	return status
+}
+
+type (
+	ExportDatabaseOutput struct {
+		Body repository.DatabaseExport
+	}
+	ImportDatabaseInput struct {
+		URLParamDatabaseID
+		Body      repository.DatabaseExport
+		Overwrite bool `default:"false" doc:"replace the elements and metadata of stacks that already exist" query:"overwrite"`
+	}
+	ImportDatabaseOutput struct {
+		Body struct {
+			Imported int `json:"imported"`
+		}
+	}
+)
+
+// ExportDatabaseHandler returns a database with all its stacks and elements
+// as JSON, see repository.Database.Export.
+func (s *Service) ExportDatabaseHandler(_ context.Context, input *SingleDatabaseInput) (*ExportDatabaseOutput, error) {
+	db, err := s.database(input.DatabaseID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ExportDatabaseOutput{Body: db.Export()}, nil
+}
+
+// ImportDatabaseHandler recreates the stacks of an export, creating the
+// database if it doesn't exist, see repository.Database.Import. The elements
+// are checked and prepared like pushes. A database created for an import that
+// fails is dropped again.
+func (s *Service) ImportDatabaseHandler(_ context.Context, input *ImportDatabaseInput) (*ImportDatabaseOutput, error) {
+	for _, stack := range input.Body.Stacks {
+		if err := s.validateNewName(stack.Name); err != nil {
+			return nil, err
+		}
+	}
+	db, created, err := s.importDatabase(input.DatabaseID, input.Body.Mode)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.importStacks(db, input.Body, input.Overwrite); err != nil {
+		if created {
+			_ = s.Repository.Drop(db.ID.String())
+		}
+		return nil, err
+	}
+
+	out := new(ImportDatabaseOutput)
+	out.Body.Imported = len(input.Body.Stacks)
+
+	return out, nil
+}
+
+// importDatabase returns the database to import into, creating it with the
+// mode of the export if it doesn't exist, and whether it was created.
+func (s *Service) importDatabase(dbID string, mode repository.Mode) (*repository.Database, bool, error) {
+	if err := s.validateID(dbID); err != nil {
+		return nil, false, err
+	}
+	db, err := s.Repository.Database(dbID)
+	created := false
+	if errors.Is(err, repository.ErrNotFound) {
+		if _, perr := uuid.Parse(dbID); perr == nil {
+			// an ID can't be created.
+			return nil, false, huma.Error404NotFound("database not found", err)
+		}
+		if err := s.validateNewName(dbID); err != nil {
+			return nil, false, err
+		}
+		db, err = s.Repository.New(dbID, repository.WithMode(mode))
+		created = err == nil
+	}
+	if err != nil {
+		return nil, false, huma.Error500InternalServerError("failed to create database", err)
+	}
+	if db.Mode != mode {
+		return nil, false, huma.Error422UnprocessableEntity(fmt.Sprintf("export of a %q database can't be imported into a %q database", mode, db.Mode))
+	}
+
+	return db, created, nil
+}
+
+// importStacks prepares the elements of the export like pushes to their
+// stacks, then imports them into the database.
+func (s *Service) importStacks(db *repository.Database, exp repository.DatabaseExport, overwrite bool) error {
+	for i, sexp := range exp.Stacks {
+		elements := make([]any, len(sexp.Elements))
+		for j, element := range sexp.Elements {
+			var err error
+			if elements[j], err = s.prepareImportElement(db, sexp.Name, element); err != nil {
+				return err
+			}
+		}
+		exp.Stacks[i].Elements = elements
+	}
+	if err := db.Import(exp, overwrite); err != nil {
+		return s.importError(err)
+	}
+
+	return nil
+}
+
+// prepareImportElement prepares an element imported into the named stack: as
+// a push if the stack exists, else against the schema of the database.
+// Counters aren't pushed to, so their elements are only validated.
+func (s *Service) prepareImportElement(db *repository.Database, name string, element any) (any, error) {
+	if db.IsCounter() {
+		return element, s.validateElement(element)
+	}
+	element, err := s.prepareElement(element)
+	if err != nil {
+		return nil, err
+	}
+	if stack, err := db.Stack(name); err == nil {
+		return s.decodeElement(stack, element)
+	}
+	if schema := db.ElementSchema(); schema != nil {
+		if err := s.matchSchema(schema, element); err != nil {
+			return nil, err
+		}
+	}
+
+	return element, nil
+}
+
+func (s *Service) importError(err error) error {
+	switch {
+	case errors.Is(err, repository.ErrInvalidExport):
+		return huma.Error422UnprocessableEntity(err.Error())
+	case errors.Is(err, repository.ErrStackFull):
+		return s.pushError(err)
+	default:
+		return s.createStackError(err)
+	}
+}
+
 func (s *Service) database(dbID string) (*repository.Database, error) {
+	if err := s.validateID(dbID); err != nil {
+		return nil, err
+	}
 	db, err := s.Repository.Database(dbID)
 	if err != nil {
 		return nil, huma.Error404NotFound("database not found", err)
@@ -106,3 +342,62 @@ func (s *Service) database(dbID string) (*repository.Database, error) {
 
 	return db, nil
 }
+
+// minNameLength is the minimum length of database and stack names, as
+// declared on the input structs.
+const minNameLength = 7
+
+// validateNewName validates the name of a database or stack created from a
+// path or body field, which the input structs don't check: it must also have
+// the minimum length, and not be a UUID, which is only ever looked up as an ID.
+func (s *Service) validateNewName(n string) error {
+	if len(n) < minNameLength {
+		return huma.Error422UnprocessableEntity(fmt.Sprintf("name must be at least %d characters", minNameLength))
+	}
+	if _, err := uuid.Parse(n); err == nil {
+		return huma.Error422UnprocessableEntity(fmt.Sprintf("name %q must not be a UUID", n))
+	}
+
+	return s.validateName(n)
+}
+
+// validateName enforces the configured maximum name length, complementing the
+// minimum length declared on the input structs.
+func (s *Service) validateName(n string) error {
+	if s.maxNameLength > 0 && len(n) > s.maxNameLength {
+		return huma.Error422UnprocessableEntity(fmt.Sprintf("name must not exceed %d characters", s.maxNameLength))
+	}
+	// such a name could never be looked up again.
+	if err := s.validateID(n); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// validateID rejects IDs that are shaped like a UUID but don't parse as one
+// with WithStrictIDs, instead of looking them up as names.
+func (s *Service) validateID(id string) error {
+	if !s.strictIDs || !looksLikeUUID(id) {
+		return nil
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		return huma.Error400BadRequest(fmt.Sprintf("malformed ID %q", id), err)
+	}
+
+	return nil
+}
+
+// looksLikeUUID reports whether id has the 8-4-4-4-12 shape of a UUID.
+func looksLikeUUID(id string) bool {
+	if len(id) != 36 {
+		return false
+	}
+	for _, i := range []int{8, 13, 18, 23} {
+		if id[i] != '-' {
+			return false
+		}
+	}
+
+	return true
+}
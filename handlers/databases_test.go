@@ -1,8 +1,10 @@
 package handlers_test
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/url"
+	"strings"
 	"testing"
 
 	"github.com/danielgtaylor/huma/v2/humatest"
@@ -10,6 +12,7 @@ import (
 	"github.com/tidwall/sjson"
 
 	"github.com/jh125486/batterdb/handlers"
+	"github.com/jh125486/batterdb/repository"
 )
 
 func TestService_DatabaseHandlers(t *testing.T) {
@@ -20,6 +23,7 @@ func TestService_DatabaseHandlers(t *testing.T) {
 		method        string
 		path          string
 		query         url.Values
+		body          map[string]any
 		expStatusCode int
 		processBody   func(string) string
 		expBody       string
@@ -69,6 +73,57 @@ func TestService_DatabaseHandlers(t *testing.T) {
 			  "number_of_databases": 2
 			}`,
 		},
+		{
+			name: "get databases filtered by name",
+			setup: func(svc *handlers.Service) {
+				for _, n := range []string{"ordersEU", "users", "ORDERS_US"} {
+					_, err := svc.Repository.New(n)
+					require.NoError(t, err)
+				}
+			},
+			method:        http.MethodGet,
+			path:          "/databases",
+			query:         url.Values{"q": []string{"orders"}},
+			expStatusCode: http.StatusOK,
+			processBody: func(s string) string {
+				var err error
+				s, err = sjson.Set(s, "databases.0.id", "ID1")
+				require.NoError(t, err)
+				s, err = sjson.Set(s, "databases.1.id", "ID2")
+				require.NoError(t, err)
+				return s
+			},
+			expBody: `{
+			  "databases": [
+				{
+				  "id": "ID1",
+				  "name": "ORDERS_US",
+				  "number_of_stacks": 0
+				},
+				{
+				  "id": "ID2",
+				  "name": "ordersEU",
+				  "number_of_stacks": 0
+				}
+			  ],
+			  "number_of_databases": 3
+			}`,
+		},
+		{
+			name: "get databases filtered without match",
+			setup: func(svc *handlers.Service) {
+				_, err := svc.Repository.New("users")
+				require.NoError(t, err)
+			},
+			method:        http.MethodGet,
+			path:          "/databases",
+			query:         url.Values{"q": []string{"orders"}},
+			expStatusCode: http.StatusOK,
+			expBody: `{
+			  "databases": [],
+			  "number_of_databases": 1
+			}`,
+		},
 		{
 			name: "get single database",
 			setup: func(svc *handlers.Service) {
@@ -110,6 +165,82 @@ func TestService_DatabaseHandlers(t *testing.T) {
 			  ]
 			}`,
 		},
+		{
+			name: "databases status all",
+			setup: func(svc *handlers.Service) {
+				db, err := svc.Repository.New("dbZ")
+				require.NoError(t, err)
+				stack, err := db.New("stackA")
+				require.NoError(t, err)
+				stack.Push(1)
+				stack.Push(2)
+				_, err = svc.Repository.New("dbA")
+				require.NoError(t, err)
+			},
+			method:        http.MethodPost,
+			path:          "/databases/status",
+			body:          map[string]any{},
+			expStatusCode: http.StatusOK,
+			processBody: func(s string) string {
+				var err error
+				s, err = sjson.Set(s, "databases.0.id", "ID1")
+				require.NoError(t, err)
+				s, err = sjson.Set(s, "databases.1.id", "ID2")
+				require.NoError(t, err)
+				return s
+			},
+			expBody: `{
+			  "databases": [
+				{
+				  "id": "ID1",
+				  "name": "dbA",
+				  "number_of_stacks": 0,
+				  "number_of_elements": 0
+				},
+				{
+				  "id": "ID2",
+				  "name": "dbZ",
+				  "number_of_stacks": 1,
+				  "number_of_elements": 2
+				}
+			  ]
+			}`,
+		},
+		{
+			name: "databases status some",
+			setup: func(svc *handlers.Service) {
+				_, err := svc.Repository.New("dbA")
+				require.NoError(t, err)
+			},
+			method: http.MethodPost,
+			path:   "/databases/status",
+			body: map[string]any{
+				"databases": []string{"dne", "dbA"},
+			},
+			expStatusCode: http.StatusOK,
+			processBody: func(s string) string {
+				var err error
+				s, err = sjson.Set(s, "databases.1.id", "ID")
+				require.NoError(t, err)
+				return s
+			},
+			expBody: `{
+			  "databases": [
+				{
+				  "name": "dne",
+				  "error": "database not found",
+				  "number_of_stacks": 0,
+				  "number_of_elements": 0
+				},
+				{
+				  "id": "ID",
+				  "name": "dbA",
+				  "number_of_stacks": 0,
+				  "number_of_elements": 0
+				}
+			  ]
+			}`,
+		},
 		{
 			name:          "create a database",
 			method:        http.MethodPost,
@@ -128,6 +259,37 @@ func TestService_DatabaseHandlers(t *testing.T) {
 			  "number_of_stacks": 0
 			}`,
 		},
+		{
+			name:          "create a counter database",
+			method:        http.MethodPost,
+			path:          "/databases",
+			query:         url.Values{"name": []string{"dbName123"}, "mode": []string{"counter"}},
+			expStatusCode: http.StatusCreated,
+			processBody: func(s string) string {
+				var err error
+				s, err = sjson.Set(s, "id", "ID")
+				require.NoError(t, err)
+				return s
+			},
+			expBody: `{
+			  "id": "ID",
+			  "name": "dbName123",
+			  "mode": "counter",
+			  "number_of_stacks": 0
+			}`,
+		},
+		{
+			name:          "create a database name too long",
+			method:        http.MethodPost,
+			path:          "/databases",
+			query:         url.Values{"name": []string{strings.Repeat("a", 256)}},
+			expStatusCode: http.StatusUnprocessableEntity,
+			expBody: `{
+			  "title": "Unprocessable Entity",
+			  "status": 422,
+			  "detail": "name must not exceed 255 characters"
+			}`,
+		},
 		{
 			name: "database already exists",
 			setup: func(svc *handlers.Service) {
@@ -191,7 +353,7 @@ func TestService_DatabaseHandlers(t *testing.T) {
 			}
 
 			// test.
-			resp := api.Do(tt.method, tt.path)
+			resp := api.Do(tt.method, tt.path, tt.body)
 			require.Equal(t, tt.expStatusCode, resp.Code)
 			body := resp.Body.String()
 			if tt.expBody == "" {
@@ -205,3 +367,190 @@ func TestService_DatabaseHandlers(t *testing.T) {
 		})
 	}
 }
+
+func TestService_StrictIDs(t *testing.T) {
+	t.Parallel()
+	const malformed = "0190c0ad-5d5e-7fe1-9a1b-2f3c4d5e6fzz"
+	tests := []struct {
+		name          string
+		strict        bool
+		path          string
+		expStatusCode int
+	}{
+		{name: "lenient database", path: "/databases/" + malformed, expStatusCode: http.StatusNotFound},
+		{name: "strict database", strict: true, path: "/databases/" + malformed, expStatusCode: http.StatusBadRequest},
+		{name: "lenient stack", path: "/databases/dbName123/stacks/" + malformed, expStatusCode: http.StatusNotFound},
+		{name: "strict stack", strict: true, path: "/databases/dbName123/stacks/" + malformed, expStatusCode: http.StatusBadRequest},
+		{name: "strict name", strict: true, path: "/databases/dbName123", expStatusCode: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, api := humatest.New(t)
+			svc := handlers.New(handlers.WithStrictIDs(tt.strict))
+			svc.AddRoutes(api)
+			_, err := svc.Repository.New("dbName123")
+			require.NoError(t, err)
+
+			resp := api.Get(tt.path)
+			require.Equal(t, tt.expStatusCode, resp.Code)
+		})
+	}
+}
+
+func TestService_DatabaseDepthsHandler(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name          string
+		path          string
+		expStatusCode int
+		expBody       string
+	}{
+		{name: "all", path: "/databases/dbName123/depths", expStatusCode: http.StatusOK, expBody: `[{"name": "deep", "size": 3}, {"name": "shallow", "size": 1}, {"name": "empty", "size": 0}]`},
+		{name: "top", path: "/databases/dbName123/depths?top=2", expStatusCode: http.StatusOK, expBody: `[{"name": "deep", "size": 3}, {"name": "shallow", "size": 1}]`},
+		{name: "database dne", path: "/databases/dne/depths", expStatusCode: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, api := humatest.New(t)
+			svc := handlers.New()
+			svc.AddRoutes(api)
+			db, err := svc.Repository.New("dbName123")
+			require.NoError(t, err)
+			for name, size := range map[string]int{"shallow": 1, "deep": 3, "empty": 0} {
+				stack, err := db.New(name)
+				require.NoError(t, err)
+				for i := range size {
+					stack.Push(i)
+				}
+			}
+
+			resp := api.Get(tt.path)
+			require.Equal(t, tt.expStatusCode, resp.Code)
+			if tt.expBody != "" {
+				require.JSONEq(t, tt.expBody, resp.Body.String())
+			}
+		})
+	}
+}
+
+func TestService_ExportImportDatabase(t *testing.T) {
+	t.Parallel()
+	_, api := humatest.New(t)
+	svc := handlers.New()
+	svc.AddRoutes(api)
+	db, err := svc.Repository.New("dbName123")
+	require.NoError(t, err)
+	stack, err := db.New("stackName123")
+	require.NoError(t, err)
+	stack.SetDescription("described")
+	require.NoError(t, stack.PushMany([]any{1, "two"}))
+
+	resp := api.Get("/databases/dbName123/export")
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.JSONEq(t, `{
+		"name": "dbName123",
+		"stacks": [{"name": "stackName123", "description": "described", "elements": [1, "two"]}]
+	}`, resp.Body.String())
+	var exp map[string]any
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &exp))
+
+	tests := []struct {
+		name          string
+		path          string
+		expStatusCode int
+	}{
+		{name: "new database", path: "/databases/otherDB123/import", expStatusCode: http.StatusOK},
+		{name: "stack exists", path: "/databases/dbName123/import", expStatusCode: http.StatusConflict},
+		{name: "overwrite", path: "/databases/dbName123/import?overwrite=true", expStatusCode: http.StatusOK},
+	}
+	for _, tt := range tests {
+		resp := api.Post(tt.path, exp)
+		require.Equal(t, tt.expStatusCode, resp.Code, tt.name)
+	}
+
+	other, err := svc.Repository.Database("otherDB123")
+	require.NoError(t, err)
+	imported, err := other.Stack("stackName123")
+	require.NoError(t, err)
+	require.Equal(t, []any{1.0, "two"}, imported.Elements(0, imported.Size()))
+	require.Equal(t, "described", imported.Description)
+}
+
+func TestService_ImportDatabaseHandler_Invalid(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name          string
+		setup         func(*repository.Database)
+		path          string
+		body          map[string]any
+		expStatusCode int
+		expStacks     int
+	}{
+		{
+			name:          "database name too short",
+			path:          "/databases/db/import",
+			body:          map[string]any{"name": "db", "stacks": []any{}},
+			expStatusCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:          "database ID",
+			path:          "/databases/7d444840-9dc0-11d1-b245-5ffdce74fad2/import",
+			body:          map[string]any{"name": "dbName", "stacks": []any{}},
+			expStatusCode: http.StatusNotFound,
+		},
+		{
+			name:          "stack name too short",
+			path:          "/databases/newDB123/import",
+			body:          map[string]any{"name": "newDB123", "stacks": []any{map[string]any{"name": "ab", "elements": []any{}}}},
+			expStatusCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "database schema",
+			setup: func(db *repository.Database) {
+				db.SetSchema([]byte(`{"type": "string"}`))
+			},
+			path:          "/databases/dbName123/import",
+			body:          map[string]any{"name": "dbName123", "stacks": []any{map[string]any{"name": "stackNew123", "elements": []any{1}}}},
+			expStatusCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "stack schema",
+			setup: func(db *repository.Database) {
+				stack, err := db.New("stackName123")
+				require.NoError(t, err)
+				stack.SetSchema([]byte(`{"type": "string"}`))
+			},
+			path:          "/databases/dbName123/import?overwrite=true",
+			body:          map[string]any{"name": "dbName123", "stacks": []any{map[string]any{"name": "stackName123", "elements": []any{1}}}},
+			expStatusCode: http.StatusUnprocessableEntity,
+			expStacks:     1,
+		},
+		{
+			name:          "element too deep in a new database",
+			path:          "/databases/newDB123/import",
+			body:          map[string]any{"name": "newDB123", "stacks": []any{map[string]any{"name": "stackNew123", "elements": []any{nested(33)}}}},
+			expStatusCode: http.StatusUnprocessableEntity,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, api := humatest.New(t)
+			svc := handlers.New()
+			svc.AddRoutes(api)
+			db, err := svc.Repository.New("dbName123")
+			require.NoError(t, err)
+			if tt.setup != nil {
+				tt.setup(db)
+			}
+
+			resp := api.Post(tt.path, tt.body)
+			require.Equal(t, tt.expStatusCode, resp.Code, resp.Body.String())
+			// a failed import leaves no database behind.
+			require.Equal(t, 1, svc.Repository.Len())
+			require.Equal(t, tt.expStacks, db.Len())
+		})
+	}
+}
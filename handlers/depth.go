@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/jh125486/batterdb/formats/yaml"
+)
+
+// maxDepthScanBytes bounds how much of a body is scanned for its depth, as
+// larger bodies are rejected by huma anyway.
+const maxDepthScanBytes = 1 << 20
+
+// DecodeDepthHandler rejects JSON and YAML request bodies that are nested
+// deeper than WithMaxDecodeDepth with 422 Unprocessable Entity before they're
+// decoded, so a maliciously nested body can't exhaust the decoder. Bodies of
+// other formats pass through unchecked.
+func (s *Service) DecodeDepthHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		depth := bodyDepthFunc(r.Header.Get("Content-Type"))
+		if depth == nil || r.Body == nil || r.Body == http.NoBody {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		b, err := io.ReadAll(io.LimitReader(r.Body, maxDepthScanBytes+1))
+		if err != nil {
+			http.Error(w, "failed to read body", http.StatusBadRequest)
+			return
+		}
+		if depth(b, len(b) <= maxDepthScanBytes) > s.maxDecodeDepth {
+			http.Error(w, fmt.Sprintf("body must not be nested deeper than %d levels", s.maxDecodeDepth),
+				http.StatusUnprocessableEntity)
+			return
+		}
+		// hand the scanned part back along with the rest of the body.
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(b), r.Body), r.Body}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// bodyDepthFunc returns the depth func of the format of a content type, or
+// nil if the format isn't checked. A body without a content type is JSON.
+func bodyDepthFunc(contentType string) func(b []byte, complete bool) int {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case strings.Contains(mediaType, "yaml"):
+		return yamlDepth
+	case mediaType == "" || strings.Contains(mediaType, "json"):
+		return jsonDepth
+	default:
+		return nil
+	}
+}
+
+// jsonDepth returns how deep objects and arrays are nested in b. As nesting
+// only grows, the depth of a prefix is a lower bound of the whole.
+func jsonDepth(b []byte, _ bool) int {
+	var depth, deepest int
+	var inString, escaped bool
+	for _, c := range b {
+		switch {
+		case escaped:
+			escaped = false
+		case inString:
+			switch c {
+			case '\\':
+				escaped = true
+			case '"':
+				inString = false
+			}
+		case c == '"':
+			inString = true
+		case c == '{' || c == '[':
+			depth++
+			deepest = max(deepest, depth)
+		case c == '}' || c == ']':
+			depth--
+		}
+	}
+
+	return deepest
+}
+
+// yamlDepth returns how deep mappings and sequences are nested in b. YAML
+// can't be parsed in part, so an incomplete or malformed body is left to the
+// decoder.
+func yamlDepth(b []byte, complete bool) int {
+	if !complete {
+		return 0
+	}
+	depth, err := yaml.Depth(b)
+	if err != nil {
+		return 0
+	}
+
+	return depth
+}
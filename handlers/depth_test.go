@@ -0,0 +1,58 @@
+package handlers_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jh125486/batterdb/handlers"
+)
+
+func TestService_DecodeDepthHandler(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name          string
+		contentType   string
+		body          string
+		expStatusCode int
+	}{
+		{name: "json within limit", contentType: "application/json", body: `{"element": [[1]]}`, expStatusCode: http.StatusOK},
+		{name: "json too deep", contentType: "application/json", body: `{"element": [[[1]]]}`, expStatusCode: http.StatusUnprocessableEntity},
+		{name: "json brackets in strings", contentType: "application/json", body: `{"element": "[[[[\"{{"}`, expStatusCode: http.StatusOK},
+		{name: "json without content type", body: `[[[[]]]]`, expStatusCode: http.StatusUnprocessableEntity},
+		{name: "camel json too deep", contentType: "application/camel+json", body: `[[[[]]]]`, expStatusCode: http.StatusUnprocessableEntity},
+		{name: "yaml within limit", contentType: "application/yaml", body: "element:\n  - - 1\n", expStatusCode: http.StatusOK},
+		{name: "yaml too deep", contentType: "application/yaml; charset=utf-8", body: "element:\n  - - - 1\n", expStatusCode: http.StatusUnprocessableEntity},
+		{name: "yaml flow too deep", contentType: "application/yaml", body: "element: [[[1]]]\n", expStatusCode: http.StatusUnprocessableEntity},
+		{name: "malformed yaml", contentType: "application/yaml", body: "element: [", expStatusCode: http.StatusOK},
+		{name: "other format", contentType: "text/plain", body: `[[[[]]]]`, expStatusCode: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			svc := handlers.New(handlers.WithMaxDecodeDepth(3))
+			var got string
+			h := svc.DecodeDepthHandler(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				b, err := io.ReadAll(r.Body)
+				require.NoError(t, err)
+				got = string(b)
+			}))
+
+			req := httptest.NewRequest(http.MethodPut, "/databases/db/stacks/stack", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			require.Equal(t, tt.expStatusCode, rec.Code)
+			if tt.expStatusCode == http.StatusOK {
+				assert.Equal(t, tt.body, got, "the body must be passed on intact")
+			}
+		})
+	}
+}
@@ -1,12 +1,15 @@
 package handlers
 
 import (
+	"cmp"
 	"context"
 	"net/http"
 	"runtime"
+	"slices"
 	"time"
 
 	"github.com/alecthomas/units"
+	"github.com/danielgtaylor/huma/v2"
 )
 
 type (
@@ -35,7 +38,7 @@ func (s *Service) StatusHandler(_ context.Context, _ *struct{}) (*StatusOutput,
 	out.Body.GoVersion = s.buildInfo.GoVersion
 	out.Body.Host = s.platform
 	out.Body.PID = s.pid
-	out.Body.StartedAt = s.startedAt
+	out.Body.StartedAt = s.startedAt.UTC()
 	out.Body.RunningFor = time.Since(s.startedAt).Seconds()
 	out.Body.NumberGoroutines = runtime.NumGoroutine()
 	out.Body.MemoryAlloc = units.Base2Bytes(mem.Alloc).Round(1).String()
@@ -43,6 +46,172 @@ func (s *Service) StatusHandler(_ context.Context, _ *struct{}) (*StatusOutput,
 	return out, nil
 }
 
+type (
+	ConfigOutput struct {
+		Body ConfigBody
+	}
+	ConfigBody struct {
+		DefaultTimeout string        `json:"default_timeout"  yaml:"defaultTimeout"`
+		ResponseCache  string        `json:"response_cache"   yaml:"responseCache"`
+		DrainWindow    string        `json:"drain_window"     yaml:"drainWindow"`
+		SeedFile       string        `json:"seed_file"        yaml:"seedFile"`
+		TrustedProxies []string      `json:"trusted_proxies"  yaml:"trustedProxies"`
+		Persist        PersistConfig `json:"persist"          yaml:"persist"`
+		Limits         LimitsConfig  `json:"limits"           yaml:"limits"`
+		Port           int32         `json:"port"             yaml:"port"`
+		AdminPort      int32         `json:"admin_port"       yaml:"adminPort"`
+		GRPCPort       int32         `json:"grpc_port"        yaml:"grpcPort"`
+		Secure         bool          `json:"secure"           yaml:"secure"`
+		CamelCaseJSON  bool          `json:"camel_case_json"  yaml:"camelCaseJSON"`
+		StrictIDs      bool          `json:"strict_ids"       yaml:"strictIDs"`
+	}
+	PersistConfig struct {
+		File             string `json:"file"               yaml:"file"`
+		Dir              string `json:"dir"                yaml:"dir"`
+		Autosave         string `json:"autosave"           yaml:"autosave"`
+		AutosaveJitter   string `json:"autosave_jitter"    yaml:"autosaveJitter"`
+		MaxBytes         int64  `json:"max_bytes"          yaml:"maxBytes"`
+		Versions         int    `json:"versions"           yaml:"versions"`
+		MaxLoadDatabases int    `json:"max_load_databases" yaml:"maxLoadDatabases"`
+		Enabled          bool   `json:"enabled"            yaml:"enabled"`
+		Verify           bool   `json:"verify"             yaml:"verify"`
+		TolerateCorrupt  bool   `json:"tolerate_corrupt"   yaml:"tolerateCorrupt"`
+	}
+	LimitsConfig struct {
+		MaxNameLength          int `json:"max_name_length"           yaml:"maxNameLength"`
+		MaxElementDepth        int `json:"max_element_depth"         yaml:"maxElementDepth"`
+		MaxBatchSize           int `json:"max_batch_size"            yaml:"maxBatchSize"`
+		ElementCompression     int `json:"element_compression"       yaml:"elementCompression"`
+		MaxDecodeDepth         int `json:"max_decode_depth"          yaml:"maxDecodeDepth"`
+		MaxStacks              int `json:"max_stacks"                yaml:"maxStacks"`
+		MaxWaiters             int `json:"max_waiters"               yaml:"maxWaiters"`
+		MaxStackSize           int `json:"max_stack_size"            yaml:"maxStackSize"`
+		MaxElementsPerResponse int `json:"max_elements_per_response" yaml:"maxElementsPerResponse"`
+	}
+)
+
+// ConfigHandler shows the effective configuration of the server. Only
+// settings that are safe to disclose are included, and a value of 0 means a
+// limit or feature is disabled.
+func (s *Service) ConfigHandler(_ context.Context, _ *struct{}) (*ConfigOutput, error) {
+	out := new(ConfigOutput)
+	out.Body.Port = s.Port()
+	out.Body.AdminPort = s.AdminPort()
+	out.Body.GRPCPort = s.GRPCPort()
+	out.Body.Secure = s.secure
+	out.Body.CamelCaseJSON = s.camelCaseJSON
+	out.Body.StrictIDs = s.strictIDs
+	out.Body.SeedFile = s.seedfile
+	out.Body.DefaultTimeout = s.defaultTimeout.String()
+	out.Body.DrainWindow = s.drainWindow.String()
+	out.Body.ResponseCache = time.Duration(0).String()
+	if s.cache != nil {
+		out.Body.ResponseCache = s.cache.ttl.String()
+	}
+	out.Body.TrustedProxies = make([]string, len(s.trustedProxies))
+	for i, prefix := range s.trustedProxies {
+		out.Body.TrustedProxies[i] = prefix.String()
+	}
+	out.Body.Persist = PersistConfig{
+		Enabled:          s.persistDB,
+		File:             s.savefile,
+		Dir:              s.persistDir,
+		Versions:         s.versions,
+		MaxBytes:         s.maxPersistSize,
+		Autosave:         s.autosave.String(),
+		AutosaveJitter:   s.autosaveJitter.String(),
+		Verify:           s.verifyPersist,
+		TolerateCorrupt:  s.tolerateCorrupt,
+		MaxLoadDatabases: s.maxLoadDBs,
+	}
+	out.Body.Limits = LimitsConfig{
+		MaxNameLength:          s.maxNameLength,
+		MaxElementDepth:        s.maxDepth,
+		MaxBatchSize:           s.maxBatchSize,
+		ElementCompression:     s.compressMin,
+		MaxDecodeDepth:         s.maxDecodeDepth,
+		MaxStacks:              s.maxStacks,
+		MaxWaiters:             s.maxWaiters,
+		MaxStackSize:           s.maxStackSize,
+		MaxElementsPerResponse: s.maxElements,
+	}
+
+	return out, nil
+}
+
+type TimeOutput struct {
+	Body struct {
+		Time   string  `doc:"current server time in UTC, as RFC 3339 with nanoseconds"    json:"time"   yaml:"time"`
+		Uptime float64 `doc:"seconds since the server started, from the monotonic clock" json:"uptime" yaml:"uptime"`
+	}
+}
+
+// TimeHandler returns the server time, so clients can detect clock skew.
+func (s *Service) TimeHandler(_ context.Context, _ *struct{}) (*TimeOutput, error) {
+	now := time.Now()
+	out := new(TimeOutput)
+	out.Body.Time = now.UTC().Format(time.RFC3339Nano)
+	out.Body.Uptime = now.Sub(s.startedAt).Seconds()
+
+	return out, nil
+}
+
+// stackOperationsTag is the tag of the operations listed by
+// OperationsHandler.
+const stackOperationsTag = "Stack Operations"
+
+type (
+	OperationsOutput struct {
+		Body struct {
+			Features   map[string]bool `doc:"optional features and whether they are enabled" json:"features"   yaml:"features"`
+			Operations []OperationInfo `json:"operations" yaml:"operations"`
+		}
+	}
+	OperationInfo struct {
+		ID          string `json:"id"          yaml:"id"`
+		Method      string `json:"method"      yaml:"method"`
+		Path        string `json:"path"        yaml:"path"`
+		Summary     string `json:"summary"     yaml:"summary"`
+		Description string `json:"description" yaml:"description"`
+	}
+)
+
+// OperationsHandler lists the stack operations registered on the API, with
+// the optional features that change their behavior, so clients can adapt to
+// the capabilities of the server.
+func (s *Service) OperationsHandler(_ context.Context, _ *struct{}) (*OperationsOutput, error) {
+	out := new(OperationsOutput)
+	out.Body.Features = map[string]bool{
+		"element_ids":           s.elementIDs,
+		"element_normalization": s.normalize,
+		"element_compression":   s.compressMin > 0,
+		"push_webhook":          s.webhook != nil,
+		"response_cache":        s.cache != nil,
+		"strict_content_type":   s.strictMediaType,
+		"grpc":                  s.grpc,
+	}
+	out.Body.Operations = []OperationInfo{}
+	for _, item := range s.API.OpenAPI().Paths {
+		for _, op := range []*huma.Operation{item.Get, item.Put, item.Post, item.Patch, item.Delete} {
+			if op == nil || op.Hidden || !slices.Contains(op.Tags, stackOperationsTag) {
+				continue
+			}
+			out.Body.Operations = append(out.Body.Operations, OperationInfo{
+				ID:          op.OperationID,
+				Method:      op.Method,
+				Path:        op.Path,
+				Summary:     op.Summary,
+				Description: op.Description,
+			})
+		}
+	}
+	slices.SortFunc(out.Body.Operations, func(a, b OperationInfo) int {
+		return cmp.Or(cmp.Compare(a.Path, b.Path), cmp.Compare(a.Method, b.Method))
+	})
+
+	return out, nil
+}
+
 type PingOutput struct {
 	Body []byte `contentType:"text/plain"`
 }
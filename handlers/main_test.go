@@ -1,11 +1,13 @@
 package handlers_test
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/url"
 	"runtime/debug"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/danielgtaylor/huma/v2/humatest"
 	"github.com/stretchr/testify/require"
@@ -62,6 +64,48 @@ func TestService_MainHandlers(t *testing.T) {
 			  "number_goroutines": "$NumberGoroutines"
 			}`,
 		},
+		{
+			name:          "get config",
+			method:        http.MethodGet,
+			path:          "/_config",
+			expStatusCode: http.StatusOK,
+			expBody: `{
+			  "port": 1234,
+			  "admin_port": 0,
+			  "grpc_port": 0,
+			  "secure": false,
+			  "camel_case_json": false,
+			  "strict_ids": false,
+			  "seed_file": "",
+			  "default_timeout": "0s",
+			  "drain_window": "0s",
+			  "response_cache": "0s",
+			  "trusted_proxies": [],
+			  "persist": {
+				"enabled": false,
+				"file": ".batterdb.gob",
+				"dir": "",
+				"versions": 0,
+				"max_bytes": 0,
+				"autosave": "0s",
+				"autosave_jitter": "0s",
+				"verify": false,
+				"tolerate_corrupt": false,
+				"max_load_databases": 0
+			  },
+			  "limits": {
+				"max_name_length": 255,
+				"max_element_depth": 32,
+				"max_batch_size": 1000,
+				"element_compression": 0,
+				"max_decode_depth": 1000,
+				"max_stacks": 0,
+				"max_waiters": 1000,
+				"max_stack_size": 0,
+				"max_elements_per_response": 10000
+			  }
+			}`,
+		},
 		{
 			name:          "get ping",
 			method:        http.MethodGet,
@@ -69,13 +113,37 @@ func TestService_MainHandlers(t *testing.T) {
 			expStatusCode: http.StatusOK,
 			expBody:       `pong`,
 		},
+		{
+			name:          "get time",
+			method:        http.MethodGet,
+			path:          "/_time",
+			expStatusCode: http.StatusOK,
+			processBody: func(s string) string {
+				var body struct {
+					Time   string  `json:"time"`
+					Uptime float64 `json:"uptime"`
+				}
+				require.NoError(t, json.Unmarshal([]byte(s), &body))
+				ts, err := time.Parse(time.RFC3339Nano, body.Time)
+				require.NoError(t, err)
+				require.Equal(t, time.UTC, ts.Location())
+				require.WithinDuration(t, time.Now(), ts, time.Minute)
+				require.Positive(t, body.Uptime)
+				s, err = sjson.Set(s, "time", "$Time")
+				require.NoError(t, err)
+				s, err = sjson.Set(s, "uptime", "$Uptime")
+				require.NoError(t, err)
+				return s
+			},
+			expBody: `{"time": "$Time", "uptime": "$Uptime"}`,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
 			// setup.
 			_, api := humatest.New(t)
-			svc := handlers.New(handlers.WithBuildInfo(&debug.BuildInfo{
+			svc := handlers.New(handlers.WithPort(1234), handlers.WithBuildInfo(&debug.BuildInfo{
 				GoVersion: goVersion,
 				Main: debug.Module{
 					Version: version,
@@ -108,3 +176,30 @@ func TestService_MainHandlers(t *testing.T) {
 		})
 	}
 }
+
+func TestService_OperationsHandler(t *testing.T) {
+	t.Parallel()
+	_, api := humatest.New(t)
+	svc := handlers.New(handlers.WithElementIDs())
+	svc.AddRoutes(api)
+
+	resp := api.Get("/_operations")
+	require.Equal(t, http.StatusOK, resp.Code)
+	var body struct {
+		Features   map[string]bool          `json:"features"`
+		Operations []handlers.OperationInfo `json:"operations"`
+	}
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+	require.True(t, body.Features["element_ids"])
+	require.False(t, body.Features["push_webhook"])
+	require.Contains(t, body.Operations, handlers.OperationInfo{
+		ID:          "push-stack",
+		Method:      http.MethodPut,
+		Path:        "/databases/{database}/stacks/{stack}",
+		Summary:     "Push",
+		Description: "`PUSH` operation on a stack.",
+	})
+	for _, op := range body.Operations {
+		require.NotEqual(t, "get-databases", op.ID, "only stack operations are listed")
+	}
+}
@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// defaultMetricsNamespace is the namespace of the custom metrics unless set
+// with WithMetricsNamespace.
+const defaultMetricsNamespace = "batterdb"
+
+// metrics are the custom Prometheus collectors of a service.
+type metrics struct {
+	// stackOperations counts stack operations by type (push, pop, peek,
+	// flush, consume) and outcome (ok, error), whether they came from their
+	// own route or a batch.
+	stackOperations *prometheus.CounterVec
+	// webhookEvents counts push webhook events by outcome (delivered,
+	// dropped).
+	webhookEvents *prometheus.CounterVec
+	// databases and stacks are the current number of databases and stacks,
+	// set on each scrape, see Service.metricsHandler.
+	databases prometheus.Gauge
+	stacks    prometheus.Gauge
+}
+
+// newMetrics registers the custom metrics with the default registerer, named
+// `<namespace>_<subsystem>_<name>`. Services sharing a namespace and
+// subsystem share the collectors.
+func newMetrics(namespace, subsystem string) *metrics {
+	return &metrics{
+		stackOperations: registerCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "stack_operations_total",
+			Help:      "The number of stack operations by type and outcome.",
+		}, "type", "outcome"),
+		webhookEvents: registerCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "webhook_events_total",
+			Help:      "The number of push webhook events by outcome.",
+		}, "outcome"),
+		databases: registerGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "databases",
+			Help:      "The number of databases.",
+		}),
+		stacks: registerGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "stacks",
+			Help:      "The number of stacks across every database.",
+		}),
+	}
+}
+
+// registerCounterVec registers a counter, or returns the identical one that
+// is already registered.
+func registerCounterVec(opts prometheus.CounterOpts, labels ...string) *prometheus.CounterVec {
+	c := prometheus.NewCounterVec(opts, labels)
+	if err := prometheus.Register(c); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if errors.As(err, &are) {
+			if existing, ok := are.ExistingCollector.(*prometheus.CounterVec); ok {
+				return existing
+			}
+		}
+		slog.Error("Failed to register metric",
+			slog.String("name", prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name)),
+			slog.String("error", err.Error()))
+	}
+
+	return c
+}
+
+// registerGauge registers a gauge, or returns the identical one that is
+// already registered.
+func registerGauge(opts prometheus.GaugeOpts) prometheus.Gauge {
+	g := prometheus.NewGauge(opts)
+	if err := prometheus.Register(g); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if errors.As(err, &are) {
+			if existing, ok := are.ExistingCollector.(prometheus.Gauge); ok {
+				return existing
+			}
+		}
+		slog.Error("Failed to register metric",
+			slog.String("name", prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name)),
+			slog.String("error", err.Error()))
+	}
+
+	return g
+}
+
+func (m *metrics) observeOperation(op string, ok bool) {
+	outcome := "ok"
+	if !ok {
+		outcome = "error"
+	}
+	m.stackOperations.WithLabelValues(op, outcome).Inc()
+}
+
+func (m *metrics) observeWebhookEvent(delivered bool) {
+	outcome := "delivered"
+	if !delivered {
+		outcome = "dropped"
+	}
+	m.webhookEvents.WithLabelValues(outcome).Inc()
+}
+
+// counted wraps the handler of a single stack operation to count it in the
+// stack operations metric.
+func counted[I, O any](m *metrics, op string, h func(context.Context, *I) (*O, error)) func(context.Context, *I) (*O, error) {
+	return func(ctx context.Context, input *I) (*O, error) {
+		out, err := h(ctx, input)
+		m.observeOperation(op, err == nil)
+		return out, err
+	}
+}
+
+// metricsHandler serves the Prometheus metrics, setting the size gauges from
+// the repository first so they are current.
+func (s *Service) metricsHandler() http.Handler {
+	h := promhttp.Handler()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stacks := 0
+		for _, db := range s.Repository.SortDatabases() {
+			stacks += db.Len()
+		}
+		s.metrics.databases.Set(float64(s.Repository.Len()))
+		s.metrics.stacks.Set(float64(stacks))
+		h.ServeHTTP(w, r)
+	})
+}
+
+type (
+	MetricsOutput struct {
+		Body MetricsBody
+	}
+	MetricsBody struct {
+		StackOperations map[string]map[string]float64 `doc:"stack operations by type and outcome"   json:"stack_operations"`
+		WebhookEvents   map[string]float64            `doc:"push webhook events by outcome"         json:"webhook_events"`
+		Databases       int                           `doc:"number of databases"                    json:"databases"`
+		Stacks          int                           `doc:"number of stacks"                       json:"stacks"`
+		Elements        int                           `doc:"number of elements across every stack" json:"elements"`
+	}
+)
+
+// MetricsHandler shows the custom metrics as JSON, for clients that can't
+// scrape `/metrics`. The counters are read from the Prometheus collectors, so
+// they match `/metrics`, and the sizes are counted from the repository.
+func (s *Service) MetricsHandler(_ context.Context, _ *struct{}) (*MetricsOutput, error) {
+	out := new(MetricsOutput)
+	out.Body.StackOperations = make(map[string]map[string]float64)
+	for _, c := range collectCounters(s.metrics.stackOperations) {
+		op := c.labels["type"]
+		if out.Body.StackOperations[op] == nil {
+			out.Body.StackOperations[op] = make(map[string]float64)
+		}
+		out.Body.StackOperations[op][c.labels["outcome"]] = c.value
+	}
+	out.Body.WebhookEvents = make(map[string]float64)
+	for _, c := range collectCounters(s.metrics.webhookEvents) {
+		out.Body.WebhookEvents[c.labels["outcome"]] = c.value
+	}
+	for _, db := range s.Repository.SortDatabases() {
+		out.Body.Databases++
+		for _, stack := range db.SortStacks() {
+			out.Body.Stacks++
+			out.Body.Elements += stack.Size()
+		}
+	}
+
+	return out, nil
+}
+
+// counterValue is the value of a counter with its labels.
+type counterValue struct {
+	labels map[string]string
+	value  float64
+}
+
+// collectCounters reads the counters of the collector, the same values that
+// are exported on `/metrics`.
+func collectCounters(c prometheus.Collector) []counterValue {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		c.Collect(ch)
+		close(ch)
+	}()
+	var values []counterValue
+	for m := range ch {
+		var pb dto.Metric
+		if err := m.Write(&pb); err != nil {
+			continue
+		}
+		labels := make(map[string]string, len(pb.GetLabel()))
+		for _, l := range pb.GetLabel() {
+			labels[l.GetName()] = l.GetValue()
+		}
+		values = append(values, counterValue{labels: labels, value: pb.GetCounter().GetValue()})
+	}
+
+	return values
+}
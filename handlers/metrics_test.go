@@ -0,0 +1,158 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2/humatest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jh125486/batterdb/handlers"
+)
+
+func TestService_MetricsNamespace(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		opts []handlers.Option
+		want string
+	}{
+		{
+			name: "namespace",
+			opts: []handlers.Option{handlers.WithMetricsNamespace("ns_only")},
+			want: "ns_only_stack_operations_total",
+		},
+		{
+			name: "namespace and subsystem",
+			opts: []handlers.Option{handlers.WithMetricsNamespace("ns"), handlers.WithMetricsSubsystem("stacks")},
+			want: "ns_stacks_stack_operations_total",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, api := humatest.New(t)
+			svc := handlers.New(tt.opts...)
+			svc.AddRoutes(api)
+			db, err := svc.Repository.New("dbName123")
+			require.NoError(t, err)
+			_, err = db.New("stackName123")
+			require.NoError(t, err)
+			before := operationCount(t, tt.want, "push", "ok")
+
+			resp := api.Put("/databases/dbName123/stacks/stackName123", map[string]any{"element": 1})
+			require.Equal(t, http.StatusOK, resp.Code)
+			assert.Equal(t, 1.0, operationCount(t, tt.want, "push", "ok")-before)
+		})
+	}
+}
+
+func TestService_MetricsHandler(t *testing.T) {
+	t.Parallel()
+	_, api := humatest.New(t)
+	// a namespace of its own, so other tests don't change the counters.
+	svc := handlers.New(handlers.WithMetricsNamespace("metrics_json"))
+	svc.AddRoutes(api)
+	db, err := svc.Repository.New("dbName123")
+	require.NoError(t, err)
+	for _, name := range []string{"stackName123", "stackName456"} {
+		_, err = db.New(name)
+		require.NoError(t, err)
+	}
+	require.Equal(t, http.StatusOK, api.Put("/databases/dbName123/stacks/stackName123", map[string]any{"element": 1}).Code)
+	require.Equal(t, http.StatusOK, api.Put("/databases/dbName123/stacks/stackName123", map[string]any{"element": 2}).Code)
+	require.Equal(t, http.StatusOK, api.Delete("/databases/dbName123/stacks/stackName123").Code)
+
+	resp := api.Get("/_metrics.json")
+	require.Equal(t, http.StatusOK, resp.Code)
+	var got handlers.MetricsBody
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &got))
+	assert.Equal(t, 1, got.Databases)
+	assert.Equal(t, 2, got.Stacks)
+	assert.Equal(t, 1, got.Elements)
+	name := "metrics_json_stack_operations_total"
+	assert.Equal(t, operationCount(t, name, "push", "ok"), got.StackOperations["push"]["ok"], "must match /metrics")
+	assert.Equal(t, operationCount(t, name, "pop", "ok"), got.StackOperations["pop"]["ok"], "must match /metrics")
+	assert.Equal(t, 2.0, got.StackOperations["push"]["ok"])
+	assert.NotNil(t, got.WebhookEvents)
+}
+
+func TestService_PrometheusMetrics(t *testing.T) {
+	t.Parallel()
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		t.Fatal("can't read build info")
+	}
+	// a namespace of its own, so other tests don't change the metrics.
+	svc := handlers.New(
+		handlers.WithPort(0),
+		handlers.WithBuildInfo(info),
+		handlers.WithMetricsNamespace("scrape"),
+	)
+	go func() {
+		assert.NoError(t, svc.Start())
+	}()
+	t.Cleanup(func() {
+		assert.NoError(t, svc.Shutdown(context.Background()))
+	})
+	require.Eventually(t, func() bool {
+		return svc.Port() != 0
+	}, time.Second, 10*time.Millisecond)
+	for _, name := range []string{"dbName123", "dbName456"} {
+		_, err := svc.Repository.New(name)
+		require.NoError(t, err)
+	}
+	db, err := svc.Repository.Database("dbName123")
+	require.NoError(t, err)
+	for _, name := range []string{"stackName123", "stackName456", "stackName789"} {
+		_, err = db.New(name)
+		require.NoError(t, err)
+	}
+
+	base := "http://localhost:" + strconv.Itoa(int(svc.Port()))
+	stack := base + "/databases/dbName123/stacks/stackName123"
+	do := func(method, url, body string) {
+		t.Helper()
+		req, err := http.NewRequest(method, url, strings.NewReader(body))
+		require.NoError(t, err)
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+	}
+	do(http.MethodPut, stack, `{"element": 1}`)
+	do(http.MethodPut, stack, `{"element": 2}`)
+	do(http.MethodGet, stack+"/peek", "")
+	do(http.MethodDelete, stack, "")
+	do(http.MethodDelete, stack+"/flush", "")
+	do(http.MethodDelete, base+"/databases/dbName123/stacks/unknown123", "")
+
+	resp, err := http.Get(base + "/metrics")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	body := string(b)
+	for _, want := range []string{
+		`scrape_stack_operations_total{outcome="ok",type="push"} 2`,
+		`scrape_stack_operations_total{outcome="ok",type="peek"} 1`,
+		`scrape_stack_operations_total{outcome="ok",type="pop"} 1`,
+		`scrape_stack_operations_total{outcome="ok",type="flush"} 1`,
+		`scrape_stack_operations_total{outcome="error",type="pop"} 1`,
+		"scrape_databases 2",
+		"scrape_stacks 3",
+	} {
+		assert.Contains(t, body, want)
+	}
+}
@@ -1,13 +1,37 @@
 package handlers
 
 import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
 	"fmt"
+	"io"
 	"log/slog"
+	"math/rand/v2"
+	"mime"
+	"net"
 	"net/http"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
 )
 
+// maxLoggedBodyBytes caps the request and response bodies logged at debug level.
+const maxLoggedBodyBytes = 1024
+
+// redactedHeaders are never logged.
+var redactedHeaders = []string{"Authorization", "X-API-Key", "Cookie"}
+
 type loggingResponseWriter struct {
 	http.ResponseWriter
+	// body captures the start of the response when debug logging.
+	body       *bytes.Buffer
 	StatusCode int
 }
 
@@ -20,10 +44,38 @@ func (lrw *loggingResponseWriter) Write(b []byte) (int, error) {
 	if lrw.StatusCode == 0 {
 		lrw.StatusCode = http.StatusOK
 	}
+	if lrw.body != nil {
+		if n := maxLoggedBodyBytes - lrw.body.Len(); n > 0 {
+			lrw.body.Write(b[:min(n, len(b))])
+		}
+	}
 	return lrw.ResponseWriter.Write(b)
 }
 
+// Flush passes flushes through, so streamed responses aren't buffered.
+func (lrw *loggingResponseWriter) Flush() {
+	if f, ok := lrw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the wrapped writer for http.ResponseController.
+func (lrw *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return lrw.ResponseWriter
+}
+
 func LoggingHandler(h http.Handler) http.Handler {
+	return logRequests(h, nil, 1)
+}
+
+// LoggingHandler is like the LoggingHandler func, redacting the keys of
+// WithLogRedaction from the logged bodies and only logging the fraction of
+// successful requests set by WithLogSampling.
+func (s *Service) LoggingHandler(h http.Handler) http.Handler {
+	return logRequests(h, s.logRedaction, s.logSampling)
+}
+
+func logRequests(h http.Handler, redactKeys []string, sampleRate float64) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Check if this is a WebSocket upgrade request.
 		if upgrade := r.Header.Get("Upgrade"); upgrade == "websocket" {
@@ -34,7 +86,405 @@ func LoggingHandler(h http.Handler) http.Handler {
 
 		// If it's not a WebSocket upgrade request, proceed with the logging as usual.
 		lrw := &loggingResponseWriter{ResponseWriter: w}
+		debug := slog.Default().Enabled(r.Context(), slog.LevelDebug)
+		var reqBody []byte
+		if debug {
+			reqBody = peekBody(r)
+			lrw.body = new(bytes.Buffer)
+		}
 		h.ServeHTTP(lrw, r)
+		if !sampled(lrw.StatusCode, sampleRate) {
+			return
+		}
 		slog.Info(fmt.Sprintf("%s %v %d", r.Method, r.URL.Path, lrw.StatusCode))
+		if debug {
+			slog.Debug("Request details",
+				slog.Any("headers", redactHeaders(r.Header)),
+				slog.String("request_body", redactBody(reqBody, redactKeys)),
+				slog.String("response_body", redactBody(lrw.body.Bytes(), redactKeys)),
+			)
+		}
+	})
+}
+
+// sampled reports whether a request answered with status is logged. Requests
+// that didn't succeed are always logged, successful ones with probability rate.
+func sampled(status int, rate float64) bool {
+	if rate >= 1 || status < http.StatusOK || status >= http.StatusMultipleChoices {
+		return true
+	}
+
+	return rand.Float64() < rate //nolint:gosec // sampling doesn't need a secure source.
+}
+
+// peekBody returns up to maxLoggedBodyBytes of the request body, leaving the
+// full body readable by the handler.
+func peekBody(r *http.Request) []byte {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil
+	}
+	b, _ := io.ReadAll(io.LimitReader(r.Body, maxLoggedBodyBytes))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(b), r.Body), r.Body}
+
+	return b
+}
+
+func redactHeaders(h http.Header) http.Header {
+	h = h.Clone()
+	for _, k := range redactedHeaders {
+		if h.Get(k) != "" {
+			h.Set(k, "REDACTED")
+		}
+	}
+
+	return h
+}
+
+// redactBody redacts the keys from a JSON body, its element and elements, and
+// the elements of its batch operations. A body that can't be parsed is
+// redacted as a whole, as it may be truncated.
+func redactBody(b []byte, keys []string) string {
+	if len(keys) == 0 || len(b) == 0 {
+		return string(b)
+	}
+	var v any
+	if err := json.Unmarshal(b, &v); err != nil {
+		return "REDACTED"
+	}
+	body, ok := v.(map[string]any)
+	if !ok {
+		return string(b)
+	}
+	redactElement(body, keys)
+	if ops, ok := body["operations"].([]any); ok {
+		for _, op := range ops {
+			if op, ok := op.(map[string]any); ok {
+				redactElement(op, keys)
+			}
+		}
+	}
+	redacted, err := json.Marshal(body)
+	if err != nil {
+		return "REDACTED"
+	}
+
+	return string(redacted)
+}
+
+// redactElement redacts the keys from m and from the objects of its element
+// and elements fields.
+func redactElement(m map[string]any, keys []string) {
+	redactKeys(m, keys)
+	if element, ok := m["element"].(map[string]any); ok {
+		redactKeys(element, keys)
+	}
+	if elements, ok := m["elements"].([]any); ok {
+		for _, element := range elements {
+			if element, ok := element.(map[string]any); ok {
+				redactKeys(element, keys)
+			}
+		}
+	}
+}
+
+func redactKeys(m map[string]any, keys []string) {
+	for _, k := range keys {
+		if _, ok := m[k]; ok {
+			m[k] = "REDACTED"
+		}
+	}
+}
+
+// TimeoutHandler cancels the context of requests after a timeout, in
+// milliseconds, so handlers waiting on it give up.
+//
+// The timeout is taken in order of precedence from the `timeout` query
+// parameter, the `X-Request-Timeout` header, and WithDefaultTimeout. An
+// explicit timeout of 0 means no timeout, even with a default.
+func (s *Service) TimeoutHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timeout := s.defaultTimeout
+		if v := cmp.Or(r.URL.Query().Get("timeout"), r.Header.Get("X-Request-Timeout")); v != "" {
+			ms, err := strconv.Atoi(v)
+			if err != nil || ms < 0 {
+				http.Error(w, "timeout must be a non-negative number of milliseconds", http.StatusBadRequest)
+				return
+			}
+			timeout = time.Duration(ms) * time.Millisecond
+		}
+		if timeout <= 0 {
+			h.ServeHTTP(w, r)
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// publicPaths are served without authentication, so health checks and the
+// docs work without the token. Paths starting with `/openapi` are public too.
+var publicPaths = []string{"/_ping", "/_status", "/docs"}
+
+// AuthMiddleware answers requests without the bearer token of WithAuthToken in
+// their `Authorization` header with 401 Unauthorized, except for the public
+// paths. Without a token it's a no-op.
+func (s *Service) AuthMiddleware(h http.Handler) http.Handler {
+	if s.authToken == "" {
+		return h
+	}
+	token := []byte(s.authToken)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if slices.Contains(publicPaths, r.URL.Path) || strings.HasPrefix(r.URL.Path, "/openapi") {
+			h.ServeHTTP(w, r)
+			return
+		}
+		scheme, got, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+		if !strings.EqualFold(scheme, "Bearer") || subtle.ConstantTimeCompare([]byte(got), token) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "missing or invalid bearer token", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// headResponseWriter discards the body of a response, counting its length.
+type headResponseWriter struct {
+	http.ResponseWriter
+	status int
+	length int
+}
+
+func (w *headResponseWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+}
+
+func (w *headResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.length += len(b)
+
+	return len(b), nil
+}
+
+// Flush does nothing: there is no body to send, and the headers are written
+// once the length is known.
+func (*headResponseWriter) Flush() {}
+
+// Unwrap returns the wrapped writer for http.ResponseController.
+func (w *headResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// HeadHandler answers HEAD requests with the status and headers of the GET
+// response for the same resource, but without a body, so existence checks
+// don't have to transfer it.
+func HeadHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		r = r.Clone(r.Context())
+		r.Method = http.MethodGet
+		hw := &headResponseWriter{ResponseWriter: w}
+		h.ServeHTTP(hw, r)
+		status := cmp.Or(hw.status, http.StatusOK)
+		if w.Header().Get("Content-Length") == "" && status != http.StatusNoContent && status != http.StatusNotModified {
+			w.Header().Set("Content-Length", strconv.Itoa(hw.length))
+		}
+		w.WriteHeader(status)
+	})
+}
+
+// DrainHandler answers requests with 503 Service Unavailable and a
+// `Retry-After` header once Shutdown has started. Requests already in flight
+// complete normally.
+func (s *Service) DrainHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.draining.Load() {
+			w.Header().Set("Connection", "close")
+			w.Header().Set("Retry-After", strconv.Itoa(max(int(s.drainWindow.Seconds()), 1)))
+			http.Error(w, "server is shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// ContentTypeHandler rejects mutating requests with a body whose
+// `Content-Type` is missing or not one of the formats of the API with 415
+// Unsupported Media Type, listing the supported types. Requests without a body
+// pass through.
+func (s *Service) ContentTypeHandler(h http.Handler) http.Handler {
+	formats := s.config().Formats
+	var supported []string
+	for ct := range formats {
+		if strings.Contains(ct, "/") {
+			supported = append(supported, ct)
+		}
+	}
+	slices.Sort(supported)
+	msg := "must be one of: " + strings.Join(supported, ", ")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !mutating(r.Method) || r.ContentLength == 0 {
+			h.ServeHTTP(w, r)
+			return
+		}
+		ct := r.Header.Get("Content-Type")
+		if ct == "" {
+			http.Error(w, "missing Content-Type, "+msg, http.StatusUnsupportedMediaType)
+			return
+		}
+		mediaType, _, err := mime.ParseMediaType(ct)
+		if _, ok := formats[formatKey(mediaType)]; err != nil || !ok {
+			http.Error(w, fmt.Sprintf("unsupported Content-Type %q, %s", ct, msg), http.StatusUnsupportedMediaType)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// formatKey returns the key of the format of a media type like huma does, so
+// a structured suffix like `application/merge-patch+json` selects `json`.
+func formatKey(mediaType string) string {
+	if _, suffix, ok := strings.Cut(mediaType, "+"); ok {
+		return suffix
+	}
+
+	return mediaType
+}
+
+func mutating(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+type clientIPKey struct{}
+
+// ClientIP returns the IP of the client that made the request. Behind trusted
+// proxies (WithTrustedProxies) it is resolved from `X-Forwarded-For`,
+// otherwise it is the host of the request's RemoteAddr.
+func ClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey{}).(string); ok {
+		return ip
+	}
+
+	return remoteIP(r)
+}
+
+// ClientIPHandler resolves the client IP of each request for ClientIP.
+//
+// `X-Forwarded-For` is only used when the direct peer is a trusted proxy. The
+// header is walked from right to left, skipping trusted proxies, and the
+// first untrusted address is the client; a client can prepend anything to the
+// header, so only addresses appended by trusted proxies are believed.
+func (s *Service) ClientIPHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := remoteIP(r)
+		if s.trustedProxy(ip) {
+			ip = s.forwardedFor(r, ip)
+		}
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientIPKey{}, ip)))
 	})
 }
+
+func (s *Service) forwardedFor(r *http.Request, peer string) string {
+	var hops []string
+	for _, v := range r.Header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(v, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	ip := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		if _, err := netip.ParseAddr(hops[i]); err != nil {
+			// garbage can't be trusted, stop at the last good address.
+			break
+		}
+		ip = hops[i]
+		if !s.trustedProxy(ip) {
+			break
+		}
+	}
+
+	return ip
+}
+
+func (s *Service) trustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range s.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// FormatMiddleware applies the per-operation and per-tag default formats to
+// requests without an `Accept` header.
+func (s *Service) FormatMiddleware(ctx huma.Context, next func(huma.Context)) {
+	if ctx.Header("Accept") != "" {
+		next(ctx)
+		return
+	}
+	op := ctx.Operation()
+	if ct, ok := s.opFormats[op.OperationID]; ok {
+		next(&acceptContext{humaContext: ctx, accept: ct})
+		return
+	}
+	for _, tag := range op.Tags {
+		if ct, ok := s.tagFormats[tag]; ok {
+			next(&acceptContext{humaContext: ctx, accept: ct})
+			return
+		}
+	}
+	next(ctx)
+}
+
+type (
+	// humaContext aliases huma.Context so it can be embedded without its
+	// field name clashing with the Context method.
+	humaContext = huma.Context
+	// acceptContext overrides the `Accept` header of the wrapped context.
+	acceptContext struct {
+		humaContext
+		accept string
+	}
+)
+
+func (c *acceptContext) Header(name string) string {
+	if strings.EqualFold(name, "Accept") {
+		return c.accept
+	}
+
+	return c.humaContext.Header(name)
+}
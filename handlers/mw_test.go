@@ -1,16 +1,24 @@
 package handlers_test
 
 import (
+	"bufio"
 	"context"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"runtime/debug"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/danielgtaylor/huma/v2/humatest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/jh125486/batterdb/formats/yaml"
 	"github.com/jh125486/batterdb/handlers"
 )
 
@@ -88,3 +96,525 @@ func TestLoggingHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestLoggingHandler_Debug(t *testing.T) {
+	// Not parallel: swaps the default logger.
+	var logs strings.Builder
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	body := strings.Repeat("x", 2000)
+	req, err := http.NewRequestWithContext(context.TODO(), http.MethodPost, "/", strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer secret")
+	rr := httptest.NewRecorder()
+	handlers.LoggingHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, body, string(b), "handler must still see the full body")
+		_, _ = w.Write([]byte("pong"))
+	})).ServeHTTP(rr, req)
+
+	assert.Equal(t, "pong", rr.Body.String())
+	assert.Contains(t, logs.String(), "response_body=pong")
+	assert.Contains(t, logs.String(), "request_body="+strings.Repeat("x", 1024)+" ")
+	assert.NotContains(t, logs.String(), "secret")
+	assert.Contains(t, logs.String(), "REDACTED")
+}
+
+func TestService_LoggingHandler_Redaction(t *testing.T) {
+	// Not parallel: swaps the default logger.
+	tests := []struct {
+		name        string
+		body        string
+		wantLogged  string
+		wantRemoved string
+	}{
+		{
+			name:        "element",
+			body:        `{"element":{"password":"hunter2","user":"alice"}}`,
+			wantLogged:  `"user\":\"alice\"`,
+			wantRemoved: "hunter2",
+		},
+		{
+			name:        "elements",
+			body:        `{"elements":[{"password":"hunter2"},"plain"]}`,
+			wantLogged:  "plain",
+			wantRemoved: "hunter2",
+		},
+		{
+			name:        "batch",
+			body:        `{"operations":[{"op":"push","stack":"s","element":{"password":"hunter2"}}]}`,
+			wantLogged:  "push",
+			wantRemoved: "hunter2",
+		},
+		{
+			name:        "unparseable",
+			body:        `{"element":{"password":"hunter2"`,
+			wantLogged:  "request_body=REDACTED",
+			wantRemoved: "hunter2",
+		},
+		{
+			name:       "not an object",
+			body:       `"password"`,
+			wantLogged: "password",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs strings.Builder
+			prev := slog.Default()
+			slog.SetDefault(slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})))
+			t.Cleanup(func() { slog.SetDefault(prev) })
+
+			svc := handlers.New(handlers.WithLogRedaction([]string{"password"}))
+			req, err := http.NewRequestWithContext(context.TODO(), http.MethodPost, "/", strings.NewReader(tt.body))
+			require.NoError(t, err)
+			req.Header.Set("X-API-Key", "secret")
+			rr := httptest.NewRecorder()
+			svc.LoggingHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, err := io.ReadAll(r.Body)
+				assert.NoError(t, err)
+				assert.Equal(t, tt.body, string(b), "handler must see the unredacted body")
+				_, _ = w.Write(b)
+			})).ServeHTTP(rr, req)
+
+			assert.Contains(t, logs.String(), tt.wantLogged)
+			if tt.wantRemoved != "" {
+				assert.NotContains(t, logs.String(), tt.wantRemoved)
+			}
+			assert.NotContains(t, logs.String(), "secret")
+		})
+	}
+}
+
+func TestService_LoggingHandler_Sampling(t *testing.T) {
+	// Not parallel: swaps the default logger.
+	tests := []struct {
+		name       string
+		rate       float64
+		status     int
+		wantLogged bool
+	}{
+		{name: "default", rate: 1, status: http.StatusOK, wantLogged: true},
+		{name: "sampled out", rate: 0, status: http.StatusOK, wantLogged: false},
+		{name: "client error", rate: 0, status: http.StatusNotFound, wantLogged: true},
+		{name: "server error", rate: 0, status: http.StatusInternalServerError, wantLogged: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs strings.Builder
+			prev := slog.Default()
+			slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+			t.Cleanup(func() { slog.SetDefault(prev) })
+
+			svc := handlers.New(handlers.WithLogSampling(tt.rate))
+			req, err := http.NewRequestWithContext(context.TODO(), http.MethodGet, "/sampled", http.NoBody)
+			require.NoError(t, err)
+			svc.LoggingHandler(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(tt.status)
+			})).ServeHTTP(httptest.NewRecorder(), req)
+
+			assert.Equal(t, tt.wantLogged, strings.Contains(logs.String(), "GET /sampled"))
+		})
+	}
+}
+
+func TestService_AuthMiddleware(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		token      string
+		path       string
+		auth       string
+		wantStatus int
+	}{
+		{name: "no token configured", path: "/databases", wantStatus: http.StatusOK},
+		{name: "missing header", token: "secret", path: "/databases", wantStatus: http.StatusUnauthorized},
+		{name: "wrong token", token: "secret", path: "/databases", auth: "Bearer wrong", wantStatus: http.StatusUnauthorized},
+		{name: "wrong scheme", token: "secret", path: "/databases", auth: "Basic secret", wantStatus: http.StatusUnauthorized},
+		{name: "correct token", token: "secret", path: "/databases", auth: "Bearer secret", wantStatus: http.StatusOK},
+		{name: "case insensitive scheme", token: "secret", path: "/databases", auth: "bearer secret", wantStatus: http.StatusOK},
+		{name: "ping", token: "secret", path: "/_ping", wantStatus: http.StatusOK},
+		{name: "status", token: "secret", path: "/_status", wantStatus: http.StatusOK},
+		{name: "docs", token: "secret", path: "/docs", wantStatus: http.StatusOK},
+		{name: "openapi", token: "secret", path: "/openapi.yaml", wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			svc := handlers.New(handlers.WithAuthToken(tt.token))
+			req, err := http.NewRequestWithContext(context.TODO(), http.MethodGet, tt.path, http.NoBody)
+			require.NoError(t, err)
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			rr := httptest.NewRecorder()
+			svc.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})).ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.wantStatus, rr.Code)
+			if tt.wantStatus == http.StatusUnauthorized {
+				assert.Equal(t, "Bearer", rr.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestHeadHandler(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		method     string
+		status     int
+		body       string
+		wantStatus int
+		wantBody   string
+		wantLength string
+		flush      bool
+	}{
+		{name: "head", method: http.MethodHead, status: http.StatusOK, body: "hello", wantStatus: http.StatusOK, wantLength: "5"},
+		{name: "head not found", method: http.MethodHead, status: http.StatusNotFound, body: "not found", wantStatus: http.StatusNotFound, wantLength: "9"},
+		{name: "head no content", method: http.MethodHead, status: http.StatusNoContent, wantStatus: http.StatusNoContent},
+		{name: "head flushed", method: http.MethodHead, status: http.StatusNotFound, body: "not found", wantStatus: http.StatusNotFound, wantLength: "9", flush: true},
+		{name: "get", method: http.MethodGet, status: http.StatusOK, body: "hello", wantStatus: http.StatusOK, wantBody: "hello"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			rr := httptest.NewRecorder()
+			handlers.HeadHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, http.MethodGet, r.Method)
+				w.Header().Set("X-Test", "value")
+				if tt.flush {
+					// a flush doesn't send the headers before the length is known.
+					require.NoError(t, http.NewResponseController(w).Flush())
+				}
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			})).ServeHTTP(rr, httptest.NewRequest(tt.method, "/", http.NoBody))
+			assert.Equal(t, tt.wantStatus, rr.Code)
+			assert.Equal(t, tt.wantBody, rr.Body.String())
+			assert.Equal(t, "value", rr.Header().Get("X-Test"))
+			if tt.method == http.MethodHead {
+				assert.Equal(t, tt.wantLength, rr.Header().Get("Content-Length"))
+			}
+		})
+	}
+}
+
+func TestService_Flush(t *testing.T) {
+	t.Parallel()
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		t.Fatal("can't read build info")
+	}
+	svc := handlers.New(
+		handlers.WithPort(0),
+		handlers.WithBuildInfo(info),
+		handlers.WithResponseCache(time.Minute),
+	)
+	release := make(chan struct{})
+	svc.Handle("GET /custom/stream", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("first\n"))
+		assert.NoError(t, http.NewResponseController(w).Flush())
+		<-release
+		_, _ = w.Write([]byte("second\n"))
+	}))
+	go func() {
+		assert.NoError(t, svc.Start())
+	}()
+	t.Cleanup(func() {
+		assert.NoError(t, svc.Shutdown(context.Background()))
+	})
+	require.Eventually(t, func() bool {
+		return svc.Port() != 0
+	}, time.Second, 10*time.Millisecond)
+	client := &http.Client{Transport: new(http.Transport), Timeout: 5 * time.Second}
+	t.Cleanup(client.CloseIdleConnections)
+
+	resp, err := client.Get("http://localhost:" + strconv.Itoa(int(svc.Port())) + "/custom/stream")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	// the first line arrives while the handler is still running.
+	r := bufio.NewReader(resp.Body)
+	line, err := r.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "first\n", line)
+	close(release)
+	rest, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "second\n", string(rest))
+}
+
+func TestService_ContentTypeHandler(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name        string
+		method      string
+		contentType string
+		body        string
+		wantStatus  int
+	}{
+		{name: "json", method: http.MethodPost, contentType: "application/json", body: "{}", wantStatus: http.StatusOK},
+		{name: "json charset", method: http.MethodPut, contentType: "application/json; charset=utf-8", body: "{}", wantStatus: http.StatusOK},
+		{name: "structured suffix", method: http.MethodPatch, contentType: "application/merge-patch+json", body: "{}", wantStatus: http.StatusOK},
+		{name: "yaml", method: http.MethodPost, contentType: "application/yaml", body: "a: 1", wantStatus: http.StatusOK},
+		{name: "missing", method: http.MethodPost, body: "{}", wantStatus: http.StatusUnsupportedMediaType},
+		{name: "unsupported", method: http.MethodPost, contentType: "text/xml", body: "<a/>", wantStatus: http.StatusUnsupportedMediaType},
+		{name: "malformed", method: http.MethodPost, contentType: "application/", body: "{}", wantStatus: http.StatusUnsupportedMediaType},
+		{name: "bodyless", method: http.MethodPost, wantStatus: http.StatusOK},
+		{name: "not mutating", method: http.MethodGet, contentType: "text/xml", body: "<a/>", wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			svc := handlers.New(handlers.WithStrictContentType())
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(tt.method, "/", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			svc.ContentTypeHandler(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})).ServeHTTP(rr, req)
+			assert.Equal(t, tt.wantStatus, rr.Code)
+			if tt.wantStatus == http.StatusUnsupportedMediaType {
+				assert.Contains(t, rr.Body.String(), "application/json")
+			}
+		})
+	}
+}
+
+func TestService_TimeoutHandler(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		opts       []handlers.Option
+		query      string
+		header     string
+		wantStatus int
+		want       time.Duration
+	}{
+		{name: "none", wantStatus: http.StatusOK},
+		{name: "default", opts: []handlers.Option{handlers.WithDefaultTimeout(time.Second)}, wantStatus: http.StatusOK, want: time.Second},
+		{name: "header", header: "2000", wantStatus: http.StatusOK, want: 2 * time.Second},
+		{
+			name:       "param over header",
+			query:      "3000",
+			header:     "2000",
+			wantStatus: http.StatusOK,
+			want:       3 * time.Second,
+		},
+		{
+			name:       "header over default",
+			opts:       []handlers.Option{handlers.WithDefaultTimeout(time.Second)},
+			header:     "2000",
+			wantStatus: http.StatusOK,
+			want:       2 * time.Second,
+		},
+		{
+			name:       "explicit zero over default",
+			opts:       []handlers.Option{handlers.WithDefaultTimeout(time.Second)},
+			query:      "0",
+			wantStatus: http.StatusOK,
+		},
+		{name: "invalid", query: "soon", wantStatus: http.StatusBadRequest},
+		{name: "negative", header: "-1", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			svc := handlers.New(tt.opts...)
+			target := "/"
+			if tt.query != "" {
+				target += "?timeout=" + tt.query
+			}
+			req := httptest.NewRequest(http.MethodGet, target, http.NoBody)
+			if tt.header != "" {
+				req.Header.Set("X-Request-Timeout", tt.header)
+			}
+
+			rr := httptest.NewRecorder()
+			start := time.Now()
+			svc.TimeoutHandler(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				deadline, ok := r.Context().Deadline()
+				if tt.want == 0 {
+					assert.False(t, ok)
+					return
+				}
+				require.True(t, ok)
+				assert.WithinDuration(t, start.Add(tt.want), deadline, 100*time.Millisecond)
+			})).ServeHTTP(rr, req)
+			assert.Equal(t, tt.wantStatus, rr.Code)
+		})
+	}
+}
+
+func TestService_ClientIPHandler(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		proxies    []string
+		remoteAddr string
+		xff        []string
+		want       string
+	}{
+		{
+			name:       "no proxies",
+			remoteAddr: "10.0.0.1:1234",
+			xff:        []string{"1.2.3.4"},
+			want:       "10.0.0.1",
+		},
+		{
+			name:       "untrusted peer",
+			proxies:    []string{"10.0.0.0/8"},
+			remoteAddr: "192.168.0.1:1234",
+			xff:        []string{"1.2.3.4"},
+			want:       "192.168.0.1",
+		},
+		{
+			name:       "trusted peer",
+			proxies:    []string{"10.0.0.0/8"},
+			remoteAddr: "10.0.0.1:1234",
+			xff:        []string{"1.2.3.4"},
+			want:       "1.2.3.4",
+		},
+		{
+			name:       "trusted peer single IP",
+			proxies:    []string{"10.0.0.1"},
+			remoteAddr: "10.0.0.1:1234",
+			xff:        []string{"1.2.3.4"},
+			want:       "1.2.3.4",
+		},
+		{
+			name:       "spoofed hop",
+			proxies:    []string{"10.0.0.0/8"},
+			remoteAddr: "10.0.0.1:1234",
+			xff:        []string{"6.6.6.6, 1.2.3.4"},
+			want:       "1.2.3.4",
+		},
+		{
+			name:       "chain of trusted proxies",
+			proxies:    []string{"10.0.0.0/8"},
+			remoteAddr: "10.0.0.1:1234",
+			xff:        []string{"1.2.3.4, 10.0.0.2", "10.0.0.3"},
+			want:       "1.2.3.4",
+		},
+		{
+			name:       "garbage hop",
+			proxies:    []string{"10.0.0.0/8"},
+			remoteAddr: "10.0.0.1:1234",
+			xff:        []string{"1.2.3.4, garbage"},
+			want:       "10.0.0.1",
+		},
+		{
+			name:       "trusted peer no header",
+			proxies:    []string{"10.0.0.0/8"},
+			remoteAddr: "10.0.0.1:1234",
+			want:       "10.0.0.1",
+		},
+		{
+			name:       "invalid proxy ignored",
+			proxies:    []string{"not-a-cidr"},
+			remoteAddr: "10.0.0.1:1234",
+			xff:        []string{"1.2.3.4"},
+			want:       "10.0.0.1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			svc := handlers.New(handlers.WithTrustedProxies(tt.proxies))
+			req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+			req.RemoteAddr = tt.remoteAddr
+			for _, v := range tt.xff {
+				req.Header.Add("X-Forwarded-For", v)
+			}
+
+			var got string
+			svc.ClientIPHandler(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				got = handlers.ClientIP(r)
+			})).ServeHTTP(httptest.NewRecorder(), req)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestService_FormatMiddleware(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		opts    []handlers.Option
+		headers []any
+		path    string
+		expBody string
+	}{
+		{
+			name:    "global default",
+			path:    "/databases/dbName123/stacks/stackName123/peek",
+			expBody: `{"element":"value"}`,
+		},
+		{
+			name:    "tag default",
+			opts:    []handlers.Option{handlers.WithTagFormat("Stack Operations", "application/yaml")},
+			path:    "/databases/dbName123/stacks/stackName123/peek",
+			expBody: "element: value\n",
+		},
+		{
+			name:    "tag default other tag",
+			opts:    []handlers.Option{handlers.WithTagFormat("Stacks", "application/yaml")},
+			path:    "/databases/dbName123/stacks/stackName123/peek",
+			expBody: `{"element":"value"}`,
+		},
+		{
+			name: "operation overrides tag",
+			opts: []handlers.Option{
+				handlers.WithTagFormat("Stack Operations", "application/yaml"),
+				handlers.WithOperationFormat("peek-stack", "application/json"),
+			},
+			path:    "/databases/dbName123/stacks/stackName123/peek",
+			expBody: `{"element":"value"}`,
+		},
+		{
+			name:    "accept header wins",
+			opts:    []handlers.Option{handlers.WithTagFormat("Stack Operations", "application/yaml")},
+			headers: []any{"Accept: application/json"},
+			path:    "/databases/dbName123/stacks/stackName123/peek",
+			expBody: `{"element":"value"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			// the default test config only has JSON.
+			_, api := humatest.New(t, huma.Config{
+				OpenAPI: &huma.OpenAPI{Info: &huma.Info{Title: "Test API", Version: "1.0.0"}},
+				Formats: map[string]huma.Format{
+					"application/json": huma.DefaultJSONFormat,
+					"application/yaml": yaml.DefaultYAMLFormat,
+				},
+				DefaultFormat: "application/json",
+			})
+			svc := handlers.New(tt.opts...)
+			svc.AddRoutes(api)
+			db, err := svc.Repository.New("dbName123")
+			require.NoError(t, err)
+			stack, err := db.New("stackName123")
+			require.NoError(t, err)
+			stack.Push("value")
+
+			resp := api.Do(http.MethodGet, tt.path, tt.headers...)
+			require.Equal(t, http.StatusOK, resp.Code)
+			if strings.HasPrefix(tt.expBody, "{") {
+				require.JSONEq(t, tt.expBody, resp.Body.String())
+				return
+			}
+			require.Equal(t, tt.expBody, resp.Body.String())
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/danielgtaylor/huma/v2"
+
+	"github.com/jh125486/batterdb/repository"
+)
+
+// schemaRegistry is required to validate against a schema. Element schemas
+// can't reference other schemas, so it stays empty.
+var schemaRegistry = huma.NewMapRegistry("#/components/schemas/", huma.DefaultSchemaNamer)
+
+type (
+	SetDatabaseSchemaInput struct {
+		Body map[string]any `doc:"JSON Schema the elements must match"`
+		URLParamDatabaseID
+	}
+	SetStackSchemaInput struct {
+		Body map[string]any `doc:"JSON Schema the elements must match"`
+		DatabaseStackInput
+	}
+	SchemaOutput struct {
+		Body struct {
+			ElementSchema map[string]any `json:"schema"`
+		}
+	}
+)
+
+// SetDatabaseSchemaHandler sets the JSON Schema that elements pushed to any
+// stack of a database must match, unless the stack sets its own.
+func (s *Service) SetDatabaseSchemaHandler(_ context.Context, input *SetDatabaseSchemaInput) (*SchemaOutput, error) {
+	db, err := s.database(input.DatabaseID)
+	if err != nil {
+		return nil, err
+	}
+	if db.IsCounter() {
+		return nil, huma.Error422UnprocessableEntity("can't set a schema on a counter database")
+	}
+	b, err := s.parseSchema(input.Body)
+	if err != nil {
+		return nil, err
+	}
+	db.SetSchema(b)
+
+	out := new(SchemaOutput)
+	out.Body.ElementSchema = input.Body
+
+	return out, nil
+}
+
+// DeleteDatabaseSchemaHandler removes the schema of a database.
+func (s *Service) DeleteDatabaseSchemaHandler(_ context.Context, input *SingleDatabaseInput) (*struct{}, error) {
+	db, err := s.database(input.DatabaseID)
+	if err != nil {
+		return nil, err
+	}
+	db.SetSchema(nil)
+
+	return nil, nil
+}
+
+// SetStackSchemaHandler sets the JSON Schema that elements pushed to a stack
+// must match, overriding the schema of its database.
+func (s *Service) SetStackSchemaHandler(_ context.Context, input *SetStackSchemaInput) (*SchemaOutput, error) {
+	db, stack, err := s.stack(input.DatabaseID, input.StackID)
+	if err != nil {
+		return nil, err
+	}
+	if db.IsCounter() {
+		return nil, huma.Error422UnprocessableEntity("can't set a schema on a counter")
+	}
+	b, err := s.parseSchema(input.Body)
+	if err != nil {
+		return nil, err
+	}
+	stack.SetSchema(b)
+
+	out := new(SchemaOutput)
+	out.Body.ElementSchema = input.Body
+
+	return out, nil
+}
+
+// DeleteStackSchemaHandler removes the schema of a stack, so the schema of its
+// database applies again.
+func (s *Service) DeleteStackSchemaHandler(_ context.Context, input *DatabaseStackInput) (*struct{}, error) {
+	_, stack, err := s.stack(input.DatabaseID, input.StackID)
+	if err != nil {
+		return nil, err
+	}
+	stack.SetSchema(nil)
+
+	return nil, nil
+}
+
+// parseSchema checks that the body is a usable schema and returns its JSON.
+func (s *Service) parseSchema(body map[string]any) ([]byte, error) {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, huma.Error422UnprocessableEntity("invalid schema", err)
+	}
+	if _, err := s.schema(b); err != nil {
+		return nil, huma.Error422UnprocessableEntity("invalid schema", err)
+	}
+
+	return b, nil
+}
+
+// schema returns the compiled schema of its JSON, compiling each distinct
+// schema only once.
+func (s *Service) schema(b []byte) (*huma.Schema, error) {
+	if schema, ok := s.schemas.Load(string(b)); ok {
+		return schema.(*huma.Schema), nil
+	}
+	schema := new(huma.Schema)
+	if err := json.Unmarshal(b, schema); err != nil {
+		return nil, err
+	}
+	if err := prepareSchema(schema); err != nil {
+		return nil, err
+	}
+	schema.PrecomputeMessages()
+	compiled, _ := s.schemas.LoadOrStore(string(b), schema)
+
+	return compiled.(*huma.Schema), nil
+}
+
+// prepareSchema checks the parts of a schema huma would panic on, and decodes
+// the schemas of additionalProperties, which JSON leaves as maps.
+func prepareSchema(schema *huma.Schema) error {
+	if schema.Discriminator != nil {
+		return errors.New("discriminator is not supported")
+	}
+	if schema.Pattern != "" {
+		if _, err := regexp.Compile(schema.Pattern); err != nil {
+			return fmt.Errorf("invalid pattern: %w", err)
+		}
+	}
+	if m, ok := schema.AdditionalProperties.(map[string]any); ok {
+		b, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		addl := new(huma.Schema)
+		if err := json.Unmarshal(b, addl); err != nil {
+			return err
+		}
+		if err := prepareSchema(addl); err != nil {
+			return err
+		}
+		// PrecomputeMessages doesn't descend into additionalProperties.
+		addl.PrecomputeMessages()
+		schema.AdditionalProperties = addl
+	}
+	for _, sub := range subschemas(schema) {
+		if err := prepareSchema(sub); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// subschemas returns the nested schemas of a schema, except those of
+// additionalProperties.
+func subschemas(schema *huma.Schema) []*huma.Schema {
+	var subs []*huma.Schema
+	if schema.Items != nil {
+		subs = append(subs, schema.Items)
+	}
+	if schema.Not != nil {
+		subs = append(subs, schema.Not)
+	}
+	for _, sub := range schema.Properties {
+		subs = append(subs, sub)
+	}
+	subs = append(subs, schema.OneOf...)
+	subs = append(subs, schema.AnyOf...)
+
+	return append(subs, schema.AllOf...)
+}
+
+// validateSchema fails with 422 Unprocessable Entity if the element doesn't
+// match the schema of the stack, see repository.Stack.ElementSchema.
+func (s *Service) validateSchema(stack *repository.Stack, element any) error {
+	b := stack.ElementSchema()
+	if b == nil {
+		return nil
+	}
+
+	return s.matchSchema(b, element)
+}
+
+// matchSchema fails with 422 Unprocessable Entity if the element doesn't match
+// the schema of its JSON.
+func (s *Service) matchSchema(b []byte, element any) error {
+	schema, err := s.schema(b)
+	if err != nil {
+		return huma.Error500InternalServerError("invalid schema", err)
+	}
+	res := new(huma.ValidateResult)
+	huma.Validate(schemaRegistry, schema, huma.NewPathBuffer([]byte("element"), 0), huma.ModeWriteToServer, element, res)
+	if len(res.Errors) > 0 {
+		return huma.Error422UnprocessableEntity("element does not match the schema", res.Errors...)
+	}
+
+	return nil
+}
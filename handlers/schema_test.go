@@ -0,0 +1,174 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2/humatest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/jh125486/batterdb/handlers"
+	"github.com/jh125486/batterdb/repository"
+	"github.com/jh125486/batterdb/rpc/pb"
+)
+
+func TestService_DatabaseSchema(t *testing.T) {
+	t.Parallel()
+	schema := map[string]any{
+		"type":     "object",
+		"required": []any{"name"},
+		"properties": map[string]any{
+			"name": map[string]any{"type": "string", "pattern": "^[a-z]+$"},
+			"age":  map[string]any{"type": "integer", "minimum": 0},
+		},
+		"additionalProperties": map[string]any{"type": "boolean"},
+	}
+	tests := []struct {
+		name          string
+		element       any
+		expStatusCode int
+	}{
+		{name: "match", element: map[string]any{"name": "bob", "age": 42}, expStatusCode: http.StatusOK},
+		{name: "additional property", element: map[string]any{"name": "bob", "admin": true}, expStatusCode: http.StatusOK},
+		{name: "missing required", element: map[string]any{"age": 42}, expStatusCode: http.StatusUnprocessableEntity},
+		{name: "wrong type", element: map[string]any{"name": "bob", "age": "old"}, expStatusCode: http.StatusUnprocessableEntity},
+		{name: "pattern mismatch", element: map[string]any{"name": "Bob"}, expStatusCode: http.StatusUnprocessableEntity},
+		{name: "minimum", element: map[string]any{"name": "bob", "age": -1}, expStatusCode: http.StatusUnprocessableEntity},
+		{name: "wrong additional property", element: map[string]any{"name": "bob", "admin": "yes"}, expStatusCode: http.StatusUnprocessableEntity},
+		{name: "not an object", element: "bob", expStatusCode: http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, api := humatest.New(t)
+			svc := handlers.New()
+			svc.AddRoutes(api)
+			db, err := svc.Repository.New("dbName123")
+			require.NoError(t, err)
+			_, err = db.New("stackName123")
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, api.Put("/databases/dbName123/schema", schema).Code)
+
+			resp := api.Put("/databases/dbName123/stacks/stackName123", map[string]any{"element": tt.element})
+			require.Equal(t, tt.expStatusCode, resp.Code, resp.Body.String())
+			bulk := api.Put("/databases/dbName123/stacks/stackName123/bulk", map[string]any{"elements": []any{tt.element}})
+			require.Equal(t, tt.expStatusCode, bulk.Code, bulk.Body.String())
+			create := api.Post("/databases/dbName123/stacks?name=otherStack123", map[string]any{"elements": []any{tt.element}})
+			if tt.expStatusCode == http.StatusOK {
+				require.Equal(t, http.StatusCreated, create.Code, create.Body.String())
+			} else {
+				require.Equal(t, tt.expStatusCode, create.Code, create.Body.String())
+			}
+		})
+	}
+}
+
+func TestService_StackSchema(t *testing.T) {
+	t.Parallel()
+	_, api := humatest.New(t)
+	svc := handlers.New()
+	svc.AddRoutes(api)
+	db, err := svc.Repository.New("dbName123")
+	require.NoError(t, err)
+	stack, err := db.New("stackName123")
+	require.NoError(t, err)
+
+	resp := api.Put("/databases/dbName123/schema", map[string]any{"type": "string"})
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.JSONEq(t, `{"schema": {"type": "string"}}`, resp.Body.String())
+	require.Equal(t, http.StatusUnprocessableEntity, api.Put("/databases/dbName123/stacks/stackName123", map[string]any{"element": 1}).Code)
+
+	// the stack overrides the schema of the database.
+	require.Equal(t, http.StatusOK, api.Put("/databases/dbName123/stacks/stackName123/schema", map[string]any{"type": "integer"}).Code)
+	require.Equal(t, http.StatusOK, api.Put("/databases/dbName123/stacks/stackName123", map[string]any{"element": 1}).Code)
+	require.Equal(t, http.StatusUnprocessableEntity, api.Put("/databases/dbName123/stacks/stackName123", map[string]any{"element": "one"}).Code)
+
+	// without the override, the schema of the database applies again.
+	require.Equal(t, http.StatusNoContent, api.Delete("/databases/dbName123/stacks/stackName123/schema").Code)
+	require.Equal(t, http.StatusOK, api.Put("/databases/dbName123/stacks/stackName123", map[string]any{"element": "one"}).Code)
+
+	// without any schema, anything goes.
+	require.Equal(t, http.StatusNoContent, api.Delete("/databases/dbName123/schema").Code)
+	require.Equal(t, http.StatusOK, api.Put("/databases/dbName123/stacks/stackName123", map[string]any{"element": true}).Code)
+	require.Equal(t, 3, stack.Size())
+
+	require.Equal(t, http.StatusNotFound, api.Put("/databases/unknown123/schema", map[string]any{"type": "string"}).Code)
+	require.Equal(t, http.StatusNotFound, api.Put("/databases/dbName123/stacks/unknown123/schema", map[string]any{"type": "string"}).Code)
+}
+
+func TestService_SetDatabaseSchemaHandler_Invalid(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name   string
+		mode   repository.Mode
+		schema map[string]any
+	}{
+		{name: "counter database", mode: repository.ModeCounter, schema: map[string]any{"type": "string"}},
+		{name: "invalid pattern", schema: map[string]any{"type": "string", "pattern": "("}},
+		{name: "invalid nested pattern", schema: map[string]any{"items": map[string]any{"pattern": "["}}},
+		{name: "discriminator", schema: map[string]any{"discriminator": map[string]any{"propertyName": "kind"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, api := humatest.New(t)
+			svc := handlers.New()
+			svc.AddRoutes(api)
+			_, err := svc.Repository.New("dbName123", repository.WithMode(tt.mode))
+			require.NoError(t, err)
+
+			resp := api.Put("/databases/dbName123/schema", tt.schema)
+			require.Equal(t, http.StatusUnprocessableEntity, resp.Code, resp.Body.String())
+		})
+	}
+}
+
+func TestService_DatabaseSchema_GRPC(t *testing.T) {
+	t.Parallel()
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		t.Fatal("can't read build info")
+	}
+	svc := handlers.New(
+		handlers.WithPort(0),
+		handlers.WithGRPCPort(0),
+		handlers.WithBuildInfo(info),
+	)
+	go func() {
+		assert.NoError(t, svc.Start())
+	}()
+	t.Cleanup(func() {
+		assert.NoError(t, svc.Shutdown(context.Background()))
+	})
+	require.Eventually(t, func() bool {
+		return svc.GRPCPort() != 0
+	}, time.Second, 10*time.Millisecond)
+	db, err := svc.Repository.New("dbName123")
+	require.NoError(t, err)
+	stack, err := db.New("stackName123")
+	require.NoError(t, err)
+	db.SetSchema([]byte(`{"type": "string"}`))
+
+	conn, err := grpc.NewClient("localhost:"+strconv.Itoa(int(svc.GRPCPort())),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	client := pb.NewBatterDBClient(conn)
+
+	ctx := context.Background()
+	_, err = client.Push(ctx, &pb.PushRequest{Database: "dbName123", Stack: "stackName123", Element: structpb.NewNumberValue(1)})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = client.Push(ctx, &pb.PushRequest{Database: "dbName123", Stack: "stackName123", Element: structpb.NewStringValue("one")})
+	require.NoError(t, err)
+	assert.Equal(t, 1, stack.Size())
+}
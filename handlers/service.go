@@ -12,13 +12,18 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
 	"math/big"
+	mrand "math/rand/v2"
 	"net"
 	"net/http"
+	"net/netip"
 	"os"
+	"path/filepath"
 	"runtime"
 	"runtime/debug"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -27,11 +32,15 @@ import (
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/danielgtaylor/huma/v2/adapters/humago"
 	_ "github.com/danielgtaylor/huma/v2/formats/cbor" // Register the CBOR format.
-	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
+	"github.com/jh125486/batterdb/formats/camel"
 	_ "github.com/jh125486/batterdb/formats/text" // Register the text format.
-	_ "github.com/jh125486/batterdb/formats/yaml" // Register the YAML format.
+	"github.com/jh125486/batterdb/formats/yaml"
 	"github.com/jh125486/batterdb/repository"
+	"github.com/jh125486/batterdb/rpc"
 )
 
 const logo = ` 
@@ -46,35 +55,193 @@ ______       _   _           ____________
 type (
 	Service struct {
 		Repository *repository.Repository
-		API        huma.API
-
-		server    *http.Server
-		startedAt time.Time
-		buildInfo *debug.BuildInfo
-		platform  string
-		savefile  string
-		port      atomic.Int32
-		persistDB bool
-		secure    bool
-		pid       int
+		// API serves the data routes. Embedders can register their own
+		// operations on it with huma.Register before Start, and they are
+		// served and documented in the OpenAPI spec like the built-in ones.
+		API huma.API
+
+		server           *http.Server
+		mux              *http.ServeMux
+		adminServer      *http.Server
+		grpcServer       *grpc.Server
+		saving           *saveCall
+		nextSave         *saveCall
+		cache            *responseCache
+		webhook          *webhook
+		certs            *certHolder
+		metrics          *metrics
+		pushTransform    func(any) (any, error)
+		stop             chan struct{}
+		buildInfo        *debug.BuildInfo
+		schemas          sync.Map
+		tagFormats       map[string]string
+		opFormats        map[string]string
+		startedAt        time.Time
+		platform         string
+		savefile         string
+		persistDir       string
+		seedfile         string
+		metricsNamespace string
+		metricsSubsystem string
+		authToken        string
+		openAPIServers   []string
+		trustedProxies   []netip.Prefix
+		logRedaction     []string
+		shutdownHooks    []func(context.Context) error
+		startupHooks     []func(*Service) error
+		maxPersistSize   int64
+		logSampling      float64
+		defaultTimeout   time.Duration
+		autosave         time.Duration
+		autosaveJitter   time.Duration
+		drainWindow      time.Duration
+		maxPersistAge    time.Duration
+		webhookBaseDelay time.Duration
+		maxNameLength    int
+		maxDepth         int
+		maxDecodeDepth   int
+		maxBatchSize     int
+		maxStacks        int
+		maxWaiters       int
+		maxStackSize     int
+		maxLoadDBs       int
+		maxElements      int
+		compressMin      int
+		versions         int
+		pid              int
+		yamlIndent       int
+		webhookAttempts  int
+		saveMx           sync.Mutex
+		stopOnce         sync.Once
+		port             atomic.Int32
+		adminPort        atomic.Int32
+		grpcPort         atomic.Int32
+		draining         atomic.Bool
+		admin            bool
+		grpc             bool
+		showLogo         bool
+		camelCaseJSON    bool
+		persistDB        bool
+		secure           bool
+		strictIDs        bool
+		normalize        bool
+		elementIDs       bool
+		createDir        bool
+		strictMediaType  bool
+		verifyPersist    bool
+		persistStats     bool
+		tolerateCorrupt  bool
+		warnLoadDBs      bool
 	}
 	Option func(*Service)
+
+	// saveCall is an in-progress save that concurrent callers wait on.
+	saveCall struct {
+		err  error
+		done chan struct{}
+	}
 )
 
 func New(opts ...Option) *Service {
 	// defaults.
 	s := &Service{
-		platform:   fmt.Sprintf("%s_%s", runtime.GOOS, runtime.GOARCH),
-		pid:        os.Getpid(),
-		startedAt:  time.Now().UTC(),
-		Repository: repository.New(),
-		savefile:   ".batterdb.gob",
+		platform:         fmt.Sprintf("%s_%s", runtime.GOOS, runtime.GOARCH),
+		pid:              os.Getpid(),
+		startedAt:        time.Now(), // keeps the monotonic clock reading for uptimes.
+		Repository:       repository.New(),
+		savefile:         ".batterdb.gob",
+		maxNameLength:    255,
+		maxDepth:         32,
+		maxDecodeDepth:   1000,
+		maxBatchSize:     1000,
+		maxWaiters:       1000,
+		maxElements:      10000,
+		logSampling:      1,
+		metricsNamespace: defaultMetricsNamespace,
+		showLogo:         true,
+		createDir:        true,
+		stop:             make(chan struct{}),
 	}
 	for _, opt := range opts {
 		opt(s)
 	}
+	s.Repository.SetElementCompression(s.compressMin)
+	s.Repository.SetMaxStacks(s.maxStacks)
+	s.Repository.SetMaxStackSize(s.maxStackSize)
+	s.metrics = newMetrics(s.metricsNamespace, s.metricsSubsystem)
+	if s.webhook != nil {
+		s.webhook.metrics = s.metrics
+		if s.webhookAttempts > 0 {
+			s.webhook.maxAttempts = s.webhookAttempts
+			s.webhook.baseDelay = s.webhookBaseDelay
+		}
+	}
+
+	if s.grpc {
+		opts := []rpc.Option{
+			rpc.WithPush(s.pushGRPC),
+			rpc.WithValidateName(s.validateNewName),
+		}
+		if s.cache != nil {
+			opts = append(opts, rpc.WithServerOptions(grpc.UnaryInterceptor(s.CacheInterceptor)))
+		}
+		s.grpcServer = rpc.NewServer(s.Repository, opts...)
+	}
 
 	mux := http.NewServeMux()
+	s.mux = mux
+	s.API = humago.New(mux, s.config())
+
+	if !s.admin {
+		// Register the API routes.
+		s.AddRoutes(s.API)
+		s.registerAdmin(mux)
+
+		// Create the server.
+		s.server = server(s.tlsConfig(), s.handler(mux))
+
+		return s
+	}
+
+	s.registerSplit(mux)
+
+	return s
+}
+
+// registerSplit registers the data routes on the main port and the main and
+// admin routes on the admin port.
+func (s *Service) registerSplit(mux *http.ServeMux) {
+	s.useMiddlewares(s.API)
+	s.registerDatabases(s.API)
+	s.registerStacks(s.API)
+	s.registerCounters(s.API)
+	s.registerBatch(s.API)
+	s.server = server(s.tlsConfig(), s.handler(mux))
+
+	// Register the main and admin routes on the admin port.
+	adminMux := http.NewServeMux()
+	adminConfig := s.config()
+	// the servers are those of the data routes.
+	adminConfig.OpenAPI.Servers = nil
+	adminAPI := humago.New(adminMux, adminConfig)
+	s.useMiddlewares(adminAPI)
+	s.registerMain(adminAPI)
+	s.registerAdmin(adminMux)
+	s.adminServer = server(s.tlsConfig(), s.handler(adminMux))
+}
+
+// registerAdmin registers the Prometheus metrics and statsviz on the mux.
+func (s *Service) registerAdmin(mux *http.ServeMux) {
+	mux.Handle("/metrics", s.metricsHandler())
+	_ = statsviz.Register(mux)
+}
+
+// config returns the huma config for the service.
+//
+// The format used for a response is picked in order of precedence from: the
+// request's `Accept` header, a per-operation format (WithOperationFormat), a
+// per-tag format (WithTagFormat), and finally the global DefaultFormat.
+func (s *Service) config() huma.Config {
 	config := huma.DefaultConfig("BatterDB", "1.0.0")
 	config.Info.Contact = &huma.Contact{
 		Name:  "Jacob Hochstetler",
@@ -82,40 +249,69 @@ func New(opts ...Option) *Service {
 		Email: "jacob.hochstetler@gmail.com",
 	}
 	config.Info.Description = "A simple in-memory stack database."
+	if s.camelCaseJSON {
+		config.Formats = maps.Clone(config.Formats)
+		config.Formats[camel.ContentType] = camel.DefaultCamelJSONFormat
+		config.DefaultFormat = camel.ContentType
+	}
+	if s.yamlIndent > 0 {
+		config.Formats = maps.Clone(config.Formats)
+		format := yaml.DefaultYAMLFormatWithIndent(s.yamlIndent)
+		config.Formats["application/yaml"] = format
+		config.Formats["yaml"] = format
+	}
+	for _, u := range s.servers() {
+		config.OpenAPI.Servers = append(config.OpenAPI.Servers, &huma.Server{URL: u})
+	}
 
-	s.API = humago.New(mux, config)
-
-	// Register Prometheus metric.
-	mux.Handle("/metrics", promhttp.Handler())
-
-	// Register the API routes.
-	s.AddRoutes(s.API)
-
-	// Register statsviz.
-	_ = statsviz.Register(mux)
+	return config
+}
 
-	// Create the server.
-	s.server = server(s.secure, mux)
+// servers returns the OpenAPI servers, inferred from the port when not set
+// with WithOpenAPIServers.
+func (s *Service) servers() []string {
+	if len(s.openAPIServers) > 0 {
+		return s.openAPIServers
+	}
+	port := s.port.Load()
+	if port <= 0 {
+		return nil
+	}
+	scheme := "http"
+	if s.secure {
+		scheme = "https"
+	}
 
-	return s
+	return []string{fmt.Sprintf("%s://localhost:%d", scheme, port)}
 }
 
-func server(secure bool, mux *http.ServeMux) *http.Server {
-	var tlsConfig *tls.Config
-	if secure {
-		cert, err := generateSelfSignedCert()
-		if err != nil {
-			slog.Error(err.Error())
-			os.Exit(1)
-		}
-		tlsConfig = &tls.Config{
-			MinVersion:   tls.VersionTLS12,
-			Certificates: []tls.Certificate{cert},
-		}
+// handler wraps h with the HTTP level middlewares.
+func (s *Service) handler(h http.Handler) http.Handler {
+	if s.maxDecodeDepth > 0 {
+		h = s.DecodeDepthHandler(h)
+	}
+	if s.strictMediaType {
+		h = s.ContentTypeHandler(h)
+	}
+	if s.cache != nil {
+		h = s.CacheHandler(h)
+	}
+	h = HeadHandler(h)
+	h = s.TimeoutHandler(h)
+	h = s.DrainHandler(h)
+	if len(s.trustedProxies) > 0 {
+		h = s.ClientIPHandler(h)
+	}
+	if s.authToken != "" {
+		h = s.AuthMiddleware(h)
 	}
 
+	return s.LoggingHandler(h)
+}
+
+func server(tlsConfig *tls.Config, h http.Handler) *http.Server {
 	return &http.Server{
-		Handler:        LoggingHandler(mux),
+		Handler:        h,
 		TLSConfig:      tlsConfig,
 		ReadTimeout:    15 * time.Second,
 		WriteTimeout:   15 * time.Second,
@@ -135,12 +331,220 @@ func WithPort(port int32) Option {
 	}
 }
 
+// WithAdminPort serves `/metrics`, `/_status`, `/_config`, `/_ping` and
+// statsviz on a separate port, leaving only the data routes on the main port.
+// A port of 0 picks a free port.
+func WithAdminPort(port int32) Option {
+	return func(s *Service) {
+		s.admin = true
+		s.adminPort.Store(port)
+	}
+}
+
+// WithGRPCPort also serves the repository over gRPC (see package rpc) on the
+// port, without TLS. A port of 0 picks a free port.
+func WithGRPCPort(port int32) Option {
+	return func(s *Service) {
+		s.grpc = true
+		s.grpcPort.Store(port)
+	}
+}
+
+// WithLogo enables or disables the ASCII-art banner on startup.
+// The startup info lines are always logged.
+func WithLogo(show bool) Option {
+	return func(s *Service) {
+		s.showLogo = show
+	}
+}
+
+// WithTrustedProxies sets the CIDRs (or single IPs) of the proxies whose
+// `X-Forwarded-For` header is trusted to determine the client IP, see ClientIP.
+// Invalid entries are logged and ignored.
+func WithTrustedProxies(cidrs []string) Option {
+	return func(s *Service) {
+		for _, cidr := range cidrs {
+			prefix, err := netip.ParsePrefix(cidr)
+			if err != nil {
+				addr, aerr := netip.ParseAddr(cidr)
+				if aerr != nil {
+					slog.Warn("Ignoring invalid trusted proxy", slog.String("cidr", cidr), slog.String("error", err.Error()))
+					continue
+				}
+				prefix = netip.PrefixFrom(addr, addr.BitLen())
+			}
+			s.trustedProxies = append(s.trustedProxies, prefix.Masked())
+		}
+	}
+}
+
+// WithDefaultTimeout sets the timeout of requests that don't set one with the
+// `timeout` query parameter or the `X-Request-Timeout` header, see
+// TimeoutHandler. A value of 0 disables it.
+func WithDefaultTimeout(d time.Duration) Option {
+	return func(s *Service) {
+		s.defaultTimeout = d
+	}
+}
+
+// WithAutosave persists the repository every interval while the server runs,
+// in addition to on shutdown. It requires WithPersistDB.
+func WithAutosave(interval time.Duration) Option {
+	return func(s *Service) {
+		s.autosave = interval
+	}
+}
+
+// WithAutosaveJitter delays each autosave by a random duration in [0, d), so a
+// fleet of instances with the same interval doesn't save at the same time.
+func WithAutosaveJitter(d time.Duration) Option {
+	return func(s *Service) {
+		s.autosaveJitter = d
+	}
+}
+
 func WithRepoFile(repofile string) Option {
 	return func(s *Service) {
 		s.savefile = repofile
 	}
 }
 
+// WithPersistDir persists each database to its own file in dir instead of the
+// single repository file, see repository.Repository.PersistDir. Persistence
+// must still be enabled with WithPersistDB.
+func WithPersistDir(dir string) Option {
+	return func(s *Service) {
+		s.persistDir = dir
+	}
+}
+
+// WithStrictIDs rejects database and stack IDs that are shaped like a UUID
+// but aren't valid with 400 Bad Request, instead of looking them up as names.
+// By default they are looked up as names and usually aren't found.
+func WithStrictIDs(strict bool) Option {
+	return func(s *Service) {
+		s.strictIDs = strict
+	}
+}
+
+// WithPushWebhook posts every pushed element as JSON to url after the push,
+// with the database and stack names in the `X-BatterDB-Database` and
+// `X-BatterDB-Stack` headers. Delivery is asynchronous and best effort:
+// failures are logged and never fail the push.
+func WithPushWebhook(url string) Option {
+	return func(s *Service) {
+		s.webhook = newWebhook(url)
+	}
+}
+
+// WithWebhookRetry retries failed deliveries of the push webhook up to
+// maxAttempts attempts in total, waiting baseDelay before the first retry and
+// doubling the delay after each further attempt. Client errors other than
+// 429 aren't retried. Without it, each event is attempted once.
+func WithWebhookRetry(maxAttempts int, baseDelay time.Duration) Option {
+	return func(s *Service) {
+		s.webhookAttempts = maxAttempts
+		s.webhookBaseDelay = baseDelay
+	}
+}
+
+// WithOpenAPIServers sets the base URLs of the `servers` of the OpenAPI spec,
+// which default to localhost on the configured port.
+func WithOpenAPIServers(urls []string) Option {
+	return func(s *Service) {
+		s.openAPIServers = urls
+	}
+}
+
+// WithElementNormalization stores pushed elements in their canonical JSON
+// form (see repository.Normalize), so equal elements are stored identically
+// regardless of their key order or number types. Object keys may be reordered
+// in responses, which is why it's off by default.
+func WithElementNormalization() Option {
+	return func(s *Service) {
+		s.normalize = true
+	}
+}
+
+// WithElementIDs assigns an ID to every pushed element, returned by the push,
+// that addresses the element wherever it is on the stack to read or delete
+// it. Pops stay LIFO. The IDs are persisted with the elements.
+func WithElementIDs() Option {
+	return func(s *Service) {
+		s.elementIDs = true
+	}
+}
+
+// WithStartupHook adds a hook that Start runs once the repository is loaded
+// and seeded, before serving, e.g. to register custom routes on the API or to
+// warm caches. Hooks run in the order they were added, and an error aborts
+// the start.
+func WithStartupHook(hook func(s *Service) error) Option {
+	return func(s *Service) {
+		s.startupHooks = append(s.startupHooks, hook)
+	}
+}
+
+// WithShutdownHook adds a hook that Shutdown runs once the servers have
+// drained and the repository has been saved, with the shutdown's context.
+// Hooks run in the order they were added, and all of them run even if some
+// fail; their errors are logged and returned along with any save error.
+func WithShutdownHook(hook func(ctx context.Context) error) Option {
+	return func(s *Service) {
+		s.shutdownHooks = append(s.shutdownHooks, hook)
+	}
+}
+
+// WithPushTransform sets a hook that is applied to every pushed element,
+// including batch pushes, after validation and before it's stored. It may
+// return a different element to store, e.g. to normalize or enrich it, or an
+// error to reject the push with a 422. The hook runs synchronously on the push
+// path, so it must be fast and safe for concurrent use. The default stores
+// elements as pushed.
+func WithPushTransform(fn func(any) (any, error)) Option {
+	return func(s *Service) {
+		s.pushTransform = fn
+	}
+}
+
+// WithElementCompression compresses pushed elements whose JSON encoding is
+// at least minBytes long in memory and in the persisted file. Responses are
+// unchanged. A value of 0 disables compression, which is the default.
+func WithElementCompression(minBytes int) Option {
+	return func(s *Service) {
+		s.compressMin = minBytes
+	}
+}
+
+// WithDrainWindow sets how long Shutdown keeps the listeners open while
+// answering new requests with 503 Service Unavailable before closing them.
+func WithDrainWindow(d time.Duration) Option {
+	return func(s *Service) {
+		s.drainWindow = d
+	}
+}
+
+// WithResponseCache caches GET responses of databases and stacks for ttl, see
+// CacheHandler for how the cache is invalidated. A ttl of 0 disables the
+// cache, which is the default.
+func WithResponseCache(ttl time.Duration) Option {
+	return func(s *Service) {
+		s.cache = nil
+		if ttl > 0 {
+			s.cache = newResponseCache(ttl)
+		}
+	}
+}
+
+// WithSeedFile sets a JSON seed file (see repository.Seed) that is loaded at
+// startup, after the persisted repository, creating any databases and stacks
+// that don't exist yet. The seed file is only ever read.
+func WithSeedFile(seedfile string) Option {
+	return func(s *Service) {
+		s.seedfile = seedfile
+	}
+}
+
 func WithSecure(secure bool) Option {
 	return func(s *Service) {
 		s.secure = secure
@@ -153,39 +557,432 @@ func WithPersistDB(persist bool) Option {
 	}
 }
 
+// WithCreatePersistDir creates the directory of the repository file, or the
+// WithPersistDir directory, on save when it's missing, instead of failing the
+// save. It's on by default.
+func WithCreatePersistDir(create bool) Option {
+	return func(s *Service) {
+		s.createDir = create
+	}
+}
+
+// WithVerifyPersist re-reads and decodes every saved file before it replaces
+// the previous one, failing the save and keeping the previous file if it
+// can't be decoded. It catches corruption at save time, at the cost of
+// reading back every save.
+func WithVerifyPersist() Option {
+	return func(s *Service) {
+		s.verifyPersist = true
+	}
+}
+
+// WithPersistStats keeps the operation counts of the stacks across restarts.
+// They are always saved, but by default they start from zero once loaded.
+func WithPersistStats() Option {
+	return func(s *Service) {
+		s.persistStats = true
+	}
+}
+
+// WithTolerateCorruptLoad starts with an empty repository instead of failing
+// when the persisted file can't be decoded, e.g. because it's truncated. The
+// error is logged and the file is renamed aside with a ".corrupt.<timestamp>"
+// suffix, see repository.MoveCorrupt, so it can still be recovered by hand. This trades data loss for availability. Errors reading the file,
+// and files written by a newer version, still fail the load. With
+// WithPersistDir the load always skips corrupt database files, see
+// repository.Repository.LoadDir.
+func WithTolerateCorruptLoad() Option {
+	return func(s *Service) {
+		s.tolerateCorrupt = true
+	}
+}
+
+// WithMaxLoadDatabases fails the load of a repository file, or directory with
+// WithPersistDir, holding more than n databases, to catch loading the wrong
+// file before serving it. See WithMaxLoadDatabasesWarnOnly to only log a
+// warning instead. A value of 0, the default, means unlimited.
+func WithMaxLoadDatabases(n int) Option {
+	return func(s *Service) {
+		s.maxLoadDBs = n
+	}
+}
+
+// WithMaxLoadDatabasesWarnOnly logs a warning and serves the loaded
+// repository when it exceeds WithMaxLoadDatabases, instead of failing.
+func WithMaxLoadDatabasesWarnOnly() Option {
+	return func(s *Service) {
+		s.warnLoadDBs = true
+	}
+}
+
+// WithMaxPersistAge refuses to load a repository file, or directory with
+// WithPersistDir, that was last written longer than d ago. The service then
+// logs a warning and starts with an empty repository rather than failing, and
+// the stale file is replaced on the next save. A value of 0, the default,
+// means unlimited.
+func WithMaxPersistAge(d time.Duration) Option {
+	return func(s *Service) {
+		s.maxPersistAge = d
+	}
+}
+
+// WithMaxPersistBytes refuses to save the repository when its file would be
+// larger than n bytes, keeping the previous file. A value of 0, the default,
+// means unlimited.
+func WithMaxPersistBytes(n int64) Option {
+	return func(s *Service) {
+		s.maxPersistSize = n
+	}
+}
+
+// WithPersistVersions keeps the previous n versions of the repository file
+// on save, as <file>.1 (most recent) to <file>.n.
+func WithPersistVersions(n int) Option {
+	return func(s *Service) {
+		s.versions = n
+	}
+}
+
+// WithMaxNameLength sets the maximum length of database and stack names.
+// A value of 0 disables the check.
+func WithMaxNameLength(n int) Option {
+	return func(s *Service) {
+		s.maxNameLength = n
+	}
+}
+
+// WithMaxElementDepth sets the maximum nesting depth of pushed elements, where
+// each object or array adds a level. A value of 0 disables the check.
+func WithMaxElementDepth(n int) Option {
+	return func(s *Service) {
+		s.maxDepth = n
+	}
+}
+
+// WithMaxBatchSize sets the maximum number of operations in a batch request.
+// A value of 0 disables the check.
+func WithMaxBatchSize(n int) Option {
+	return func(s *Service) {
+		s.maxBatchSize = n
+	}
+}
+
+// WithMaxElementsPerResponse caps the number of elements returned by the
+// head, preview and elements endpoints. A capped response is marked as
+// truncated with the offset of the next page. Consuming and exporting stacks
+// and streams aren't capped, as they return every element by design. The
+// default is 10000, and a value of 0 disables the cap.
+func WithMaxElementsPerResponse(n int) Option {
+	return func(s *Service) {
+		s.maxElements = n
+	}
+}
+
+// WithMaxStacksPerDatabase limits the number of stacks of each database.
+// Creating a stack in a full database fails with 507 Insufficient Storage. A
+// value of 0, the default, disables the limit.
+func WithMaxStacksPerDatabase(n int) Option {
+	return func(s *Service) {
+		s.maxStacks = n
+	}
+}
+
+// WithMaxStackSize limits the number of elements of each stack. Pushes to a
+// full stack fail with 413 Request Entity Too Large, leaving it unchanged. A
+// value of 0, the default, disables the limit.
+func WithMaxStackSize(n int) Option {
+	return func(s *Service) {
+		s.maxStackSize = n
+	}
+}
+
+// WithMaxWaitersPerStack limits the number of concurrent long-polling pops
+// waiting on each stack, so idle waiters can't pile up. Waiters beyond the
+// limit fail right away with 503 Service Unavailable. The default is 1000, and
+// a value of 0 disables the limit.
+func WithMaxWaitersPerStack(n int) Option {
+	return func(s *Service) {
+		s.maxWaiters = n
+	}
+}
+
+// WithLogRedaction redacts the top-level keys of elements, and of request and
+// response bodies, logged at debug level. Bodies that can't be parsed, e.g.
+// because they were truncated for logging, are redacted as a whole. The API
+// key and other credential headers are always redacted.
+func WithLogRedaction(keys []string) Option {
+	return func(s *Service) {
+		s.logRedaction = keys
+	}
+}
+
+// WithAuthToken requires the token as a bearer token in the `Authorization`
+// header of every request, except for the health checks and the docs, see
+// AuthMiddleware. An empty token disables authentication, the default.
+func WithAuthToken(token string) Option {
+	return func(s *Service) {
+		s.authToken = token
+	}
+}
+
+// WithLogSampling only logs a fraction of the successful requests, between 0
+// and 1, to cut the access log volume under high request rates. Requests
+// answered with a status other than 2xx are always logged. The default of 1
+// logs every request.
+func WithLogSampling(rate float64) Option {
+	return func(s *Service) {
+		s.logSampling = rate
+	}
+}
+
+// WithCamelCaseJSON registers the camelCase JSON format (see formats/camel)
+// and makes it the default response format. Clients can still ask for
+// snake_case keys with `Accept: application/json`.
+//
+// Affected keys are those declared on the response structs, e.g.
+// `number_of_databases`, `number_of_stacks`, `created_at`, `updated_at`,
+// `read_at`, `started_at`, `go_version`, `memory_alloc`, `running_for` and
+// `number_goroutines`. Element payloads are never rewritten.
+func WithCamelCaseJSON() Option {
+	return func(s *Service) {
+		s.camelCaseJSON = true
+	}
+}
+
+// WithMaxDecodeDepth rejects JSON and YAML request bodies nested deeper than
+// n levels before decoding them, see DecodeDepthHandler. It defaults to 1000,
+// and 0 disables the check. Unlike WithMaxElementDepth, the levels of the
+// body's own envelope count.
+func WithMaxDecodeDepth(n int) Option {
+	return func(s *Service) {
+		s.maxDecodeDepth = n
+	}
+}
+
+// WithStrictContentType rejects mutating requests with a body that has no
+// `Content-Type` or one without a registered format with 415, instead of
+// failing to parse them. See ContentTypeHandler.
+func WithStrictContentType() Option {
+	return func(s *Service) {
+		s.strictMediaType = true
+	}
+}
+
+// WithMetricsNamespace sets the namespace of the custom Prometheus metrics,
+// `batterdb` by default. Together with WithMetricsSubsystem the metrics are
+// named `<namespace>_<subsystem>_stack_operations_total`,
+// `<namespace>_<subsystem>_webhook_events_total`,
+// `<namespace>_<subsystem>_databases` and `<namespace>_<subsystem>_stacks`,
+// with empty parts left out, e.g. `batterdb_stack_operations_total` by
+// default.
+func WithMetricsNamespace(ns string) Option {
+	return func(s *Service) {
+		s.metricsNamespace = ns
+	}
+}
+
+// WithMetricsSubsystem sets the subsystem of the custom Prometheus metrics,
+// see WithMetricsNamespace. It's empty by default.
+func WithMetricsSubsystem(subsystem string) Option {
+	return func(s *Service) {
+		s.metricsSubsystem = subsystem
+	}
+}
+
+// WithYAMLIndent indents nested values of YAML responses by n spaces instead
+// of the default 4.
+func WithYAMLIndent(n int) Option {
+	return func(s *Service) {
+		s.yamlIndent = n
+	}
+}
+
+// WithTagFormat sets the default response format for operations with the
+// given tag (e.g. "Stack Operations") when the request has no `Accept` header.
+func WithTagFormat(tag, contentType string) Option {
+	return func(s *Service) {
+		if s.tagFormats == nil {
+			s.tagFormats = make(map[string]string)
+		}
+		s.tagFormats[tag] = contentType
+	}
+}
+
+// WithOperationFormat sets the default response format for the operation with
+// the given ID (e.g. "peek-stack") when the request has no `Accept` header.
+// It takes precedence over WithTagFormat.
+func WithOperationFormat(operationID, contentType string) Option {
+	return func(s *Service) {
+		if s.opFormats == nil {
+			s.opFormats = make(map[string]string)
+		}
+		s.opFormats[operationID] = contentType
+	}
+}
+
+// Handle registers a plain HTTP handler for the pattern, see http.ServeMux,
+// next to the data routes, e.g. for endpoints that don't fit an operation.
+// Unlike operations registered on API, such handlers aren't in the OpenAPI
+// spec. The pattern must not conflict with a built-in route, and it must be
+// registered before Start.
+func (s *Service) Handle(pattern string, h http.Handler) {
+	s.mux.Handle(pattern, h)
+}
+
 func (s *Service) AddRoutes(api huma.API) {
+	s.useMiddlewares(api)
 	s.registerMain(api)
 	s.registerDatabases(api)
 	s.registerStacks(api)
+	s.registerCounters(api)
+	s.registerBatch(api)
+}
+
+// useMiddlewares adds the huma middlewares, it must be called before any
+// operation is registered.
+func (s *Service) useMiddlewares(api huma.API) {
+	if len(s.tagFormats) > 0 || len(s.opFormats) > 0 {
+		api.UseMiddleware(s.FormatMiddleware)
+	}
 }
 
 func (s *Service) Port() int32 { return s.port.Load() }
 
+// GRPCPort returns the gRPC port, only meaningful with WithGRPCPort.
+func (s *Service) GRPCPort() int32 { return s.grpcPort.Load() }
+
+// pushGRPC pushes an element over gRPC like PushDatabaseStackHandler: with
+// the same checks, element IDs, webhook and operation metrics. Its errors are
+// gRPC statuses, but for the checks rejecting the element.
+func (s *Service) pushGRPC(db *repository.Database, stack *repository.Stack, element any) (_ any, err error) {
+	defer func() { s.metrics.observeOperation("push", err == nil) }()
+	element, err = s.preparePush(stack, element)
+	var se huma.StatusError
+	if errors.As(err, &se) && se.GetStatus() >= http.StatusInternalServerError {
+		return nil, status.Error(codes.Internal, se.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err := s.push(stack, element); err != nil {
+		return nil, rpc.PushError(err)
+	}
+	s.pushed(db, stack, element)
+
+	return element, nil
+}
+
+// Secure reports whether the service is served over HTTPS.
+func (s *Service) Secure() bool { return s.secure }
+
+// AdminPort returns the admin port, only meaningful with WithAdminPort.
+func (s *Service) AdminPort() int32 { return s.adminPort.Load() }
+
 func (s *Service) Start() error {
-	l, err := net.Listen("tcp", fmt.Sprintf(":%d", s.Port()))
+	if s.certs != nil {
+		if err := s.certs.load(); err != nil {
+			return fmt.Errorf("failed to load TLS certificate: %w", err)
+		}
+		go s.reloadOnHangup()
+	}
+	l, al, gl, err := s.listen()
+	if err != nil {
+		return err
+	}
+	if err := s.startup(); err != nil {
+		// free the ports, as nothing will serve them.
+		for _, listener := range []net.Listener{l, al, gl} {
+			if listener != nil {
+				_ = listener.Close()
+			}
+		}
+		return err
+	}
+
+	s.loadInitMsg()
+
+	if s.persistDB && s.autosave > 0 {
+		go s.autosaveLoop()
+	}
+
+	if gl != nil {
+		go func() {
+			if err := s.grpcServer.Serve(gl); err != nil {
+				slog.Error("gRPC server failed", slog.String("error", err.Error()))
+			}
+		}()
+	}
+	if al != nil {
+		go func() {
+			if err := s.serve(s.adminServer, al); err != nil {
+				slog.Error("Admin server failed", slog.String("error", err.Error()))
+			}
+		}()
+	}
+
+	return s.serve(s.server, l)
+}
+
+// startup loads and seeds the repository, then runs the startup hooks.
+func (s *Service) startup() error {
+	if err := s.LoadToFile(); err != nil {
+		return fmt.Errorf("failed to load repository: %w", err)
+	}
+	if err := s.LoadSeedFile(); err != nil {
+		return fmt.Errorf("failed to seed repository: %w", err)
+	}
+	for _, hook := range s.startupHooks {
+		if err := hook(s); err != nil {
+			return fmt.Errorf("startup hook failed: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// listen opens the listeners of the servers, the admin and gRPC ones being
+// nil when disabled, and records their actual ports.
+func (s *Service) listen() (l, al, gl net.Listener, err error) {
+	l, err = net.Listen("tcp", fmt.Sprintf(":%d", s.Port()))
 	if err != nil {
-		return fmt.Errorf("failed to start listener: %w", err)
+		return nil, nil, nil, fmt.Errorf("failed to start listener: %w", err)
 	}
 
 	// Save the actual port from the listener.
 	s.port.Store(int32(l.Addr().(*net.TCPAddr).Port))
 	s.server.Addr = fmt.Sprintf("localhost:%d", s.port.Load())
 
-	if err := s.LoadToFile(); err != nil {
-		return fmt.Errorf("failed to load repository: %w", err)
+	if s.adminServer != nil {
+		al, err = net.Listen("tcp", fmt.Sprintf(":%d", s.AdminPort()))
+		if err != nil {
+			_ = l.Close()
+			return nil, nil, nil, fmt.Errorf("failed to start admin listener: %w", err)
+		}
+		s.adminPort.Store(int32(al.Addr().(*net.TCPAddr).Port))
+		s.adminServer.Addr = fmt.Sprintf("localhost:%d", s.adminPort.Load())
 	}
 
-	s.loadInitMsg()
+	if s.grpcServer != nil {
+		gl, err = net.Listen("tcp", fmt.Sprintf(":%d", s.GRPCPort()))
+		if err != nil {
+			_ = l.Close()
+			if al != nil {
+				_ = al.Close()
+			}
+			return nil, nil, nil, fmt.Errorf("failed to start gRPC listener: %w", err)
+		}
+		s.grpcPort.Store(int32(gl.Addr().(*net.TCPAddr).Port))
+	}
 
-	return s.serve(l)
+	return l, al, gl, nil
 }
 
-func (s *Service) serve(l net.Listener) error {
+func (s *Service) serve(srv *http.Server, l net.Listener) error {
 	var err error
 	if s.secure {
-		err = s.server.ServeTLS(l, "", "")
+		err = srv.ServeTLS(l, "", "")
 	} else {
-		err = s.server.Serve(l)
+		err = srv.Serve(l)
 	}
 	if !errors.Is(err, http.ErrServerClosed) {
 		return err
@@ -211,20 +1008,58 @@ func (s *Service) OpenAPI(openapi string) []byte {
 }
 
 func (s *Service) Shutdown(ctx context.Context) error {
+	// Answer new requests with 503 for the drain window, so load balancers
+	// stop routing to us before the listeners close.
+	s.draining.Store(true)
+	if s.drainWindow > 0 {
+		select {
+		case <-time.After(s.drainWindow):
+		case <-ctx.Done():
+		}
+	}
+
 	// Create a deadline to wait for.
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
+	s.stopOnce.Do(func() { close(s.stop) })
+
 	// Doesn't block if no connections, but will otherwise wait until the timeout deadline.
 	if err := s.server.Shutdown(ctx); err != nil {
 		return err
 	}
+	if s.adminServer != nil {
+		if err := s.adminServer.Shutdown(ctx); err != nil {
+			return err
+		}
+	}
+	if s.grpcServer != nil {
+		s.stopGRPC(ctx)
+	}
 
-	if err := s.SaveToFile(); err != nil {
-		return err
+	errs := []error{s.SaveToFile()}
+	for _, hook := range s.shutdownHooks {
+		if err := hook(ctx); err != nil {
+			slog.Error("Shutdown hook failed", slog.String("error", err.Error()))
+			errs = append(errs, err)
+		}
 	}
 
-	return nil
+	return errors.Join(errs...)
+}
+
+// stopGRPC gracefully stops the gRPC server, forcing it to stop once ctx is done.
+func (s *Service) stopGRPC(ctx context.Context) {
+	stopped := make(chan struct{})
+	go func() {
+		s.grpcServer.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		s.grpcServer.Stop()
+	}
 }
 
 func (s *Service) registerMain(api huma.API) {
@@ -236,6 +1071,14 @@ func (s *Service) registerMain(api huma.API) {
 		Description: "Show server status.",
 		Tags:        []string{"Main"},
 	}, s.StatusHandler)
+	huma.Register(api, huma.Operation{
+		OperationID: "get-config",
+		Method:      http.MethodGet,
+		Path:        "/_config",
+		Summary:     "Config",
+		Description: "Show the effective server configuration.",
+		Tags:        []string{"Main"},
+	}, s.ConfigHandler)
 	huma.Register(api, huma.Operation{
 		OperationID: "get-ping",
 		Method:      http.MethodGet,
@@ -244,6 +1087,44 @@ func (s *Service) registerMain(api huma.API) {
 		Description: "Sends a ping to the server, that will answer pong if it is running.",
 		Tags:        []string{"Main"},
 	}, PingHandler)
+	huma.Register(api, huma.Operation{
+		OperationID: "get-time",
+		Method:      http.MethodGet,
+		Path:        "/_time",
+		Summary:     "Time",
+		Description: "Show the server time and uptime, to detect clock skew.",
+		Tags:        []string{"Main"},
+	}, s.TimeHandler)
+	huma.Register(api, huma.Operation{
+		OperationID: "get-operations",
+		Method:      http.MethodGet,
+		Path:        "/_operations",
+		Summary:     "Operations",
+		Description: "List the stack operations and the optional features enabled on the server.",
+		Tags:        []string{"Main"},
+	}, s.OperationsHandler)
+	if s.certs != nil {
+		huma.Register(api, huma.Operation{
+			OperationID:   "reload-tls",
+			Method:        http.MethodPost,
+			Path:          "/_tls/reload",
+			Summary:       "Reload TLS",
+			Description:   "Re-reads the TLS certificate and key files, keeping the current certificate on error.",
+			Tags:          []string{"Main"},
+			DefaultStatus: http.StatusNoContent,
+		}, s.ReloadTLSHandler)
+	}
+	s.registerMetrics(api)
+}
+func (s *Service) registerMetrics(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "get-metrics-json",
+		Method:      http.MethodGet,
+		Path:        "/_metrics.json",
+		Summary:     "Metrics",
+		Description: "Show the custom metrics of `/metrics` and the size of the repository as JSON.",
+		Tags:        []string{"Main"},
+	}, s.MetricsHandler)
 }
 func (s *Service) registerDatabases(api huma.API) {
 	huma.Register(api, huma.Operation{
@@ -263,6 +1144,14 @@ func (s *Service) registerDatabases(api huma.API) {
 		Description: "Show databases.",
 		Tags:        []string{"Databases"},
 	}, s.ListDatabasesHandler)
+	huma.Register(api, huma.Operation{
+		OperationID: "post-databases-status",
+		Method:      http.MethodPost,
+		Path:        "/databases/status",
+		Summary:     "Status",
+		Description: "Show the status of multiple databases.",
+		Tags:        []string{"Databases"},
+	}, s.DatabasesStatusHandler)
 	huma.Register(api, huma.Operation{
 		OperationID: "get-database",
 		Method:      http.MethodGet,
@@ -279,41 +1168,245 @@ func (s *Service) registerDatabases(api huma.API) {
 		Description: "Delete a database.",
 		Tags:        []string{"Databases"},
 	}, s.DeleteDatabaseHandler)
+	huma.Register(api, huma.Operation{
+		OperationID: "get-database-depths",
+		Method:      http.MethodGet,
+		Path:        "/databases/{database}/depths",
+		Summary:     "Depths",
+		Description: "Show the size of each stack of a database, deepest first.",
+		Tags:        []string{"Databases"},
+	}, s.DatabaseDepthsHandler)
+	s.registerDatabaseTransfer(api)
+	s.registerSchemas(api)
+}
+func (s *Service) registerDatabaseTransfer(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "export-database",
+		Method:      http.MethodGet,
+		Path:        "/databases/{database}/export",
+		Summary:     "Export",
+		Description: "Export a database with all its stacks and elements as JSON.",
+		Tags:        []string{"Databases"},
+	}, s.ExportDatabaseHandler)
+	huma.Register(api, huma.Operation{
+		OperationID: "import-database",
+		Method:      http.MethodPost,
+		Path:        "/databases/{database}/import",
+		Summary:     "Import",
+		Description: "Import the stacks of an export into a new or existing database.",
+		Tags:        []string{"Databases"},
+	}, s.ImportDatabaseHandler)
+}
+func (s *Service) registerSchemas(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "put-database-schema",
+		Method:      http.MethodPut,
+		Path:        "/databases/{database}/schema",
+		Summary:     "Set schema",
+		Description: "Set the JSON Schema elements pushed to any stack of a database must match.",
+		Tags:        []string{"Databases"},
+	}, s.SetDatabaseSchemaHandler)
+	huma.Register(api, huma.Operation{
+		OperationID: "delete-database-schema",
+		Method:      http.MethodDelete,
+		Path:        "/databases/{database}/schema",
+		Summary:     "Delete schema",
+		Description: "Remove the schema of a database.",
+		Tags:        []string{"Databases"},
+	}, s.DeleteDatabaseSchemaHandler)
+	huma.Register(api, huma.Operation{
+		OperationID: "put-stack-schema",
+		Method:      http.MethodPut,
+		Path:        "/databases/{database}/stacks/{stack}/schema",
+		Summary:     "Set schema",
+		Description: "Set the JSON Schema elements pushed to a stack must match, overriding the schema of its database.",
+		Tags:        []string{"Stacks"},
+	}, s.SetStackSchemaHandler)
+	huma.Register(api, huma.Operation{
+		OperationID: "delete-stack-schema",
+		Method:      http.MethodDelete,
+		Path:        "/databases/{database}/stacks/{stack}/schema",
+		Summary:     "Delete schema",
+		Description: "Remove the schema of a stack, so the schema of its database applies again.",
+		Tags:        []string{"Stacks"},
+	}, s.DeleteStackSchemaHandler)
 }
 func (s *Service) registerStacks(api huma.API) {
 	s.registerStacksCRUD(api)
+	s.registerStackViews(api)
+	s.registerStackElements(api)
 	huma.Register(api, huma.Operation{
 		OperationID: "peek-stack",
 		Method:      http.MethodGet,
 		Path:        "/databases/{database}/stacks/{stack}/peek",
 		Summary:     "Peek",
 		Description: "`PEEK` operation on a stack.",
-		Tags:        []string{"Stack Operations"},
-	}, s.PeekDatabaseStackHandler)
+		Tags:        []string{stackOperationsTag},
+	}, counted(s.metrics, "peek", s.PeekDatabaseStackHandler))
 	huma.Register(api, huma.Operation{
 		OperationID: "push-stack",
 		Method:      http.MethodPut,
 		Path:        "/databases/{database}/stacks/{stack}",
 		Summary:     "Push",
 		Description: "`PUSH` operation on a stack.",
-		Tags:        []string{"Stack Operations"},
-	}, s.PushDatabaseStackHandler)
+		Tags:        []string{stackOperationsTag},
+	}, counted(s.metrics, "push", s.PushDatabaseStackHandler))
 	huma.Register(api, huma.Operation{
 		OperationID: "pop-stack",
 		Method:      http.MethodDelete,
 		Path:        "/databases/{database}/stacks/{stack}",
 		Summary:     "Pop",
 		Description: "`POP` operation on a stack.",
-		Tags:        []string{"Stack Operations"},
-	}, s.PopDatabaseStackHandler)
+		Tags:        []string{stackOperationsTag},
+	}, counted(s.metrics, "pop", s.PopDatabaseStackHandler))
+	huma.Register(api, huma.Operation{
+		OperationID: "pop-wait-stack",
+		Method:      http.MethodDelete,
+		Path:        "/databases/{database}/stacks/{stack}/popWait",
+		Summary:     "Pop (wait)",
+		Description: "`POP` operation on a stack that waits for an element to be pushed if the stack is empty.",
+		Tags:        []string{stackOperationsTag},
+	}, s.PopWaitDatabaseStackHandler)
+	huma.Register(api, huma.Operation{
+		OperationID: "swap-stacks",
+		Method:      http.MethodPost,
+		Path:        "/databases/{database}/stacks/{stack}/swapWith/{other}",
+		Summary:     "Swap",
+		Description: "Atomically swap the elements and capacities of two stacks, keeping their names, IDs, schemas and element types.",
+		Tags:        []string{stackOperationsTag},
+	}, s.SwapDatabaseStacksHandler)
 	huma.Register(api, huma.Operation{
 		OperationID: "flush-stack",
 		Method:      http.MethodDelete,
 		Path:        "/databases/{database}/stacks/{stack}/flush",
 		Summary:     "Flush",
 		Description: "`FLUSH` operation on a stack.",
-		Tags:        []string{"Stack Operations"},
-	}, s.FlushDatabaseStackHandler)
+		Tags:        []string{stackOperationsTag},
+	}, counted(s.metrics, "flush", s.FlushDatabaseStackHandler))
+	huma.Register(api, huma.Operation{
+		OperationID: "consume-stack",
+		Method:      http.MethodDelete,
+		Path:        "/databases/{database}/stacks/{stack}/consume",
+		Summary:     "Consume",
+		Description: "Remove and return all elements of a stack in one operation.",
+		Tags:        []string{stackOperationsTag},
+	}, counted(s.metrics, "consume", s.ConsumeDatabaseStackHandler))
+}
+func (s *Service) registerStackViews(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "peek-raw-stack",
+		Method:      http.MethodGet,
+		Path:        "/databases/{database}/stacks/{stack}/peek/raw",
+		Summary:     "Peek (raw)",
+		Description: "`PEEK` operation on a stack, returning a text element as `text/plain` without an envelope.",
+		Tags:        []string{stackOperationsTag},
+	}, s.PeekRawDatabaseStackHandler)
+	huma.Register(api, huma.Operation{
+		OperationID: "text-stack",
+		Method:      http.MethodGet,
+		Path:        "/databases/{database}/stacks/{stack}/text",
+		Summary:     "Text",
+		Description: "Show all elements of a stack as `text/plain`, one per line from the bottom up, with non-text elements as JSON.",
+		Tags:        []string{stackOperationsTag},
+	}, s.TextDatabaseStackHandler)
+	huma.Register(api, huma.Operation{
+		OperationID: "stream-stack",
+		Method:      http.MethodGet,
+		Path:        "/databases/{database}/stacks/{stack}/stream",
+		Summary:     "Stream",
+		Description: "Stream all elements of a stack as NDJSON, from the top to the bottom.",
+		Tags:        []string{stackOperationsTag},
+	}, s.StreamDatabaseStackHandler)
+	huma.Register(api, huma.Operation{
+		OperationID: "head-stack",
+		Method:      http.MethodGet,
+		Path:        "/databases/{database}/stacks/{stack}/head",
+		Summary:     "Head",
+		Description: "Show the oldest elements of a stack, from the bottom up.",
+		Tags:        []string{stackOperationsTag},
+	}, s.HeadDatabaseStackHandler)
+	huma.Register(api, huma.Operation{
+		OperationID: "preview-stack",
+		Method:      http.MethodGet,
+		Path:        "/databases/{database}/stacks/{stack}/preview",
+		Summary:     "Preview",
+		Description: "Show the top elements of a stack with their positions, from the top down.",
+		Tags:        []string{stackOperationsTag},
+	}, s.PreviewDatabaseStackHandler)
+	huma.Register(api, huma.Operation{
+		OperationID: "list-stack-elements",
+		Method:      http.MethodGet,
+		Path:        "/databases/{database}/stacks/{stack}/elements",
+		Summary:     "Elements",
+		Description: "List the elements of a stack, from the top down, a page at a time.",
+		Tags:        []string{stackOperationsTag},
+	}, s.ListDatabaseStackElementsHandler)
+	huma.Register(api, huma.Operation{
+		OperationID: "compare-stacks",
+		Method:      http.MethodGet,
+		Path:        "/databases/{database}/stacks/{stack}/equals/{other}",
+		Summary:     "Compare",
+		Description: "Check whether two stacks hold the same elements in the same order.",
+		Tags:        []string{stackOperationsTag},
+	}, s.CompareDatabaseStacksHandler)
+}
+func (s *Service) registerStackElements(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "stack-activity",
+		Method:      http.MethodGet,
+		Path:        "/databases/{database}/stacks/{stack}/activity",
+		Summary:     "Activity",
+		Description: "Show when a stack was created and last pushed, popped and peeked.",
+		Tags:        []string{"Stacks"},
+	}, s.ActivityDatabaseStackHandler)
+	huma.Register(api, huma.Operation{
+		OperationID: "push-many-stack",
+		Method:      http.MethodPut,
+		Path:        "/databases/{database}/stacks/{stack}/bulk",
+		Summary:     "Push (bulk)",
+		Description: "`PUSH` operation on a stack for many elements at once, pushed in order under a single lock.",
+		Tags:        []string{stackOperationsTag},
+	}, counted(s.metrics, "push", s.PushManyDatabaseStackHandler))
+	huma.Register(api, huma.Operation{
+		OperationID: "dup-stack",
+		Method:      http.MethodPut,
+		Path:        "/databases/{database}/stacks/{stack}/dup",
+		Summary:     "Dup",
+		Description: "`DUP` operation on a stack, pushing a copy of its top element.",
+		Tags:        []string{stackOperationsTag},
+	}, s.DupDatabaseStackHandler)
+	huma.Register(api, huma.Operation{
+		OperationID: "swap-stack-top",
+		Method:      http.MethodPost,
+		Path:        "/databases/{database}/stacks/{stack}/swap",
+		Summary:     "Swap top",
+		Description: "`SWAP` operation on a stack, exchanging its top two elements.",
+		Tags:        []string{stackOperationsTag},
+	}, s.SwapTopDatabaseStackHandler)
+	huma.Register(api, huma.Operation{
+		OperationID: "truncate-stack",
+		Method:      http.MethodPost,
+		Path:        "/databases/{database}/stacks/{stack}/truncate",
+		Summary:     "Truncate",
+		Description: "Keep only the most recent elements of a stack, discarding the oldest.",
+		Tags:        []string{stackOperationsTag},
+	}, s.TruncateDatabaseStackHandler)
+	huma.Register(api, huma.Operation{
+		OperationID: "get-stack-element",
+		Method:      http.MethodGet,
+		Path:        "/databases/{database}/stacks/{stack}/elements/{elementID}",
+		Summary:     "Element",
+		Description: "Show an element of a stack by the ID returned from its push.",
+		Tags:        []string{stackOperationsTag},
+	}, s.GetElementHandler)
+	huma.Register(api, huma.Operation{
+		OperationID: "delete-stack-element",
+		Method:      http.MethodDelete,
+		Path:        "/databases/{database}/stacks/{stack}/elements/{elementID}",
+		Summary:     "Delete element",
+		Description: "Remove an element of a stack by the ID returned from its push.",
+		Tags:        []string{stackOperationsTag},
+	}, s.DeleteElementHandler)
 }
 func (s *Service) registerStacksCRUD(api huma.API) {
 	huma.Register(api, huma.Operation{
@@ -341,6 +1434,14 @@ func (s *Service) registerStacksCRUD(api huma.API) {
 		Description: "Show a stack of a database.",
 		Tags:        []string{"Stacks"},
 	}, s.ShowDatabaseStackHandler)
+	huma.Register(api, huma.Operation{
+		OperationID: "patch-stack",
+		Method:      http.MethodPatch,
+		Path:        "/databases/{database}/stacks/{stack}",
+		Summary:     "Update",
+		Description: "Update the metadata of a stack.",
+		Tags:        []string{"Stacks"},
+	}, s.UpdateDatabaseStackHandler)
 	huma.Register(api, huma.Operation{
 		OperationID: "delete-stack",
 		Method:      http.MethodDelete,
@@ -349,11 +1450,73 @@ func (s *Service) registerStacksCRUD(api huma.API) {
 		Description: "Delete a stack from a database.",
 		Tags:        []string{"Stacks"},
 	}, s.DeleteDatabaseStackHandler)
+	huma.Register(api, huma.Operation{
+		OperationID: "rename-stack",
+		Method:      http.MethodPost,
+		Path:        "/databases/{database}/stacks/{stack}/rename",
+		Summary:     "Rename",
+		Description: "Rename a stack, keeping its ID and elements.",
+		Tags:        []string{"Stacks"},
+	}, s.RenameDatabaseStackHandler)
+	huma.Register(api, huma.Operation{
+		OperationID: "delete-empty-stacks",
+		Method:      http.MethodDelete,
+		Path:        "/databases/{database}/stacks/empty",
+		Summary:     "Delete empty",
+		Description: "Delete every empty stack of a database.",
+		Tags:        []string{"Stacks"},
+	}, s.DeleteEmptyDatabaseStacksHandler)
+}
+func (s *Service) registerBatch(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "batch",
+		Method:      http.MethodPost,
+		Path:        "/databases/{database}/batch",
+		Summary:     "Batch",
+		Description: "Run multiple stack operations of a database in one request.",
+		Tags:        []string{stackOperationsTag},
+	}, s.BatchOperationsHandler)
+}
+func (s *Service) registerCounters(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "get-counter",
+		Method:      http.MethodGet,
+		Path:        "/databases/{database}/counters/{counter}",
+		Summary:     "Get",
+		Description: "Get the value of a counter of a counter database.",
+		Tags:        []string{"Counters"},
+	}, s.GetCounterHandler)
+	huma.Register(api, huma.Operation{
+		OperationID: "set-counter",
+		Method:      http.MethodPut,
+		Path:        "/databases/{database}/counters/{counter}",
+		Summary:     "Set",
+		Description: "Set the value of a counter of a counter database, creating it if needed.",
+		Tags:        []string{"Counters"},
+	}, s.SetCounterHandler)
+	huma.Register(api, huma.Operation{
+		OperationID: "incr-counter",
+		Method:      http.MethodPost,
+		Path:        "/databases/{database}/counters/{counter}/incr",
+		Summary:     "Increment",
+		Description: "Atomically increment a counter of a counter database, creating it if needed.",
+		Tags:        []string{"Counters"},
+	}, s.IncrCounterHandler)
+	huma.Register(api, huma.Operation{
+		OperationID: "decr-counter",
+		Method:      http.MethodPost,
+		Path:        "/databases/{database}/counters/{counter}/decr",
+		Summary:     "Decrement",
+		Description: "Atomically decrement a counter of a counter database, creating it if needed.",
+		Tags:        []string{"Counters"},
+	}, s.DecrCounterHandler)
 }
 
 func (s *Service) loadInitMsg() {
-	for _, l := range strings.Split(logo, "\n") {
-		slog.Info(l)
+	if s.showLogo {
+		for _, l := range strings.Split(logo, "\n") {
+			slog.Info(l)
+		}
 	}
 	slog.Info(fmt.Sprintf("Version:      %v", s.buildInfo.Main.Version))
 	slog.Info(fmt.Sprintf("Go version:   %v", s.buildInfo.GoVersion))
@@ -364,21 +1527,128 @@ func (s *Service) loadInitMsg() {
 		slog.Info(fmt.Sprintf("Loaded repo:  %v", s.savefile))
 		slog.Info(fmt.Sprintf("Databases:    %v", s.Repository.Len()))
 	}
-	baseURL := "http://" + s.server.Addr
-	if s.secure {
-		baseURL = "https://" + s.server.Addr
+	baseURL := s.baseURL(s.server)
+	adminURL := baseURL
+	if s.adminServer != nil {
+		adminURL = s.baseURL(s.adminServer)
 	}
 	slog.Info(fmt.Sprintf("Serving:      %v", baseURL))
 	slog.Info(fmt.Sprintf("Docs:         %v/docs#/", baseURL))
-	slog.Info(fmt.Sprintf("Metrics:      %v/metrics", baseURL))
-	slog.Info(fmt.Sprintf("StatsViz:     %v/debug/statsviz", baseURL))
+	slog.Info(fmt.Sprintf("Metrics:      %v/metrics", adminURL))
+	slog.Info(fmt.Sprintf("StatsViz:     %v/debug/statsviz", adminURL))
+	if s.grpcServer != nil {
+		slog.Info(fmt.Sprintf("gRPC:         localhost:%v", s.GRPCPort()))
+	}
+}
+
+func (s *Service) baseURL(srv *http.Server) string {
+	if s.secure {
+		return "https://" + srv.Addr
+	}
+	return "http://" + srv.Addr
 }
 
+// SaveToFile persists the repository to disk. Concurrent calls are coalesced:
+// a save in progress may have taken its snapshot before the caller's changes,
+// so callers arriving meanwhile wait for it and then share a single new save.
 func (s *Service) SaveToFile() error {
 	if !s.persistDB {
 		return nil
 	}
-	if err := s.Repository.Persist(s.savefile); err != nil {
+
+	s.saveMx.Lock()
+	running := s.saving
+	if running == nil {
+		call := &saveCall{done: make(chan struct{})}
+		s.saving = call
+		s.saveMx.Unlock()
+		return s.runSave(call)
+	}
+	next := s.nextSave
+	first := next == nil
+	if first {
+		next = &saveCall{done: make(chan struct{})}
+		s.nextSave = next
+	}
+	s.saveMx.Unlock()
+
+	if first {
+		// the running save hands over to next when it's done.
+		<-running.done
+		return s.runSave(next)
+	}
+	<-next.done
+
+	return next.err
+}
+
+// runSave saves for the call, then makes the queued save, if any, the
+// running one.
+func (s *Service) runSave(call *saveCall) error {
+	call.err = s.save()
+
+	s.saveMx.Lock()
+	s.saving = s.nextSave
+	s.nextSave = nil
+	s.saveMx.Unlock()
+	close(call.done)
+
+	return call.err
+}
+
+// autosaveLoop saves the repository every autosave interval, plus jitter,
+// until the service is shut down.
+func (s *Service) autosaveLoop() {
+	for {
+		d := s.autosave
+		if s.autosaveJitter > 0 {
+			d += mrand.N(s.autosaveJitter)
+		}
+		timer := time.NewTimer(d)
+		select {
+		case <-s.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+			if err := s.SaveToFile(); err != nil {
+				slog.Error("Autosave failed", slog.String("error", err.Error()))
+			}
+		}
+	}
+}
+
+func (s *Service) save() error {
+	opts := []repository.PersistOption{
+		repository.KeepVersions(s.versions),
+		repository.MaxBytes(s.maxPersistSize),
+	}
+	if s.verifyPersist {
+		opts = append(opts, repository.Verify())
+	}
+	dir := filepath.Dir(s.savefile)
+	if s.persistDir != "" {
+		dir = s.persistDir
+	}
+	if s.createDir {
+		if err := ensureDir(dir); err != nil {
+			return err
+		}
+	} else if _, err := os.Stat(dir); err != nil {
+		// PersistDir creates its directory, so check it exists here.
+		return fmt.Errorf("missing persistence directory: %w", err)
+	}
+	var err error
+	if s.persistDir != "" {
+		err = s.Repository.PersistDir(s.persistDir, opts...)
+	} else {
+		err = s.Repository.Persist(s.savefile, opts...)
+	}
+	if errors.Is(err, repository.ErrTooLarge) {
+		slog.Error("Repository not saved, the previous save is kept",
+			slog.String("error", err.Error()),
+			slog.Int64("max_bytes", s.maxPersistSize))
+	}
+	if err != nil {
 		return err
 	}
 	slog.Info("Repository saved to disk", slog.Int("databases", s.Repository.Len()))
@@ -386,13 +1656,121 @@ func (s *Service) SaveToFile() error {
 	return nil
 }
 
+// ensureDir creates dir if it doesn't exist yet.
+func ensureDir(dir string) error {
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return fmt.Errorf("failed to create persistence directory: %w", err)
+	}
+	slog.Info("Created persistence directory", slog.String("dir", dir))
+
+	return nil
+}
+
 func (s *Service) LoadToFile() error {
+	if err := s.load(); err != nil {
+		// LoadDir handles corrupt files itself, so this is the single file.
+		if !s.tolerateCorrupt || !errors.Is(err, repository.ErrCorrupt) {
+			return err
+		}
+		if err := s.moveCorruptAside(err); err != nil {
+			return err
+		}
+	}
+	if err := s.checkLoadedDatabases(); err != nil {
+		return err
+	}
+	if !s.persistStats {
+		s.Repository.ResetStats()
+	}
+
+	return nil
+}
+
+// checkLoadedDatabases fails, or only warns, when the loaded repository has
+// more databases than WithMaxLoadDatabases.
+func (s *Service) checkLoadedDatabases() error {
+	n := s.Repository.Len()
+	if s.maxLoadDBs <= 0 || n <= s.maxLoadDBs {
+		return nil
+	}
+	if !s.warnLoadDBs {
+		return fmt.Errorf("loaded %d databases, more than the maximum of %d", n, s.maxLoadDBs)
+	}
+	slog.Warn("Loaded more databases than expected",
+		slog.Int("databases", n),
+		slog.Int("max", s.maxLoadDBs),
+	)
+
+	return nil
+}
+
+// load loads the persisted repository, unless it is stale.
+func (s *Service) load() error {
 	if !s.persistDB {
 		return nil
 	}
+	if s.persistDir != "" {
+		if s.stale(s.persistDir) {
+			return nil
+		}
+		return s.Repository.LoadDir(s.persistDir)
+	}
+	if s.stale(s.savefile) {
+		return nil
+	}
 	return s.Repository.Load(s.savefile)
 }
 
+// moveCorruptAside logs the load error, renames the persisted file aside and
+// clears whatever was loaded before the error, see WithTolerateCorruptLoad.
+func (s *Service) moveCorruptAside(loadErr error) error {
+	aside, err := repository.MoveCorrupt(s.savefile)
+	if err != nil {
+		return fmt.Errorf("failed to move corrupt repository aside: %w", err)
+	}
+	slog.Error("Failed to load persisted repository, starting empty",
+		slog.String("path", s.savefile),
+		slog.String("moved_to", aside),
+		slog.String("error", loadErr.Error()))
+	s.Repository.Clear()
+
+	return nil
+}
+
+// stale reports whether the persisted file or directory at path was last
+// written longer ago than WithMaxPersistAge, logging that it isn't loaded.
+func (s *Service) stale(path string) bool {
+	if s.maxPersistAge <= 0 {
+		return false
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		// a missing file is up to the load.
+		return false
+	}
+	age := time.Since(info.ModTime())
+	if age <= s.maxPersistAge {
+		return false
+	}
+	slog.Warn("Persisted repository is too old to load, starting empty",
+		slog.String("path", path),
+		slog.Duration("age", age.Round(time.Second)),
+		slog.Duration("max_age", s.maxPersistAge))
+
+	return true
+}
+
+// LoadSeedFile seeds the repository from the seed file, if one is set.
+func (s *Service) LoadSeedFile() error {
+	if s.seedfile == "" {
+		return nil
+	}
+	return s.Repository.LoadSeed(s.seedfile)
+}
+
 func generateSelfSignedCert() (tls.Certificate, error) {
 	// Generate a new private key.
 	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
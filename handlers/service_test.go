@@ -1,21 +1,35 @@
 package handlers_test
 
 import (
+	"bytes"
 	"context"
+	"encoding/gob"
+	"errors"
+	"io"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"runtime/debug"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
 
 	"github.com/jh125486/batterdb/handlers"
 	"github.com/jh125486/batterdb/repository"
+	"github.com/jh125486/batterdb/rpc/pb"
 )
 
 func TestService_Start(t *testing.T) {
@@ -29,6 +43,9 @@ func TestService_Start(t *testing.T) {
 	canceledCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
 	cancel()
 
+	seedfile := filepath.Join(t.TempDir(), "seed.json")
+	require.NoError(t, os.WriteFile(seedfile, []byte(`{"databases": [{"name": "db1", "stacks": [{"name": "s1"}]}]}`), 0o600))
+
 	test := []struct {
 		name            string
 		opts            []handlers.Option
@@ -69,6 +86,18 @@ func TestService_Start(t *testing.T) {
 			wantStartErr:    assert.NoError,
 			wantShutdownErr: assert.NoError,
 		},
+		{
+			name: "save dir",
+			opts: []handlers.Option{
+				handlers.WithPersistDB(true),
+				handlers.WithPersistDir(filepath.Join(t.TempDir(), "dbs")),
+				handlers.WithPort(0),
+			},
+			shutdownCtx:     context.Background(),
+			wait:            10 * time.Millisecond,
+			wantStartErr:    assert.NoError,
+			wantShutdownErr: assert.NoError,
+		},
 		{
 			name: "bad savefile",
 			opts: []handlers.Option{
@@ -95,6 +124,114 @@ func TestService_Start(t *testing.T) {
 			wantStartErr:    assert.NoError,
 			wantShutdownErr: assert.NoError,
 		},
+		{
+			name: "admin port",
+			opts: []handlers.Option{
+				handlers.WithPort(0),
+				handlers.WithAdminPort(0),
+			},
+			shutdownCtx:     context.Background(),
+			wait:            10 * time.Millisecond,
+			wantStartErr:    assert.NoError,
+			wantShutdownErr: assert.NoError,
+		},
+		{
+			name: "insane admin port",
+			opts: []handlers.Option{
+				handlers.WithPort(0),
+				handlers.WithAdminPort(-666),
+			},
+			shutdownCtx:     context.Background(),
+			wait:            10 * time.Millisecond,
+			wantStartErr:    assert.Error,
+			wantShutdownErr: assert.NoError,
+		},
+		{
+			name: "grpc port",
+			opts: []handlers.Option{
+				handlers.WithPort(0),
+				handlers.WithGRPCPort(0),
+			},
+			shutdownCtx:     context.Background(),
+			wait:            10 * time.Millisecond,
+			wantStartErr:    assert.NoError,
+			wantShutdownErr: assert.NoError,
+		},
+		{
+			name: "insane grpc port",
+			opts: []handlers.Option{
+				handlers.WithPort(0),
+				handlers.WithGRPCPort(-666),
+			},
+			shutdownCtx:     context.Background(),
+			wait:            10 * time.Millisecond,
+			wantStartErr:    assert.Error,
+			wantShutdownErr: assert.NoError,
+		},
+		{
+			name: "no logo",
+			opts: []handlers.Option{
+				handlers.WithPort(0),
+				handlers.WithLogo(false),
+			},
+			shutdownCtx:     context.Background(),
+			wait:            10 * time.Millisecond,
+			wantStartErr:    assert.NoError,
+			wantShutdownErr: assert.NoError,
+		},
+		{
+			name: "seed",
+			opts: []handlers.Option{
+				handlers.WithPort(0),
+				handlers.WithSeedFile(seedfile),
+			},
+			shutdownCtx:     context.Background(),
+			wait:            10 * time.Millisecond,
+			wantStartErr:    assert.NoError,
+			wantShutdownErr: assert.NoError,
+		},
+		{
+			name: "bad seed",
+			opts: []handlers.Option{
+				handlers.WithPort(0),
+				handlers.WithSeedFile(filepath.Join(t.TempDir(), "dne.json")),
+			},
+			shutdownCtx:     context.Background(),
+			wait:            10 * time.Millisecond,
+			wantStartErr:    assert.Error,
+			wantShutdownErr: assert.NoError,
+		},
+		{
+			name: "startup hooks",
+			opts: []handlers.Option{
+				handlers.WithPort(0),
+				handlers.WithStartupHook(func(svc *handlers.Service) error {
+					_, err := svc.Repository.New("warmed")
+					return err
+				}),
+				handlers.WithStartupHook(func(svc *handlers.Service) error {
+					_, err := svc.Repository.Database("warmed")
+					return err
+				}),
+			},
+			shutdownCtx:     context.Background(),
+			wait:            10 * time.Millisecond,
+			wantStartErr:    assert.NoError,
+			wantShutdownErr: assert.NoError,
+		},
+		{
+			name: "failing startup hook",
+			opts: []handlers.Option{
+				handlers.WithPort(0),
+				handlers.WithStartupHook(func(*handlers.Service) error {
+					return errors.New("cache unavailable")
+				}),
+			},
+			shutdownCtx:     context.Background(),
+			wait:            10 * time.Millisecond,
+			wantStartErr:    assert.Error,
+			wantShutdownErr: assert.NoError,
+		},
 		{
 			name: "secure",
 			opts: []handlers.Option{
@@ -120,6 +257,419 @@ func TestService_Start(t *testing.T) {
 	}
 }
 
+// startGRPC starts a service with a gRPC port and returns a client of it.
+func startGRPC(t *testing.T, opts ...handlers.Option) (*handlers.Service, pb.BatterDBClient) {
+	t.Helper()
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		t.Fatal("can't read build info")
+	}
+	svc := handlers.New(append(opts,
+		handlers.WithPort(0),
+		handlers.WithGRPCPort(0),
+		handlers.WithBuildInfo(info),
+	)...)
+	go func() {
+		assert.NoError(t, svc.Start())
+	}()
+	t.Cleanup(func() {
+		assert.NoError(t, svc.Shutdown(context.Background()))
+	})
+	require.Eventually(t, func() bool {
+		return svc.Port() != 0 && svc.GRPCPort() != 0
+	}, time.Second, 10*time.Millisecond)
+	conn, err := grpc.NewClient("localhost:"+strconv.Itoa(int(svc.GRPCPort())),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return svc, pb.NewBatterDBClient(conn)
+}
+
+func TestService_GRPCNames(t *testing.T) {
+	t.Parallel()
+	svc, client := startGRPC(t, handlers.WithMaxNameLength(12))
+	_, err := svc.Repository.New("dbName123")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		want codes.Code
+	}{
+		{name: "short", want: codes.InvalidArgument},
+		{name: "waytoolongname", want: codes.InvalidArgument},
+		{name: "00000000-0000-0000-0000-000000000000", want: codes.InvalidArgument},
+		{name: "name1234", want: codes.OK},
+	}
+	ctx := context.Background()
+	for _, tt := range tests {
+		_, err := client.CreateDatabase(ctx, &pb.CreateDatabaseRequest{Name: tt.name})
+		assert.Equal(t, tt.want, status.Code(err), "database "+tt.name)
+		_, err = client.CreateStack(ctx, &pb.CreateStackRequest{Database: "dbName123", Name: tt.name})
+		assert.Equal(t, tt.want, status.Code(err), "stack "+tt.name)
+	}
+}
+
+func TestService_GRPCPush(t *testing.T) {
+	t.Parallel()
+	events := make(chan string, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		events <- string(b)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(srv.Close)
+	svc, client := startGRPC(t,
+		handlers.WithPushWebhook(srv.URL),
+		handlers.WithMetricsNamespace("grpcpush"),
+		handlers.WithPushTransform(func(element any) (any, error) {
+			if element == "rejected" {
+				return nil, errors.New("rejected")
+			}
+			return map[string]any{"element": element}, nil
+		}),
+	)
+	db, err := svc.Repository.New("dbName123")
+	require.NoError(t, err)
+	stack, err := db.New("stackName123")
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	resp, err := client.Push(ctx, &pb.PushRequest{Database: "dbName123", Stack: "stackName123", Element: structpb.NewStringValue("pushed")})
+	require.NoError(t, err)
+	// the response, the stack and the webhook have the element as pushed.
+	assert.Equal(t, map[string]any{"element": "pushed"}, resp.GetElement().AsInterface())
+	assert.Equal(t, map[string]any{"element": "pushed"}, stack.Peek())
+	select {
+	case body := <-events:
+		assert.JSONEq(t, `{"element": "pushed"}`, body)
+	case <-time.After(time.Second):
+		t.Fatal("no webhook event")
+	}
+	_, err = client.Push(ctx, &pb.PushRequest{Database: "dbName123", Stack: "stackName123", Element: structpb.NewStringValue("rejected")})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	metrics, err := http.Get("http://localhost:" + strconv.Itoa(int(svc.Port())) + "/metrics")
+	require.NoError(t, err)
+	defer metrics.Body.Close()
+	b, err := io.ReadAll(metrics.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(b), `grpcpush_stack_operations_total{outcome="ok",type="push"} 1`)
+	assert.Contains(t, string(b), `grpcpush_stack_operations_total{outcome="error",type="push"} 1`)
+}
+
+func TestService_Start_FailedStartup(t *testing.T) {
+	t.Parallel()
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		t.Fatal("can't read build info")
+	}
+	svc := handlers.New(
+		handlers.WithPort(0),
+		handlers.WithAdminPort(0),
+		handlers.WithGRPCPort(0),
+		handlers.WithBuildInfo(info),
+		handlers.WithStartupHook(func(*handlers.Service) error {
+			return errors.New("not ready")
+		}),
+	)
+	require.Error(t, svc.Start())
+
+	// the ports are free again.
+	for _, port := range []int32{svc.Port(), svc.AdminPort(), svc.GRPCPort()} {
+		require.NotZero(t, port)
+		l, err := net.Listen("tcp", ":"+strconv.Itoa(int(port)))
+		require.NoError(t, err)
+		require.NoError(t, l.Close())
+	}
+}
+
+func TestService_AdminPort(t *testing.T) {
+	t.Parallel()
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		t.Fatal("can't read build info")
+	}
+	svc := handlers.New(
+		handlers.WithPort(0),
+		handlers.WithAdminPort(0),
+		handlers.WithBuildInfo(info),
+	)
+	go func() {
+		assert.NoError(t, svc.Start())
+	}()
+	t.Cleanup(func() {
+		assert.NoError(t, svc.Shutdown(context.Background()))
+	})
+	require.Eventually(t, func() bool {
+		return svc.AdminPort() != 0
+	}, time.Second, 10*time.Millisecond)
+
+	// Close the idle connections before the shutdown (cleanups run last in,
+	// first out), as the server waits for them until its deadline.
+	client := &http.Client{Transport: new(http.Transport)}
+	t.Cleanup(client.CloseIdleConnections)
+
+	tests := []struct {
+		name string
+		port int32
+		path string
+		want int
+	}{
+		{name: "main data", port: svc.Port(), path: "/databases", want: http.StatusOK},
+		{name: "main ping", port: svc.Port(), path: "/_ping", want: http.StatusNotFound},
+		{name: "main metrics", port: svc.Port(), path: "/metrics", want: http.StatusNotFound},
+		{name: "admin ping", port: svc.AdminPort(), path: "/_ping", want: http.StatusOK},
+		{name: "admin status", port: svc.AdminPort(), path: "/_status", want: http.StatusOK},
+		{name: "admin metrics", port: svc.AdminPort(), path: "/metrics", want: http.StatusOK},
+		{name: "admin data", port: svc.AdminPort(), path: "/databases", want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			resp, err := client.Get("http://localhost:" + strconv.Itoa(int(tt.port)) + tt.path)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, tt.want, resp.StatusCode)
+		})
+	}
+}
+
+func TestService_CustomRoutes(t *testing.T) {
+	t.Parallel()
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		t.Fatal("can't read build info")
+	}
+	svc := handlers.New(
+		handlers.WithPort(0),
+		handlers.WithBuildInfo(info),
+	)
+	svc.Handle("GET /custom/plain", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	huma.Register(svc.API, huma.Operation{
+		OperationID: "custom-operation",
+		Method:      http.MethodGet,
+		Path:        "/custom/operation",
+	}, func(context.Context, *struct{}) (*struct{}, error) {
+		return nil, nil
+	})
+	assert.Contains(t, svc.API.OpenAPI().Paths, "/custom/operation")
+	assert.NotContains(t, svc.API.OpenAPI().Paths, "/custom/plain")
+
+	go func() {
+		assert.NoError(t, svc.Start())
+	}()
+	t.Cleanup(func() {
+		assert.NoError(t, svc.Shutdown(context.Background()))
+	})
+	require.Eventually(t, func() bool {
+		return svc.Port() != 0
+	}, time.Second, 10*time.Millisecond)
+
+	// Close the idle connections before the shutdown (cleanups run last in,
+	// first out), as the server waits for them until its deadline.
+	client := &http.Client{Transport: new(http.Transport)}
+	t.Cleanup(client.CloseIdleConnections)
+
+	tests := []struct {
+		name string
+		path string
+		want int
+	}{
+		{name: "plain handler", path: "/custom/plain", want: http.StatusTeapot},
+		{name: "operation", path: "/custom/operation", want: http.StatusNoContent},
+		{name: "built-in", path: "/databases", want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			resp, err := client.Get("http://localhost:" + strconv.Itoa(int(svc.Port())) + tt.path)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, tt.want, resp.StatusCode)
+		})
+	}
+}
+
+func TestService_Autosave(t *testing.T) {
+	t.Parallel()
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		t.Fatal("can't read build info")
+	}
+	filename := filepath.Join(t.TempDir(), "autosave")
+	svc := handlers.New(
+		handlers.WithPort(0),
+		handlers.WithPersistDB(true),
+		handlers.WithRepoFile(filename),
+		handlers.WithAutosave(10*time.Millisecond),
+		handlers.WithAutosaveJitter(10*time.Millisecond),
+		handlers.WithBuildInfo(info),
+	)
+	go func() {
+		assert.NoError(t, svc.Start())
+	}()
+
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(filename)
+		return err == nil
+	}, time.Second, 5*time.Millisecond)
+	require.NoError(t, svc.Shutdown(context.Background()))
+}
+
+func TestService_Autosave_Concurrent(t *testing.T) {
+	t.Parallel()
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		t.Fatal("can't read build info")
+	}
+	tests := []struct {
+		name string
+		opt  func(path string) handlers.Option
+	}{
+		{name: "file", opt: handlers.WithRepoFile},
+		{name: "dir", opt: handlers.WithPersistDir},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			path := filepath.Join(t.TempDir(), "autosave")
+			svc := handlers.New(
+				handlers.WithPort(0),
+				handlers.WithPersistDB(true),
+				tt.opt(path),
+				handlers.WithAutosave(time.Millisecond),
+				handlers.WithBuildInfo(info),
+			)
+			go func() {
+				assert.NoError(t, svc.Start())
+			}()
+			require.Eventually(t, func() bool {
+				return svc.Port() != 0
+			}, time.Second, 10*time.Millisecond)
+
+			// mutate databases, stacks and elements while autosaves encode them.
+			db, err := svc.Repository.New("database0")
+			require.NoError(t, err)
+			for i := range 200 {
+				stack, err := db.New("stack" + strconv.Itoa(i))
+				require.NoError(t, err)
+				stack.Push("element" + strconv.Itoa(i))
+				stack.SetLabels(map[string]string{"i": strconv.Itoa(i)})
+				if i%2 == 0 {
+					require.NoError(t, db.Drop(stack.ID.String()))
+				}
+				other, err := svc.Repository.New("other" + strconv.Itoa(i))
+				require.NoError(t, err)
+				require.NoError(t, svc.Repository.Drop(other.ID.String()))
+				time.Sleep(100 * time.Microsecond)
+			}
+			require.NoError(t, svc.Shutdown(context.Background()))
+		})
+	}
+}
+
+func TestService_DrainWindow(t *testing.T) {
+	t.Parallel()
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		t.Fatal("can't read build info")
+	}
+	svc := handlers.New(
+		handlers.WithPort(0),
+		handlers.WithDrainWindow(500*time.Millisecond),
+		handlers.WithBuildInfo(info),
+	)
+	go func() {
+		assert.NoError(t, svc.Start())
+	}()
+	require.Eventually(t, func() bool {
+		return svc.Port() != 0
+	}, time.Second, 10*time.Millisecond)
+	url := "http://localhost:" + strconv.Itoa(int(svc.Port())) + "/_ping"
+
+	resp, err := http.Get(url)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	require.NotEqual(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+	shutdown := make(chan error)
+	go func() {
+		shutdown <- svc.Shutdown(context.Background())
+	}()
+	require.Eventually(t, func() bool {
+		resp, err := http.Get(url)
+		if err != nil {
+			return false
+		}
+		_ = resp.Body.Close()
+		return resp.StatusCode == http.StatusServiceUnavailable && resp.Header.Get("Retry-After") == "1"
+	}, time.Second, 10*time.Millisecond)
+	require.NoError(t, <-shutdown)
+}
+
+func TestService_ShutdownHooks(t *testing.T) {
+	t.Parallel()
+	errHook := errors.New("hook failed")
+	tests := []struct {
+		name      string
+		opts      []handlers.Option
+		failHook  bool
+		wantErrIs []error
+	}{
+		{name: "hooks"},
+		{name: "failing hook", failHook: true, wantErrIs: []error{errHook}},
+		{
+			name: "failing hook and save",
+			opts: []handlers.Option{
+				handlers.WithPersistDB(true),
+				handlers.WithRepoFile(""),
+			},
+			failHook:  true,
+			wantErrIs: []error{errHook},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var ran []string
+			svc := handlers.New(append(tt.opts,
+				handlers.WithShutdownHook(func(context.Context) error {
+					ran = append(ran, "first")
+					if tt.failHook {
+						return errHook
+					}
+					return nil
+				}),
+				handlers.WithShutdownHook(func(ctx context.Context) error {
+					ran = append(ran, "second")
+					return ctx.Err()
+				}),
+			)...)
+
+			err := svc.Shutdown(context.Background())
+			assert.Equal(t, []string{"first", "second"}, ran, "all hooks must run in order")
+			if tt.wantErrIs == nil {
+				require.NoError(t, err)
+			}
+			for _, want := range tt.wantErrIs {
+				require.ErrorIs(t, err, want)
+			}
+			if tt.opts != nil {
+				require.NotEqual(t, errHook.Error(), err.Error(), "the save error must be included")
+			}
+		})
+	}
+}
+
 func TestService_SaveToFile(t *testing.T) {
 	t.Parallel()
 	type args struct {
@@ -128,6 +678,7 @@ func TestService_SaveToFile(t *testing.T) {
 	tests := []struct {
 		name    string
 		save    bool
+		opts    []handlers.Option
 		args    args
 		wantErr assert.ErrorAssertionFunc
 	}{
@@ -154,19 +705,172 @@ func TestService_SaveToFile(t *testing.T) {
 			},
 			wantErr: assert.Error,
 		},
+		{
+			name: "save missing dir",
+			save: true,
+			args: args{
+				filename: filepath.Join("missing", "dir", "test"),
+			},
+			wantErr: assert.NoError,
+		},
+		{
+			name: "save missing dir not created",
+			save: true,
+			opts: []handlers.Option{handlers.WithCreatePersistDir(false)},
+			args: args{
+				filename: filepath.Join("missing", "dir", "test"),
+			},
+			wantErr: assert.Error,
+		},
+		{
+			name: "save missing persist dir",
+			save: true,
+			opts: []handlers.Option{handlers.WithPersistDir(filepath.Join(t.TempDir(), "missing", "dir"))},
+			args: args{
+				filename: "test",
+			},
+			wantErr: assert.NoError,
+		},
+		{
+			name: "save missing persist dir not created",
+			save: true,
+			opts: []handlers.Option{
+				handlers.WithPersistDir(filepath.Join(t.TempDir(), "missing", "dir")),
+				handlers.WithCreatePersistDir(false),
+			},
+			args: args{
+				filename: "test",
+			},
+			wantErr: assert.Error,
+		},
+		{
+			name: "save verified",
+			save: true,
+			opts: []handlers.Option{handlers.WithVerifyPersist()},
+			args: args{
+				filename: "test",
+			},
+			wantErr: assert.NoError,
+		},
+		{
+			name: "save too large",
+			save: true,
+			opts: []handlers.Option{handlers.WithMaxPersistBytes(1)},
+			args: args{
+				filename: "test",
+			},
+			wantErr: assert.Error,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
-			svc := handlers.New(
+			svc := handlers.New(append(tt.opts,
 				handlers.WithPersistDB(tt.save),
 				handlers.WithRepoFile(filepath.Join(t.TempDir(), tt.args.filename)),
-			)
+			)...)
 			tt.wantErr(t, svc.SaveToFile())
 		})
 	}
 }
 
+func TestService_SaveToFile_Concurrent(t *testing.T) {
+	t.Parallel()
+	filename := filepath.Join(t.TempDir(), t.Name())
+	svc := handlers.New(
+		handlers.WithPersistDB(true),
+		handlers.WithRepoFile(filename),
+	)
+	for i := range 10 {
+		_, err := svc.Repository.New("database" + strconv.Itoa(i))
+		require.NoError(t, err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 100)
+	for range cap(errs) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- svc.SaveToFile()
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	repo := repository.New()
+	require.NoError(t, repo.Load(filename))
+	assert.Equal(t, 10, repo.Len())
+}
+
+type (
+	// slowElement blocks its first decoding until the gate is released, to
+	// hold a save in progress in its verification.
+	slowElement struct{}
+	slowGate    struct {
+		once    sync.Once
+		started chan struct{}
+		release chan struct{}
+	}
+)
+
+var currentSlowGate atomic.Pointer[slowGate]
+
+func (slowElement) GobEncode() ([]byte, error) { return nil, nil }
+
+func (*slowElement) GobDecode([]byte) error {
+	if g := currentSlowGate.Load(); g != nil {
+		g.once.Do(func() {
+			close(g.started)
+			<-g.release
+		})
+	}
+
+	return nil
+}
+
+func TestService_SaveToFile_DuringSave(t *testing.T) {
+	t.Parallel()
+	gob.Register(slowElement{})
+	gate := &slowGate{started: make(chan struct{}), release: make(chan struct{})}
+	currentSlowGate.Store(gate)
+	filename := filepath.Join(t.TempDir(), t.Name())
+	svc := handlers.New(
+		handlers.WithPersistDB(true),
+		handlers.WithRepoFile(filename),
+		handlers.WithVerifyPersist(),
+	)
+	db, err := svc.Repository.New("database0")
+	require.NoError(t, err)
+	stack, err := db.New("stack0")
+	require.NoError(t, err)
+	stack.Push(slowElement{})
+
+	errs := make(chan error, 2)
+	go func() { errs <- svc.SaveToFile() }()
+	<-gate.started
+	// the running save has already written its snapshot, so this change
+	// needs another one.
+	stack.Push("late")
+	go func() { errs <- svc.SaveToFile() }()
+	// give the second call time to arrive while the first is running.
+	time.Sleep(50 * time.Millisecond)
+	close(gate.release)
+	require.NoError(t, <-errs)
+	require.NoError(t, <-errs)
+
+	repo := repository.New()
+	require.NoError(t, repo.Load(filename))
+	loaded, err := repo.Database("database0")
+	require.NoError(t, err)
+	loadedStack, err := loaded.Stack("stack0")
+	require.NoError(t, err)
+	assert.Equal(t, "late", loadedStack.Peek())
+}
+
 func TestService_LoadToFile(t *testing.T) {
 	t.Parallel()
 
@@ -177,6 +881,10 @@ func TestService_LoadToFile(t *testing.T) {
 	}
 	persistedRepoFile := filepath.Join(t.TempDir(), t.Name())
 	require.NoError(t, persistedRepo.Persist(persistedRepoFile))
+	staleRepoFile := filepath.Join(t.TempDir(), "stale")
+	require.NoError(t, persistedRepo.Persist(staleRepoFile))
+	old := time.Now().Add(-48 * time.Hour)
+	require.NoError(t, os.Chtimes(staleRepoFile, old, old))
 
 	type args struct {
 		filename string
@@ -184,6 +892,7 @@ func TestService_LoadToFile(t *testing.T) {
 	tests := []struct {
 		name    string
 		persist bool
+		opts    []handlers.Option
 		args    args
 		wantErr assert.ErrorAssertionFunc
 		wantDB  int
@@ -214,6 +923,26 @@ func TestService_LoadToFile(t *testing.T) {
 			wantErr: assert.NoError,
 			wantDB:  10,
 		},
+		{
+			name:    "fresh enough load",
+			persist: true,
+			opts:    []handlers.Option{handlers.WithMaxPersistAge(time.Hour)},
+			args: args{
+				filename: persistedRepoFile,
+			},
+			wantErr: assert.NoError,
+			wantDB:  10,
+		},
+		{
+			name:    "too old load",
+			persist: true,
+			opts:    []handlers.Option{handlers.WithMaxPersistAge(time.Hour)},
+			args: args{
+				filename: staleRepoFile,
+			},
+			wantErr: assert.NoError,
+			wantDB:  0,
+		},
 		{
 			name:    "save bad file",
 			persist: true,
@@ -226,10 +955,10 @@ func TestService_LoadToFile(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
-			svc := handlers.New(
+			svc := handlers.New(append(tt.opts,
 				handlers.WithPersistDB(tt.persist),
 				handlers.WithRepoFile(tt.args.filename),
-			)
+			)...)
 			err := svc.LoadToFile()
 			if tt.wantErr(t, err); err != nil {
 				return
@@ -239,6 +968,161 @@ func TestService_LoadToFile(t *testing.T) {
 	}
 }
 
+func TestService_LoadToFile_TolerateCorrupt(t *testing.T) {
+	t.Parallel()
+	persistedRepo := repository.New()
+	for i := range 10 {
+		_, err := persistedRepo.New("database" + strconv.Itoa(i))
+		require.NoError(t, err)
+	}
+
+	tests := []struct {
+		name      string
+		opts      []handlers.Option
+		content   func(t *testing.T, filename string) []byte
+		wantErr   assert.ErrorAssertionFunc
+		wantAside bool
+	}{
+		{
+			name: "fail fast",
+			content: func(t *testing.T, filename string) []byte {
+				t.Helper()
+				require.NoError(t, persistedRepo.Persist(filename))
+				b, err := os.ReadFile(filename)
+				require.NoError(t, err)
+				return b[:len(b)/2]
+			},
+			wantErr: assert.Error,
+		},
+		{
+			name: "truncated",
+			opts: []handlers.Option{handlers.WithTolerateCorruptLoad()},
+			content: func(t *testing.T, filename string) []byte {
+				t.Helper()
+				require.NoError(t, persistedRepo.Persist(filename))
+				b, err := os.ReadFile(filename)
+				require.NoError(t, err)
+				return b[:len(b)/2]
+			},
+			wantErr:   assert.NoError,
+			wantAside: true,
+		},
+		{
+			name: "newer version",
+			opts: []handlers.Option{handlers.WithTolerateCorruptLoad()},
+			content: func(*testing.T, string) []byte {
+				return []byte("\x00batterdb\x63")
+			},
+			wantErr: assert.Error,
+		},
+		{
+			name: "unreadable",
+			opts: []handlers.Option{handlers.WithTolerateCorruptLoad()},
+			content: func(t *testing.T, filename string) []byte {
+				t.Helper()
+				// reading a directory fails like an I/O error.
+				require.NoError(t, os.Mkdir(filename, 0o750))
+				return nil
+			},
+			wantErr: assert.Error,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			dir := t.TempDir()
+			filename := filepath.Join(dir, "repo")
+			content := tt.content(t, filename)
+			if content != nil {
+				require.NoError(t, os.WriteFile(filename, content, 0o600))
+			}
+
+			svc := handlers.New(append(tt.opts,
+				handlers.WithPersistDB(true),
+				handlers.WithRepoFile(filename),
+			)...)
+			tt.wantErr(t, svc.LoadToFile())
+			assert.Equal(t, 0, svc.Repository.Len(), "nothing of a corrupt file must be loaded")
+			aside, err := filepath.Glob(filename + ".corrupt.*")
+			require.NoError(t, err)
+			if !tt.wantAside {
+				assert.Empty(t, aside)
+				return
+			}
+			require.Len(t, aside, 1)
+			b, err := os.ReadFile(aside[0])
+			require.NoError(t, err)
+			assert.Equal(t, content, b, "the corrupt file must be kept for recovery")
+			assert.NoFileExists(t, filename)
+		})
+	}
+}
+
+func TestService_LoadToFile_TolerateCorrupt_Dir(t *testing.T) {
+	t.Parallel()
+	persistedRepo := repository.New()
+	for _, dbName := range []string{"healthy", "corrupt"} {
+		_, err := persistedRepo.New(dbName)
+		require.NoError(t, err)
+	}
+	dir := filepath.Join(t.TempDir(), "repo")
+	require.NoError(t, persistedRepo.PersistDir(dir))
+	corrupt := filepath.Join(dir, "corrupt.gob")
+	require.NoError(t, os.WriteFile(corrupt, []byte("garbage"), 0o600))
+
+	svc := handlers.New(
+		handlers.WithPersistDB(true),
+		handlers.WithPersistDir(dir),
+		handlers.WithTolerateCorruptLoad(),
+	)
+	require.NoError(t, svc.LoadToFile())
+	// only the corrupt file is moved aside, the healthy database loads.
+	assert.DirExists(t, dir)
+	_, err := svc.Repository.Database("healthy")
+	require.NoError(t, err)
+	assert.Equal(t, 1, svc.Repository.Len())
+	assert.NoFileExists(t, corrupt)
+	aside, err := filepath.Glob(dir + ".corrupt*")
+	require.NoError(t, err)
+	assert.Empty(t, aside)
+}
+
+func TestService_LoadToFile_MaxLoadDatabases(t *testing.T) {
+	t.Parallel()
+	persistedRepo := repository.New()
+	for i := range 10 {
+		_, err := persistedRepo.New("database" + strconv.Itoa(i))
+		require.NoError(t, err)
+	}
+	filename := filepath.Join(t.TempDir(), "repo")
+	require.NoError(t, persistedRepo.Persist(filename))
+
+	tests := []struct {
+		name    string
+		opts    []handlers.Option
+		wantErr assert.ErrorAssertionFunc
+	}{
+		{name: "unlimited", wantErr: assert.NoError},
+		{name: "within limit", opts: []handlers.Option{handlers.WithMaxLoadDatabases(10)}, wantErr: assert.NoError},
+		{name: "over limit", opts: []handlers.Option{handlers.WithMaxLoadDatabases(9)}, wantErr: assert.Error},
+		{
+			name:    "over limit warn only",
+			opts:    []handlers.Option{handlers.WithMaxLoadDatabases(9), handlers.WithMaxLoadDatabasesWarnOnly()},
+			wantErr: assert.NoError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			svc := handlers.New(append(tt.opts,
+				handlers.WithPersistDB(true),
+				handlers.WithRepoFile(filename),
+			)...)
+			tt.wantErr(t, svc.LoadToFile())
+		})
+	}
+}
+
 func TestService_OpenAPI(t *testing.T) {
 	t.Parallel()
 
@@ -289,3 +1173,60 @@ func TestService_OpenAPI(t *testing.T) {
 		})
 	}
 }
+
+func TestService_OpenAPIServers(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		opts []handlers.Option
+		want []string
+	}{
+		{name: "no port", want: nil},
+		{name: "inferred", opts: []handlers.Option{handlers.WithPort(1205)}, want: []string{"http://localhost:1205"}},
+		{
+			name: "inferred secure",
+			opts: []handlers.Option{handlers.WithPort(1205), handlers.WithSecure(true)},
+			want: []string{"https://localhost:1205"},
+		},
+		{
+			name: "explicit",
+			opts: []handlers.Option{
+				handlers.WithPort(1205),
+				handlers.WithOpenAPIServers([]string{"https://batterdb.example.com", "http://localhost:8080"}),
+			},
+			want: []string{"https://batterdb.example.com", "http://localhost:8080"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			svc := handlers.New(tt.opts...)
+			var got []string
+			for _, server := range svc.API.OpenAPI().Servers {
+				got = append(got, server.URL)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestService_YAMLIndent(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		opts []handlers.Option
+		want string
+	}{
+		{name: "default", want: "key:\n    nested: value\n"},
+		{name: "two", opts: []handlers.Option{handlers.WithYAMLIndent(2)}, want: "key:\n  nested: value\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			svc := handlers.New(tt.opts...)
+			var bb bytes.Buffer
+			require.NoError(t, svc.API.Marshal(&bb, "application/yaml", map[string]any{"key": map[string]any{"nested": "value"}}))
+			assert.Equal(t, tt.want, bb.String())
+		})
+	}
+}
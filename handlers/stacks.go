@@ -1,20 +1,32 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/danielgtaylor/huma/v2"
+	"github.com/google/uuid"
 
+	"github.com/jh125486/batterdb/formats/text"
 	"github.com/jh125486/batterdb/repository"
 )
 
 type (
 	StackInput struct {
 		URLParamDatabaseID
-		KV bool `default:"false" query:"kv"`
+		Sort      string   `default:"name" doc:"sort by name or by last read time" enum:"name,read" query:"sort"`
+		Order     string   `default:"asc" enum:"asc,desc" query:"order"`
+		Label     []string `doc:"only show stacks with these labels, as key=value" query:"label"`
+		Limit     int      `default:"0" doc:"maximum number of stacks to return, 0 for all" minimum:"0" query:"limit"`
+		KV        bool     `default:"false" query:"kv"`
+		WithBytes bool     `default:"false" doc:"include the estimated size of the elements in bytes" query:"withBytes"`
 	}
 	StacksOutput struct {
 		Body struct {
@@ -22,53 +34,187 @@ type (
 		}
 	}
 	Stack struct {
-		CreatedAt time.Time `json:"created_at"`
-		UpdatedAt time.Time `json:"updated_at"`
-		ReadAt    time.Time `json:"read_at"`
-		Peek      any       `json:"peek"`
-		ID        string    `json:"id"`
-		Name      string    `json:"name"`
-		Size      int       `json:"size"`
+		CreatedAt   time.Time         `json:"created_at"`
+		UpdatedAt   time.Time         `json:"updated_at"`
+		ReadAt      time.Time         `json:"read_at"`
+		Peek        any               `json:"peek"`
+		Labels      map[string]string `json:"labels,omitempty"`
+		Bytes       *int              `doc:"estimated size of the elements in bytes, only with withBytes" json:"bytes,omitempty"`
+		ID          string            `json:"id"`
+		Name        string            `json:"name"`
+		Description string            `json:"description,omitempty"`
+		Elements    []any             `doc:"elements from the bottom up, only when created with elements" json:"elements,omitempty"`
+		Size        int               `json:"size"`
+		Capacity    int               `doc:"number of elements kept by a ring, 0 for a regular stack" json:"capacity,omitempty"`
+		Stats       StackStats        `doc:"lifetime operation counts" json:"stats"`
+	}
+	StackStats struct {
+		Pushes  int64 `json:"pushes"`
+		Pops    int64 `json:"pops"`
+		Peeks   int64 `json:"peeks"`
+		Flushes int64 `json:"flushes"`
 	}
 )
 
+func newStack(stack *repository.Stack) Stack {
+	return Stack{
+		ID:          stack.ID.String(),
+		Name:        stack.Name,
+		Description: stack.Description,
+		Labels:      stack.Labels,
+		Peek:        stack.Top(),
+		Size:        stack.Size(),
+		Capacity:    stack.Capacity,
+		CreatedAt:   stack.CreatedAt,
+		UpdatedAt:   stack.UpdatedAt,
+		ReadAt:      stack.ReadAt.Load(),
+		Stats: StackStats{
+			Pushes:  stack.Stats.Pushes.Load(),
+			Pops:    stack.Stats.Pops.Load(),
+			Peeks:   stack.Stats.Peeks.Load(),
+			Flushes: stack.Stats.Flushes.Load(),
+		},
+	}
+}
+
+// withBytes adds the estimated size of the elements, see
+// repository.Stack.Bytes.
+func (st *Stack) withBytes(stack *repository.Stack) {
+	n := stack.Bytes()
+	st.Bytes = &n
+}
+
 func (s *Service) ListDatabaseStacksHandler(_ context.Context, input *StackInput) (*StacksOutput, error) {
-	db, err := s.Repository.Database(input.DatabaseID)
+	db, err := s.database(input.DatabaseID)
+	if err != nil {
+		return nil, err
+	}
+	labels, err := parseLabels(input.Label)
 	if err != nil {
-		return nil, huma.Error404NotFound("database not found", err)
+		return nil, err
+	}
+	// Listing doesn't count as a read, so stacks can be sorted by staleness
+	// without changing it.
+	sorted := filterStacks(db.SortStacksFunc(stackComparator(input.Sort)), labels)
+	if input.Order == "desc" {
+		slices.Reverse(sorted)
 	}
+	if input.Limit > 0 && len(sorted) > input.Limit {
+		sorted = sorted[:input.Limit]
+	}
+
 	out := new(StacksOutput)
 	if input.KV {
 		stacks := make(map[string]any)
-		for _, stack := range db.SortStacks() {
-			stacks[stack.Name] = stack.Peek()
+		for _, stack := range sorted {
+			stacks[stack.Name] = stack.Top()
 		}
 		out.Body.Stacks = stacks
 
 		return out, nil
 	}
 
-	stacks := make([]any, db.Len())
-	for i, stack := range db.SortStacks() {
-		stacks[i] = Stack{
-			ID:        stack.ID.String(),
-			Name:      stack.Name,
-			Peek:      stack.Peek(),
-			Size:      stack.Size(),
-			CreatedAt: stack.CreatedAt,
-			UpdatedAt: stack.UpdatedAt,
-			ReadAt:    stack.ReadAt,
+	stacks := make([]any, len(sorted))
+	for i, stack := range sorted {
+		st := newStack(stack)
+		if input.WithBytes {
+			st.withBytes(stack)
 		}
+		stacks[i] = st
 	}
 	out.Body.Stacks = stacks
 
 	return out, nil
 }
 
+type (
+	DepthsInput struct {
+		URLParamDatabaseID
+		Top int `default:"0" doc:"only return the deepest N stacks, 0 for all" minimum:"0" query:"top"`
+	}
+	DepthsOutput struct {
+		Body []StackDepth
+	}
+	StackDepth struct {
+		Name string `json:"name"`
+		Size int    `json:"size"`
+	}
+)
+
+// DatabaseDepthsHandler returns the size of every stack of a database,
+// deepest first, to spot backlogs. Like listing, it doesn't count as a read.
+func (s *Service) DatabaseDepthsHandler(_ context.Context, input *DepthsInput) (*DepthsOutput, error) {
+	db, err := s.database(input.DatabaseID)
+	if err != nil {
+		return nil, err
+	}
+	depths := db.Depths()
+	if input.Top > 0 && len(depths) > input.Top {
+		depths = depths[:input.Top]
+	}
+
+	out := new(DepthsOutput)
+	out.Body = make([]StackDepth, len(depths))
+	for i, d := range depths {
+		out.Body[i] = StackDepth{Name: d.Name, Size: d.Size}
+	}
+
+	return out, nil
+}
+
+func stackComparator(sort string) func(a, b *repository.Stack) int {
+	if sort == "read" {
+		return repository.ByReadAt
+	}
+
+	return repository.ByName
+}
+
+// filterStacks returns the stacks that have all the labels.
+func filterStacks(stacks []*repository.Stack, labels map[string]string) []*repository.Stack {
+	if len(labels) == 0 {
+		return stacks
+	}
+	filtered := make([]*repository.Stack, 0, len(stacks))
+	for _, stack := range stacks {
+		if stack.HasLabels(labels) {
+			filtered = append(filtered, stack)
+		}
+	}
+
+	return filtered
+}
+
+// parseLabels parses labels in the form key=value.
+func parseLabels(kvs []string) (map[string]string, error) {
+	if len(kvs) == 0 {
+		return nil, nil
+	}
+	labels := make(map[string]string, len(kvs))
+	for _, kv := range kvs {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || k == "" {
+			return nil, huma.Error422UnprocessableEntity(fmt.Sprintf("label %q must be in the form key=value", kv))
+		}
+		labels[k] = v
+	}
+
+	return labels, nil
+}
+
 type (
 	CreateDatabaseStackInput struct {
+		// Body is a pointer, as huma requires every non-pointer body.
+		Body *CreateDatabaseStackBody
 		URLParamDatabaseID
-		Name string `minLength:"7" query:"name" required:"true"`
+		Name        string   `minLength:"7" query:"name" required:"true"`
+		Description string   `doc:"human-readable description of the stack" query:"description"`
+		Label       []string `doc:"labels of the stack, as key=value" query:"label"`
+		Capacity    int      `doc:"number of elements kept by a ring" minimum:"0" query:"capacity"`
+		Ring        bool     `default:"false" doc:"keep only the newest capacity elements, dropping the oldest on push" query:"ring"`
+	}
+	CreateDatabaseStackBody struct {
+		Elements []any `doc:"elements to push to the new stack, from the bottom up" json:"elements,omitempty"`
 	}
 	StackOutput struct {
 		Body Stack `json:"stack"`
@@ -76,29 +222,110 @@ type (
 )
 
 func (s *Service) CreateDatabaseStackHandler(_ context.Context, input *CreateDatabaseStackInput) (*StackOutput, error) {
-	db, err := s.Repository.Database(input.DatabaseID)
+	labels, elements, err := s.validateCreateStack(input)
+	if err != nil {
+		return nil, err
+	}
+	db, err := s.database(input.DatabaseID)
 	if err != nil {
-		return nil, huma.Error404NotFound("database not found", err)
+		return nil, err
+	}
+	if err := s.checkCreateElements(db, elements); err != nil {
+		return nil, err
 	}
 	stack, err := db.New(input.Name)
-	if errors.Is(err, repository.ErrAlreadyExists) {
-		return nil, huma.Error409Conflict("stack already exists", err)
+	if err != nil {
+		return nil, s.createStackError(err)
+	}
+	if input.Description != "" {
+		stack.SetDescription(input.Description)
+	}
+	if labels != nil {
+		stack.SetLabels(labels)
+	}
+	if input.Ring {
+		stack.SetCapacity(input.Capacity)
+	}
+	// pushed under one lock, so readers never see only some of the elements.
+	if _, err := s.pushMany(stack, elements); err != nil {
+		return nil, s.pushError(err)
+	}
+	for _, element := range elements {
+		s.pushed(db, stack, element)
 	}
 
 	out := new(StackOutput)
-	out.Body = Stack{
-		ID:        stack.ID.String(),
-		Name:      stack.Name,
-		Peek:      stack.Peek(),
-		Size:      stack.Size(),
-		CreatedAt: stack.CreatedAt,
-		UpdatedAt: stack.UpdatedAt,
-		ReadAt:    stack.ReadAt,
+	out.Body = newStack(stack)
+	if len(elements) > 0 {
+		out.Body.Elements = stack.Elements(0, stack.Size())
 	}
 
 	return out, nil
 }
 
+// validateCreateStack validates the input of CreateDatabaseStackHandler, and
+// returns the parsed labels and the prepared elements to push.
+func (s *Service) validateCreateStack(input *CreateDatabaseStackInput) (map[string]string, []any, error) {
+	if err := s.validateName(input.Name); err != nil {
+		return nil, nil, err
+	}
+	if input.Ring != (input.Capacity > 0) {
+		return nil, nil, huma.Error422UnprocessableEntity("ring and capacity must be set together")
+	}
+	labels, err := parseLabels(input.Label)
+	if err != nil {
+		return nil, nil, err
+	}
+	if input.Body == nil {
+		input.Body = new(CreateDatabaseStackBody)
+	}
+	if err := s.checkStackSize(input); err != nil {
+		return nil, nil, err
+	}
+	elements := make([]any, len(input.Body.Elements))
+	for i, element := range input.Body.Elements {
+		if elements[i], err = s.prepareElement(element); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return labels, elements, nil
+}
+
+// checkCreateElements fails before a stack is created with initial elements
+// the database doesn't accept.
+func (s *Service) checkCreateElements(db *repository.Database, elements []any) error {
+	if len(elements) == 0 {
+		return nil
+	}
+	if db.IsCounter() {
+		return huma.Error422UnprocessableEntity("can't push to a counter database")
+	}
+	if schema := db.ElementSchema(); schema != nil {
+		for _, element := range elements {
+			if err := s.matchSchema(schema, element); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkStackSize fails before a stack is created with more initial elements
+// than WithMaxStackSize allows.
+func (s *Service) checkStackSize(input *CreateDatabaseStackInput) error {
+	n := len(input.Body.Elements)
+	if input.Ring {
+		n = min(n, input.Capacity)
+	}
+	if s.maxStackSize > 0 && n > s.maxStackSize {
+		return s.pushError(fmt.Errorf("%w: at most %d elements", repository.ErrStackFull, s.maxStackSize))
+	}
+
+	return nil
+}
+
 type (
 	DatabaseStackInput struct {
 		URLParamDatabaseID
@@ -109,23 +336,86 @@ type (
 	}
 )
 
-func (s *Service) ShowDatabaseStackHandler(_ context.Context, input *DatabaseStackInput) (*StackOutput, error) {
+type ShowDatabaseStackInput struct {
+	DatabaseStackInput
+	WithBytes bool `default:"false" doc:"include the estimated size of the elements in bytes" query:"withBytes"`
+}
+
+func (s *Service) ShowDatabaseStackHandler(_ context.Context, input *ShowDatabaseStackInput) (*StackOutput, error) {
 	_, stack, err := s.stack(input.DatabaseID, input.StackID)
 	if err != nil {
 		return nil, err
 	}
 
 	out := new(StackOutput)
-	out.Body = Stack{
-		ID:        stack.ID.String(),
-		Name:      stack.Name,
-		Peek:      stack.Peek(),
-		Size:      stack.Size(),
-		CreatedAt: stack.CreatedAt,
-		UpdatedAt: stack.UpdatedAt,
-		ReadAt:    stack.ReadAt,
+	out.Body = newStack(stack)
+	if input.WithBytes {
+		out.Body.withBytes(stack)
+	}
+
+	return out, nil
+}
+
+type ActivityOutput struct {
+	Body struct {
+		CreatedAt  time.Time  `json:"created_at"`
+		LastPushAt *time.Time `doc:"last push, absent if never pushed" json:"last_push_at,omitempty"`
+		LastPopAt  *time.Time `doc:"last pop, absent if never popped"  json:"last_pop_at,omitempty"`
+		LastPeekAt *time.Time `doc:"last peek, absent if never peeked" json:"last_peek_at,omitempty"`
+	}
+}
+
+// ActivityDatabaseStackHandler shows when a stack was created and last
+// pushed, popped and peeked. Stacks persisted before these were tracked have
+// no activity until their next operation.
+func (s *Service) ActivityDatabaseStackHandler(_ context.Context, input *DatabaseStackInput) (*ActivityOutput, error) {
+	_, stack, err := s.stack(input.DatabaseID, input.StackID)
+	if err != nil {
+		return nil, err
 	}
 
+	lastPushAt, lastPopAt := stack.Activity()
+	out := new(ActivityOutput)
+	out.Body.CreatedAt = stack.CreatedAt
+	out.Body.LastPushAt = timeOrNil(lastPushAt)
+	out.Body.LastPopAt = timeOrNil(lastPopAt)
+	out.Body.LastPeekAt = timeOrNil(stack.LastPeekAt.Load())
+
+	return out, nil
+}
+
+// timeOrNil returns nil for the zero time, so it's omitted from the output.
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	return &t
+}
+
+type UpdateDatabaseStackInput struct {
+	Body struct {
+		Description *string           `doc:"human-readable description of the stack" json:"description,omitempty"`
+		Labels      map[string]string `doc:"replaces the labels of the stack"        json:"labels,omitempty"`
+	}
+	DatabaseStackInput
+}
+
+func (s *Service) UpdateDatabaseStackHandler(_ context.Context, input *UpdateDatabaseStackInput) (*StackOutput, error) {
+	_, stack, err := s.stack(input.DatabaseID, input.StackID)
+	if err != nil {
+		return nil, err
+	}
+	if input.Body.Description != nil {
+		stack.SetDescription(*input.Body.Description)
+	}
+	if input.Body.Labels != nil {
+		stack.SetLabels(input.Body.Labels)
+	}
+
+	out := new(StackOutput)
+	out.Body = newStack(stack)
+
 	return out, nil
 }
 
@@ -147,21 +437,252 @@ func (s *Service) PeekDatabaseStackHandler(_ context.Context, input *DatabaseSta
 	return out, nil
 }
 
+type RawElementOutput struct {
+	ContentType string `header:"Content-Type"`
+	Body        []byte
+	Status      int
+}
+
+// PeekRawDatabaseStackHandler returns the top element without an envelope, as
+// text/plain. Only strings and text marshalers can be returned raw.
+func (s *Service) PeekRawDatabaseStackHandler(_ context.Context, input *DatabaseStackInput) (*RawElementOutput, error) {
+	_, stack, err := s.stack(input.DatabaseID, input.StackID)
+	if err != nil {
+		return nil, err
+	}
+	out := new(RawElementOutput)
+
+	v := stack.Peek()
+	if v == nil {
+		out.Status = http.StatusNoContent
+		return out, nil
+	}
+	b, ok, err := text.MarshalText(v)
+	if err != nil {
+		return nil, huma.Error500InternalServerError("failed to marshal element", err)
+	}
+	if !ok {
+		return nil, huma.Error415UnsupportedMediaType("top element is not text")
+	}
+
+	out.Status = http.StatusOK
+	out.ContentType = "text/plain; charset=utf-8"
+	out.Body = b
+
+	return out, nil
+}
+
+// TextDatabaseStackHandler returns all elements of a stack as text/plain, one
+// per line from the bottom up, so a stack used as a log reads in order. Text
+// elements are written as is and any other element as a line of JSON.
+func (s *Service) TextDatabaseStackHandler(_ context.Context, input *DatabaseStackInput) (*RawElementOutput, error) {
+	_, stack, err := s.stack(input.DatabaseID, input.StackID)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	for _, v := range stack.Elements(0, stack.Size()) {
+		b, err := text.Marshal(v)
+		if err != nil {
+			return nil, huma.Error500InternalServerError("failed to marshal element", err)
+		}
+		buf.Write(b)
+		buf.WriteByte('\n')
+	}
+
+	out := new(RawElementOutput)
+	out.Status = http.StatusOK
+	out.ContentType = "text/plain; charset=utf-8"
+	out.Body = buf.Bytes()
+
+	return out, nil
+}
+
 type PushDatabaseStackElementInput struct {
 	Body struct {
 		Element any `json:"element"`
 	}
 	DatabaseStackInput
+	CreateMissing bool `default:"false" doc:"create the stack if it does not exist" query:"createMissing"`
 }
 
-func (s *Service) PushDatabaseStackHandler(_ context.Context, input *PushDatabaseStackElementInput) (*StackElement, error) {
+type PushOutput struct {
+	Body struct {
+		Element any    `json:"element"`
+		Dropped any    `doc:"element dropped from the bottom of a ring at capacity" json:"dropped,omitempty"`
+		ID      string `doc:"ID of the element, only with element IDs enabled"     json:"id,omitempty"`
+	}
+}
+
+func (s *Service) PushDatabaseStackHandler(_ context.Context, input *PushDatabaseStackElementInput) (*PushOutput, error) {
+	element, err := s.prepareElement(input.Body.Element)
+	if err != nil {
+		return nil, err
+	}
+	if !input.CreateMissing {
+		db, stack, err := s.stack(input.DatabaseID, input.StackID)
+		if err != nil {
+			return nil, err
+		}
+		return s.pushElement(db, stack, element)
+	}
+	db, stack, created, err := s.stackOrCreate(input.DatabaseID, input.StackID)
+	if err != nil {
+		return nil, err
+	}
+	out, err := s.pushElement(db, stack, element)
+	if err != nil && created && stack.Size() == 0 {
+		// don't leave the stack of a rejected push behind.
+		_ = db.Drop(stack.ID.String())
+	}
+
+	return out, err
+}
+
+// pushElement pushes a prepared element to the stack, see
+// PushDatabaseStackHandler.
+func (s *Service) pushElement(db *repository.Database, stack *repository.Stack, element any) (*PushOutput, error) {
+	if db.IsCounter() {
+		// keep the single element invariant of counters.
+		return nil, huma.Error422UnprocessableEntity("can't push to a counter database")
+	}
+	element, err := s.decodeElement(stack, element)
+	if err != nil {
+		return nil, err
+	}
+	out := new(PushOutput)
+	if out.Body.ID, out.Body.Dropped, err = s.push(stack, element); err != nil {
+		return nil, s.pushError(err)
+	}
+	s.pushed(db, stack, element)
+	out.Body.Element = element
+
+	return out, nil
+}
+
+// push pushes the element, with an ID if WithElementIDs is set, and returns
+// the ID and the element dropped by a ring at capacity.
+func (s *Service) push(stack *repository.Stack, element any) (id string, dropped any, err error) {
+	if !s.elementIDs {
+		dropped, err = stack.Push(element)
+		return "", dropped, err
+	}
+
+	return stack.PushWithID(element)
+}
+
+// pushMany pushes the elements like push, see repository.Stack.PushMany, and
+// returns their IDs, nil without WithElementIDs.
+func (s *Service) pushMany(stack *repository.Stack, elements []any) ([]string, error) {
+	if !s.elementIDs {
+		return nil, stack.PushMany(elements)
+	}
+
+	return stack.PushManyWithIDs(elements)
+}
+
+// pushError maps an error of a push to a response, see WithMaxStackSize.
+func (s *Service) pushError(err error) error {
+	if errors.Is(err, repository.ErrStackFull) {
+		return huma.NewError(http.StatusRequestEntityTooLarge,
+			fmt.Sprintf("stack must not have more than %d elements", s.maxStackSize), err)
+	}
+
+	return huma.Error500InternalServerError("failed to push", err)
+}
+
+type (
+	PushManyDatabaseStackInput struct {
+		DatabaseStackInput
+		Body struct {
+			Elements []any `doc:"elements to push in order, the last one ends up on top" json:"elements"`
+		}
+	}
+	PushManyOutput struct {
+		Body struct {
+			Top    any      `doc:"top element after the push"                                json:"top"`
+			IDs    []string `doc:"IDs of the elements in order, only with element IDs enabled" json:"ids,omitempty"`
+			Pushed int      `json:"pushed"`
+			Size   int      `json:"size"`
+		}
+	}
+)
+
+// PushManyDatabaseStackHandler pushes the elements in order under a single
+// lock, see repository.Stack.PushMany.
+func (s *Service) PushManyDatabaseStackHandler(_ context.Context, input *PushManyDatabaseStackInput) (*PushManyOutput, error) {
+	if len(input.Body.Elements) == 0 {
+		return nil, huma.Error400BadRequest("elements must not be empty")
+	}
+	if s.maxBatchSize > 0 && len(input.Body.Elements) > s.maxBatchSize {
+		return nil, huma.Error422UnprocessableEntity(fmt.Sprintf("bulk push must not contain more than %d elements", s.maxBatchSize))
+	}
+	db, stack, err := s.stack(input.DatabaseID, input.StackID)
+	if err != nil {
+		return nil, err
+	}
+	if db.IsCounter() {
+		return nil, huma.Error422UnprocessableEntity("can't push to a counter database")
+	}
+	elements := make([]any, len(input.Body.Elements))
+	for i, element := range input.Body.Elements {
+		if elements[i], err = s.preparePush(stack, element); err != nil {
+			return nil, err
+		}
+	}
+	out := new(PushManyOutput)
+	if out.Body.IDs, err = s.pushMany(stack, elements); err != nil {
+		return nil, s.pushError(err)
+	}
+	for _, element := range elements {
+		s.pushed(db, stack, element)
+	}
+
+	out.Body.Pushed = len(elements)
+	out.Body.Size = stack.Size()
+	out.Body.Top = elements[len(elements)-1]
+
+	return out, nil
+}
+
+type ElementInput struct {
+	DatabaseStackInput
+	ElementID string `doc:"ID returned by the push of the element" path:"elementID"`
+}
+
+// GetElementHandler returns an element by its ID (WithElementIDs), wherever it
+// is on the stack, without removing it.
+func (s *Service) GetElementHandler(_ context.Context, input *ElementInput) (*StackElement, error) {
+	_, stack, err := s.stack(input.DatabaseID, input.StackID)
+	if err != nil {
+		return nil, err
+	}
+	element, err := stack.Element(input.ElementID)
+	if err != nil {
+		return nil, huma.Error404NotFound("element not found", err)
+	}
+
+	out := new(StackElement)
+	out.Body.Element = element
+
+	return out, nil
+}
+
+// DeleteElementHandler removes an element by its ID (WithElementIDs), wherever
+// it is on the stack, and returns it.
+func (s *Service) DeleteElementHandler(_ context.Context, input *ElementInput) (*StackElement, error) {
 	_, stack, err := s.stack(input.DatabaseID, input.StackID)
 	if err != nil {
 		return nil, err
 	}
-	stack.Push(input.Body.Element)
+	element, err := stack.DeleteElement(input.ElementID)
+	if err != nil {
+		return nil, huma.Error404NotFound("element not found", err)
+	}
+
 	out := new(StackElement)
-	out.Body.Element = input.Body.Element
+	out.Body.Element = element
 
 	return out, nil
 }
@@ -192,6 +713,198 @@ func (s *Service) PopDatabaseStackHandler(_ context.Context, input *DatabaseStac
 	return out, nil
 }
 
+type PopWaitDatabaseStackInput struct {
+	DatabaseStackInput
+	Timeout int `default:"5000" doc:"maximum time to wait for an element, in milliseconds" maximum:"10000" minimum:"0" query:"timeout"`
+}
+
+func (s *Service) PopWaitDatabaseStackHandler(ctx context.Context, input *PopWaitDatabaseStackInput) (*PopDatabaseStackElementOutput, error) {
+	_, stack, err := s.stack(input.DatabaseID, input.StackID)
+	if err != nil {
+		return nil, err
+	}
+	release, ok := stack.AcquireWaiter(s.maxWaiters)
+	if !ok {
+		return nil, huma.Error503ServiceUnavailable(fmt.Sprintf("stack must not have more than %d waiters", s.maxWaiters))
+	}
+	defer release()
+	// The request context is canceled if the client disconnects, which also
+	// releases the waiter.
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(input.Timeout)*time.Millisecond)
+	defer cancel()
+	out := new(PopDatabaseStackElementOutput)
+
+	v := stack.PopWait(ctx)
+	if v == nil {
+		out.Status = http.StatusNoContent
+		return out, nil
+	}
+
+	out.Status = http.StatusOK
+	out.Body.Element = v
+
+	return out, nil
+}
+
+// streamChunkSize is the number of elements read from a stack under its lock
+// at a time while streaming.
+const streamChunkSize = 1000
+
+// StreamDatabaseStackHandler streams the elements of a stack as NDJSON, top
+// first. The stack is read in chunks so memory stays bounded; elements pushed
+// after the stream started aren't included and popped elements that weren't
+// streamed yet are skipped.
+func (s *Service) StreamDatabaseStackHandler(ctx context.Context, input *DatabaseStackInput) (*huma.StreamResponse, error) {
+	_, stack, err := s.stack(input.DatabaseID, input.StackID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &huma.StreamResponse{
+		Body: func(hctx huma.Context) {
+			hctx.SetHeader("Content-Type", "application/x-ndjson")
+			w := hctx.BodyWriter()
+			enc := json.NewEncoder(w)
+			for end := stack.Size(); end > 0 && ctx.Err() == nil; end -= streamChunkSize {
+				chunk := stack.Elements(max(end-streamChunkSize, 0), end)
+				for i := len(chunk) - 1; i >= 0; i-- {
+					if err := enc.Encode(chunk[i]); err != nil {
+						return
+					}
+				}
+				if f, ok := w.(http.Flusher); ok {
+					f.Flush()
+				}
+			}
+		},
+	}, nil
+}
+
+type (
+	HeadDatabaseStackInput struct {
+		DatabaseStackInput
+		N      int `default:"10" doc:"number of elements to return"               minimum:"0" query:"n"`
+		Offset int `default:"0"  doc:"number of elements to skip from the bottom" minimum:"0" query:"offset"`
+	}
+	StackElements struct {
+		Body struct {
+			Elements   []any `doc:"elements, bottom first"                                     json:"elements"`
+			NextOffset int   `doc:"offset of the next page, only when truncated"               json:"next_offset,omitempty"`
+			Truncated  bool  `doc:"whether n was capped to the maximum elements of a response" json:"truncated,omitempty"`
+		}
+	}
+)
+
+// HeadDatabaseStackHandler returns the oldest elements of a stack, bottom
+// first, without removing them.
+func (s *Service) HeadDatabaseStackHandler(_ context.Context, input *HeadDatabaseStackInput) (*StackElements, error) {
+	_, stack, err := s.stack(input.DatabaseID, input.StackID)
+	if err != nil {
+		return nil, err
+	}
+
+	n, capped := s.capElements(input.N)
+	size := stack.Size()
+	out := new(StackElements)
+	out.Body.Elements = stack.Elements(input.Offset, input.Offset+min(n, size))
+	if out.Body.Elements == nil {
+		out.Body.Elements = []any{}
+	}
+	if next := input.Offset + len(out.Body.Elements); capped && next < size {
+		out.Body.Truncated, out.Body.NextOffset = true, next
+	}
+
+	return out, nil
+}
+
+type (
+	ListDatabaseStackElementsInput struct {
+		DatabaseStackInput
+		Limit  int `default:"100" doc:"maximum number of elements to return"    minimum:"0" query:"limit"`
+		Offset int `default:"0"   doc:"number of elements to skip from the top" minimum:"0" query:"offset"`
+	}
+	ListElementsOutput struct {
+		Body struct {
+			Elements   []any `doc:"elements, top first"                                                json:"elements"`
+			Total      int   `doc:"size of the stack"                                                  json:"total"`
+			NextOffset int   `doc:"offset of the next page, only when truncated"                       json:"next_offset,omitempty"`
+			Truncated  bool  `doc:"whether the limit was capped to the maximum elements of a response" json:"truncated,omitempty"`
+		}
+	}
+)
+
+// ListDatabaseStackElementsHandler pages through the elements of a stack, top
+// first, without removing them.
+func (s *Service) ListDatabaseStackElementsHandler(_ context.Context, input *ListDatabaseStackElementsInput) (*ListElementsOutput, error) {
+	_, stack, err := s.stack(input.DatabaseID, input.StackID)
+	if err != nil {
+		return nil, err
+	}
+
+	limit, capped := s.capElements(input.Limit)
+	out := new(ListElementsOutput)
+	out.Body.Elements, out.Body.Total = stack.Slice(input.Offset, limit)
+	if next := input.Offset + len(out.Body.Elements); capped && next < out.Body.Total {
+		out.Body.Truncated, out.Body.NextOffset = true, next
+	}
+
+	return out, nil
+}
+
+type (
+	PreviewDatabaseStackInput struct {
+		DatabaseStackInput
+		N      int `default:"3" doc:"number of elements to return"            minimum:"0" query:"n"`
+		Offset int `default:"0" doc:"number of elements to skip from the top" minimum:"0" query:"offset"`
+	}
+	PreviewOutput struct {
+		Body struct {
+			Elements   []IndexedElement `doc:"elements, top first"                                        json:"elements"`
+			NextOffset int              `doc:"offset of the next page, only when truncated"               json:"next_offset,omitempty"`
+			Truncated  bool             `doc:"whether n was capped to the maximum elements of a response" json:"truncated,omitempty"`
+		}
+	}
+	IndexedElement struct {
+		Element any `json:"element"`
+		Index   int `doc:"position from the bottom of the stack, starting at 0" json:"index"`
+	}
+)
+
+// PreviewDatabaseStackHandler returns the top elements of a stack, top first,
+// each with its position, without removing them.
+func (s *Service) PreviewDatabaseStackHandler(_ context.Context, input *PreviewDatabaseStackInput) (*PreviewOutput, error) {
+	_, stack, err := s.stack(input.DatabaseID, input.StackID)
+	if err != nil {
+		return nil, err
+	}
+
+	n, capped := s.capElements(input.N)
+	size := stack.Size()
+	end := max(size-input.Offset, 0)
+	start := max(end-n, 0)
+	elements := stack.Elements(start, end)
+	out := new(PreviewOutput)
+	out.Body.Elements = make([]IndexedElement, len(elements))
+	for i, e := range elements {
+		out.Body.Elements[len(elements)-1-i] = IndexedElement{Element: e, Index: start + i}
+	}
+	if capped && start > 0 {
+		out.Body.Truncated, out.Body.NextOffset = true, size-start
+	}
+
+	return out, nil
+}
+
+// capElements caps the number of elements n requested for a response to
+// WithMaxElementsPerResponse, reporting whether it was lowered.
+func (s *Service) capElements(n int) (int, bool) {
+	if s.maxElements > 0 && n > s.maxElements {
+		return s.maxElements, true
+	}
+
+	return n, false
+}
+
 func (s *Service) FlushDatabaseStackHandler(_ context.Context, input *DatabaseStackInput) (*StackOutput, error) {
 	_, stack, err := s.stack(input.DatabaseID, input.StackID)
 	if err != nil {
@@ -200,16 +913,185 @@ func (s *Service) FlushDatabaseStackHandler(_ context.Context, input *DatabaseSt
 	stack.Flush()
 
 	out := new(StackOutput)
-	out.Body = Stack{
-		ID:        stack.ID.String(),
-		Name:      stack.Name,
-		Peek:      stack.Peek(),
-		Size:      stack.Size(),
-		CreatedAt: stack.CreatedAt,
-		UpdatedAt: stack.UpdatedAt,
-		ReadAt:    stack.ReadAt,
+	out.Body = newStack(stack)
+
+	return out, nil
+}
+
+type ConsumeOutput struct {
+	Body struct {
+		UpdatedAt time.Time `doc:"last update before the stack was consumed" json:"updated_at"`
+		DrainedAt time.Time `json:"drained_at"`
+		Elements  []any     `doc:"elements from the bottom up" json:"elements"`
+		Size      int       `json:"size"`
+	}
+}
+
+// ConsumeDatabaseStackHandler removes and returns all elements of a stack at
+// once, see repository.Stack.Drain.
+func (s *Service) ConsumeDatabaseStackHandler(_ context.Context, input *DatabaseStackInput) (*ConsumeOutput, error) {
+	_, stack, err := s.stack(input.DatabaseID, input.StackID)
+	if err != nil {
+		return nil, err
+	}
+	drained := stack.Drain()
+
+	out := new(ConsumeOutput)
+	out.Body.UpdatedAt = drained.UpdatedAt
+	out.Body.DrainedAt = drained.DrainedAt
+	out.Body.Elements = drained.Elements
+	if out.Body.Elements == nil {
+		out.Body.Elements = []any{}
+	}
+	out.Body.Size = len(drained.Elements)
+
+	return out, nil
+}
+
+type (
+	TruncateDatabaseStackInput struct {
+		DatabaseStackInput
+		Keep int `doc:"number of most recent elements to keep" minimum:"0" query:"keep" required:"true"`
+	}
+	TruncateOutput struct {
+		Body struct {
+			Discarded int `json:"discarded"`
+		}
+	}
+)
+
+// TruncateDatabaseStackHandler keeps only the most recent elements of a stack,
+// see repository.Stack.Truncate.
+func (s *Service) TruncateDatabaseStackHandler(_ context.Context, input *TruncateDatabaseStackInput) (*TruncateOutput, error) {
+	_, stack, err := s.stack(input.DatabaseID, input.StackID)
+	if err != nil {
+		return nil, err
 	}
 
+	out := new(TruncateOutput)
+	out.Body.Discarded = stack.Truncate(input.Keep)
+
+	return out, nil
+}
+
+// SwapTopDatabaseStackHandler exchanges the top two elements of a stack and
+// returns the new top element.
+func (s *Service) SwapTopDatabaseStackHandler(_ context.Context, input *DatabaseStackInput) (*StackElement, error) {
+	_, stack, err := s.stack(input.DatabaseID, input.StackID)
+	if err != nil {
+		return nil, err
+	}
+	top, ok := stack.Swap()
+	if !ok {
+		return nil, huma.Error409Conflict("stack must have at least two elements to swap")
+	}
+
+	out := new(StackElement)
+	out.Body.Element = top
+
+	return out, nil
+}
+
+// DupDatabaseStackHandler pushes a copy of the top element of a stack and
+// returns it, or 204 No Content if the stack is empty.
+func (s *Service) DupDatabaseStackHandler(_ context.Context, input *DatabaseStackInput) (*PopDatabaseStackElementOutput, error) {
+	_, stack, err := s.stack(input.DatabaseID, input.StackID)
+	if err != nil {
+		return nil, err
+	}
+	out := new(PopDatabaseStackElementOutput)
+
+	v, err := stack.Dup()
+	if errors.Is(err, repository.ErrEmpty) {
+		out.Status = http.StatusNoContent
+		return out, nil
+	}
+	if err != nil {
+		return nil, s.pushError(err)
+	}
+
+	out.Status = http.StatusOK
+	out.Body.Element = v
+
+	return out, nil
+}
+
+type RenameDatabaseStackInput struct {
+	Body struct {
+		Name string `doc:"new name of the stack" json:"name" minLength:"7"`
+	}
+	DatabaseStackInput
+}
+
+// RenameDatabaseStackHandler renames a stack, carrying over its elements,
+// and returns the renamed stack.
+func (s *Service) RenameDatabaseStackHandler(_ context.Context, input *RenameDatabaseStackInput) (*StackOutput, error) {
+	if err := s.validateName(input.Body.Name); err != nil {
+		return nil, err
+	}
+	db, stack, err := s.stack(input.DatabaseID, input.StackID)
+	if err != nil {
+		return nil, err
+	}
+	stack, err = db.Rename(stack.ID.String(), input.Body.Name)
+	switch {
+	case errors.Is(err, repository.ErrAlreadyExists):
+		return nil, huma.Error409Conflict("stack already exists", err)
+	case err != nil:
+		return nil, huma.Error404NotFound("stack not found", err)
+	}
+
+	out := new(StackOutput)
+	out.Body = newStack(stack)
+
+	return out, nil
+}
+
+type SwapDatabaseStacksInput struct {
+	DatabaseStackInput
+	OtherID string `doc:"can be the stack ID or name" path:"other"`
+}
+
+// SwapDatabaseStacksHandler atomically exchanges the elements of two stacks,
+// see repository.Database.SwapStacks, and returns the first stack.
+func (s *Service) SwapDatabaseStacksHandler(_ context.Context, input *SwapDatabaseStacksInput) (*StackOutput, error) {
+	db, stack, err := s.stack(input.DatabaseID, input.StackID)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.SwapStacks(stack.ID.String(), input.OtherID); err != nil {
+		return nil, huma.Error404NotFound("stack not found", err)
+	}
+
+	out := new(StackOutput)
+	out.Body = newStack(stack)
+
+	return out, nil
+}
+
+type CompareOutput struct {
+	Body struct {
+		Equal          bool `json:"equal"`
+		FirstDiffIndex int  `doc:"index of the first differing element from the bottom, -1 if equal" json:"first_diff_index"`
+	}
+}
+
+// CompareDatabaseStacksHandler reports whether two stacks hold the same
+// elements in the same order, see repository.Database.CompareStacks.
+func (s *Service) CompareDatabaseStacksHandler(_ context.Context, input *SwapDatabaseStacksInput) (*CompareOutput, error) {
+	db, stack, err := s.stack(input.DatabaseID, input.StackID)
+	if err != nil {
+		return nil, err
+	}
+	i, err := db.CompareStacks(stack.ID.String(), input.OtherID)
+	if err != nil {
+		return nil, huma.Error404NotFound("stack not found", err)
+	}
+
+	out := new(CompareOutput)
+	out.Body.Equal = i < 0
+	out.Body.FirstDiffIndex = i
+
 	return out, nil
 }
 
@@ -225,10 +1107,33 @@ func (s *Service) DeleteDatabaseStackHandler(_ context.Context, input *DatabaseS
 	return nil, nil
 }
 
+type DeleteEmptyStacksOutput struct {
+	Body struct {
+		Dropped int `json:"dropped"`
+	}
+}
+
+// DeleteEmptyDatabaseStacksHandler drops every empty stack of a database, see
+// repository.Database.DropEmpty.
+func (s *Service) DeleteEmptyDatabaseStacksHandler(_ context.Context, input *SingleDatabaseInput) (*DeleteEmptyStacksOutput, error) {
+	db, err := s.database(input.DatabaseID)
+	if err != nil {
+		return nil, err
+	}
+
+	out := new(DeleteEmptyStacksOutput)
+	out.Body.Dropped = db.DropEmpty()
+
+	return out, nil
+}
+
 func (s *Service) stack(dbID, sID string) (*repository.Database, *repository.Stack, error) {
-	db, err := s.Repository.Database(dbID)
+	db, err := s.database(dbID)
 	if err != nil {
-		return nil, nil, huma.Error404NotFound("database not found", err)
+		return nil, nil, err
+	}
+	if err := s.validateID(sID); err != nil {
+		return nil, nil, err
 	}
 	stack, err := db.Stack(sID)
 	if err != nil {
@@ -237,3 +1142,140 @@ func (s *Service) stack(dbID, sID string) (*repository.Database, *repository.Sta
 
 	return db, stack, nil
 }
+
+// stackOrCreate is like stack, but creates the stack when it doesn't exist,
+// unless it's looked up by ID, reporting whether it did. The database must
+// still exist.
+func (s *Service) stackOrCreate(dbID, sID string) (*repository.Database, *repository.Stack, bool, error) {
+	db, err := s.database(dbID)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if err := s.validateID(sID); err != nil {
+		return nil, nil, false, err
+	}
+	stack, err := db.Stack(sID)
+	if err == nil {
+		return db, stack, false, nil
+	}
+	if _, perr := uuid.Parse(sID); perr == nil {
+		// an ID can't be created.
+		return nil, nil, false, huma.Error404NotFound("stack not found", err)
+	}
+	if err := s.validateNewName(sID); err != nil {
+		return nil, nil, false, err
+	}
+	created := true
+	stack, err = db.New(sID)
+	if errors.Is(err, repository.ErrAlreadyExists) {
+		// lost a race with another creator.
+		created = false
+		stack, err = db.Stack(sID)
+	}
+	if err != nil {
+		return nil, nil, false, s.createStackError(err)
+	}
+
+	return db, stack, created, nil
+}
+
+// createStackError maps an error creating a stack to its HTTP error.
+func (s *Service) createStackError(err error) error {
+	switch {
+	case errors.Is(err, repository.ErrAlreadyExists):
+		return huma.Error409Conflict("stack already exists", err)
+	case errors.Is(err, repository.ErrLimitReached):
+		return huma.NewError(http.StatusInsufficientStorage,
+			fmt.Sprintf("database must not have more than %d stacks", s.maxStacks), err)
+	default:
+		return huma.Error500InternalServerError("failed to create stack", err)
+	}
+}
+
+// prepareElement validates an element to push and returns the form to store,
+// transformed with WithPushTransform and normalized with
+// WithElementNormalization.
+func (s *Service) prepareElement(element any) (any, error) {
+	if err := s.validateElement(element); err != nil {
+		return nil, err
+	}
+	if s.pushTransform != nil {
+		transformed, err := s.pushTransform(element)
+		if err != nil {
+			return nil, huma.Error422UnprocessableEntity("element rejected", err)
+		}
+		element = transformed
+	}
+	if !s.normalize {
+		return element, nil
+	}
+	normalized, err := repository.Normalize(element)
+	if err != nil {
+		return nil, huma.Error422UnprocessableEntity("element can't be normalized", err)
+	}
+
+	return normalized, nil
+}
+
+// preparePush prepares an element pushed to the stack, see prepareElement and
+// decodeElement.
+func (s *Service) preparePush(stack *repository.Stack, element any) (any, error) {
+	element, err := s.prepareElement(element)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.decodeElement(stack, element)
+}
+
+// decodeElement validates the element against the schema of the stack, then
+// decodes it into the element type of the stack, see
+// repository.Stack.SetElementType.
+func (s *Service) decodeElement(stack *repository.Stack, element any) (any, error) {
+	if err := s.validateSchema(stack, element); err != nil {
+		return nil, err
+	}
+	decoded, err := stack.DecodeElement(element)
+	if err != nil {
+		return nil, huma.Error422UnprocessableEntity("element does not match the element type of the stack", err)
+	}
+
+	return decoded, nil
+}
+
+// validateElement enforces the configured maximum element depth.
+func (s *Service) validateElement(element any) error {
+	if s.maxDepth > 0 && exceedsDepth(element, s.maxDepth) {
+		return huma.Error422UnprocessableEntity(fmt.Sprintf("element must not be nested deeper than %d levels", s.maxDepth))
+	}
+
+	return nil
+}
+
+// exceedsDepth reports whether v nests objects or arrays deeper than limit
+// levels. It stops descending once the limit is reached, so the recursion is
+// bounded by limit rather than by the element.
+func exceedsDepth(v any, limit int) bool {
+	var children []any
+	switch v := v.(type) {
+	case []any:
+		children = v
+	case map[string]any:
+		for _, e := range v {
+			children = append(children, e)
+		}
+	case map[any]any:
+		for _, e := range v {
+			children = append(children, e)
+		}
+	default:
+		return false
+	}
+	if limit == 0 {
+		return true
+	}
+
+	return slices.ContainsFunc(children, func(e any) bool {
+		return exceedsDepth(e, limit-1)
+	})
+}
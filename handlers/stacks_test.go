@@ -1,11 +1,14 @@
 package handlers_test
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/danielgtaylor/huma/v2/humatest"
 	"github.com/stretchr/testify/require"
@@ -91,7 +94,8 @@ func TestService_StacksHandlers(t *testing.T) {
 				  "peek": null,
 				  "id": "ID0",
 				  "name": "stackA",
-				  "size": 0
+				  "size": 0,
+				  "stats": {"pushes": 0, "pops": 0, "peeks": 0, "flushes": 0}
 				},
 				{
 				  "created_at": "CreatedAt1",
@@ -100,7 +104,8 @@ func TestService_StacksHandlers(t *testing.T) {
 				  "peek": null,
 				  "id": "ID1",
 				  "name": "stackZ",
-				  "size": 0
+				  "size": 0,
+				  "stats": {"pushes": 0, "pops": 0, "peeks": 0, "flushes": 0}
 				},
 				{
 				  "created_at": "CreatedAt2",
@@ -109,7 +114,8 @@ func TestService_StacksHandlers(t *testing.T) {
 				  "peek": null,
 				  "id": "ID2",
 				  "name": "stackZZ",
-				  "size": 0
+				  "size": 0,
+				  "stats": {"pushes": 0, "pops": 0, "peeks": 0, "flushes": 0}
 				}
 			  ]
 			}`,
@@ -142,6 +148,84 @@ func TestService_StacksHandlers(t *testing.T) {
 			  }
 			}`,
 		},
+		{
+			name: "get stacks filtered by label",
+			setup: func(db *repository.Database) {
+				s1, err := db.New("stackProd")
+				require.NoError(t, err)
+				s1.SetLabels(map[string]string{"env": "prod"})
+				s1.Push("v1")
+
+				s2, err := db.New("stackDev")
+				require.NoError(t, err)
+				s2.SetLabels(map[string]string{"env": "dev"})
+				s2.Push("v2")
+			},
+			method:        http.MethodGet,
+			path:          "/databases/{database}/stacks",
+			query:         url.Values{"kv": {"true"}, "label": {"env=prod"}},
+			expStatusCode: http.StatusOK,
+			expBody: `{
+			  "stacks": {
+				"stackProd": "v1"
+			  }
+			}`,
+		},
+		{
+			name: "get stalest stacks",
+			setup: func(db *repository.Database) {
+				now := time.Now()
+				for i, n := range []string{"stackFresh", "stackStale", "stackStaler"} {
+					stack, err := db.New(n)
+					require.NoError(t, err)
+					stack.Push(n)
+					stack.ReadAt.Store(now.Add(-time.Duration(i) * time.Hour))
+				}
+			},
+			method:        http.MethodGet,
+			path:          "/databases/{database}/stacks",
+			query:         url.Values{"kv": {"true"}, "sort": {"read"}, "order": {"asc"}, "limit": {"2"}},
+			expStatusCode: http.StatusOK,
+			expBody: `{
+			  "stacks": {
+				"stackStale": "stackStale",
+				"stackStaler": "stackStaler"
+			  }
+			}`,
+		},
+		{
+			name: "get freshest stack",
+			setup: func(db *repository.Database) {
+				now := time.Now()
+				for i, n := range []string{"stackFresh", "stackStale", "stackStaler"} {
+					stack, err := db.New(n)
+					require.NoError(t, err)
+					stack.Push(n)
+					stack.ReadAt.Store(now.Add(-time.Duration(i) * time.Hour))
+				}
+			},
+			method:        http.MethodGet,
+			path:          "/databases/{database}/stacks",
+			query:         url.Values{"kv": {"true"}, "sort": {"read"}, "order": {"desc"}, "limit": {"1"}},
+			expStatusCode: http.StatusOK,
+			expBody: `{
+			  "stacks": {
+				"stackFresh": "stackFresh"
+			  }
+			}`,
+		},
+		{
+			name:          "get stacks bad label",
+			method:        http.MethodGet,
+			path:          "/databases/{database}/stacks",
+			query:         url.Values{"label": {"env"}},
+			expStatusCode: http.StatusUnprocessableEntity,
+			expBody: `{
+			  "title": "Unprocessable Entity",
+			  "status": 422,
+			  "detail": "label \"env\" must be in the form key=value"
+			}`,
+		},
 		{
 			name: "get single stack",
 			setup: func(db *repository.Database) {
@@ -171,7 +255,8 @@ func TestService_StacksHandlers(t *testing.T) {
 			  "peek": null,
 			  "id": "ID",
 			  "name": "stackSingle",
-			  "size": 0
+			  "size": 0,
+			  "stats": {"pushes": 0, "pops": 0, "peeks": 0, "flushes": 0}
 			}`,
 		},
 		{
@@ -278,6 +363,133 @@ func TestService_StacksHandlers(t *testing.T) {
 			  ]
 			}`,
 		},
+		{
+			name:   "push create missing stack",
+			method: http.MethodPut,
+			path:   "/databases/{database}/stacks/stackMissing",
+			query:  url.Values{"createMissing": []string{"true"}},
+			body: map[string]any{
+				"element": "value",
+			},
+			expStatusCode: http.StatusOK,
+			expBody: `{
+			  "element": "value"
+			}`,
+		},
+		{
+			name:   "push create missing stack name too short",
+			method: http.MethodPut,
+			path:   "/databases/{database}/stacks/ab",
+			query:  url.Values{"createMissing": []string{"true"}},
+			body: map[string]any{
+				"element": "value",
+			},
+			expStatusCode: http.StatusUnprocessableEntity,
+			expBody: `{
+			  "title": "Unprocessable Entity",
+			  "status": 422,
+			  "detail": "name must be at least 7 characters"
+			}`,
+		},
+		{
+			name:   "push create missing stack by ID",
+			method: http.MethodPut,
+			path:   "/databases/{database}/stacks/7d444840-9dc0-11d1-b245-5ffdce74fad2",
+			query:  url.Values{"createMissing": []string{"true"}},
+			body: map[string]any{
+				"element": "value",
+			},
+			expStatusCode: http.StatusNotFound,
+			expBody: `{
+			  "title": "Not Found",
+			  "status": 404,
+			  "detail": "stack not found",
+			  "errors": [
+				{
+				  "message": "not found"
+				}
+			  ]
+			}`,
+		},
+		{
+			name: "push too deep",
+			setup: func(db *repository.Database) {
+				_, err := db.New("stackSingle")
+				require.NoError(t, err)
+			},
+			method: http.MethodPut,
+			path:   "/databases/{database}/stacks/stackSingle",
+			body: map[string]any{
+				"element": nested(33),
+			},
+			expStatusCode: http.StatusUnprocessableEntity,
+			expBody: `{
+			  "title": "Unprocessable Entity",
+			  "status": 422,
+			  "detail": "element must not be nested deeper than 32 levels"
+			}`,
+		},
+		{
+			name: "push nested",
+			setup: func(db *repository.Database) {
+				_, err := db.New("stackSingle")
+				require.NoError(t, err)
+			},
+			method: http.MethodPut,
+			path:   "/databases/{database}/stacks/stackSingle",
+			body: map[string]any{
+				"element": nested(3),
+			},
+			expStatusCode: http.StatusOK,
+			expBody: `{
+			  "element": [{"nested": [1]}]
+			}`,
+		},
+		{
+			name:   "push create missing database dne",
+			method: http.MethodPut,
+			path:   "/databases/{dne}/stacks/stackMissing",
+			query:  url.Values{"createMissing": []string{"true"}},
+			body: map[string]any{
+				"element": "value",
+			},
+			expStatusCode: http.StatusNotFound,
+			expBody: `{
+			  "title": "Not Found",
+			  "status": 404,
+			  "detail": "database not found",
+			  "errors": [
+				{
+				  "message": "not found"
+				}
+			  ]
+			}`,
+		},
+		{
+			name: "pop wait single stack",
+			setup: func(db *repository.Database) {
+				stack, err := db.New("stackSingle")
+				require.NoError(t, err)
+				stack.Push("value")
+			},
+			method:        http.MethodDelete,
+			path:          "/databases/{database}/stacks/stackSingle/popWait",
+			expStatusCode: http.StatusOK,
+			expBody: `{
+			  "element": "value"
+			}`,
+		},
+		{
+			name: "pop wait empty stack timeout",
+			setup: func(db *repository.Database) {
+				_, err := db.New("stackSingle")
+				require.NoError(t, err)
+			},
+			method:        http.MethodDelete,
+			path:          "/databases/{database}/stacks/stackSingle/popWait",
+			query:         url.Values{"timeout": []string{"10"}},
+			expStatusCode: http.StatusNoContent,
+		},
 		{
 			name:          "create a stack",
 			method:        http.MethodPost,
@@ -304,7 +516,131 @@ func TestService_StacksHandlers(t *testing.T) {
 			  "peek": null,
 			  "id": "ID",
 			  "name": "stackName123",
-			  "size": 0
+			  "size": 0,
+			  "stats": {"pushes": 0, "pops": 0, "peeks": 0, "flushes": 0}
+			}`,
+		},
+		{
+			name:          "create a stack name too long",
+			method:        http.MethodPost,
+			path:          "/databases/{database}/stacks",
+			query:         url.Values{"name": []string{strings.Repeat("s", 256)}},
+			expStatusCode: http.StatusUnprocessableEntity,
+			expBody: `{
+			  "title": "Unprocessable Entity",
+			  "status": 422,
+			  "detail": "name must not exceed 255 characters"
+			}`,
+		},
+		{
+			name:   "create a stack with description",
+			method: http.MethodPost,
+			path:   "/databases/{database}/stacks",
+			query: url.Values{
+				"name":        []string{"stackName123"},
+				"description": []string{"holds things"},
+			},
+			expStatusCode: http.StatusCreated,
+			processBody: func(s string) string {
+				var err error
+				for k, v := range map[string]string{
+					"created_at": "CreatedAt",
+					"updated_at": "UpdatedAt",
+					"read_at":    "ReadAt",
+					"id":         "ID",
+				} {
+					s, err = sjson.Set(s, k, v)
+					require.NoError(t, err)
+				}
+				return s
+			},
+			expBody: `{
+			  "created_at": "CreatedAt",
+			  "updated_at": "UpdatedAt",
+			  "read_at": "ReadAt",
+			  "peek": null,
+			  "id": "ID",
+			  "name": "stackName123",
+			  "description": "holds things",
+			  "size": 0,
+			  "stats": {"pushes": 0, "pops": 0, "peeks": 0, "flushes": 0}
+			}`,
+		},
+		{
+			name: "update a stack labels",
+			setup: func(db *repository.Database) {
+				_, err := db.New("stackName123")
+				require.NoError(t, err)
+			},
+			method: http.MethodPatch,
+			path:   "/databases/{database}/stacks/stackName123",
+			body: map[string]any{
+				"labels": map[string]string{"env": "prod"},
+			},
+			expStatusCode: http.StatusOK,
+			processBody: func(s string) string {
+				var err error
+				for k, v := range map[string]string{
+					"created_at": "CreatedAt",
+					"updated_at": "UpdatedAt",
+					"read_at":    "ReadAt",
+					"id":         "ID",
+				} {
+					s, err = sjson.Set(s, k, v)
+					require.NoError(t, err)
+				}
+				return s
+			},
+			expBody: `{
+			  "created_at": "CreatedAt",
+			  "updated_at": "UpdatedAt",
+			  "read_at": "ReadAt",
+			  "peek": null,
+			  "id": "ID",
+			  "name": "stackName123",
+			  "labels": {
+				"env": "prod"
+			  },
+			  "size": 0,
+			  "stats": {"pushes": 0, "pops": 0, "peeks": 0, "flushes": 0}
+			}`,
+		},
+		{
+			name: "update a stack description",
+			setup: func(db *repository.Database) {
+				stack, err := db.New("stackName123")
+				require.NoError(t, err)
+				stack.SetDescription("old")
+			},
+			method: http.MethodPatch,
+			path:   "/databases/{database}/stacks/stackName123",
+			body: map[string]any{
+				"description": "new",
+			},
+			expStatusCode: http.StatusOK,
+			processBody: func(s string) string {
+				var err error
+				for k, v := range map[string]string{
+					"created_at": "CreatedAt",
+					"updated_at": "UpdatedAt",
+					"read_at":    "ReadAt",
+					"id":         "ID",
+				} {
+					s, err = sjson.Set(s, k, v)
+					require.NoError(t, err)
+				}
+				return s
+			},
+			expBody: `{
+			  "created_at": "CreatedAt",
+			  "updated_at": "UpdatedAt",
+			  "read_at": "ReadAt",
+			  "peek": null,
+			  "id": "ID",
+			  "name": "stackName123",
+			  "description": "new",
+			  "size": 0,
+			  "stats": {"pushes": 0, "pops": 0, "peeks": 0, "flushes": 0}
 			}`,
 		},
 		{
@@ -419,7 +755,8 @@ func TestService_StacksHandlers(t *testing.T) {
 			  "peek": null,
 			  "id": "ID",
 			  "name": "stackName123",
-			  "size": 0
+			  "size": 0,
+			  "stats": {"pushes": 10, "pops": 0, "peeks": 0, "flushes": 1}
 			}`,
 		},
 		{
@@ -517,7 +854,12 @@ func TestService_StacksHandlers(t *testing.T) {
 			tt.path = strings.Replace(tt.path, "{database}", db.ID.String(), -1)
 
 			// test.
-			resp := api.Do(tt.method, tt.path, tt.body)
+			var args []any
+			if tt.body != nil {
+				// a nil map would be sent as a null body.
+				args = append(args, tt.body)
+			}
+			resp := api.Do(tt.method, tt.path, args...)
 			require.Equal(t, tt.expStatusCode, resp.Code)
 			body := resp.Body.String()
 			if tt.expBody == "" {
@@ -531,3 +873,1177 @@ func TestService_StacksHandlers(t *testing.T) {
 		})
 	}
 }
+
+func TestService_StreamDatabaseStackHandler(t *testing.T) {
+	t.Parallel()
+	_, api := humatest.New(t)
+	svc := handlers.New()
+	svc.AddRoutes(api)
+	db, err := svc.Repository.New("dbName123")
+	require.NoError(t, err)
+	stack, err := db.New("stackName123")
+	require.NoError(t, err)
+	const n = 2500
+	for i := range n {
+		stack.Push(i)
+	}
+
+	resp := api.Get("/databases/dbName123/stacks/stackName123/stream")
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Equal(t, "application/x-ndjson", resp.Header().Get("Content-Type"))
+	lines := strings.Split(strings.TrimSpace(resp.Body.String()), "\n")
+	require.Len(t, lines, n)
+	for i, line := range lines {
+		require.Equal(t, strconv.Itoa(n-1-i), line, "elements must be streamed top first")
+	}
+
+	resp = api.Get("/databases/dbName123/stacks/dne/stream")
+	require.Equal(t, http.StatusNotFound, resp.Code)
+}
+
+func TestService_HeadDatabaseStackHandler(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name          string
+		path          string
+		expStatusCode int
+		expBody       string
+	}{
+		{name: "default", path: "/databases/dbName123/stacks/stackName123/head", expStatusCode: http.StatusOK, expBody: `{"elements": [0, 1, 2, 3, 4, 5, 6, 7, 8, 9]}`},
+		{name: "n", path: "/databases/dbName123/stacks/stackName123/head?n=3", expStatusCode: http.StatusOK, expBody: `{"elements": [0, 1, 2]}`},
+		{name: "capped", path: "/databases/dbName123/stacks/stackName123/head?n=100", expStatusCode: http.StatusOK, expBody: `{"elements": [0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11]}`},
+		{name: "empty", path: "/databases/dbName123/stacks/emptyStack123/head", expStatusCode: http.StatusOK, expBody: `{"elements": []}`},
+		{name: "stack dne", path: "/databases/dbName123/stacks/dne/head", expStatusCode: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, api := humatest.New(t)
+			svc := handlers.New()
+			svc.AddRoutes(api)
+			db, err := svc.Repository.New("dbName123")
+			require.NoError(t, err)
+			stack, err := db.New("stackName123")
+			require.NoError(t, err)
+			for i := range 12 {
+				stack.Push(i)
+			}
+			_, err = db.New("emptyStack123")
+			require.NoError(t, err)
+
+			resp := api.Get(tt.path)
+			require.Equal(t, tt.expStatusCode, resp.Code)
+			if tt.expBody != "" {
+				require.JSONEq(t, tt.expBody, resp.Body.String())
+			}
+			require.Equal(t, 12, stack.Size(), "head must not remove elements")
+		})
+	}
+}
+
+func TestService_PreviewDatabaseStackHandler(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name          string
+		path          string
+		expStatusCode int
+		expBody       string
+	}{
+		{
+			name:          "default",
+			path:          "/databases/dbName123/stacks/stackName123/preview",
+			expStatusCode: http.StatusOK,
+			expBody:       `{"elements": [{"element": "e", "index": 4}, {"element": "d", "index": 3}, {"element": "c", "index": 2}]}`,
+		},
+		{
+			name:          "capped",
+			path:          "/databases/dbName123/stacks/stackName123/preview?n=10",
+			expStatusCode: http.StatusOK,
+			expBody: `{"elements": [
+				{"element": "e", "index": 4},
+				{"element": "d", "index": 3},
+				{"element": "c", "index": 2},
+				{"element": "b", "index": 1},
+				{"element": "a", "index": 0}
+			]}`,
+		},
+		{
+			name:          "empty",
+			path:          "/databases/dbName123/stacks/emptyStack123/preview",
+			expStatusCode: http.StatusOK,
+			expBody:       `{"elements": []}`,
+		},
+		{name: "stack dne", path: "/databases/dbName123/stacks/dne/preview", expStatusCode: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, api := humatest.New(t)
+			svc := handlers.New()
+			svc.AddRoutes(api)
+			db, err := svc.Repository.New("dbName123")
+			require.NoError(t, err)
+			stack, err := db.New("stackName123")
+			require.NoError(t, err)
+			for _, e := range []string{"a", "b", "c", "d", "e"} {
+				stack.Push(e)
+			}
+			_, err = db.New("emptyStack123")
+			require.NoError(t, err)
+
+			resp := api.Get(tt.path)
+			require.Equal(t, tt.expStatusCode, resp.Code)
+			if tt.expBody != "" {
+				require.JSONEq(t, tt.expBody, resp.Body.String())
+			}
+			require.Equal(t, 5, stack.Size(), "preview must not remove elements")
+		})
+	}
+}
+
+func TestService_SwapDatabaseStacksHandler(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name          string
+		path          string
+		expStatusCode int
+		expStaging    []any
+		expProduction []any
+	}{
+		{
+			name:          "swap",
+			path:          "/databases/dbName123/stacks/production/swapWith/staging",
+			expStatusCode: http.StatusOK,
+			expStaging:    []any{"p1"},
+			expProduction: []any{"s1", "s2"},
+		},
+		{
+			name:          "other dne",
+			path:          "/databases/dbName123/stacks/production/swapWith/dne",
+			expStatusCode: http.StatusNotFound,
+			expStaging:    []any{"s1", "s2"},
+			expProduction: []any{"p1"},
+		},
+		{
+			name:          "stack dne",
+			path:          "/databases/dbName123/stacks/dne/swapWith/staging",
+			expStatusCode: http.StatusNotFound,
+			expStaging:    []any{"s1", "s2"},
+			expProduction: []any{"p1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, api := humatest.New(t)
+			svc := handlers.New()
+			svc.AddRoutes(api)
+			db, err := svc.Repository.New("dbName123")
+			require.NoError(t, err)
+			staging, err := db.New("staging")
+			require.NoError(t, err)
+			staging.Push("s1")
+			staging.Push("s2")
+			production, err := db.New("production")
+			require.NoError(t, err)
+			production.Push("p1")
+
+			resp := api.Post(tt.path)
+			require.Equal(t, tt.expStatusCode, resp.Code)
+			require.Equal(t, tt.expStaging, staging.Data)
+			require.Equal(t, tt.expProduction, production.Data)
+		})
+	}
+}
+
+// nested returns an element nested depth levels deep, alternating objects and
+// arrays.
+func nested(depth int) any {
+	var v any = 1
+	for i := range depth {
+		if i%2 == 0 {
+			v = []any{v}
+		} else {
+			v = map[string]any{"nested": v}
+		}
+	}
+
+	return v
+}
+
+func TestService_PeekRawDatabaseStackHandler(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name          string
+		element       any
+		expStatusCode int
+		expBody       string
+	}{
+		{name: "string", element: "hello world", expStatusCode: http.StatusOK, expBody: "hello world"},
+		{name: "empty", expStatusCode: http.StatusNoContent},
+		{name: "not text", element: map[string]any{"key": "value"}, expStatusCode: http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, api := humatest.New(t)
+			svc := handlers.New()
+			svc.AddRoutes(api)
+			db, err := svc.Repository.New("dbName123")
+			require.NoError(t, err)
+			stack, err := db.New("stackName123")
+			require.NoError(t, err)
+			if tt.element != nil {
+				stack.Push(tt.element)
+			}
+
+			resp := api.Get("/databases/dbName123/stacks/stackName123/peek/raw")
+			require.Equal(t, tt.expStatusCode, resp.Code)
+			if tt.expStatusCode == http.StatusOK {
+				require.Equal(t, "text/plain; charset=utf-8", resp.Header().Get("Content-Type"))
+				require.Equal(t, tt.expBody, resp.Body.String())
+			}
+		})
+	}
+}
+
+func TestService_TextDatabaseStackHandler(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		elements []any
+		expBody  string
+	}{
+		{name: "empty"},
+		{name: "lines", elements: []any{"first", "second", "third"}, expBody: "first\nsecond\nthird\n"},
+		{name: "mixed", elements: []any{"started", map[string]any{"key": "value"}, 1.5}, expBody: "started\n{\"key\":\"value\"}\n1.5\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, api := humatest.New(t)
+			svc := handlers.New()
+			svc.AddRoutes(api)
+			db, err := svc.Repository.New("dbName123")
+			require.NoError(t, err)
+			stack, err := db.New("stackName123")
+			require.NoError(t, err)
+			require.NoError(t, stack.PushMany(tt.elements))
+
+			resp := api.Get("/databases/dbName123/stacks/stackName123/text")
+			require.Equal(t, http.StatusOK, resp.Code)
+			require.Equal(t, "text/plain; charset=utf-8", resp.Header().Get("Content-Type"))
+			require.Equal(t, tt.expBody, resp.Body.String())
+		})
+	}
+}
+
+func TestService_PushTransform(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name          string
+		transform     func(any) (any, error)
+		element       any
+		expStatusCode int
+		expElements   []any
+	}{
+		{
+			name:          "identity",
+			element:       "value",
+			expStatusCode: http.StatusOK,
+			expElements:   []any{"value"},
+		},
+		{
+			name: "enriched",
+			transform: func(e any) (any, error) {
+				return map[string]any{"value": e, "source": "api"}, nil
+			},
+			element:       "value",
+			expStatusCode: http.StatusOK,
+			expElements:   []any{map[string]any{"value": "value", "source": "api"}},
+		},
+		{
+			name: "rejected",
+			transform: func(any) (any, error) {
+				return nil, errors.New("not allowed")
+			},
+			element:       "value",
+			expStatusCode: http.StatusUnprocessableEntity,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, api := humatest.New(t)
+			svc := handlers.New(handlers.WithPushTransform(tt.transform))
+			svc.AddRoutes(api)
+			db, err := svc.Repository.New("dbName123")
+			require.NoError(t, err)
+			stack, err := db.New("stackName123")
+			require.NoError(t, err)
+
+			resp := api.Put("/databases/dbName123/stacks/stackName123", map[string]any{"element": tt.element})
+			require.Equal(t, tt.expStatusCode, resp.Code)
+			require.Equal(t, tt.expElements, stack.Elements(0, stack.Size()))
+		})
+	}
+}
+
+func TestService_PushDatabaseStackHandler_CreateMissing(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name          string
+		mode          repository.Mode
+		schema        []byte
+		expStatusCode int
+		expStacks     int
+	}{
+		{name: "created", expStatusCode: http.StatusOK, expStacks: 1},
+		{name: "counter database", mode: repository.ModeCounter, expStatusCode: http.StatusUnprocessableEntity},
+		{name: "schema mismatch", schema: []byte(`{"type": "integer"}`), expStatusCode: http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, api := humatest.New(t)
+			svc := handlers.New()
+			svc.AddRoutes(api)
+			db, err := svc.Repository.New("dbName123", repository.WithMode(tt.mode))
+			require.NoError(t, err)
+			db.SetSchema(tt.schema)
+
+			resp := api.Put("/databases/dbName123/stacks/stackName123?createMissing=true", map[string]any{"element": "value"})
+			require.Equal(t, tt.expStatusCode, resp.Code, resp.Body.String())
+			// a rejected push leaves no stack behind.
+			require.Equal(t, tt.expStacks, db.Len())
+		})
+	}
+}
+
+func TestService_ConsumeDatabaseStackHandler(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name          string
+		stack         string
+		expStatusCode int
+		expElements   []any
+	}{
+		{name: "consume", stack: "stackName123", expStatusCode: http.StatusOK, expElements: []any{0.0, 1.0, 2.0}},
+		{name: "empty", stack: "emptyStack123", expStatusCode: http.StatusOK, expElements: []any{}},
+		{name: "stack dne", stack: "dne", expStatusCode: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, api := humatest.New(t)
+			svc := handlers.New()
+			svc.AddRoutes(api)
+			db, err := svc.Repository.New("dbName123")
+			require.NoError(t, err)
+			stack, err := db.New("stackName123")
+			require.NoError(t, err)
+			for i := range 3 {
+				stack.Push(i)
+			}
+			_, err = db.New("emptyStack123")
+			require.NoError(t, err)
+
+			resp := api.Delete("/databases/dbName123/stacks/" + tt.stack + "/consume")
+			require.Equal(t, tt.expStatusCode, resp.Code)
+			if tt.expStatusCode != http.StatusOK {
+				return
+			}
+			var body struct {
+				DrainedAt time.Time `json:"drained_at"`
+				Elements  []any     `json:"elements"`
+				Size      int       `json:"size"`
+			}
+			require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+			require.Equal(t, tt.expElements, body.Elements)
+			require.Equal(t, len(tt.expElements), body.Size)
+			require.False(t, body.DrainedAt.IsZero())
+			s, err := db.Stack(tt.stack)
+			require.NoError(t, err)
+			require.Zero(t, s.Size())
+		})
+	}
+}
+
+func TestService_ElementIDs(t *testing.T) {
+	t.Parallel()
+	_, api := humatest.New(t)
+	svc := handlers.New(handlers.WithElementIDs())
+	svc.AddRoutes(api)
+	db, err := svc.Repository.New("dbName123")
+	require.NoError(t, err)
+	stack, err := db.New("stackName123")
+	require.NoError(t, err)
+
+	var pushed struct {
+		ID string `json:"id"`
+	}
+	resp := api.Put("/databases/dbName123/stacks/stackName123", map[string]any{"element": "first"})
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &pushed))
+	require.NotEmpty(t, pushed.ID)
+	stack.Push("second")
+	path := "/databases/dbName123/stacks/stackName123/elements/" + pushed.ID
+
+	resp = api.Get(path)
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.JSONEq(t, `{"element": "first"}`, resp.Body.String())
+
+	resp = api.Delete(path)
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.JSONEq(t, `{"element": "first"}`, resp.Body.String())
+	require.Equal(t, []any{"second"}, stack.Elements(0, stack.Size()))
+
+	resp = api.Get(path)
+	require.Equal(t, http.StatusNotFound, resp.Code)
+	resp = api.Delete(path)
+	require.Equal(t, http.StatusNotFound, resp.Code)
+
+	// bulk pushes return the IDs in order.
+	var bulk struct {
+		IDs []string `json:"ids"`
+	}
+	resp = api.Put("/databases/dbName123/stacks/stackName123/bulk", map[string]any{"elements": []any{"third", "fourth"}})
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &bulk))
+	require.Len(t, bulk.IDs, 2)
+	resp = api.Get("/databases/dbName123/stacks/stackName123/elements/" + bulk.IDs[0])
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.JSONEq(t, `{"element": "third"}`, resp.Body.String())
+}
+
+func TestService_StackBytes(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		path    string
+		list    bool
+		expSize *float64
+	}{
+		{name: "show", path: "/databases/dbName123/stacks/stackName123"},
+		{name: "show with bytes", path: "/databases/dbName123/stacks/stackName123?withBytes=true", expSize: ptr(6.0)},
+		{name: "list", path: "/databases/dbName123/stacks", list: true},
+		{name: "list with bytes", path: "/databases/dbName123/stacks?withBytes=true", list: true, expSize: ptr(6.0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, api := humatest.New(t)
+			svc := handlers.New()
+			svc.AddRoutes(api)
+			db, err := svc.Repository.New("dbName123")
+			require.NoError(t, err)
+			stack, err := db.New("stackName123")
+			require.NoError(t, err)
+			stack.Push("a")
+			stack.Push(1)
+
+			resp := api.Get(tt.path)
+			require.Equal(t, http.StatusOK, resp.Code)
+			var got struct {
+				Bytes  *float64 `json:"bytes"`
+				Stacks []struct {
+					Bytes *float64 `json:"bytes"`
+				} `json:"stacks"`
+			}
+			require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &got))
+			if tt.list {
+				require.Len(t, got.Stacks, 1)
+				got.Bytes = got.Stacks[0].Bytes
+			}
+			require.Equal(t, tt.expSize, got.Bytes)
+		})
+	}
+}
+
+func ptr[T any](v T) *T { return &v }
+
+func TestService_TruncateDatabaseStackHandler(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name          string
+		path          string
+		expStatusCode int
+		expBody       string
+		expSize       int
+	}{
+		{name: "truncate", path: "/databases/dbName123/stacks/stackName123/truncate?keep=3", expStatusCode: http.StatusOK, expBody: `{"discarded": 7}`, expSize: 3},
+		{name: "keep all", path: "/databases/dbName123/stacks/stackName123/truncate?keep=100", expStatusCode: http.StatusOK, expBody: `{"discarded": 0}`, expSize: 10},
+		{name: "keep missing", path: "/databases/dbName123/stacks/stackName123/truncate", expStatusCode: http.StatusUnprocessableEntity, expSize: 10},
+		{name: "keep negative", path: "/databases/dbName123/stacks/stackName123/truncate?keep=-1", expStatusCode: http.StatusUnprocessableEntity, expSize: 10},
+		{name: "stack dne", path: "/databases/dbName123/stacks/dne/truncate?keep=3", expStatusCode: http.StatusNotFound, expSize: 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, api := humatest.New(t)
+			svc := handlers.New()
+			svc.AddRoutes(api)
+			db, err := svc.Repository.New("dbName123")
+			require.NoError(t, err)
+			stack, err := db.New("stackName123")
+			require.NoError(t, err)
+			for i := range 10 {
+				stack.Push(i)
+			}
+
+			resp := api.Post(tt.path)
+			require.Equal(t, tt.expStatusCode, resp.Code)
+			if tt.expBody != "" {
+				require.JSONEq(t, tt.expBody, resp.Body.String())
+			}
+			require.Equal(t, tt.expSize, stack.Size())
+			if tt.expSize == 3 {
+				require.Equal(t, []any{7, 8, 9}, stack.Elements(0, 3), "the most recent elements must be kept")
+			}
+		})
+	}
+}
+
+func TestService_SwapTopDatabaseStackHandler(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name          string
+		stack         string
+		push          int
+		expStatusCode int
+		expBody       string
+		expElements   []any
+	}{
+		{name: "swap", stack: "stackName123", push: 3, expStatusCode: http.StatusOK, expBody: `{"element": 1}`, expElements: []any{0, 2, 1}},
+		{name: "one element", stack: "stackName123", push: 1, expStatusCode: http.StatusConflict, expElements: []any{0}},
+		{name: "empty stack", stack: "stackName123", expStatusCode: http.StatusConflict},
+		{name: "stack dne", stack: "dne", expStatusCode: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, api := humatest.New(t)
+			svc := handlers.New()
+			svc.AddRoutes(api)
+			db, err := svc.Repository.New("dbName123")
+			require.NoError(t, err)
+			stack, err := db.New("stackName123")
+			require.NoError(t, err)
+			for i := range tt.push {
+				stack.Push(i)
+			}
+
+			resp := api.Post("/databases/dbName123/stacks/" + tt.stack + "/swap")
+			require.Equal(t, tt.expStatusCode, resp.Code)
+			if tt.expBody != "" {
+				require.JSONEq(t, tt.expBody, resp.Body.String())
+			}
+			require.Equal(t, tt.expElements, stack.Elements(0, stack.Size()))
+		})
+	}
+}
+
+func TestService_RenameDatabaseStackHandler(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name          string
+		stack         string
+		body          map[string]any
+		expStatusCode int
+		expName       string
+	}{
+		{name: "rename", stack: "stackName123", body: map[string]any{"name": "renamed123"}, expStatusCode: http.StatusOK, expName: "renamed123"},
+		{name: "name taken", stack: "stackName123", body: map[string]any{"name": "otherStack123"}, expStatusCode: http.StatusConflict},
+		{name: "name too short", stack: "stackName123", body: map[string]any{"name": "short"}, expStatusCode: http.StatusUnprocessableEntity},
+		{name: "stack dne", stack: "dne", body: map[string]any{"name": "renamed123"}, expStatusCode: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, api := humatest.New(t)
+			svc := handlers.New()
+			svc.AddRoutes(api)
+			db, err := svc.Repository.New("dbName123")
+			require.NoError(t, err)
+			stack, err := db.New("stackName123")
+			require.NoError(t, err)
+			stack.Push(1)
+			_, err = db.New("otherStack123")
+			require.NoError(t, err)
+
+			resp := api.Post("/databases/dbName123/stacks/"+tt.stack+"/rename", tt.body)
+			require.Equal(t, tt.expStatusCode, resp.Code)
+			if tt.expName == "" {
+				return
+			}
+			var got map[string]any
+			require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &got))
+			require.Equal(t, tt.expName, got["name"])
+			require.Equal(t, stack.ID.String(), got["id"])
+			renamed, err := db.Stack(tt.expName)
+			require.NoError(t, err)
+			require.Equal(t, []any{1}, renamed.Elements(0, 1), "elements must be carried over")
+		})
+	}
+}
+
+func TestService_DupDatabaseStackHandler(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name          string
+		stack         string
+		push          []any
+		expStatusCode int
+		expBody       string
+		expSize       int
+	}{
+		{name: "dup", stack: "stackName123", push: []any{1, map[string]any{"a": []any{1}}}, expStatusCode: http.StatusOK, expBody: `{"element": {"a": [1]}}`, expSize: 3},
+		{name: "empty stack", stack: "stackName123", expStatusCode: http.StatusNoContent},
+		{name: "stack dne", stack: "dne", expStatusCode: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, api := humatest.New(t)
+			svc := handlers.New()
+			svc.AddRoutes(api)
+			db, err := svc.Repository.New("dbName123")
+			require.NoError(t, err)
+			stack, err := db.New("stackName123")
+			require.NoError(t, err)
+			stack.PushMany(tt.push)
+
+			resp := api.Put("/databases/dbName123/stacks/" + tt.stack + "/dup")
+			require.Equal(t, tt.expStatusCode, resp.Code)
+			if tt.expBody != "" {
+				require.JSONEq(t, tt.expBody, resp.Body.String())
+			}
+			require.Equal(t, tt.expSize, stack.Size())
+		})
+	}
+}
+
+func TestService_PushManyDatabaseStackHandler(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name          string
+		stack         string
+		body          map[string]any
+		opts          []handlers.Option
+		expStatusCode int
+		expBody       string
+		expElements   []any
+	}{
+		{
+			name:          "push in order",
+			stack:         "stackName123",
+			body:          map[string]any{"elements": []any{"a", "b", "c"}},
+			expStatusCode: http.StatusOK,
+			expBody:       `{"pushed": 3, "size": 4, "top": "c"}`,
+			expElements:   []any{0.0, "a", "b", "c"},
+		},
+		{
+			name:          "empty",
+			stack:         "stackName123",
+			body:          map[string]any{"elements": []any{}},
+			expStatusCode: http.StatusBadRequest,
+			expElements:   []any{0.0},
+		},
+		{
+			name:          "too many",
+			stack:         "stackName123",
+			body:          map[string]any{"elements": []any{"a", "b"}},
+			opts:          []handlers.Option{handlers.WithMaxBatchSize(1)},
+			expStatusCode: http.StatusUnprocessableEntity,
+			expElements:   []any{0.0},
+		},
+		{
+			name:          "stack dne",
+			stack:         "dne",
+			body:          map[string]any{"elements": []any{"a"}},
+			expStatusCode: http.StatusNotFound,
+			expElements:   []any{0.0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, api := humatest.New(t)
+			svc := handlers.New(tt.opts...)
+			svc.AddRoutes(api)
+			db, err := svc.Repository.New("dbName123")
+			require.NoError(t, err)
+			stack, err := db.New("stackName123")
+			require.NoError(t, err)
+			stack.Push(0.0)
+
+			resp := api.Put("/databases/dbName123/stacks/"+tt.stack+"/bulk", tt.body)
+			require.Equal(t, tt.expStatusCode, resp.Code)
+			if tt.expBody != "" {
+				require.JSONEq(t, tt.expBody, resp.Body.String())
+			}
+			require.Equal(t, tt.expElements, stack.Elements(0, stack.Size()))
+		})
+	}
+}
+
+func TestService_MaxWaitersPerStack(t *testing.T) {
+	t.Parallel()
+	_, api := humatest.New(t)
+	svc := handlers.New(handlers.WithMaxWaitersPerStack(1))
+	svc.AddRoutes(api)
+	db, err := svc.Repository.New("dbName123")
+	require.NoError(t, err)
+	stack, err := db.New("stackName123")
+	require.NoError(t, err)
+
+	done := make(chan int)
+	go func() {
+		done <- api.Delete("/databases/dbName123/stacks/stackName123/popWait?timeout=5000").Code
+	}()
+	require.Eventually(t, func() bool { return stack.Waiters() == 1 }, time.Second, time.Millisecond)
+
+	resp := api.Delete("/databases/dbName123/stacks/stackName123/popWait?timeout=5000")
+	require.Equal(t, http.StatusServiceUnavailable, resp.Code)
+
+	stack.Push(1)
+	require.Equal(t, http.StatusOK, <-done)
+	require.Equal(t, 0, stack.Waiters(), "the waiter must be released")
+}
+
+func TestService_MaxStackSize(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name          string
+		method        string
+		path          string
+		body          map[string]any
+		expStatusCode int
+	}{
+		{name: "push", method: http.MethodPut, path: "/databases/dbName123/stacks/stackName123", body: map[string]any{"element": 3}, expStatusCode: http.StatusRequestEntityTooLarge},
+		{name: "bulk push", method: http.MethodPut, path: "/databases/dbName123/stacks/stackName123/bulk", body: map[string]any{"elements": []any{3}}, expStatusCode: http.StatusRequestEntityTooLarge},
+		{name: "dup", method: http.MethodPut, path: "/databases/dbName123/stacks/stackName123/dup", expStatusCode: http.StatusRequestEntityTooLarge},
+		{name: "pop", method: http.MethodDelete, path: "/databases/dbName123/stacks/stackName123", expStatusCode: http.StatusOK},
+		{name: "create with elements", method: http.MethodPost, path: "/databases/dbName123/stacks?name=otherStack123", body: map[string]any{"elements": []any{1, 2, 3}}, expStatusCode: http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, api := humatest.New(t)
+			svc := handlers.New(handlers.WithMaxStackSize(2))
+			svc.AddRoutes(api)
+			db, err := svc.Repository.New("dbName123")
+			require.NoError(t, err)
+			stack, err := db.New("stackName123")
+			require.NoError(t, err)
+			for i := range 2 {
+				_, err := stack.Push(i)
+				require.NoError(t, err, "pushes up to the limit must succeed")
+			}
+
+			var args []any
+			if tt.body != nil {
+				args = append(args, tt.body)
+			}
+			resp := api.Do(tt.method, tt.path, args...)
+			require.Equal(t, tt.expStatusCode, resp.Code)
+			if tt.expStatusCode == http.StatusRequestEntityTooLarge {
+				require.Equal(t, 2, stack.Size(), "a rejected push must not change the stack")
+				require.Equal(t, 1, db.Len())
+			}
+		})
+	}
+}
+
+func TestService_DeleteEmptyDatabaseStacksHandler(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name          string
+		database      string
+		empty         int
+		expStatusCode int
+		expBody       string
+		expLen        int
+	}{
+		{name: "drop empty", database: "dbName123", empty: 2, expStatusCode: http.StatusOK, expBody: `{"dropped": 2}`, expLen: 1},
+		{name: "none empty", database: "dbName123", expStatusCode: http.StatusOK, expBody: `{"dropped": 0}`, expLen: 1},
+		{name: "database dne", database: "dne", empty: 1, expStatusCode: http.StatusNotFound, expLen: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, api := humatest.New(t)
+			svc := handlers.New()
+			svc.AddRoutes(api)
+			db, err := svc.Repository.New("dbName123")
+			require.NoError(t, err)
+			stack, err := db.New("stackName123")
+			require.NoError(t, err)
+			_, err = stack.Push(1)
+			require.NoError(t, err)
+			for i := range tt.empty {
+				_, err := db.New("emptyStack" + strconv.Itoa(i))
+				require.NoError(t, err)
+			}
+
+			resp := api.Delete("/databases/" + tt.database + "/stacks/empty")
+			require.Equal(t, tt.expStatusCode, resp.Code)
+			if tt.expBody != "" {
+				require.JSONEq(t, tt.expBody, resp.Body.String())
+			}
+			require.Equal(t, tt.expLen, db.Len())
+		})
+	}
+}
+
+func TestService_ListDatabaseStackElementsHandler(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name          string
+		path          string
+		expStatusCode int
+		expBody       string
+	}{
+		{name: "defaults", path: "/databases/dbName123/stacks/stackName123/elements", expStatusCode: http.StatusOK, expBody: `{"total": 3, "elements": [2, 1, 0]}`},
+		{name: "page", path: "/databases/dbName123/stacks/stackName123/elements?offset=1&limit=1", expStatusCode: http.StatusOK, expBody: `{"total": 3, "elements": [1]}`},
+		{name: "offset past the end", path: "/databases/dbName123/stacks/stackName123/elements?offset=3", expStatusCode: http.StatusOK, expBody: `{"total": 3, "elements": []}`},
+		{name: "negative limit", path: "/databases/dbName123/stacks/stackName123/elements?limit=-1", expStatusCode: http.StatusUnprocessableEntity},
+		{name: "stack dne", path: "/databases/dbName123/stacks/dne/elements", expStatusCode: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, api := humatest.New(t)
+			svc := handlers.New()
+			svc.AddRoutes(api)
+			db, err := svc.Repository.New("dbName123")
+			require.NoError(t, err)
+			stack, err := db.New("stackName123")
+			require.NoError(t, err)
+			require.NoError(t, stack.PushMany([]any{0, 1, 2}))
+
+			resp := api.Get(tt.path)
+			require.Equal(t, tt.expStatusCode, resp.Code)
+			if tt.expBody != "" {
+				require.JSONEq(t, tt.expBody, resp.Body.String())
+			}
+			require.Equal(t, 3, stack.Size())
+		})
+	}
+}
+
+func TestService_MaxElementsPerResponse(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		path    string
+		expBody string
+	}{
+		{
+			name:    "head truncated",
+			path:    "/databases/dbName123/stacks/stackName123/head?n=10",
+			expBody: `{"elements": [0, 1, 2], "truncated": true, "next_offset": 3}`,
+		},
+		{
+			name:    "head next page",
+			path:    "/databases/dbName123/stacks/stackName123/head?n=10&offset=3",
+			expBody: `{"elements": [3, 4]}`,
+		},
+		{
+			name:    "head within cap",
+			path:    "/databases/dbName123/stacks/stackName123/head?n=2",
+			expBody: `{"elements": [0, 1]}`,
+		},
+		{
+			name:    "elements truncated",
+			path:    "/databases/dbName123/stacks/stackName123/elements",
+			expBody: `{"total": 5, "elements": [4, 3, 2], "truncated": true, "next_offset": 3}`,
+		},
+		{
+			name:    "elements next page",
+			path:    "/databases/dbName123/stacks/stackName123/elements?offset=3",
+			expBody: `{"total": 5, "elements": [1, 0]}`,
+		},
+		{
+			name: "preview truncated",
+			path: "/databases/dbName123/stacks/stackName123/preview?n=10",
+			expBody: `{"elements": [
+				{"element": 4, "index": 4},
+				{"element": 3, "index": 3},
+				{"element": 2, "index": 2}
+			], "truncated": true, "next_offset": 3}`,
+		},
+		{
+			name: "preview next page",
+			path: "/databases/dbName123/stacks/stackName123/preview?n=10&offset=3",
+			expBody: `{"elements": [
+				{"element": 1, "index": 1},
+				{"element": 0, "index": 0}
+			]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, api := humatest.New(t)
+			svc := handlers.New(handlers.WithMaxElementsPerResponse(3))
+			svc.AddRoutes(api)
+			db, err := svc.Repository.New("dbName123")
+			require.NoError(t, err)
+			stack, err := db.New("stackName123")
+			require.NoError(t, err)
+			require.NoError(t, stack.PushMany([]any{0, 1, 2, 3, 4}))
+
+			resp := api.Get(tt.path)
+			require.Equal(t, http.StatusOK, resp.Code)
+			require.JSONEq(t, tt.expBody, resp.Body.String())
+		})
+	}
+}
+
+func TestService_ActivityDatabaseStackHandler(t *testing.T) {
+	t.Parallel()
+	_, api := humatest.New(t)
+	svc := handlers.New()
+	svc.AddRoutes(api)
+	db, err := svc.Repository.New("dbName123")
+	require.NoError(t, err)
+	_, err = db.New("stackName123")
+	require.NoError(t, err)
+
+	resp := api.Get("/databases/dbName123/stacks/stackName123/activity")
+	require.Equal(t, http.StatusOK, resp.Code)
+	var got map[string]any
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &got))
+	require.Contains(t, got, "created_at")
+	require.NotContains(t, got, "last_push_at")
+	require.NotContains(t, got, "last_pop_at")
+	require.NotContains(t, got, "last_peek_at")
+
+	require.Equal(t, http.StatusOK, api.Put("/databases/dbName123/stacks/stackName123", map[string]any{"element": 1}).Code)
+	require.Equal(t, http.StatusOK, api.Get("/databases/dbName123/stacks/stackName123/peek").Code)
+	require.Equal(t, http.StatusOK, api.Delete("/databases/dbName123/stacks/stackName123").Code)
+
+	resp = api.Get("/databases/dbName123/stacks/stackName123/activity")
+	require.Equal(t, http.StatusOK, resp.Code)
+	got = nil
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &got))
+	require.Contains(t, got, "last_push_at")
+	require.Contains(t, got, "last_pop_at")
+	require.Contains(t, got, "last_peek_at")
+
+	require.Equal(t, http.StatusNotFound, api.Get("/databases/dbName123/stacks/unknown123/activity").Code)
+}
+
+func TestService_RingStack(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name          string
+		query         string
+		expStatusCode int
+		expCapacity   int
+	}{
+		{name: "ring", query: "&ring=true&capacity=2", expStatusCode: http.StatusCreated, expCapacity: 2},
+		{name: "ring without capacity", query: "&ring=true", expStatusCode: http.StatusUnprocessableEntity},
+		{name: "capacity without ring", query: "&capacity=2", expStatusCode: http.StatusUnprocessableEntity},
+		{name: "negative capacity", query: "&ring=true&capacity=-1", expStatusCode: http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, api := humatest.New(t)
+			svc := handlers.New()
+			svc.AddRoutes(api)
+			_, err := svc.Repository.New("dbName123")
+			require.NoError(t, err)
+
+			resp := api.Post("/databases/dbName123/stacks?name=stackName123" + tt.query)
+			require.Equal(t, tt.expStatusCode, resp.Code)
+			if tt.expStatusCode != http.StatusCreated {
+				return
+			}
+			var created struct {
+				Capacity int `json:"capacity"`
+			}
+			require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &created))
+			require.Equal(t, tt.expCapacity, created.Capacity)
+
+			for i, exp := range []string{`{"element": 1}`, `{"element": 2}`, `{"element": 3, "dropped": 1}`, `{"element": 4, "dropped": 2}`} {
+				resp := api.Put("/databases/dbName123/stacks/stackName123", map[string]any{"element": i + 1})
+				require.Equal(t, http.StatusOK, resp.Code)
+				require.JSONEq(t, exp, resp.Body.String())
+			}
+			resp = api.Delete("/databases/dbName123/stacks/stackName123")
+			require.Equal(t, http.StatusOK, resp.Code)
+			require.JSONEq(t, `{"element": 4}`, resp.Body.String())
+		})
+	}
+}
+
+type typedEvent struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+func TestService_StackElementType(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name          string
+		element       any
+		expStatusCode int
+		expTop        any
+	}{
+		{name: "typed", element: map[string]any{"name": "a", "count": 2}, expStatusCode: http.StatusOK, expTop: typedEvent{Name: "a", Count: 2}},
+		{name: "type mismatch", element: map[string]any{"name": "a", "count": "two"}, expStatusCode: http.StatusUnprocessableEntity},
+		{name: "not an object", element: "a", expStatusCode: http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, api := humatest.New(t)
+			svc := handlers.New()
+			svc.AddRoutes(api)
+			db, err := svc.Repository.New("dbName123")
+			require.NoError(t, err)
+			stack, err := db.New("stackName123")
+			require.NoError(t, err)
+			stack.SetElementType(typedEvent{})
+
+			resp := api.Put("/databases/dbName123/stacks/stackName123", map[string]any{"element": tt.element})
+			require.Equal(t, tt.expStatusCode, resp.Code)
+			require.Equal(t, tt.expTop, stack.Peek())
+		})
+	}
+}
+
+func TestService_CompareDatabaseStacksHandler(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name          string
+		path          string
+		expStatusCode int
+		expBody       string
+	}{
+		{name: "equal", path: "/databases/dbName123/stacks/stackA123/equals/stackB123", expStatusCode: http.StatusOK, expBody: `{"equal": true, "first_diff_index": -1}`},
+		{name: "differ", path: "/databases/dbName123/stacks/stackA123/equals/stackC123", expStatusCode: http.StatusOK, expBody: `{"equal": false, "first_diff_index": 1}`},
+		{name: "other dne", path: "/databases/dbName123/stacks/stackA123/equals/dne", expStatusCode: http.StatusNotFound},
+		{name: "stack dne", path: "/databases/dbName123/stacks/dne/equals/stackA123", expStatusCode: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, api := humatest.New(t)
+			svc := handlers.New()
+			svc.AddRoutes(api)
+			db, err := svc.Repository.New("dbName123")
+			require.NoError(t, err)
+			for n, data := range map[string][]any{"stackA123": {1, 2}, "stackB123": {1, 2}, "stackC123": {1, 3}} {
+				stack, err := db.New(n)
+				require.NoError(t, err)
+				for _, e := range data {
+					stack.Push(e)
+				}
+			}
+
+			resp := api.Get(tt.path)
+			require.Equal(t, tt.expStatusCode, resp.Code)
+			if tt.expBody != "" {
+				require.JSONEq(t, tt.expBody, resp.Body.String())
+			}
+		})
+	}
+}
+
+func TestService_MaxStacksPerDatabase(t *testing.T) {
+	t.Parallel()
+	_, api := humatest.New(t)
+	svc := handlers.New(handlers.WithMaxStacksPerDatabase(1))
+	svc.AddRoutes(api)
+	_, err := svc.Repository.New("dbName123")
+	require.NoError(t, err)
+
+	resp := api.Post("/databases/dbName123/stacks?name=stackA123")
+	require.Equal(t, http.StatusCreated, resp.Code)
+	resp = api.Post("/databases/dbName123/stacks?name=stackB123")
+	require.Equal(t, http.StatusInsufficientStorage, resp.Code)
+	require.JSONEq(t, `{
+	  "title": "Insufficient Storage",
+	  "status": 507,
+	  "detail": "database must not have more than 1 stacks",
+	  "errors": [{"message": "limit reached: at most 1 stacks per database"}]
+	}`, resp.Body.String())
+	resp = api.Put("/databases/dbName123/stacks/stackB123?createMissing=true", map[string]any{"element": 1})
+	require.Equal(t, http.StatusInsufficientStorage, resp.Code)
+}
+
+func TestService_CreateDatabaseStackHandler_Elements(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name          string
+		path          string
+		body          any
+		expStatusCode int
+		expElements   []any
+	}{
+		{name: "no body", path: "/databases/dbName123/stacks?name=stackNew123", expStatusCode: http.StatusCreated},
+		{
+			name:          "elements",
+			path:          "/databases/dbName123/stacks?name=stackNew123",
+			body:          map[string]any{"elements": []any{"a", "b", "c"}},
+			expStatusCode: http.StatusCreated,
+			expElements:   []any{"a", "b", "c"},
+		},
+		{
+			name:          "ring",
+			path:          "/databases/dbName123/stacks?name=stackNew123&ring=true&capacity=2",
+			body:          map[string]any{"elements": []any{"a", "b", "c"}},
+			expStatusCode: http.StatusCreated,
+			expElements:   []any{"b", "c"},
+		},
+		{
+			name:          "exists",
+			path:          "/databases/dbName123/stacks?name=stackOld123",
+			body:          map[string]any{"elements": []any{"a"}},
+			expStatusCode: http.StatusConflict,
+		},
+		{
+			name:          "too deep",
+			path:          "/databases/dbName123/stacks?name=stackNew123",
+			body:          map[string]any{"elements": []any{nested(33)}},
+			expStatusCode: http.StatusUnprocessableEntity,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, api := humatest.New(t)
+			svc := handlers.New()
+			svc.AddRoutes(api)
+			db, err := svc.Repository.New("dbName123")
+			require.NoError(t, err)
+			old, err := db.New("stackOld123")
+			require.NoError(t, err)
+			old.Push("old")
+
+			var args []any
+			if tt.body != nil {
+				args = append(args, tt.body)
+			}
+			resp := api.Post(tt.path, args...)
+			require.Equal(t, tt.expStatusCode, resp.Code)
+			if tt.expStatusCode != http.StatusCreated {
+				require.Equal(t, []any{"old"}, old.Data)
+				_, err := db.Stack("stackNew123")
+				require.ErrorIs(t, err, repository.ErrNotFound)
+				return
+			}
+			var created struct {
+				Elements []any `json:"elements"`
+				Size     int   `json:"size"`
+			}
+			require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &created))
+			require.Equal(t, tt.expElements, created.Elements)
+			require.Len(t, tt.expElements, created.Size)
+		})
+	}
+}
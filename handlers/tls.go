@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/danielgtaylor/huma/v2"
+)
+
+// errNoTLSFiles is returned when reloading without WithTLSFiles.
+var errNoTLSFiles = errors.New("TLS certificate files not configured")
+
+// certHolder holds the certificate served over HTTPS, so it can be swapped
+// without restarting the servers.
+type certHolder struct {
+	cert     atomic.Pointer[tls.Certificate]
+	certFile string
+	keyFile  string
+}
+
+// load reads the certificate and key files, keeping the current certificate
+// if they can't be read.
+func (h *certHolder) load() error {
+	cert, err := tls.LoadX509KeyPair(h.certFile, h.keyFile)
+	if err != nil {
+		return err
+	}
+	h.cert.Store(&cert)
+
+	return nil
+}
+
+func (h *certHolder) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cert := h.cert.Load()
+	if cert == nil {
+		return nil, errors.New("no TLS certificate loaded")
+	}
+
+	return cert, nil
+}
+
+// WithTLSFiles serves HTTPS with the certificate and key read from the
+// given PEM files instead of a self-signed certificate. The files are read
+// again by ReloadTLS, on SIGHUP, or with POST /_tls/reload, so a renewed
+// certificate is picked up without a restart.
+func WithTLSFiles(certFile, keyFile string) Option {
+	return func(s *Service) {
+		s.secure = true
+		s.certs = &certHolder{certFile: certFile, keyFile: keyFile}
+	}
+}
+
+// ReloadTLS re-reads the certificate and key files of WithTLSFiles. New
+// connections use the new certificate, while established ones are left as
+// is. On error the current certificate keeps being served.
+func (s *Service) ReloadTLS() error {
+	if s.certs == nil {
+		return errNoTLSFiles
+	}
+
+	return s.certs.load()
+}
+
+// tlsConfig returns the TLS config of the servers, nil if not secure.
+func (s *Service) tlsConfig() *tls.Config {
+	if !s.secure {
+		return nil
+	}
+	if s.certs != nil {
+		return &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: s.certs.getCertificate,
+		}
+	}
+	cert, err := generateSelfSignedCert()
+	if err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+
+	return &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+}
+
+// reloadOnHangup reloads the TLS certificate on SIGHUP until the service is
+// shut down.
+func (s *Service) reloadOnHangup() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-hup:
+			if err := s.ReloadTLS(); err != nil {
+				slog.Error("Failed to reload TLS certificate", slog.String("error", err.Error()))
+				continue
+			}
+			slog.Info("Reloaded TLS certificate")
+		}
+	}
+}
+
+func (s *Service) ReloadTLSHandler(_ context.Context, _ *struct{}) (*struct{}, error) {
+	if err := s.ReloadTLS(); err != nil {
+		return nil, huma.Error500InternalServerError("failed to reload TLS certificate", err)
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,152 @@
+package handlers_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jh125486/batterdb/handlers"
+)
+
+func TestService_ReloadTLS(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeCert(t, certFile, keyFile, 1)
+	badFile := filepath.Join(dir, "bad.pem")
+	require.NoError(t, os.WriteFile(badFile, []byte("not a cert"), 0o600))
+
+	tests := []struct {
+		name    string
+		opts    []handlers.Option
+		wantErr assert.ErrorAssertionFunc
+	}{
+		{
+			name:    "no files",
+			wantErr: assert.Error,
+		},
+		{
+			name:    "missing files",
+			opts:    []handlers.Option{handlers.WithTLSFiles(filepath.Join(dir, "dne.pem"), keyFile)},
+			wantErr: assert.Error,
+		},
+		{
+			name:    "bad files",
+			opts:    []handlers.Option{handlers.WithTLSFiles(badFile, keyFile)},
+			wantErr: assert.Error,
+		},
+		{
+			name:    "files",
+			opts:    []handlers.Option{handlers.WithTLSFiles(certFile, keyFile)},
+			wantErr: assert.NoError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			svc := handlers.New(tt.opts...)
+			tt.wantErr(t, svc.ReloadTLS())
+		})
+	}
+}
+
+func TestService_TLSFiles(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeCert(t, certFile, keyFile, 1)
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		t.Fatal("can't read build info")
+	}
+	svc := handlers.New(
+		handlers.WithPort(0),
+		handlers.WithBuildInfo(info),
+		handlers.WithTLSFiles(certFile, keyFile),
+	)
+	require.True(t, svc.Secure())
+	go func() {
+		assert.NoError(t, svc.Start())
+	}()
+	t.Cleanup(func() {
+		assert.NoError(t, svc.Shutdown(context.Background()))
+	})
+	require.Eventually(t, func() bool {
+		return svc.Port() != 0
+	}, time.Second, 10*time.Millisecond)
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true}, //nolint:gosec // self-signed test certificate.
+		DisableKeepAlives: true,
+	}}
+	url := "https://localhost:" + strconv.Itoa(int(svc.Port()))
+	serial := func() int64 {
+		resp, err := client.Get(url + "/_ping")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		return resp.TLS.PeerCertificates[0].SerialNumber.Int64()
+	}
+	require.Eventually(t, func() bool {
+		resp, err := client.Get(url + "/_ping")
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, int64(1), serial())
+
+	// A failed reload keeps the current certificate.
+	require.NoError(t, os.WriteFile(certFile, []byte("not a cert"), 0o600))
+	resp, err := client.Post(url+"/_tls/reload", "", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	assert.Equal(t, int64(1), serial())
+
+	writeCert(t, certFile, keyFile, 2)
+	resp, err = client.Post(url+"/_tls/reload", "", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Equal(t, int64(2), serial())
+}
+
+// writeCert writes a self-signed certificate with the serial number and its
+// key as PEM files.
+func writeCert(t *testing.T, certFile, keyFile string, serial int64) {
+	t.Helper()
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{Organization: []string{"batterdb test"}},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &priv.PublicKey, priv)
+	require.NoError(t, err)
+	key, err := x509.MarshalPKCS8PrivateKey(priv)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key}), 0o600))
+}
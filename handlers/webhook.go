@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/jh125486/batterdb/repository"
+)
+
+const (
+	// maxWebhookPending bounds the events being delivered or waiting to be
+	// retried, events beyond it are dropped.
+	maxWebhookPending = 256
+	// webhookTimeout is the timeout of a single webhook request.
+	webhookTimeout = 10 * time.Second
+	// maxWebhookBackoff caps the delay between retries.
+	maxWebhookBackoff = time.Minute
+)
+
+// errPermanent marks a webhook failure that a retry won't fix.
+var errPermanent = errors.New("permanent failure")
+
+// webhook posts pushed elements to a URL in the background.
+type webhook struct {
+	client  *http.Client
+	metrics *metrics
+	pending chan struct{}
+	url     string
+	// baseDelay is the delay before the first retry, doubling after each
+	// further attempt.
+	baseDelay   time.Duration
+	maxAttempts int
+}
+
+func newWebhook(url string) *webhook {
+	return &webhook{
+		client:      &http.Client{Timeout: webhookTimeout},
+		pending:     make(chan struct{}, maxWebhookPending),
+		url:         url,
+		maxAttempts: 1,
+	}
+}
+
+// send delivers the element in the background, retrying failed attempts with
+// exponential backoff. The event is dropped and logged once all attempts
+// failed, or right away when too many events are pending.
+func (wh *webhook) send(db, stack string, element any) {
+	select {
+	case wh.pending <- struct{}{}:
+	default:
+		slog.Warn("Push webhook saturated, dropping event",
+			slog.String("database", db),
+			slog.String("stack", stack))
+		wh.metrics.observeWebhookEvent(false)
+		return
+	}
+	go func() {
+		defer func() { <-wh.pending }()
+		err := wh.deliver(db, stack, element)
+		wh.metrics.observeWebhookEvent(err == nil)
+		if err != nil {
+			slog.Error("Push webhook failed, dropping event",
+				slog.String("database", db),
+				slog.String("stack", stack),
+				slog.String("error", err.Error()))
+		}
+	}()
+}
+
+// deliver posts the element until it succeeds, fails permanently, or runs
+// out of attempts.
+func (wh *webhook) deliver(db, stack string, element any) error {
+	b, err := json.Marshal(element)
+	if err != nil {
+		return err
+	}
+	delay := wh.baseDelay
+	for attempt := 1; ; attempt++ {
+		err = wh.post(context.Background(), db, stack, b)
+		if err == nil || errors.Is(err, errPermanent) || attempt >= wh.maxAttempts {
+			return err
+		}
+		slog.Warn("Push webhook failed, retrying",
+			slog.String("database", db),
+			slog.String("stack", stack),
+			slog.Int("attempt", attempt),
+			slog.Duration("delay", delay),
+			slog.String("error", err.Error()))
+		time.Sleep(delay)
+		delay = min(2*delay, maxWebhookBackoff)
+	}
+}
+
+func (wh *webhook) post(ctx context.Context, db, stack string, b []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-BatterDB-Database", db)
+	req.Header.Set("X-BatterDB-Stack", stack)
+
+	resp, err := wh.client.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError:
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	case resp.StatusCode >= http.StatusMultipleChoices:
+		return fmt.Errorf("%w: unexpected status %d", errPermanent, resp.StatusCode)
+	}
+
+	return nil
+}
+
+// pushed notifies the push webhook, if any, of a pushed element.
+func (s *Service) pushed(db *repository.Database, stack *repository.Stack, element any) {
+	if s.webhook != nil {
+		s.webhook.send(db.Name, stack.Name, element)
+	}
+}
@@ -0,0 +1,107 @@
+package handlers_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2/humatest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jh125486/batterdb/handlers"
+)
+
+func TestService_PushWebhook(t *testing.T) {
+	t.Parallel()
+	type event struct {
+		database, stack, body string
+	}
+	tests := []struct {
+		name      string
+		opts      []handlers.Option
+		statuses  []int
+		wantCalls int
+	}{
+		{
+			name:      "delivered",
+			statuses:  []int{http.StatusNoContent},
+			wantCalls: 1,
+		},
+		{
+			name:      "webhook fails",
+			statuses:  []int{http.StatusInternalServerError},
+			wantCalls: 1,
+		},
+		{
+			name:      "retried until delivered",
+			opts:      []handlers.Option{handlers.WithWebhookRetry(5, time.Millisecond)},
+			statuses:  []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK},
+			wantCalls: 3,
+		},
+		{
+			name:      "retries exhausted",
+			opts:      []handlers.Option{handlers.WithWebhookRetry(3, time.Millisecond)},
+			statuses:  []int{http.StatusBadGateway},
+			wantCalls: 3,
+		},
+		{
+			name:      "client error not retried",
+			opts:      []handlers.Option{handlers.WithWebhookRetry(3, time.Millisecond)},
+			statuses:  []int{http.StatusBadRequest},
+			wantCalls: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var (
+				mx     sync.Mutex
+				events []event
+			)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, _ := io.ReadAll(r.Body)
+				mx.Lock()
+				defer mx.Unlock()
+				events = append(events, event{
+					database: r.Header.Get("X-BatterDB-Database"),
+					stack:    r.Header.Get("X-BatterDB-Stack"),
+					body:     string(b),
+				})
+				w.WriteHeader(tt.statuses[min(len(events), len(tt.statuses))-1])
+			}))
+			t.Cleanup(srv.Close)
+
+			_, api := humatest.New(t)
+			svc := handlers.New(append([]handlers.Option{handlers.WithPushWebhook(srv.URL)}, tt.opts...)...)
+			svc.AddRoutes(api)
+			db, err := svc.Repository.New("dbName123")
+			require.NoError(t, err)
+			_, err = db.New("stackName123")
+			require.NoError(t, err)
+
+			resp := api.Put("/databases/dbName123/stacks/stackName123", map[string]any{
+				"element": map[string]any{"key": "value"},
+			})
+			require.Equal(t, http.StatusOK, resp.Code, "webhook failures must not fail the push")
+			require.Eventually(t, func() bool {
+				mx.Lock()
+				defer mx.Unlock()
+				return len(events) >= tt.wantCalls
+			}, time.Second, time.Millisecond)
+			time.Sleep(20 * time.Millisecond)
+
+			mx.Lock()
+			defer mx.Unlock()
+			require.Len(t, events, tt.wantCalls)
+			for _, e := range events {
+				assert.Equal(t, "dbName123", e.database)
+				assert.Equal(t, "stackName123", e.stack)
+				assert.JSONEq(t, `{"key": "value"}`, e.body)
+			}
+		})
+	}
+}
@@ -43,6 +43,7 @@ func main() {
 			Stop:      stop,
 			BuildInfo: info,
 			Writer:    os.Stdout,
+			Reader:    os.Stdin,
 		}),
 	)
 	if err != nil {
@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/gob"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"sync"
+)
+
+// compressedElement is an element stored as flate-compressed JSON. It is
+// persisted as is, and expanded whenever the element is read.
+type compressedElement struct {
+	Data []byte
+}
+
+// flateWriters pools writers, as each one allocates large internal buffers.
+var flateWriters = sync.Pool{
+	New: func() any {
+		w, _ := flate.NewWriter(nil, flate.DefaultCompression)
+		return w
+	},
+}
+
+func init() {
+	gob.Register(compressedElement{})
+}
+
+// SetElementCompression compresses elements pushed from now on whose JSON
+// encoding is at least minBytes long, trading CPU on push and read for memory.
+// A value of 0 disables compression. Elements that are already compressed
+// stay compressed either way.
+func (r *Repository) SetElementCompression(minBytes int) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.compressMin = minBytes
+	for _, db := range r.Databases {
+		db.compressMin = minBytes
+	}
+}
+
+// compress returns the compressed form of element if its JSON encoding is at
+// least minBytes long and compression saves space, otherwise element itself.
+func compress(element any, minBytes int) any {
+	if minBytes <= 0 || element == nil {
+		return element
+	}
+	b, err := json.Marshal(element)
+	if err != nil || len(b) < minBytes {
+		return element
+	}
+
+	var buf bytes.Buffer
+	w := flateWriters.Get().(*flate.Writer)
+	defer flateWriters.Put(w)
+	w.Reset(&buf)
+	_, _ = w.Write(b)
+	if err := w.Close(); err != nil || buf.Len() >= len(b) {
+		return element
+	}
+
+	return compressedElement{Data: buf.Bytes()}
+}
+
+// expand returns the original form of a possibly compressed or identified
+// element.
+func expand(element any) any {
+	if ie, ok := element.(identifiedElement); ok {
+		element = ie.Value
+	}
+	c, ok := element.(compressedElement)
+	if !ok {
+		return element
+	}
+
+	var v any
+	if err := json.NewDecoder(flate.NewReader(bytes.NewReader(c.Data))).Decode(&v); err != nil && err != io.EOF {
+		slog.Error("Failed to expand compressed element", slog.String("error", err.Error()))
+		return nil
+	}
+
+	return v
+}
+
+// expandAll expands the elements in place.
+func expandAll(elements []any) []any {
+	for i, e := range elements {
+		elements[i] = expand(e)
+	}
+
+	return elements
+}
@@ -0,0 +1,81 @@
+package repository_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jh125486/batterdb/repository"
+)
+
+func TestRepository_SetElementCompression(t *testing.T) {
+	t.Parallel()
+	large := strings.Repeat("batter ", 100)
+	tests := []struct {
+		name           string
+		minBytes       int
+		element        any
+		wantCompressed bool
+	}{
+		{name: "disabled", minBytes: 0, element: large},
+		{name: "below threshold", minBytes: 1024, element: large},
+		{name: "compressed", minBytes: 64, element: large, wantCompressed: true},
+		{name: "incompressible", minBytes: 1, element: "a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			repo := repository.New()
+			repo.SetElementCompression(tt.minBytes)
+			db, err := repo.New("test")
+			require.NoError(t, err)
+			stack, err := db.New("stack")
+			require.NoError(t, err)
+
+			stack.Push(tt.element)
+			if tt.wantCompressed {
+				assert.NotEqual(t, tt.element, stack.Data[0], "stored element must be compressed")
+			} else {
+				assert.Equal(t, tt.element, stack.Data[0])
+			}
+			assert.Equal(t, tt.element, stack.Peek())
+			assert.Equal(t, tt.element, stack.Top())
+			assert.Equal(t, []any{tt.element}, stack.Elements(0, 1))
+			assert.True(t, stack.Contains(tt.element))
+
+			// The compressed form is persisted and expanded after loading.
+			filename := filepath.Join(t.TempDir(), "repo")
+			require.NoError(t, repo.Persist(filename))
+			loaded := repository.New()
+			require.NoError(t, loaded.Load(filename))
+			db, err = loaded.Database("test")
+			require.NoError(t, err)
+			stack, err = db.Stack("stack")
+			require.NoError(t, err)
+			assert.Equal(t, tt.element, stack.Pop())
+		})
+	}
+}
+
+func BenchmarkStack_Push(b *testing.B) {
+	element := strings.Repeat("batter ", 1000)
+	for _, minBytes := range []int{0, 1024} {
+		b.Run("compression="+map[bool]string{false: "off", true: "on"}[minBytes > 0], func(b *testing.B) {
+			repo := repository.New()
+			repo.SetElementCompression(minBytes)
+			db, err := repo.New("test")
+			require.NoError(b, err)
+			stack, err := db.New("stack")
+			require.NoError(b, err)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for range b.N {
+				stack.Push(element)
+				_ = stack.Peek()
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrNotANumber is returned when a counter holds a non-numeric element.
+var ErrNotANumber = errors.New("not a number")
+
+// Counter returns the value of the stack used as a counter, which is its top
+// element. An empty stack counts as 0.
+func (s *Stack) Counter() (float64, error) {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+	s.setReadTime(time.Now())
+
+	return s.counter()
+}
+
+// SetCounter sets the value of the stack used as a counter, replacing all of
+// its elements.
+func (s *Stack) SetCounter(v float64) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.setUpdateTime(time.Now())
+	s.Data = []any{v}
+}
+
+// AddCounter atomically adds delta to the value of the stack used as a
+// counter and returns the new value.
+func (s *Stack) AddCounter(delta float64) (float64, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	v, err := s.counter()
+	if err != nil {
+		return 0, err
+	}
+	v += delta
+	s.setUpdateTime(time.Now())
+	s.Data = []any{v}
+
+	return v, nil
+}
+
+func (s *Stack) counter() (float64, error) {
+	if len(s.Data) == 0 {
+		return 0, nil
+	}
+	switch v := expand(s.Data[len(s.Data)-1]).(type) {
+	case float64:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case int32:
+		return float64(v), nil
+	case uint:
+		return float64(v), nil
+	case uint64:
+		return float64(v), nil
+	case uint32:
+		return float64(v), nil
+	default:
+		return 0, ErrNotANumber
+	}
+}
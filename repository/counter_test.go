@@ -0,0 +1,48 @@
+package repository_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jh125486/batterdb/repository"
+)
+
+func TestStack_AddCounter(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		data    []any
+		delta   float64
+		want    float64
+		wantErr assert.ErrorAssertionFunc
+	}{
+		{name: "empty", delta: 1, want: 1, wantErr: assert.NoError},
+		{name: "float", data: []any{1.5}, delta: 1, want: 2.5, wantErr: assert.NoError},
+		{name: "int", data: []any{"x", 3}, delta: -1, want: 2, wantErr: assert.NoError},
+		{name: "not a number", data: []any{"x"}, delta: 1, want: 0, wantErr: assert.Error},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			stack := &repository.Stack{Data: tt.data}
+			got, err := stack.AddCounter(tt.delta)
+			tt.wantErr(t, err)
+			assert.InDelta(t, tt.want, got, 0)
+			if err == nil {
+				assert.Equal(t, []any{tt.want}, stack.Data)
+			}
+		})
+	}
+}
+
+func TestStack_SetCounter(t *testing.T) {
+	t.Parallel()
+	stack := &repository.Stack{Data: []any{1, 2, 3}}
+	stack.SetCounter(42)
+	assert.Equal(t, []any{float64(42)}, stack.Data)
+
+	got, err := stack.Counter()
+	assert.NoError(t, err)
+	assert.InDelta(t, 42, got, 0)
+}
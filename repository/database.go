@@ -1,18 +1,93 @@
 package repository
 
 import (
-	"sort"
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 )
 
-type Database struct {
-	Stacks map[name]*Stack
-	Name   string
-	ID     uuid.UUID
-	mx     sync.RWMutex
+type (
+	Database struct {
+		Stacks map[name]*Stack
+		Name   string
+		Mode   Mode
+		// Schema is the JSON Schema of the elements of its stacks, see
+		// SetSchema.
+		Schema []byte
+		ID     uuid.UUID
+		mx     sync.RWMutex
+		// schemaMx guards Schema apart from mx, so pushes can read it while a
+		// batch holds the database exclusively.
+		schemaMx sync.RWMutex
+		// compressMin is the threshold of SetElementCompression.
+		compressMin int
+		// maxStacks is the limit of SetMaxStacks.
+		maxStacks int
+		// maxSize is the limit of SetMaxStackSize.
+		maxSize int
+		// dirty is set by every mutation of the database or its stacks, and
+		// cleared when PersistDir writes the database.
+		dirty atomic.Bool
+	}
+	// DatabaseOption configures a new database.
+	DatabaseOption func(*Database)
+	// Mode is the kind of a database.
+	Mode string
+)
+
+const (
+	// ModeStack is a regular database of stacks.
+	ModeStack Mode = ""
+	// ModeCounter is a database of counters, where every stack holds a single
+	// numeric element.
+	ModeCounter Mode = "counter"
+)
+
+// WithMode sets the mode of a new database.
+func WithMode(mode Mode) DatabaseOption {
+	return func(db *Database) {
+		db.Mode = mode
+	}
+}
+
+// IsCounter reports whether the database is a counter database.
+func (db *Database) IsCounter() bool { return db.Mode == ModeCounter }
+
+func (db *Database) markDirty() { db.dirty.Store(true) }
+
+// link restores the database of each stack, which isn't persisted.
+func (db *Database) link() {
+	for _, stack := range db.Stacks {
+		stack.database = db
+	}
+}
+
+// snapshot returns a copy of the persisted fields of the database and its
+// stacks, locking the database and then each stack, so it can be encoded while
+// they change.
+func (db *Database) snapshot() *Database {
+	db.mx.RLock()
+	defer db.mx.RUnlock()
+	c := &Database{
+		Stacks: make(map[name]*Stack, len(db.Stacks)),
+		Name:   db.Name,
+		Mode:   db.Mode,
+		Schema: db.ElementSchema(),
+		ID:     db.ID,
+	}
+	for n, stack := range db.Stacks {
+		c.Stacks[n] = stack.snapshot()
+	}
+
+	return c
 }
 
 func (db *Database) Len() int {
@@ -22,22 +97,81 @@ func (db *Database) Len() int {
 }
 
 func (db *Database) SortStacks() []*Stack {
+	return db.SortStacksFunc(ByName)
+}
+
+// SortStacksFunc returns the stacks sorted by the comparator, e.g. ByName or
+// ByReadAt.
+func (db *Database) SortStacksFunc(compare func(a, b *Stack) int) []*Stack {
 	db.mx.RLock()
 	defer db.mx.RUnlock()
 	stacks := make([]*Stack, 0, len(db.Stacks))
 	for _, stack := range db.Stacks {
 		stacks = append(stacks, stack)
 	}
-	sort.Slice(stacks, func(i, j int) bool {
-		return stacks[i].Name < stacks[j].Name
-	})
+	slices.SortFunc(stacks, compare)
 
 	return stacks
 }
 
+// StackDepth is the size of a stack at the time of a Depths snapshot.
+type StackDepth struct {
+	Name string
+	Size int
+}
+
+// Depths returns a snapshot of the size of every stack, deepest first, with
+// ties broken by name.
+func (db *Database) Depths() []StackDepth {
+	db.mx.RLock()
+	depths := make([]StackDepth, 0, len(db.Stacks))
+	for _, stack := range db.Stacks {
+		depths = append(depths, StackDepth{Name: stack.Name, Size: stack.Size()})
+	}
+	db.mx.RUnlock()
+	slices.SortFunc(depths, func(a, b StackDepth) int {
+		if c := cmp.Compare(b.Size, a.Size); c != 0 {
+			return c
+		}
+
+		return cmp.Compare(a.Name, b.Name)
+	})
+
+	return depths
+}
+
+// ByName compares stacks by name.
+func ByName(a, b *Stack) int {
+	return cmp.Compare(a.Name, b.Name)
+}
+
+// ByReadAt compares stacks by last read time, least recently read first.
+// Ties are broken by name.
+func ByReadAt(a, b *Stack) int {
+	if c := a.ReadAt.Load().Compare(b.ReadAt.Load()); c != 0 {
+		return c
+	}
+
+	return ByName(a, b)
+}
+
 func (db *Database) Stack(id string) (*Stack, error) {
 	db.mx.RLock()
 	defer db.mx.RUnlock()
+
+	return db.stack(id)
+}
+
+// Exclusive runs fn holding the write lock of the database, so no other
+// operation can look up, create or drop its stacks until fn returns. Inside
+// fn, stacks must be looked up with the given func, as Stack would deadlock.
+func (db *Database) Exclusive(fn func(stack func(id string) (*Stack, error))) {
+	db.mx.Lock()
+	defer db.mx.Unlock()
+	fn(db.stack)
+}
+
+func (db *Database) stack(id string) (*Stack, error) {
 	uid, err := uuid.Parse(id)
 	if err != nil {
 		// must be a name.
@@ -61,6 +195,9 @@ func (db *Database) New(n string) (*Stack, error) {
 	if _, ok := db.Stacks[name(n)]; ok {
 		return nil, ErrAlreadyExists
 	}
+	if db.maxStacks > 0 && len(db.Stacks) >= db.maxStacks {
+		return nil, fmt.Errorf("%w: at most %d stacks per database", ErrLimitReached, db.maxStacks)
+	}
 
 	t := time.Now()
 	stack := &Stack{
@@ -69,9 +206,10 @@ func (db *Database) New(n string) (*Stack, error) {
 		database:  db,
 		CreatedAt: t,
 		UpdatedAt: t,
-		ReadAt:    t,
 	}
+	stack.ReadAt.Store(t)
 	db.Stacks[name(n)] = stack
+	db.markDirty()
 
 	return stack, nil
 }
@@ -82,9 +220,262 @@ func (db *Database) Drop(id string) error {
 	for _, stack := range db.Stacks {
 		if stack.ID.String() == id || stack.Name == id {
 			delete(db.Stacks, name(stack.Name))
+			db.markDirty()
 			return nil
 		}
 	}
 
 	return ErrNotFound
 }
+
+// DropEmpty drops every empty stack and returns the number dropped. The
+// database is locked for the whole pass, so no stack can be looked up or
+// created in between.
+func (db *Database) DropEmpty() int {
+	db.mx.Lock()
+	defer db.mx.Unlock()
+	dropped := 0
+	for n, stack := range db.Stacks {
+		if stack.Size() == 0 {
+			delete(db.Stacks, n)
+			dropped++
+		}
+	}
+	if dropped > 0 {
+		db.markDirty()
+	}
+
+	return dropped
+}
+
+// Rename renames a stack, keeping its ID, elements and metadata. It fails
+// with ErrAlreadyExists if another stack has the new name.
+func (db *Database) Rename(id, newName string) (*Stack, error) {
+	db.mx.Lock()
+	defer db.mx.Unlock()
+	stack, err := db.stack(id)
+	if err != nil {
+		return nil, err
+	}
+	if stack.Name == newName {
+		return stack, nil
+	}
+	if _, ok := db.Stacks[name(newName)]; ok {
+		return nil, ErrAlreadyExists
+	}
+
+	stack.mx.Lock()
+	defer stack.mx.Unlock()
+	delete(db.Stacks, name(stack.Name))
+	stack.Name = newName
+	stack.UpdatedAt = time.Now()
+	db.Stacks[name(newName)] = stack
+	db.markDirty()
+
+	return stack, nil
+}
+
+// SwapStacks atomically exchanges the elements of two stacks, along with their
+// capacities (so a ring's elements stay within its capacity) and their
+// updated, push, pop, read and peek times. The stacks keep their IDs, names,
+// creation times, labels, descriptions, element types, schemas and stats, so
+// swapping a staging stack with a production stack promotes the staging
+// elements under the production name, still validated as the production
+// stack. The database is locked throughout, so neither stack can be dropped
+// while they're swapped.
+func (db *Database) SwapStacks(idA, idB string) error {
+	db.mx.RLock()
+	defer db.mx.RUnlock()
+	a, err := db.stack(idA)
+	if err != nil {
+		return err
+	}
+	b, err := db.stack(idB)
+	if err != nil {
+		return err
+	}
+	if a == b {
+		return nil
+	}
+
+	// Lock in a consistent order so concurrent swaps can't deadlock.
+	first, second := a, b
+	if bytes.Compare(a.ID[:], b.ID[:]) > 0 {
+		first, second = b, a
+	}
+	first.mx.Lock()
+	defer first.mx.Unlock()
+	second.mx.Lock()
+	defer second.mx.Unlock()
+
+	a.Data, b.Data = b.Data, a.Data
+	a.Capacity, b.Capacity = b.Capacity, a.Capacity
+	a.UpdatedAt, b.UpdatedAt = b.UpdatedAt, a.UpdatedAt
+	a.LastPushAt, b.LastPushAt = b.LastPushAt, a.LastPushAt
+	a.LastPopAt, b.LastPopAt = b.LastPopAt, a.LastPopAt
+	readA, readB := a.ReadAt.Load(), b.ReadAt.Load()
+	a.setReadTime(readB)
+	b.setReadTime(readA)
+	peekA, peekB := a.LastPeekAt.Load(), b.LastPeekAt.Load()
+	a.LastPeekAt.Store(peekB)
+	b.LastPeekAt.Store(peekA)
+	// Waiters of either stack may now have elements to pop.
+	a.notifyPushed()
+	b.notifyPushed()
+	db.markDirty()
+
+	return nil
+}
+
+// CompareStacks compares the elements of two stacks one by one, from the
+// bottom up, with the element equality of Contains. It returns the index of
+// the first element that differs, counted from the bottom, or -1 if the stacks
+// are equal. When one stack is a prefix of the other, the index is the size of
+// the smaller one.
+func (db *Database) CompareStacks(idA, idB string) (int, error) {
+	a, err := db.Stack(idA)
+	if err != nil {
+		return 0, err
+	}
+	b, err := db.Stack(idB)
+	if err != nil {
+		return 0, err
+	}
+	if a == b {
+		return -1, nil
+	}
+
+	// Lock in a consistent order, like SwapStacks.
+	first, second := a, b
+	if bytes.Compare(a.ID[:], b.ID[:]) > 0 {
+		first, second = b, a
+	}
+	first.mx.RLock()
+	defer first.mx.RUnlock()
+	second.mx.RLock()
+	defer second.mx.RUnlock()
+
+	now := time.Now()
+	a.setReadTime(now)
+	b.setReadTime(now)
+	for i := range min(len(a.Data), len(b.Data)) {
+		if !elementsEqual(expand(a.Data[i]), expand(b.Data[i])) {
+			return i, nil
+		}
+	}
+	if len(a.Data) != len(b.Data) {
+		return min(len(a.Data), len(b.Data)), nil
+	}
+
+	return -1, nil
+}
+
+type (
+	// DatabaseExport is the JSON document of Export and Import.
+	DatabaseExport struct {
+		Name   string        `json:"name"`
+		Mode   Mode          `json:"mode,omitempty"`
+		Stacks []StackExport `json:"stacks"`
+	}
+	// StackExport is a stack of a DatabaseExport, with its elements bottom
+	// first so the last one is the top.
+	StackExport struct {
+		Labels      map[string]string `json:"labels,omitempty"`
+		Name        string            `json:"name"`
+		Description string            `json:"description,omitempty"`
+		Elements    []any             `json:"elements"`
+		Capacity    int               `json:"capacity,omitempty"`
+	}
+)
+
+// ErrInvalidExport is returned by Import for a document with duplicate or
+// missing stack names.
+var ErrInvalidExport = errors.New("invalid export")
+
+// Export returns the database with every stack and its elements, sorted by
+// stack name.
+func (db *Database) Export() DatabaseExport {
+	stacks := db.SortStacks()
+	exp := DatabaseExport{
+		Name:   db.Name,
+		Mode:   db.Mode,
+		Stacks: make([]StackExport, len(stacks)),
+	}
+	for i, stack := range stacks {
+		stack.mx.RLock()
+		exp.Stacks[i] = StackExport{
+			Name:        stack.Name,
+			Description: stack.Description,
+			Labels:      maps.Clone(stack.Labels),
+			Capacity:    stack.Capacity,
+			Elements:    expandAll(slices.Clone(stack.Data)),
+		}
+		stack.mx.RUnlock()
+		stack.setReadTime(time.Now())
+	}
+
+	return exp
+}
+
+// Import creates the stacks of the export. A stack that already exists fails
+// the import with ErrAlreadyExists, unless overwrite is set, in which case its
+// elements and metadata are replaced and its ID is kept. Nothing is imported
+// if any stack fails.
+func (db *Database) Import(exp DatabaseExport, overwrite bool) error {
+	db.mx.Lock()
+	defer db.mx.Unlock()
+	if err := db.checkImport(exp, overwrite); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, sexp := range exp.Stacks {
+		stack, ok := db.Stacks[name(sexp.Name)]
+		if !ok {
+			stack = &Stack{ID: uuid.New(), Name: sexp.Name, database: db, CreatedAt: now}
+			db.Stacks[name(sexp.Name)] = stack
+		}
+		stack.mx.Lock()
+		stack.Description = sexp.Description
+		stack.Labels = maps.Clone(sexp.Labels)
+		stack.Capacity = sexp.Capacity
+		stack.Data = make([]any, 0, len(sexp.Elements))
+		for _, element := range sexp.Elements {
+			stack.push(compress(element, db.compressMin))
+		}
+		stack.setUpdateTime(now)
+		stack.notifyPushed()
+		stack.mx.Unlock()
+	}
+	db.markDirty()
+
+	return nil
+}
+
+// checkImport validates the export against the database and its limits.
+// It must be called with the write lock held.
+func (db *Database) checkImport(exp DatabaseExport, overwrite bool) error {
+	names := make(map[string]bool, len(exp.Stacks))
+	added := 0
+	for i, sexp := range exp.Stacks {
+		switch {
+		case sexp.Name == "":
+			return fmt.Errorf("%w: stack %d has no name", ErrInvalidExport, i)
+		case names[sexp.Name]:
+			return fmt.Errorf("%w: duplicate stack %q", ErrInvalidExport, sexp.Name)
+		case db.maxSize > 0 && min(len(sexp.Elements), cmp.Or(sexp.Capacity, len(sexp.Elements))) > db.maxSize:
+			return fmt.Errorf("%w: stack %q has more than %d elements", ErrStackFull, sexp.Name, db.maxSize)
+		}
+		names[sexp.Name] = true
+		if _, ok := db.Stacks[name(sexp.Name)]; !ok {
+			added++
+		} else if !overwrite {
+			return fmt.Errorf("%w: stack %q", ErrAlreadyExists, sexp.Name)
+		}
+	}
+	if db.maxStacks > 0 && len(db.Stacks)+added > db.maxStacks {
+		return fmt.Errorf("%w: at most %d stacks per database", ErrLimitReached, db.maxStacks)
+	}
+
+	return nil
+}
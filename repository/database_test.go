@@ -2,6 +2,7 @@ package repository_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
@@ -114,6 +115,31 @@ func TestDatabase_SortStacks(t *testing.T) {
 	}
 }
 
+func TestDatabase_SortStacksFunc_ByReadAt(t *testing.T) {
+	t.Parallel()
+	db, err := repository.New().New("abcd")
+	require.NoError(t, err)
+	now := time.Now()
+	for n, age := range map[string]time.Duration{
+		"fresh": 0,
+		"stale": time.Hour,
+		"aaaa":  time.Minute,
+		"bbbb":  time.Minute,
+	} {
+		stack, err := db.New(n)
+		require.NoError(t, err)
+		stack.ReadAt.Store(now.Add(-age))
+	}
+
+	stacks := db.SortStacksFunc(repository.ByReadAt)
+	names := make([]string, len(stacks))
+	for i, stack := range stacks {
+		names[i] = stack.Name
+	}
+	assert.Equal(t, []string{"stale", "aaaa", "bbbb", "fresh"}, names)
+	assert.True(t, now.Add(-time.Hour).Equal(stacks[0].ReadAt.Load()), "sorting must not touch ReadAt")
+}
+
 func TestDatabase_Stack(t *testing.T) {
 	t.Parallel()
 	type args struct {
@@ -292,3 +318,255 @@ func TestDatabase_Drop(t *testing.T) {
 		})
 	}
 }
+
+func TestDatabase_DropEmpty(t *testing.T) {
+	t.Parallel()
+	db, err := repository.New().New("test")
+	require.NoError(t, err)
+	for _, n := range []string{"empty1", "empty2", "full"} {
+		_, err := db.New(n)
+		require.NoError(t, err)
+	}
+	full, err := db.Stack("full")
+	require.NoError(t, err)
+	_, err = full.Push(1)
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, db.DropEmpty())
+	assert.Equal(t, 1, db.Len())
+	_, err = db.Stack("full")
+	require.NoError(t, err)
+	assert.Equal(t, 0, db.DropEmpty(), "nothing left to drop")
+}
+
+func TestDatabase_ExportImport(t *testing.T) {
+	t.Parallel()
+	src, err := repository.New().New("source")
+	require.NoError(t, err)
+	stack, err := src.New("stack")
+	require.NoError(t, err)
+	stack.SetDescription("described")
+	stack.SetLabels(map[string]string{"env": "test"})
+	stack.SetCapacity(5)
+	require.NoError(t, stack.PushMany([]any{1.0, "two", map[string]any{"three": 3.0}}))
+	_, err = src.New("empty")
+	require.NoError(t, err)
+
+	exp := src.Export()
+	require.Equal(t, "source", exp.Name)
+	require.Len(t, exp.Stacks, 2)
+
+	dst, err := repository.New().New("destination")
+	require.NoError(t, err)
+	require.NoError(t, dst.Import(exp, false))
+	got, err := dst.Stack("stack")
+	require.NoError(t, err)
+	assert.Equal(t, []any{1.0, "two", map[string]any{"three": 3.0}}, got.Elements(0, got.Size()), "the order must survive")
+	assert.Equal(t, "described", got.Description)
+	assert.Equal(t, map[string]string{"env": "test"}, got.Labels)
+	assert.Equal(t, 5, got.Capacity)
+	assert.Equal(t, 2, dst.Len())
+
+	// an existing stack is kept unless overwritten.
+	id := got.ID
+	require.NoError(t, got.PushMany([]any{"extra"}))
+	require.ErrorIs(t, dst.Import(exp, false), repository.ErrAlreadyExists)
+	assert.Equal(t, 4, got.Size())
+	require.NoError(t, dst.Import(exp, true))
+	assert.Equal(t, 3, got.Size())
+	assert.Equal(t, id, got.ID, "an overwritten stack keeps its ID")
+
+	exp.Stacks = append(exp.Stacks, exp.Stacks[0])
+	require.ErrorIs(t, dst.Import(exp, true), repository.ErrInvalidExport)
+}
+
+func TestDatabase_SwapStacks(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		a, b    string
+		wantErr assert.ErrorAssertionFunc
+		wantA   []any
+		wantB   []any
+		wantCap int
+	}{
+		{name: "swap", a: "staging", b: "production", wantErr: assert.NoError, wantA: []any{"p1"}, wantB: []any{"s1", "s2"}, wantCap: 1},
+		{name: "same stack", a: "staging", b: "staging", wantErr: assert.NoError, wantA: []any{"s1", "s2"}, wantB: []any{"p1"}},
+		{name: "a dne", a: "dne", b: "production", wantErr: assert.Error, wantA: []any{"s1", "s2"}, wantB: []any{"p1"}},
+		{name: "b dne", a: "staging", b: "dne", wantErr: assert.Error, wantA: []any{"s1", "s2"}, wantB: []any{"p1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			db, err := repository.New().New("test")
+			require.NoError(t, err)
+			staging, err := db.New("staging")
+			require.NoError(t, err)
+			staging.Push("s1")
+			staging.Push("s2")
+			production, err := db.New("production")
+			require.NoError(t, err)
+			production.Push("p1")
+			production.SetCapacity(1)
+			production.SetSchema([]byte(`{"type":"string"}`))
+			production.CreatedAt = staging.CreatedAt.Add(time.Hour)
+			stagingID, stagingCreated := staging.ID, staging.CreatedAt
+
+			tt.wantErr(t, db.SwapStacks(tt.a, tt.b))
+			assert.Equal(t, tt.wantA, staging.Data)
+			assert.Equal(t, tt.wantB, production.Data)
+			assert.Equal(t, tt.wantCap, staging.Capacity, "capacities must be swapped")
+			assert.Equal(t, 1-tt.wantCap, production.Capacity, "capacities must be swapped")
+			assert.Nil(t, staging.Schema, "schemas must not be swapped")
+			assert.Equal(t, stagingCreated, staging.CreatedAt, "creation times must not be swapped")
+			assert.Equal(t, "staging", staging.Name, "names must not be swapped")
+			assert.Equal(t, stagingID, staging.ID, "IDs must not be swapped")
+		})
+	}
+}
+
+func TestDatabase_SwapStacks_Drop(t *testing.T) {
+	t.Parallel()
+	db, err := repository.New().New("test")
+	require.NoError(t, err)
+	staging, err := db.New("staging")
+	require.NoError(t, err)
+	_, err = db.New("production")
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assert.NoError(t, db.Drop(staging.ID.String()))
+	}()
+	for {
+		err := db.SwapStacks("staging", "production")
+		if err != nil {
+			// once dropped, the stack can't be swapped into.
+			require.ErrorIs(t, err, repository.ErrNotFound)
+			break
+		}
+	}
+	<-done
+	assert.Equal(t, 1, db.Len())
+}
+
+func TestDatabase_Rename(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		id       string
+		newName  string
+		wantErr  error
+		wantName string
+	}{
+		{name: "rename", id: "staging", newName: "renamed", wantName: "renamed"},
+		{name: "same name", id: "staging", newName: "staging", wantName: "staging"},
+		{name: "name taken", id: "staging", newName: "production", wantErr: repository.ErrAlreadyExists, wantName: "staging"},
+		{name: "dne", id: "dne", newName: "renamed", wantErr: repository.ErrNotFound, wantName: "staging"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			db, err := repository.New().New("test")
+			require.NoError(t, err)
+			staging, err := db.New("staging")
+			require.NoError(t, err)
+			staging.Push("s1")
+			_, err = db.New("production")
+			require.NoError(t, err)
+
+			_, err = db.Rename(tt.id, tt.newName)
+			require.ErrorIs(t, err, tt.wantErr)
+			stack, err := db.Stack(tt.wantName)
+			require.NoError(t, err)
+			assert.Same(t, staging, stack)
+			assert.Equal(t, tt.wantName, stack.Name)
+			assert.Equal(t, []any{"s1"}, stack.Data)
+			assert.Equal(t, 2, db.Len())
+		})
+	}
+}
+
+func TestDatabase_Depths(t *testing.T) {
+	t.Parallel()
+	db, err := repository.New().New("test")
+	require.NoError(t, err)
+	for name, size := range map[string]int{"a": 1, "b": 3, "c": 1, "d": 0} {
+		stack, err := db.New(name)
+		require.NoError(t, err)
+		for i := range size {
+			stack.Push(i)
+		}
+	}
+
+	assert.Equal(t, []repository.StackDepth{
+		{Name: "b", Size: 3},
+		{Name: "a", Size: 1},
+		{Name: "c", Size: 1},
+		{Name: "d", Size: 0},
+	}, db.Depths())
+}
+
+func TestDatabase_Exclusive(t *testing.T) {
+	t.Parallel()
+	db, err := repository.New().New("test")
+	require.NoError(t, err)
+	_, err = db.New("stack")
+	require.NoError(t, err)
+
+	looked := make(chan struct{})
+	db.Exclusive(func(lookup func(string) (*repository.Stack, error)) {
+		stack, err := lookup("stack")
+		require.NoError(t, err)
+		go func() {
+			_, _ = db.Stack("stack")
+			close(looked)
+		}()
+		stack.Push(1)
+		select {
+		case <-looked:
+			t.Error("lookup must block until the exclusive func returns")
+		case <-time.After(50 * time.Millisecond):
+		}
+		_, err = lookup("dne")
+		require.ErrorIs(t, err, repository.ErrNotFound)
+	})
+	<-looked
+}
+
+func TestDatabase_CompareStacks(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		a, b    []any
+		other   string
+		want    int
+		wantErr assert.ErrorAssertionFunc
+	}{
+		{name: "both empty", other: "b", want: -1, wantErr: assert.NoError},
+		{name: "equal", a: []any{1, "x", map[string]any{"k": 1}}, b: []any{1.0, "x", map[string]any{"k": 1.0}}, other: "b", want: -1, wantErr: assert.NoError},
+		{name: "differ", a: []any{1, 2, 3}, b: []any{1, 5, 3}, other: "b", want: 1, wantErr: assert.NoError},
+		{name: "prefix", a: []any{1, 2}, b: []any{1, 2, 3}, other: "b", want: 2, wantErr: assert.NoError},
+		{name: "self", a: []any{1}, other: "a", want: -1, wantErr: assert.NoError},
+		{name: "other dne", other: "dne", wantErr: assert.Error},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			db, err := repository.New().New("test")
+			require.NoError(t, err)
+			for n, data := range map[string][]any{"a": tt.a, "b": tt.b} {
+				stack, err := db.New(n)
+				require.NoError(t, err)
+				for _, e := range data {
+					stack.Push(e)
+				}
+			}
+
+			got, err := db.CompareStacks("a", tt.other)
+			tt.wantErr(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
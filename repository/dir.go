@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"errors"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// dbFileExt is the extension of the per-database files of PersistDir.
+const dbFileExt = ".gob"
+
+// dbFilename returns the file of a database in dir, with the name escaped so
+// it's always a single path element.
+func dbFilename(dir, n string) string {
+	return filepath.Join(dir, url.PathEscape(n)+dbFileExt)
+}
+
+// PersistDir writes each database to its own file, dir/<name>.gob, creating
+// dir if needed. Every file is replaced atomically like with Persist, and the
+// options apply per file. Only databases changed since they were last written
+// or loaded are written. Files of databases that no longer exist, e.g. after
+// a drop, are removed along with their versions.
+func (r *Repository) PersistDir(dir string, opts ...PersistOption) error {
+	var o persistOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return err
+	}
+
+	r.mx.RLock()
+	dbs := make([]*Database, 0, len(r.Databases))
+	for _, db := range r.Databases {
+		dbs = append(dbs, db)
+	}
+	r.mx.RUnlock()
+
+	keep := make(map[string]bool, len(dbs))
+	for _, db := range dbs {
+		filename := dbFilename(dir, db.Name)
+		keep[filename] = true
+		if err := persistDatabase(filename, db, o); err != nil {
+			return err
+		}
+	}
+
+	return removeStale(dir, keep)
+}
+
+// persistDatabase writes a snapshot of db to filename unless it's clean and
+// the file exists.
+func persistDatabase(filename string, db *Database, o persistOptions) error {
+	// Clear the flag before the snapshot, so a mutation after it marks the
+	// database dirty for the next save.
+	if !db.dirty.Swap(false) {
+		if _, err := os.Stat(filename); err == nil {
+			return nil
+		}
+	}
+	if err := writeFile(filename, db.snapshot(), o); err != nil {
+		db.markDirty()
+		return err
+	}
+
+	return nil
+}
+
+// removeStale removes the database files in dir that aren't kept.
+func removeStale(dir string, keep map[string]bool) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		filename := filepath.Join(dir, entry.Name())
+		if entry.IsDir() || !strings.HasSuffix(filename, dbFileExt) || keep[filename] {
+			continue
+		}
+		versions, err := filepath.Glob(filename + ".[0-9]*")
+		if err != nil {
+			return err
+		}
+		for _, f := range append(versions, filename) {
+			if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		slog.Info("Removed stale database file", slog.String("filename", filename))
+	}
+
+	return nil
+}
+
+// LoadDir loads the databases persisted by PersistDir, replacing databases of
+// the same name. A database file that can't be decoded is logged and renamed
+// aside, see MoveCorrupt, so the other databases still load and the next
+// PersistDir doesn't remove it as stale.
+func (r *Repository) LoadDir(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*"+dbFileExt))
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		slog.Info("No database files found", slog.String("dir", dir))
+		return nil
+	}
+
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	for _, filename := range files {
+		db, err := loadDatabase(filename)
+		if errors.Is(err, ErrCorrupt) {
+			slog.Error("Skipped corrupt database file",
+				slog.String("filename", filename),
+				slog.String("error", err.Error()))
+			if _, err := MoveCorrupt(filename); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		db.compressMin = r.compressMin
+		db.maxStacks = r.maxStacks
+		db.maxSize = r.maxSize
+		db.link()
+		r.Databases[name(db.Name)] = db
+	}
+
+	return nil
+}
+
+func loadDatabase(filename string) (*Database, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	db := new(Database)
+	if err := decode(file, db); err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
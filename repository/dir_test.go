@@ -0,0 +1,182 @@
+package repository_test
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jh125486/batterdb/repository"
+)
+
+func TestRepository_PersistDir(t *testing.T) {
+	t.Parallel()
+	dir := filepath.Join(t.TempDir(), "dbs")
+	repo := repository.New()
+	for _, n := range []string{"database0", "database1", "with/slash"} {
+		db, err := repo.New(n)
+		require.NoError(t, err)
+		stack, err := db.New("stack")
+		require.NoError(t, err)
+		stack.Push(n)
+	}
+	require.NoError(t, repo.PersistDir(dir, repository.KeepVersions(1)))
+	for _, n := range []string{"database0", "database1"} {
+		db, err := repo.Database(n)
+		require.NoError(t, err)
+		stack, err := db.Stack("stack")
+		require.NoError(t, err)
+		stack.Pop()
+		stack.Push(n)
+	}
+	require.NoError(t, repo.PersistDir(dir, repository.KeepVersions(1)))
+	assert.FileExists(t, filepath.Join(dir, "database0.gob"))
+	assert.FileExists(t, filepath.Join(dir, "database0.gob.1"))
+	assert.FileExists(t, filepath.Join(dir, "with%2Fslash.gob"))
+
+	// Dropped databases are removed with their versions.
+	require.NoError(t, repo.Drop("database1"))
+	require.NoError(t, repo.PersistDir(dir, repository.KeepVersions(1)))
+	assert.NoFileExists(t, filepath.Join(dir, "database1.gob"))
+	assert.NoFileExists(t, filepath.Join(dir, "database1.gob.1"))
+
+	loaded := repository.New()
+	require.NoError(t, loaded.LoadDir(dir))
+	assert.Equal(t, 2, loaded.Len())
+	for _, n := range []string{"database0", "with/slash"} {
+		db, err := loaded.Database(n)
+		require.NoError(t, err)
+		stack, err := db.Stack("stack")
+		require.NoError(t, err)
+		assert.Equal(t, n, stack.Peek())
+	}
+}
+
+func TestRepository_PersistDir_Dirty(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	repo := repository.New()
+	stacks := make(map[string]*repository.Stack)
+	for _, n := range []string{"clean", "pushed", "labeled", "created", "dropped"} {
+		db, err := repo.New(n)
+		require.NoError(t, err)
+		stacks[n], err = db.New("stack")
+		require.NoError(t, err)
+	}
+	require.NoError(t, repo.PersistDir(dir))
+
+	// Overwrite every file, so the files that are rewritten can be told apart.
+	for n := range stacks {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, n+".gob"), []byte("old"), 0o600))
+	}
+	stacks["pushed"].Push(1)
+	stacks["labeled"].SetLabels(map[string]string{"k": "v"})
+	_, err := stacks["created"].Database().New("another")
+	require.NoError(t, err)
+	require.NoError(t, stacks["dropped"].Database().Drop("stack"))
+	require.NoError(t, repo.PersistDir(dir))
+
+	for n := range stacks {
+		b, err := os.ReadFile(filepath.Join(dir, n+".gob"))
+		require.NoError(t, err)
+		if n == "clean" {
+			assert.Equal(t, "old", string(b), "clean database must not be rewritten")
+		} else {
+			assert.NotEqual(t, "old", string(b), n+" database must be rewritten")
+		}
+	}
+
+	// A clean database is still written when its file is missing.
+	require.NoError(t, os.Remove(filepath.Join(dir, "clean.gob")))
+	require.NoError(t, repo.PersistDir(dir))
+	assert.FileExists(t, filepath.Join(dir, "clean.gob"))
+}
+
+func TestRepository_LoadDir(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		setup   func(t *testing.T, dir string)
+		wantErr assert.ErrorAssertionFunc
+		wantLen int
+	}{
+		{
+			name:    "dne",
+			setup:   func(*testing.T, string) {},
+			wantErr: assert.NoError,
+		},
+		{
+			name: "corrupt file",
+			setup: func(t *testing.T, dir string) {
+				t.Helper()
+				require.NoError(t, os.MkdirAll(dir, 0o750))
+				require.NoError(t, os.WriteFile(filepath.Join(dir, "bad.gob"), []byte("garbage"), 0o600))
+			},
+			wantErr: assert.NoError,
+		},
+		{
+			name: "corrupt file among databases",
+			setup: func(t *testing.T, dir string) {
+				t.Helper()
+				repo := repository.New()
+				for i := range 3 {
+					_, err := repo.New("database" + strconv.Itoa(i))
+					require.NoError(t, err)
+				}
+				require.NoError(t, repo.PersistDir(dir))
+				require.NoError(t, os.WriteFile(filepath.Join(dir, "bad.gob"), []byte("garbage"), 0o600))
+			},
+			wantErr: assert.NoError,
+			wantLen: 3,
+		},
+		{
+			name: "newer version",
+			setup: func(t *testing.T, dir string) {
+				t.Helper()
+				require.NoError(t, os.MkdirAll(dir, 0o750))
+				require.NoError(t, os.WriteFile(filepath.Join(dir, "new.gob"), []byte("\x00batterdb\x63"), 0o600))
+			},
+			wantErr: assert.Error,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			dir := filepath.Join(t.TempDir(), "dbs")
+			tt.setup(t, dir)
+			repo := repository.New()
+			tt.wantErr(t, repo.LoadDir(dir))
+			assert.Equal(t, tt.wantLen, repo.Len())
+			if aside, _ := filepath.Glob(filepath.Join(dir, "bad.gob.corrupt.*")); len(aside) > 0 {
+				// moved aside, so a save doesn't remove it as stale.
+				require.NoError(t, repo.PersistDir(dir))
+				assert.FileExists(t, aside[0])
+				assert.NoFileExists(t, filepath.Join(dir, "bad.gob"))
+			}
+		})
+	}
+}
+
+func TestRepository_LoadDir_CorruptTwice(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	for _, content := range []string{"first", "second"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "bad.gob"), []byte(content), 0o600))
+		require.NoError(t, repository.New().LoadDir(dir))
+	}
+
+	// the second move doesn't replace the first.
+	aside, err := filepath.Glob(filepath.Join(dir, "bad.gob.corrupt.*"))
+	require.NoError(t, err)
+	require.Len(t, aside, 2)
+	var contents []string
+	for _, f := range aside {
+		b, err := os.ReadFile(f)
+		require.NoError(t, err)
+		contents = append(contents, string(b))
+	}
+	assert.ElementsMatch(t, []string{"first", "second"}, contents)
+}
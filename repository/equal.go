@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+)
+
+// elementsEqual reports whether two elements are equal. It is the single
+// definition of element equality used by find-by-value, dedupe, and
+// compare-and-swap style operations.
+//
+// Elements are compared by their canonical JSON form: each element is
+// marshaled, decoded back into generic values, and marshaled again. This
+// makes numbers compare by value regardless of Go type (int 1 == float64 1),
+// map keys compare regardless of order, and structs compare equal to maps
+// with the same JSON fields. Numbers are compared as float64, so integers
+// beyond 2^53 may compare equal to their neighbours.
+//
+// Elements that can't be marshaled to JSON fall back to reflect.DeepEqual.
+func elementsEqual(a, b any) bool {
+	ca, errA := canonicalJSON(a)
+	cb, errB := canonicalJSON(b)
+	if errA != nil || errB != nil {
+		return reflect.DeepEqual(a, b)
+	}
+
+	return bytes.Equal(ca, cb)
+}
+
+// Normalize returns the canonical form of an element: the generic value it
+// decodes to from JSON, with maps, slices, strings, float64 numbers, bools
+// and nil only. Marshaling the result always sorts object keys and omits
+// insignificant whitespace.
+func Normalize(v any) (any, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var generic any
+	if err := json.Unmarshal(b, &generic); err != nil {
+		return nil, err
+	}
+
+	return generic, nil
+}
+
+func canonicalJSON(v any) ([]byte, error) {
+	generic, err := Normalize(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(generic)
+}
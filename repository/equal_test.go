@@ -0,0 +1,56 @@
+package repository_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jh125486/batterdb/repository"
+)
+
+func TestNormalize(t *testing.T) {
+	t.Parallel()
+	type point struct {
+		Y int `json:"y"`
+		X int `json:"x"`
+	}
+	tests := []struct {
+		name     string
+		v        any
+		want     any
+		wantJSON string
+		wantErr  assert.ErrorAssertionFunc
+	}{
+		{name: "nil", v: nil, want: nil, wantJSON: `null`, wantErr: assert.NoError},
+		{name: "int", v: 1, want: 1.0, wantJSON: `1`, wantErr: assert.NoError},
+		{
+			name:     "struct",
+			v:        point{Y: 2, X: 1},
+			want:     map[string]any{"x": 1.0, "y": 2.0},
+			wantJSON: `{"x":1,"y":2}`,
+			wantErr:  assert.NoError,
+		},
+		{
+			name:     "nested",
+			v:        map[string]any{"b": []int{1, 2}, "a": map[string]string{"d": "", "c": ""}},
+			want:     map[string]any{"a": map[string]any{"c": "", "d": ""}, "b": []any{1.0, 2.0}},
+			wantJSON: `{"a":{"c":"","d":""},"b":[1,2]}`,
+			wantErr:  assert.NoError,
+		},
+		{name: "unmarshalable", v: make(chan int), wantErr: assert.Error},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := repository.Normalize(tt.v)
+			if tt.wantErr(t, err); err != nil {
+				return
+			}
+			assert.Equal(t, tt.want, got)
+			b, err := json.Marshal(got)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantJSON, string(b))
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// FormatVersion is the version of the persisted file format written by
+// Persist and PersistDir. It's bumped whenever a change to the persisted types
+// can't be read by older versions.
+const FormatVersion = 1
+
+// ErrNewerVersion is returned when loading a file written in a newer format
+// than FormatVersion, so a downgrade fails clearly instead of with a gob error
+// or silently dropped fields.
+var ErrNewerVersion = errors.New("file written by newer version")
+
+// ErrCorrupt is returned when loading a file that can't be decoded, e.g.
+// because it's truncated. Errors reading the file aren't ErrCorrupt.
+var ErrCorrupt = errors.New("corrupt file")
+
+// corruptTimeFormat is the timestamp of the files moved aside by MoveCorrupt,
+// precise enough that a later move never replaces an earlier one.
+const corruptTimeFormat = "20060102T150405.000000000Z"
+
+// MoveCorrupt renames a corrupt file aside to
+// "<filename>.corrupt.<timestamp>", in UTC, so it can be recovered by hand, and
+// returns the new name.
+func MoveCorrupt(filename string) (string, error) {
+	aside := filename + ".corrupt." + time.Now().UTC().Format(corruptTimeFormat)
+	if err := os.Rename(filename, aside); err != nil {
+		return "", err
+	}
+
+	return aside, nil
+}
+
+// formatMagic starts the header of persisted files. Gob never writes a zero
+// length message, so it can't be mistaken for a file written before the
+// header was added.
+var formatMagic = []byte("\x00batterdb")
+
+// writeHeader writes the magic and FormatVersion.
+func writeHeader(w io.Writer) error {
+	header := binary.AppendUvarint(bytes.Clone(formatMagic), FormatVersion)
+	_, err := w.Write(header)
+
+	return err
+}
+
+// readHeader consumes the header of a persisted file, failing with
+// ErrNewerVersion if its format is newer than FormatVersion. Files without a
+// header are read as is.
+func readHeader(r *bufio.Reader) error {
+	magic, err := r.Peek(len(formatMagic))
+	if err != nil || !bytes.Equal(magic, formatMagic) {
+		// no header, the gob decoder reports a truncated file.
+		return nil
+	}
+	if _, err := r.Discard(len(formatMagic)); err != nil {
+		return err
+	}
+	version, err := binary.ReadUvarint(r)
+	if err != nil {
+		return fmt.Errorf("malformed file header: %w", err)
+	}
+	if version > FormatVersion {
+		return fmt.Errorf("%w: format version %d, this version reads up to %d", ErrNewerVersion, version, FormatVersion)
+	}
+
+	return nil
+}
+
+// decode reads the header and gob-decodes the rest of r into v. Errors other
+// than ErrNewerVersion and those reading the file are wrapped in ErrCorrupt.
+func decode(r io.Reader, v any) error {
+	br := bufio.NewReader(r)
+	err := readHeader(br)
+	if err == nil {
+		err = gob.NewDecoder(br).Decode(v)
+	}
+	var pathErr *fs.PathError
+	if err == nil || errors.Is(err, ErrNewerVersion) || errors.As(err, &pathErr) {
+		return err
+	}
+
+	return fmt.Errorf("%w: %w", ErrCorrupt, err)
+}
@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"encoding/gob"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// identifiedElement is an element pushed with PushWithID. It is persisted as
+// is, and unwrapped whenever the element is read.
+type identifiedElement struct {
+	Value any
+	ID    string
+}
+
+func init() {
+	gob.Register(identifiedElement{})
+}
+
+// PushWithID pushes the element like Push, and returns a generated ID that
+// addresses it for Element and DeleteElement along with the dropped element.
+func (s *Stack) PushWithID(element any) (id string, dropped any, err error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if err := s.checkSize(1); err != nil {
+		return "", nil, err
+	}
+	id = uuid.NewString()
+	s.Stats.Pushes.Add(1)
+	s.setPushTime(time.Now())
+	dropped = s.push(identifiedElement{ID: id, Value: compress(element, s.compressMin())})
+	s.notifyPushed()
+
+	return id, dropped, nil
+}
+
+// PushManyWithIDs pushes the elements like PushMany, and returns the generated
+// IDs of the elements in order, see PushWithID.
+func (s *Stack) PushManyWithIDs(elements []any) ([]string, error) {
+	ids := make([]string, len(elements))
+	for i := range ids {
+		ids[i] = uuid.NewString()
+	}
+	if err := s.pushMany(elements, ids); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// Element returns the element pushed with the ID, wherever it is on the stack.
+func (s *Stack) Element(id string) (any, error) {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+	s.setReadTime(time.Now())
+	i := s.indexOf(id)
+	if i < 0 {
+		return nil, ErrNotFound
+	}
+
+	return expand(s.Data[i]), nil
+}
+
+// DeleteElement removes the element pushed with the ID, wherever it is on the
+// stack, and returns it. The order of the other elements is kept.
+func (s *Stack) DeleteElement(id string) (any, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	i := s.indexOf(id)
+	if i < 0 {
+		return nil, ErrNotFound
+	}
+	s.setUpdateTime(time.Now())
+	element := s.Data[i]
+	s.Data = slices.Delete(s.Data, i, i+1)
+
+	return expand(element), nil
+}
+
+// indexOf returns the position of the element with the ID, or -1. It must be
+// called with the lock held.
+func (s *Stack) indexOf(id string) int {
+	return slices.IndexFunc(s.Data, func(e any) bool {
+		ie, ok := e.(identifiedElement)
+		return ok && ie.ID == id
+	})
+}
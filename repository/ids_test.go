@@ -0,0 +1,87 @@
+package repository_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jh125486/batterdb/repository"
+)
+
+func TestStack_PushWithID(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		minBytes int
+		element  any
+	}{
+		{name: "plain", element: "value"},
+		{name: "compressed", minBytes: 64, element: strings.Repeat("batter ", 100)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			repo := repository.New()
+			repo.SetElementCompression(tt.minBytes)
+			db, err := repo.New("test")
+			require.NoError(t, err)
+			stack, err := db.New("stack")
+			require.NoError(t, err)
+
+			stack.Push("bottom")
+			id, _, _ := stack.PushWithID(tt.element)
+			stack.Push("top")
+			require.NotEmpty(t, id)
+			other, _, _ := stack.PushWithID(tt.element)
+			assert.NotEqual(t, id, other, "IDs must be unique")
+			got, err := stack.Element(id)
+			require.NoError(t, err)
+			assert.Equal(t, tt.element, got)
+			assert.True(t, stack.Contains(tt.element))
+			_, err = stack.Element("dne")
+			require.ErrorIs(t, err, repository.ErrNotFound)
+
+			// The IDs are persisted.
+			filename := filepath.Join(t.TempDir(), "repo")
+			require.NoError(t, repo.Persist(filename))
+			loaded := repository.New()
+			require.NoError(t, loaded.Load(filename))
+			db, err = loaded.Database("test")
+			require.NoError(t, err)
+			stack, err = db.Stack("stack")
+			require.NoError(t, err)
+
+			got, err = stack.DeleteElement(id)
+			require.NoError(t, err)
+			assert.Equal(t, tt.element, got)
+			_, err = stack.DeleteElement(id)
+			require.ErrorIs(t, err, repository.ErrNotFound)
+			assert.Equal(t, []any{"bottom", "top", tt.element}, stack.Elements(0, stack.Size()), "order must be kept")
+		})
+	}
+}
+
+func TestStack_PushManyWithIDs(t *testing.T) {
+	t.Parallel()
+	repo := repository.New()
+	repo.SetElementCompression(64)
+	db, err := repo.New("test")
+	require.NoError(t, err)
+	stack, err := db.New("stack")
+	require.NoError(t, err)
+
+	elements := []any{"first", strings.Repeat("batter ", 100)}
+	ids, err := stack.PushManyWithIDs(elements)
+	require.NoError(t, err)
+	require.Len(t, ids, len(elements))
+	assert.NotEqual(t, ids[0], ids[1], "IDs must be unique")
+	for i, id := range ids {
+		got, err := stack.Element(id)
+		require.NoError(t, err)
+		assert.Equal(t, elements[i], got)
+	}
+	assert.Equal(t, elements, stack.Elements(0, stack.Size()))
+}
@@ -3,9 +3,14 @@ package repository
 import (
 	"encoding/gob"
 	"errors"
+	"fmt"
+	"io"
 	"log/slog"
 	"os"
+	"path/filepath"
+	"reflect"
 	"sort"
+	"strconv"
 	"sync"
 
 	"github.com/google/uuid"
@@ -13,8 +18,11 @@ import (
 
 type (
 	Repository struct {
-		Databases map[name]*Database
-		mx        sync.RWMutex
+		Databases   map[name]*Database
+		mx          sync.RWMutex
+		compressMin int
+		maxStacks   int
+		maxSize     int
 	}
 	name string
 )
@@ -22,6 +30,9 @@ type (
 var (
 	ErrNotFound      = errors.New("not found")
 	ErrAlreadyExists = errors.New("already exists")
+	ErrLimitReached  = errors.New("limit reached")
+	ErrEmpty         = errors.New("stack is empty")
+	ErrStackFull     = errors.New("stack is full")
 )
 
 func New() *Repository {
@@ -70,7 +81,7 @@ func (r *Repository) Database(id string) (*Database, error) {
 	return nil, ErrNotFound
 }
 
-func (r *Repository) New(n string) (*Database, error) {
+func (r *Repository) New(n string, opts ...DatabaseOption) (*Database, error) {
 	r.mx.Lock()
 	defer r.mx.Unlock()
 	if _, ok := r.Databases[name(n)]; ok {
@@ -78,15 +89,57 @@ func (r *Repository) New(n string) (*Database, error) {
 	}
 
 	db := &Database{
-		ID:     uuid.New(),
-		Name:   n,
-		Stacks: make(map[name]*Stack),
+		ID:          uuid.New(),
+		Name:        n,
+		Stacks:      make(map[name]*Stack),
+		compressMin: r.compressMin,
+		maxStacks:   r.maxStacks,
+		maxSize:     r.maxSize,
 	}
+	for _, opt := range opts {
+		opt(db)
+	}
+	db.markDirty()
 	r.Databases[name(n)] = db
 
 	return db, nil
 }
 
+// SetMaxStacks limits the number of stacks of each database, making New of a
+// full database fail with ErrLimitReached. A value of 0 disables the limit.
+// Databases already over the limit keep their stacks.
+func (r *Repository) SetMaxStacks(n int) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.maxStacks = n
+	for _, db := range r.Databases {
+		db.mx.Lock()
+		db.maxStacks = n
+		db.mx.Unlock()
+	}
+}
+
+// SetMaxStackSize limits the number of elements of each stack, making pushes
+// to a full stack fail with ErrStackFull. A value of 0 disables the limit.
+// Stacks already over the limit keep their elements.
+func (r *Repository) SetMaxStackSize(n int) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.maxSize = n
+	for _, db := range r.Databases {
+		db.mx.Lock()
+		db.maxSize = n
+		db.mx.Unlock()
+	}
+}
+
+// Clear drops all databases.
+func (r *Repository) Clear() {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.Databases = make(map[name]*Database)
+}
+
 func (r *Repository) Drop(id string) error {
 	r.mx.Lock()
 	defer r.mx.Unlock()
@@ -100,19 +153,178 @@ func (r *Repository) Drop(id string) error {
 	return ErrNotFound
 }
 
-func (r *Repository) Persist(filename string) error {
+type (
+	// PersistOption configures Persist.
+	PersistOption  func(*persistOptions)
+	persistOptions struct {
+		maxBytes int64
+		versions int
+		verify   bool
+	}
+)
+
+// ErrTooLarge is returned by Persist when the encoded repository exceeds
+// MaxBytes.
+var ErrTooLarge = errors.New("repository too large to persist")
+
+// KeepVersions keeps the previous n versions of the persisted file, with
+// filename.1 being the most recent and filename.n the oldest.
+func KeepVersions(n int) PersistOption {
+	return func(o *persistOptions) {
+		o.versions = n
+	}
+}
+
+// MaxBytes refuses to persist a repository whose encoding exceeds n bytes,
+// leaving the previously persisted file intact. A value of 0 means unlimited.
+func MaxBytes(n int64) PersistOption {
+	return func(o *persistOptions) {
+		o.maxBytes = n
+	}
+}
+
+// ErrVerifyFailed is returned by Persist with Verify when the written file
+// can't be decoded back.
+var ErrVerifyFailed = errors.New("persisted file failed verification")
+
+// Verify re-reads and decodes the written file before it replaces the
+// previous one, failing with ErrVerifyFailed and keeping the previous file if
+// it can't be decoded. This doubles the cost of a save.
+func Verify() PersistOption {
+	return func(o *persistOptions) {
+		o.verify = true
+	}
+}
+
+// verifyFile decodes filename into a new value of the type v points to.
+func verifyFile(filename string, v any) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrVerifyFailed, err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	if err := decode(file, reflect.New(reflect.TypeOf(v).Elem()).Interface()); err != nil {
+		return fmt.Errorf("%w: %w", ErrVerifyFailed, err)
+	}
+
+	return nil
+}
+
+// limitWriter fails writes once more than n bytes have been written.
+type limitWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (l *limitWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) > l.n {
+		return 0, ErrTooLarge
+	}
+	l.n -= int64(len(p))
+
+	return l.w.Write(p)
+}
+
+// Persist writes the repository to filename. The repository is encoded to a
+// temporary file in the same directory which is then renamed over filename,
+// so a reader never sees a partially written file. A snapshot is encoded, so
+// the repository can change while it's written.
+func (r *Repository) Persist(filename string, opts ...PersistOption) error {
+	var o persistOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return writeFile(filename, r.snapshot(), o)
+}
+
+// snapshot returns a copy of the persisted fields of the repository, see
+// Database.snapshot.
+func (r *Repository) snapshot() *Repository {
 	r.mx.RLock()
 	defer r.mx.RUnlock()
+	c := &Repository{Databases: make(map[name]*Database, len(r.Databases))}
+	for n, db := range r.Databases {
+		c.Databases[n] = db.snapshot()
+	}
 
-	file, err := os.Create(filename)
+	return c
+}
+
+// writeFile gob-encodes v to a temporary file next to filename and renames it
+// over filename once it's safely on disk.
+func writeFile(filename string, v any, o persistOptions) error {
+	file, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".*.tmp")
 	if err != nil {
 		return err
 	}
-	defer func() {
+	tmp := file.Name()
+	var w io.Writer = file
+	if o.maxBytes > 0 {
+		w = &limitWriter{w: file, n: o.maxBytes}
+	}
+	if err := writeHeader(w); err != nil {
 		_ = file.Close()
-	}()
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := gob.NewEncoder(w).Encode(v); err != nil {
+		_ = file.Close()
+		_ = os.Remove(tmp)
+		return err
+	}
+	// Make sure the snapshot is on disk before it replaces the previous one.
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if o.verify {
+		if err := verifyFile(tmp, v); err != nil {
+			_ = os.Remove(tmp)
+			return err
+		}
+	}
+	if err := rotate(filename, o.versions); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, filename); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+
+	return nil
+}
+
+// rotate shifts the existing versions of filename up by one, dropping the
+// oldest, and links the current file as filename.1. The current file is left
+// in place so it's only ever replaced atomically.
+func rotate(filename string, versions int) error {
+	if versions <= 0 {
+		return nil
+	}
+	if _, err := os.Stat(filename); os.IsNotExist(err) {
+		return nil
+	}
+
+	version := func(i int) string { return filename + "." + strconv.Itoa(i) }
+	if err := os.Remove(version(versions)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for i := versions - 1; i >= 1; i-- {
+		if err := os.Rename(version(i), version(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
 
-	return gob.NewEncoder(file).Encode(r)
+	return os.Link(filename, version(1))
 }
 
 func (r *Repository) Load(filename string) error {
@@ -130,5 +342,15 @@ func (r *Repository) Load(filename string) error {
 		_ = file.Close()
 	}()
 
-	return gob.NewDecoder(file).Decode(r)
+	if err := decode(file, r); err != nil {
+		return err
+	}
+	for _, db := range r.Databases {
+		db.compressMin = r.compressMin
+		db.maxStacks = r.maxStacks
+		db.maxSize = r.maxSize
+		db.link()
+	}
+
+	return nil
 }
@@ -1,6 +1,8 @@
 package repository_test
 
 import (
+	"encoding/gob"
+	"errors"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -305,6 +307,144 @@ func TestRepository_Persist(t *testing.T) {
 	}
 }
 
+func TestRepository_Persist_EncodeError(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	filename := filepath.Join(dir, t.Name())
+	repo := repository.New()
+	db, err := repo.New("database")
+	require.NoError(t, err)
+	require.NoError(t, repo.Persist(filename))
+
+	// functions can't be gob encoded.
+	stack, err := db.New("stack")
+	require.NoError(t, err)
+	stack.Push(func() {})
+	require.Error(t, repo.Persist(filename))
+
+	// the previous snapshot survives, and no temporary files are left behind.
+	loaded := repository.New()
+	require.NoError(t, loaded.Load(filename))
+	loadedDB, err := loaded.Database("database")
+	require.NoError(t, err)
+	assert.Equal(t, 0, loadedDB.Len())
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestRepository_Persist_KeepVersions(t *testing.T) {
+	t.Parallel()
+	filename := filepath.Join(t.TempDir(), t.Name())
+	repo := repository.New()
+	for i := range 4 {
+		_, err := repo.New("database" + strconv.Itoa(i))
+		require.NoError(t, err)
+		require.NoError(t, repo.Persist(filename, repository.KeepVersions(2)))
+	}
+
+	for file, want := range map[string]int{
+		filename:        4,
+		filename + ".1": 3,
+		filename + ".2": 2,
+	} {
+		loaded := repository.New()
+		require.NoError(t, loaded.Load(file))
+		assert.Equal(t, want, loaded.Len(), file)
+	}
+	assert.NoFileExists(t, filename+".3")
+}
+
+func TestRepository_Persist_MaxBytes(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "repo")
+	repo := repository.New()
+	_, err := repo.New("database0")
+	require.NoError(t, err)
+	require.NoError(t, repo.Persist(filename, repository.MaxBytes(1<<20)))
+
+	db, err := repo.New("database1")
+	require.NoError(t, err)
+	stack, err := db.New("stack")
+	require.NoError(t, err)
+	for range 1000 {
+		stack.Push("a large enough element to grow the repository")
+	}
+	err = repo.Persist(filename, repository.MaxBytes(1024))
+	require.ErrorIs(t, err, repository.ErrTooLarge)
+
+	// The previous save is intact and no temporary file is left behind.
+	loaded := repository.New()
+	require.NoError(t, loaded.Load(filename))
+	assert.Equal(t, 1, loaded.Len())
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+// undecodable encodes fine but fails to decode, like a corrupted file.
+type undecodable struct{}
+
+func (undecodable) GobEncode() ([]byte, error) { return []byte{1}, nil }
+
+func (*undecodable) GobDecode([]byte) error { return errors.New("corrupted") }
+
+func TestRepository_Persist_Verify(t *testing.T) {
+	t.Parallel()
+	gob.Register(undecodable{})
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "repo")
+	repo := repository.New()
+	db, err := repo.New("database0")
+	require.NoError(t, err)
+	require.NoError(t, repo.Persist(filename, repository.Verify()))
+
+	stack, err := db.New("stack")
+	require.NoError(t, err)
+	stack.Push(undecodable{})
+	err = repo.Persist(filename, repository.Verify())
+	require.ErrorIs(t, err, repository.ErrVerifyFailed)
+
+	// The previous save is intact and no temporary file is left behind.
+	loaded := repository.New()
+	require.NoError(t, loaded.Load(filename))
+	assert.Equal(t, 1, loaded.Len())
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestRepository_Load_FormatVersion(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	repo := repository.New()
+	_, err := repo.New("database0")
+	require.NoError(t, err)
+
+	// files written before the header was added are still read.
+	legacy := filepath.Join(dir, "legacy")
+	file, err := os.Create(legacy)
+	require.NoError(t, err)
+	require.NoError(t, gob.NewEncoder(file).Encode(repo))
+	require.NoError(t, file.Close())
+	loaded := repository.New()
+	require.NoError(t, loaded.Load(legacy))
+	assert.Equal(t, 1, loaded.Len())
+
+	current := filepath.Join(dir, "current")
+	require.NoError(t, repo.Persist(current))
+	loaded = repository.New()
+	require.NoError(t, loaded.Load(current))
+	assert.Equal(t, 1, loaded.Len())
+
+	newer := filepath.Join(dir, "newer")
+	require.NoError(t, os.WriteFile(newer, []byte("\x00batterdb\x63"), 0o600))
+	err = repository.New().Load(newer)
+	require.ErrorIs(t, err, repository.ErrNewerVersion)
+	assert.ErrorContains(t, err, "format version 99")
+}
+
 func TestRepository_Load(t *testing.T) {
 	t.Parallel()
 
@@ -361,3 +501,30 @@ func TestRepository_Load(t *testing.T) {
 		})
 	}
 }
+
+func TestRepository_SetMaxStacks(t *testing.T) {
+	t.Parallel()
+	repo := repository.New()
+	before, err := repo.New("before")
+	require.NoError(t, err)
+	repo.SetMaxStacks(2)
+	after, err := repo.New("after")
+	require.NoError(t, err)
+
+	for _, db := range []*repository.Database{before, after} {
+		for _, n := range []string{"a", "b"} {
+			_, err := db.New(n)
+			require.NoError(t, err)
+		}
+		_, err := db.New("c")
+		require.ErrorIs(t, err, repository.ErrLimitReached)
+		assert.ErrorContains(t, err, "at most 2 stacks")
+		_, err = db.New("a")
+		require.ErrorIs(t, err, repository.ErrAlreadyExists, "existing stacks are reported as such")
+		assert.Equal(t, 2, db.Len())
+	}
+
+	repo.SetMaxStacks(0)
+	_, err = before.New("c")
+	require.NoError(t, err)
+}
@@ -0,0 +1,44 @@
+package repository
+
+import "bytes"
+
+// SetSchema sets the JSON Schema that elements pushed to the stacks of the
+// database must match, unless a stack sets its own. A nil schema removes it.
+// The schema is persisted but not interpreted by the repository.
+func (db *Database) SetSchema(schema []byte) {
+	db.schemaMx.Lock()
+	defer db.schemaMx.Unlock()
+	db.Schema = bytes.Clone(schema)
+	db.markDirty()
+}
+
+// ElementSchema returns the schema of SetSchema, nil if none.
+func (db *Database) ElementSchema() []byte {
+	db.schemaMx.RLock()
+	defer db.schemaMx.RUnlock()
+
+	return db.Schema
+}
+
+// SetSchema sets the JSON Schema that elements pushed to the stack must
+// match, overriding the schema of its database. A nil schema removes the
+// override.
+func (s *Stack) SetSchema(schema []byte) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.Schema = bytes.Clone(schema)
+	s.markDirty()
+}
+
+// ElementSchema returns the schema elements pushed to the stack must match:
+// its own, or else the schema of its database. It's nil if neither is set.
+func (s *Stack) ElementSchema() []byte {
+	s.mx.RLock()
+	schema := s.Schema
+	s.mx.RUnlock()
+	if schema != nil || s.database == nil {
+		return schema
+	}
+
+	return s.database.ElementSchema()
+}
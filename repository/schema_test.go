@@ -0,0 +1,44 @@
+package repository_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jh125486/batterdb/repository"
+)
+
+func TestStack_ElementSchema(t *testing.T) {
+	t.Parallel()
+	repo := repository.New()
+	db, err := repo.New("database0")
+	require.NoError(t, err)
+	stack, err := db.New("stack0")
+	require.NoError(t, err)
+	assert.Nil(t, stack.ElementSchema())
+
+	db.SetSchema([]byte(`{"type":"string"}`))
+	assert.JSONEq(t, `{"type":"string"}`, string(stack.ElementSchema()))
+
+	stack.SetSchema([]byte(`{"type":"integer"}`))
+	assert.JSONEq(t, `{"type":"integer"}`, string(stack.ElementSchema()))
+
+	// both schemas are persisted.
+	filename := filepath.Join(t.TempDir(), "repo")
+	require.NoError(t, repo.Persist(filename))
+	loaded := repository.New()
+	require.NoError(t, loaded.Load(filename))
+	ldb, err := loaded.Database("database0")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"type":"string"}`, string(ldb.ElementSchema()))
+	lstack, err := ldb.Stack("stack0")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"type":"integer"}`, string(lstack.ElementSchema()))
+
+	lstack.SetSchema(nil)
+	assert.JSONEq(t, `{"type":"string"}`, string(lstack.ElementSchema()))
+	ldb.SetSchema(nil)
+	assert.Nil(t, lstack.ElementSchema())
+}
@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+type (
+	// Seed is the declarative JSON format of a seed file:
+	//
+	//	{
+	//	  "databases": [
+	//	    {
+	//	      "name": "myDatabase",
+	//	      "stacks": [
+	//	        {"name": "myStack", "elements": [1, "two", {"three": 3}]}
+	//	      ]
+	//	    }
+	//	  ]
+	//	}
+	//
+	// Elements are pushed in order, so the last element ends up on top.
+	Seed struct {
+		Databases []SeedDatabase `json:"databases"`
+	}
+	SeedDatabase struct {
+		Name   string      `json:"name"`
+		Stacks []SeedStack `json:"stacks"`
+	}
+	SeedStack struct {
+		Name     string `json:"name"`
+		Elements []any  `json:"elements"`
+	}
+)
+
+// ErrInvalidSeed is returned when a seed file doesn't match the Seed format.
+var ErrInvalidSeed = errors.New("invalid seed")
+
+// Validate checks that every database and stack has a name, and that names
+// are unique within their parent.
+func (seed *Seed) Validate() error {
+	dbs := make(map[string]bool, len(seed.Databases))
+	for i, db := range seed.Databases {
+		if db.Name == "" {
+			return fmt.Errorf("%w: database %d has no name", ErrInvalidSeed, i)
+		}
+		if dbs[db.Name] {
+			return fmt.Errorf("%w: duplicate database %q", ErrInvalidSeed, db.Name)
+		}
+		dbs[db.Name] = true
+
+		stacks := make(map[string]bool, len(db.Stacks))
+		for j, stack := range db.Stacks {
+			if stack.Name == "" {
+				return fmt.Errorf("%w: stack %d of database %q has no name", ErrInvalidSeed, j, db.Name)
+			}
+			if stacks[stack.Name] {
+				return fmt.Errorf("%w: duplicate stack %q in database %q", ErrInvalidSeed, stack.Name, db.Name)
+			}
+			stacks[stack.Name] = true
+		}
+	}
+
+	return nil
+}
+
+// LoadSeed reads the seed file and creates the databases and stacks it
+// declares. Databases and stacks that already exist are left untouched, so
+// seeding never overwrites persisted data.
+func (r *Repository) LoadSeed(filename string) error {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	var seed Seed
+	if err := json.Unmarshal(b, &seed); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidSeed, err)
+	}
+	if err := seed.Validate(); err != nil {
+		return err
+	}
+
+	for _, sdb := range seed.Databases {
+		db, err := r.Database(sdb.Name)
+		if errors.Is(err, ErrNotFound) {
+			if db, err = r.New(sdb.Name); err != nil {
+				return err
+			}
+		}
+		for _, sstack := range sdb.Stacks {
+			stack, err := db.New(sstack.Name)
+			if errors.Is(err, ErrAlreadyExists) {
+				slog.Info("Seed stack already exists",
+					slog.String("database", sdb.Name),
+					slog.String("stack", sstack.Name))
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if err := stack.PushMany(sstack.Elements); err != nil {
+				return err
+			}
+			slog.Info("Seeded stack",
+				slog.String("database", sdb.Name),
+				slog.String("stack", sstack.Name),
+				slog.Int("elements", len(sstack.Elements)))
+		}
+	}
+
+	return nil
+}
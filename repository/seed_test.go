@@ -0,0 +1,102 @@
+package repository_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jh125486/batterdb/repository"
+)
+
+func TestRepository_LoadSeed(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		seed      string
+		setup     func(t *testing.T, repo *repository.Repository)
+		wantErr   assert.ErrorAssertionFunc
+		wantStack map[string][]any
+	}{
+		{
+			name: "seed",
+			seed: `{"databases": [
+				{"name": "db1", "stacks": [{"name": "s1", "elements": [1, "two"]}, {"name": "s2"}]},
+				{"name": "db2", "stacks": [{"name": "s1", "elements": [{"three": 3}]}]}
+			]}`,
+			wantErr: assert.NoError,
+			wantStack: map[string][]any{
+				"db1/s1": {1.0, "two"},
+				"db1/s2": nil,
+				"db2/s1": {map[string]any{"three": 3.0}},
+			},
+		},
+		{
+			name: "existing stack untouched",
+			seed: `{"databases": [
+				{"name": "db1", "stacks": [{"name": "s1", "elements": [1]}, {"name": "s2", "elements": [2]}]}
+			]}`,
+			setup: func(t *testing.T, repo *repository.Repository) {
+				db, err := repo.New("db1")
+				require.NoError(t, err)
+				stack, err := db.New("s1")
+				require.NoError(t, err)
+				stack.Push("persisted")
+			},
+			wantErr: assert.NoError,
+			wantStack: map[string][]any{
+				"db1/s1": {"persisted"},
+				"db1/s2": {2.0},
+			},
+		},
+		{
+			name:    "malformed",
+			seed:    `{"databases": {}}`,
+			wantErr: assert.Error,
+		},
+		{
+			name:    "missing name",
+			seed:    `{"databases": [{"stacks": []}]}`,
+			wantErr: assert.Error,
+		},
+		{
+			name:    "duplicate stack",
+			seed:    `{"databases": [{"name": "db1", "stacks": [{"name": "s1"}, {"name": "s1"}]}]}`,
+			wantErr: assert.Error,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			filename := filepath.Join(t.TempDir(), "seed.json")
+			require.NoError(t, os.WriteFile(filename, []byte(tt.seed), 0o600))
+			repo := repository.New()
+			if tt.setup != nil {
+				tt.setup(t, repo)
+			}
+
+			err := repo.LoadSeed(filename)
+			if tt.wantErr(t, err); err != nil {
+				assert.ErrorIs(t, err, repository.ErrInvalidSeed)
+				return
+			}
+			for path, want := range tt.wantStack {
+				dbName, stackName, _ := strings.Cut(path, "/")
+				db, err := repo.Database(dbName)
+				require.NoError(t, err)
+				stack, err := db.Stack(stackName)
+				require.NoError(t, err)
+				assert.Equal(t, want, stack.Data)
+			}
+		})
+	}
+}
+
+func TestRepository_LoadSeed_DNE(t *testing.T) {
+	t.Parallel()
+	err := repository.New().LoadSeed(filepath.Join(t.TempDir(), "dne.json"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
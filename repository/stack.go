@@ -1,73 +1,581 @@
 package repository
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 type Stack struct {
-	CreatedAt time.Time
-	UpdatedAt time.Time
-	ReadAt    time.Time
-	database  *Database
-	Name      string
-	Data      []any
-	mx        sync.RWMutex
-	ID        uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	LastPushAt  time.Time
+	LastPopAt   time.Time
+	database    *Database
+	subs        map[chan struct{}]struct{}
+	elementType reflect.Type
+	Name        string
+	Description string
+	Labels      map[string]string
+	Data        []any
+	Schema      []byte
+	Capacity    int
+	Stats       StackStats
+	ReadAt      AtomicTime
+	LastPeekAt  AtomicTime
+	waiters     atomic.Int32
+	mx          sync.RWMutex
+	ID          uuid.UUID
 }
 
 func (s *Stack) setUpdateTime(t time.Time) {
 	s.setReadTime(t)
 	s.UpdatedAt = t
+	s.markDirty()
+}
+
+// setPushTime records a push at t, see setUpdateTime.
+func (s *Stack) setPushTime(t time.Time) {
+	s.setUpdateTime(t)
+	s.LastPushAt = t
+}
+
+func (s *Stack) markDirty() {
+	if s.database != nil {
+		s.database.markDirty()
+	}
+}
+
+// compressMin returns the compression threshold of the stack's database.
+func (s *Stack) compressMin() int {
+	if s.database == nil {
+		return 0
+	}
+
+	return s.database.compressMin
+}
+
+// maxSize returns the stack size limit of the stack's database.
+func (s *Stack) maxSize() int {
+	if s.database == nil {
+		return 0
+	}
+
+	return s.database.maxSize
+}
+
+// checkSize fails with ErrStackFull if pushing n elements would grow the
+// stack beyond the size limit. A ring only grows up to its capacity.
+// It must be called with the write lock held.
+func (s *Stack) checkSize(n int) error {
+	limit := s.maxSize()
+	if limit <= 0 {
+		return nil
+	}
+	size := len(s.Data) + n
+	if s.Capacity > 0 {
+		size = min(size, max(s.Capacity, len(s.Data)))
+	}
+	if size > limit {
+		return fmt.Errorf("%w: at most %d elements", ErrStackFull, limit)
+	}
+
+	return nil
+}
+
+// Activity returns when the stack was last pushed and popped, zero if never,
+// including for stacks persisted before the times were tracked.
+func (s *Stack) Activity() (lastPushAt, lastPopAt time.Time) {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
+	return s.LastPushAt, s.LastPopAt
 }
-func (s *Stack) setReadTime(t time.Time) { s.ReadAt = t }
+
+func (s *Stack) setReadTime(t time.Time) { s.ReadAt.Store(t) }
 
 func (s *Stack) Database() *Database { return s.database }
 
-func (s *Stack) Push(element any) {
+// SetLabels replaces the labels of the stack.
+func (s *Stack) SetLabels(labels map[string]string) {
 	s.mx.Lock()
 	defer s.mx.Unlock()
-	s.setUpdateTime(time.Now())
-	s.Data = append(s.Data, element)
+	s.Labels = maps.Clone(labels)
+	s.markDirty()
+}
+
+// HasLabels reports whether the stack has all the labels.
+func (s *Stack) HasLabels(labels map[string]string) bool {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+	for k, v := range labels {
+		if got, ok := s.Labels[k]; !ok || got != v {
+			return false
+		}
+	}
+
+	return true
+}
+
+// SetDescription sets the human-readable description of the stack.
+func (s *Stack) SetDescription(description string) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.Description = description
+	s.markDirty()
+}
+
+// Push pushes the element on top of the stack. When the stack is a ring at
+// capacity, the bottom element is dropped and returned. A stack at the size
+// limit of SetMaxStackSize rejects the element with ErrStackFull.
+func (s *Stack) Push(element any) (dropped any, err error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if err := s.checkSize(1); err != nil {
+		return nil, err
+	}
+	s.Stats.Pushes.Add(1)
+	s.setPushTime(time.Now())
+	dropped = s.push(compress(element, s.compressMin()))
 	s.UpdatedAt = time.Now()
+	s.notifyPushed()
+
+	return dropped, nil
+}
+
+// PushMany pushes the elements in order under a single lock, so the last one
+// ends up on top and no other operation sees only some of them. A ring at
+// capacity drops its oldest elements as needed. If the elements don't all fit
+// within the size limit, none are pushed.
+func (s *Stack) PushMany(elements []any) error {
+	return s.pushMany(elements, nil)
+}
+
+// pushMany pushes the elements like PushMany, with the IDs if not nil, see
+// PushManyWithIDs.
+func (s *Stack) pushMany(elements []any, ids []string) error {
+	if len(elements) == 0 {
+		return nil
+	}
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if err := s.checkSize(len(elements)); err != nil {
+		return err
+	}
+	s.Stats.Pushes.Add(int64(len(elements)))
+	s.setPushTime(time.Now())
+	minBytes := s.compressMin()
+	for i, element := range elements {
+		element = compress(element, minBytes)
+		if ids != nil {
+			element = identifiedElement{ID: ids[i], Value: element}
+		}
+		s.push(element)
+	}
+	s.notifyPushed()
+
+	return nil
+}
+
+// push appends the element, dropping the bottom one first if the stack is a
+// ring at capacity.
+func (s *Stack) push(element any) (dropped any) {
+	if s.Capacity > 0 && len(s.Data) >= s.Capacity {
+		dropped = expand(s.Data[0])
+		// clear, so the dropped element can be collected.
+		s.Data[0] = nil
+		s.Data = s.Data[1:]
+	}
+	s.Data = append(s.Data, element)
+
+	return dropped
+}
+
+// SetCapacity makes the stack a ring keeping only the newest n elements, or a
+// regular stack if n is 0. Elements beyond the capacity are discarded from the
+// bottom.
+func (s *Stack) SetCapacity(n int) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.Capacity = max(n, 0)
+	if s.Capacity > 0 && len(s.Data) > s.Capacity {
+		s.Data = slices.Clone(s.Data[len(s.Data)-s.Capacity:])
+	}
+	s.markDirty()
+}
+
+// Subscribe registers for notifications of pushes to the stack. The returned
+// channel receives a signal after each push, with signals coalescing while
+// the subscriber is busy. The returned func unsubscribes and must be called
+// once the subscriber is done to avoid leaking it.
+func (s *Stack) Subscribe() (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+	s.mx.Lock()
+	if s.subs == nil {
+		s.subs = make(map[chan struct{}]struct{})
+	}
+	s.subs[ch] = struct{}{}
+	s.mx.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			s.mx.Lock()
+			defer s.mx.Unlock()
+			delete(s.subs, ch)
+		})
+	}
+}
+
+// notifyPushed signals all subscribers without ever blocking the pusher.
+// It must be called with the write lock held.
+func (s *Stack) notifyPushed() {
+	for ch := range s.subs {
+		select {
+		case ch <- struct{}{}:
+		default:
+			// a signal is already pending.
+		}
+	}
 }
 
 func (s *Stack) Pop() any {
 	s.mx.Lock()
 	defer s.mx.Unlock()
+
+	return s.pop()
+}
+
+func (s *Stack) pop() any {
+	s.Stats.Pops.Add(1)
 	if len(s.Data) == 0 {
 		s.setReadTime(time.Now())
 		return nil
 	}
-	s.setUpdateTime(time.Now())
+	now := time.Now()
+	s.setUpdateTime(now)
+	s.LastPopAt = now
 	res := s.Data[len(s.Data)-1]
 	s.Data = s.Data[:len(s.Data)-1]
 
-	return res
+	return expand(res)
+}
+
+// PopWait pops the top element, blocking until an element is pushed if the
+// stack is empty. It returns nil if ctx is done before an element is available.
+func (s *Stack) PopWait(ctx context.Context) any {
+	// Subscribe before checking so a push in between isn't missed.
+	pushed, unsubscribe := s.Subscribe()
+	defer unsubscribe()
+	for {
+		s.mx.Lock()
+		if len(s.Data) > 0 {
+			res := s.pop()
+			s.mx.Unlock()
+			return res
+		}
+		s.mx.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-pushed:
+			// another waiter may win the element, so check again.
+		}
+	}
 }
 
+// AcquireWaiter registers a waiter of PopWait, failing if limit waiters are
+// already registered. A limit of 0 means unlimited. The returned func releases
+// the waiter and must be called once it's done waiting.
+func (s *Stack) AcquireWaiter(limit int) (func(), bool) {
+	for {
+		n := s.waiters.Load()
+		if limit > 0 && int(n) >= limit {
+			return nil, false
+		}
+		if s.waiters.CompareAndSwap(n, n+1) {
+			break
+		}
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { s.waiters.Add(-1) })
+	}, true
+}
+
+// Waiters returns the number of waiters registered with AcquireWaiter.
+func (s *Stack) Waiters() int { return int(s.waiters.Load()) }
+
 func (s *Stack) Size() int {
 	s.mx.RLock()
 	defer s.mx.RUnlock()
 	return len(s.Data)
 }
 
+// Top returns the top element like Peek, but without recording a read, for
+// metadata views such as listings.
+func (s *Stack) Top() any {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+	if len(s.Data) == 0 {
+		return nil
+	}
+
+	return expand(s.Data[len(s.Data)-1])
+}
+
 func (s *Stack) Peek() any {
 	s.mx.RLock()
 	defer s.mx.RUnlock()
-	s.setReadTime(time.Now())
+	s.Stats.Peeks.Add(1)
+	now := time.Now()
+	s.setReadTime(now)
+	s.LastPeekAt.Store(now)
 	if len(s.Data) == 0 {
 		return nil
 	}
 
-	return s.Data[len(s.Data)-1]
+	return expand(s.Data[len(s.Data)-1])
+}
+
+// Dup pushes a deep copy of the top element and returns it, or fails with
+// ErrEmpty if the stack is empty or ErrStackFull at the size limit. A
+// duplicated element doesn't keep the ID of the original.
+func (s *Stack) Dup() (any, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if len(s.Data) == 0 {
+		return nil, ErrEmpty
+	}
+	if err := s.checkSize(1); err != nil {
+		return nil, err
+	}
+	s.Stats.Pushes.Add(1)
+	s.setPushTime(time.Now())
+	element := copyElement(expand(s.Data[len(s.Data)-1]))
+	s.push(compress(element, s.compressMin()))
+	s.notifyPushed()
+
+	return element, nil
+}
+
+// Swap exchanges the top two elements and returns the new top, or false if
+// the stack has fewer than two elements.
+func (s *Stack) Swap() (any, bool) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	n := len(s.Data)
+	if n < 2 {
+		return nil, false
+	}
+	now := time.Now()
+	s.setUpdateTime(now)
+	s.setReadTime(now)
+	s.Data[n-1], s.Data[n-2] = s.Data[n-2], s.Data[n-1]
+
+	return expand(s.Data[n-1]), true
+}
+
+// Elements returns a copy of the elements at positions [start, end) counted
+// from the bottom of the stack, clamped to the current size. Positions from
+// the bottom are stable across pushes, so a large stack can be read in chunks.
+func (s *Stack) Elements(start, end int) []any {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+	s.setReadTime(time.Now())
+	end = min(end, len(s.Data))
+	if start < 0 || start >= end {
+		return nil
+	}
+
+	return expandAll(slices.Clone(s.Data[start:end]))
+}
+
+// Slice returns a copy of up to limit elements, top first, skipping the top
+// offset elements, along with the size of the stack. An offset past the
+// bottom returns no elements.
+func (s *Stack) Slice(offset, limit int) ([]any, int) {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+	s.setReadTime(time.Now())
+	size := len(s.Data)
+	if offset < 0 || limit <= 0 || offset >= size {
+		return []any{}, size
+	}
+	end := size - offset
+	start := max(end-limit, 0)
+	elements := expandAll(slices.Clone(s.Data[start:end]))
+	slices.Reverse(elements)
+
+	return elements, size
+}
+
+// Contains reports whether an element equal to element is on the stack,
+// see elementsEqual for the definition of equality.
+func (s *Stack) Contains(element any) bool {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+	s.setReadTime(time.Now())
+	for _, e := range s.Data {
+		if elementsEqual(expand(e), element) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Truncate keeps the top n elements, discarding the older ones from the
+// bottom, and returns the number of discarded elements.
+func (s *Stack) Truncate(n int) int {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	discarded := max(len(s.Data)-max(n, 0), 0)
+	if discarded == 0 {
+		return 0
+	}
+	s.setUpdateTime(time.Now())
+	// copy, so the discarded elements can be collected.
+	s.Data = slices.Clone(s.Data[discarded:])
+
+	return discarded
+}
+
+// Bytes estimates the memory used by the elements as the length of their JSON
+// encoding.
+func (s *Stack) Bytes() int {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+	var cw countingWriter
+	enc := json.NewEncoder(&cw)
+	for _, e := range s.Data {
+		// elements are validated JSON on push, so encoding doesn't fail.
+		_ = enc.Encode(expand(e))
+	}
+
+	return cw.n
+}
+
+// countingWriter counts the bytes written to it, discarding them.
+type countingWriter struct {
+	n int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += len(p)
+	return len(p), nil
 }
 
 func (s *Stack) Flush() {
 	s.mx.Lock()
 	defer s.mx.Unlock()
+	s.Stats.Flushes.Add(1)
 	s.setUpdateTime(time.Now())
 	s.Data = nil
 }
+
+// Drained is the result of Drain.
+type Drained struct {
+	// UpdatedAt is when the stack was last updated before the drain.
+	UpdatedAt time.Time
+	DrainedAt time.Time
+	// Elements are the drained elements, bottom first.
+	Elements []any
+}
+
+// Drain removes and returns all elements in a single operation, so no push
+// or pop can interleave between reading and clearing the stack. Each drained
+// element counts as a pop.
+func (s *Stack) Drain() Drained {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	d := Drained{
+		UpdatedAt: s.UpdatedAt,
+		DrainedAt: time.Now(),
+		Elements:  expandAll(s.Data),
+	}
+	s.setUpdateTime(d.DrainedAt)
+	if len(s.Data) > 0 {
+		s.Stats.Pops.Add(int64(len(s.Data)))
+		s.LastPopAt = d.DrainedAt
+	}
+	s.Data = nil
+
+	return d
+}
+
+// snapshot returns a copy of the persisted fields of the stack, taken under
+// its read lock so it can be encoded while the stack changes.
+func (s *Stack) snapshot() *Stack {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+	c := &Stack{
+		CreatedAt:   s.CreatedAt,
+		UpdatedAt:   s.UpdatedAt,
+		LastPushAt:  s.LastPushAt,
+		LastPopAt:   s.LastPopAt,
+		Name:        s.Name,
+		Description: s.Description,
+		Labels:      maps.Clone(s.Labels),
+		Data:        slices.Clone(s.Data),
+		Schema:      s.Schema,
+		Capacity:    s.Capacity,
+		ID:          s.ID,
+	}
+	counters := c.Stats.counters()
+	for i, counter := range s.Stats.counters() {
+		counters[i].Store(counter.Load())
+	}
+	c.ReadAt.Store(s.ReadAt.Load())
+	c.LastPeekAt.Store(s.LastPeekAt.Load())
+
+	return c
+}
+
+// AtomicTime is a time.Time that can be loaded and stored without locking,
+// so frequent reads (e.g. peeks) can record their access time while only
+// holding a read lock. It is persisted like a regular time.Time.
+type AtomicTime struct {
+	ns atomic.Int64
+}
+
+// Load returns the stored time, or the zero time if none was stored.
+func (t *AtomicTime) Load() time.Time {
+	ns := t.ns.Load()
+	if ns == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, ns)
+}
+
+// Store sets the time.
+func (t *AtomicTime) Store(v time.Time) {
+	if v.IsZero() {
+		t.ns.Store(0)
+		return
+	}
+	t.ns.Store(v.UnixNano())
+}
+
+func (t *AtomicTime) GobEncode() ([]byte, error) { return t.Load().GobEncode() }
+
+func (t *AtomicTime) GobDecode(b []byte) error {
+	var v time.Time
+	if err := v.GobDecode(b); err != nil {
+		return err
+	}
+	t.Store(v)
+
+	return nil
+}
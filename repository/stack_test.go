@@ -1,7 +1,10 @@
 package repository_test
 
 import (
+	"context"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -22,10 +25,11 @@ func TestStack_Database(t *testing.T) {
 func TestStack_Push(t *testing.T) {
 	t.Parallel()
 	tests := []struct {
-		name  string
-		stack *repository.Stack
-		item  int
-		want  []any
+		name        string
+		stack       *repository.Stack
+		item        int
+		want        []any
+		wantDropped any
 	}{
 		{
 			name:  "push to empty stack",
@@ -39,13 +43,74 @@ func TestStack_Push(t *testing.T) {
 			item:  4,
 			want:  []any{1, 2, 3, 4},
 		},
+		{
+			name:  "push to ring below capacity",
+			stack: &repository.Stack{Data: []any{1, 2}, Capacity: 3},
+			item:  3,
+			want:  []any{1, 2, 3},
+		},
+		{
+			name:        "push to full ring",
+			stack:       &repository.Stack{Data: []any{1, 2, 3}, Capacity: 3},
+			item:        4,
+			want:        []any{2, 3, 4},
+			wantDropped: 1,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
-			tt.stack.Push(tt.item)
+			dropped, err := tt.stack.Push(tt.item)
+			require.NoError(t, err)
 			assert.Equal(t, tt.want, tt.stack.Data)
+			assert.Equal(t, tt.wantDropped, dropped)
+		})
+	}
+}
+
+func TestStack_PushMany(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		stack    *repository.Stack
+		elements []any
+		want     []any
+	}{
+		{name: "none", stack: &repository.Stack{Data: []any{1}}, want: []any{1}},
+		{name: "empty stack", stack: &repository.Stack{}, elements: []any{1, 2}, want: []any{1, 2}},
+		{name: "non-empty stack", stack: &repository.Stack{Data: []any{1}}, elements: []any{2, 3}, want: []any{1, 2, 3}},
+		{name: "ring", stack: &repository.Stack{Data: []any{1, 2}, Capacity: 3}, elements: []any{3, 4, 5}, want: []any{3, 4, 5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			require.NoError(t, tt.stack.PushMany(tt.elements))
+			assert.Equal(t, tt.want, tt.stack.Data)
+		})
+	}
+}
+
+func TestStack_SetCapacity(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		data []any
+		n    int
+		want []any
+	}{
+		{name: "empty stack", n: 2, want: nil},
+		{name: "trims the bottom", data: []any{1, 2, 3, 4}, n: 2, want: []any{3, 4}},
+		{name: "below capacity", data: []any{1, 2}, n: 5, want: []any{1, 2}},
+		{name: "regular stack", data: []any{1, 2}, n: 0, want: []any{1, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			stack := &repository.Stack{Data: tt.data}
+			stack.SetCapacity(tt.n)
+			assert.Equal(t, tt.n, stack.Capacity)
+			assert.Equal(t, tt.want, stack.Data)
 		})
 	}
 }
@@ -142,6 +207,73 @@ func TestStack_Peek(t *testing.T) {
 	}
 }
 
+func TestStack_Elements(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		data       []any
+		start, end int
+		want       []any
+	}{
+		{name: "empty stack", start: 0, end: 10, want: nil},
+		{name: "all", data: []any{1, 2, 3}, start: 0, end: 3, want: []any{1, 2, 3}},
+		{name: "middle", data: []any{1, 2, 3, 4}, start: 1, end: 3, want: []any{2, 3}},
+		{name: "end clamped", data: []any{1, 2, 3}, start: 1, end: 10, want: []any{2, 3}},
+		{name: "start past end", data: []any{1, 2, 3}, start: 5, end: 10, want: nil},
+		{name: "negative start", data: []any{1, 2, 3}, start: -1, end: 2, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			stack := &repository.Stack{Data: tt.data}
+			got := stack.Elements(tt.start, tt.end)
+			assert.Equal(t, tt.want, got)
+			if len(got) > 0 {
+				got[0] = "changed"
+				assert.NotEqual(t, "changed", stack.Data[tt.start], "must return a copy")
+			}
+		})
+	}
+}
+
+func TestStack_Contains(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		data    []any
+		element any
+		want    bool
+	}{
+		{name: "empty stack", data: nil, element: 1, want: false},
+		{name: "int vs float", data: []any{float64(1)}, element: 1, want: true},
+		{name: "different number", data: []any{1.5}, element: 1, want: false},
+		{
+			name:    "map key order",
+			data:    []any{map[string]any{"a": 1, "b": "x"}},
+			element: map[string]any{"b": "x", "a": 1.0},
+			want:    true,
+		},
+		{
+			name: "struct vs map",
+			data: []any{map[string]any{"name": "x"}},
+			element: struct {
+				Name string `json:"name"`
+			}{Name: "x"},
+			want: true,
+		},
+		{name: "string vs number", data: []any{"1"}, element: 1, want: false},
+		{name: "nested slice", data: []any{[]any{1, 2}}, element: []int{1, 2}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			stack := &repository.Stack{Data: tt.data}
+			assert.Equal(t, tt.want, stack.Contains(tt.element))
+		})
+	}
+}
+
 func TestStack_Flush(t *testing.T) {
 	t.Parallel()
 	tests := []struct {
@@ -166,3 +298,445 @@ func TestStack_Flush(t *testing.T) {
 		})
 	}
 }
+
+func TestAtomicTime(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		v    time.Time
+	}{
+		{
+			name: "zero",
+			v:    time.Time{},
+		},
+		{
+			name: "now",
+			v:    time.Now(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var at repository.AtomicTime
+			at.Store(tt.v)
+			assert.True(t, tt.v.Equal(at.Load()))
+
+			b, err := at.GobEncode()
+			require.NoError(t, err)
+			var decoded repository.AtomicTime
+			require.NoError(t, decoded.GobDecode(b))
+			assert.True(t, tt.v.Equal(decoded.Load()))
+		})
+	}
+}
+
+func TestStack_PopWait(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		stack    *repository.Stack
+		push     any
+		timeout  time.Duration
+		wantItem any
+	}{
+		{
+			name:     "element available",
+			stack:    &repository.Stack{Data: []any{1, 2}},
+			timeout:  time.Second,
+			wantItem: 2,
+		},
+		{
+			name:     "element pushed while waiting",
+			stack:    &repository.Stack{},
+			push:     3,
+			timeout:  time.Second,
+			wantItem: 3,
+		},
+		{
+			name:     "timeout",
+			stack:    &repository.Stack{},
+			timeout:  10 * time.Millisecond,
+			wantItem: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+			if tt.push != nil {
+				go func() {
+					time.Sleep(10 * time.Millisecond)
+					tt.stack.Push(tt.push)
+				}()
+			}
+			assert.Equal(t, tt.wantItem, tt.stack.PopWait(ctx))
+		})
+	}
+}
+
+func TestStack_Subscribe(t *testing.T) {
+	t.Parallel()
+	stack := &repository.Stack{}
+	pushed, unsubscribe := stack.Subscribe()
+	idle, unsubscribeIdle := stack.Subscribe()
+	defer unsubscribeIdle()
+
+	// pushes never block on subscribers that aren't listening.
+	for i := range 10 {
+		stack.Push(i)
+	}
+	select {
+	case <-pushed:
+	case <-time.After(time.Second):
+		t.Fatal("expected a push signal")
+	}
+	assert.Len(t, idle, 1)
+
+	unsubscribe()
+	unsubscribe() // safe to call twice.
+	stack.Push(10)
+	assert.Empty(t, pushed)
+}
+
+func TestStack_SetDescription(t *testing.T) {
+	t.Parallel()
+	stack := &repository.Stack{}
+	stack.SetDescription("a description")
+	assert.Equal(t, "a description", stack.Description)
+}
+
+func TestStack_HasLabels(t *testing.T) {
+	t.Parallel()
+	stack := &repository.Stack{}
+	stack.SetLabels(map[string]string{"env": "prod", "owner": "me"})
+	tests := []struct {
+		name   string
+		labels map[string]string
+		want   bool
+	}{
+		{
+			name: "no labels",
+			want: true,
+		},
+		{
+			name:   "match",
+			labels: map[string]string{"env": "prod"},
+			want:   true,
+		},
+		{
+			name:   "match all",
+			labels: map[string]string{"env": "prod", "owner": "me"},
+			want:   true,
+		},
+		{
+			name:   "value mismatch",
+			labels: map[string]string{"env": "dev"},
+			want:   false,
+		},
+		{
+			name:   "missing key",
+			labels: map[string]string{"team": "core"},
+			want:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.want, stack.HasLabels(tt.labels))
+		})
+	}
+}
+
+func TestStack_Drain(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		data []any
+		want []any
+	}{
+		{name: "empty stack", want: nil},
+		{name: "bottom first", data: []any{1, 2, 3}, want: []any{1, 2, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			updatedAt := time.Now().Add(-time.Hour)
+			stack := &repository.Stack{Data: tt.data, UpdatedAt: updatedAt}
+			got := stack.Drain()
+			assert.Equal(t, tt.want, got.Elements)
+			assert.Equal(t, updatedAt, got.UpdatedAt)
+			assert.Equal(t, got.DrainedAt, stack.UpdatedAt)
+			assert.Zero(t, stack.Size())
+			assert.Equal(t, int64(len(tt.data)), stack.Stats.Pops.Load())
+			if len(tt.data) > 0 {
+				assert.Equal(t, got.DrainedAt, stack.LastPopAt)
+			} else {
+				assert.Zero(t, stack.LastPopAt)
+			}
+		})
+	}
+}
+
+func TestStack_Bytes(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		data []any
+		want int
+	}{
+		{name: "empty stack", want: 0},
+		{name: "scalars", data: []any{"a", 1.0}, want: len("\"a\"\n1\n")},
+		{name: "object", data: []any{map[string]any{"k": "v"}}, want: len("{\"k\":\"v\"}\n")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			stack := &repository.Stack{Data: tt.data}
+			assert.Equal(t, tt.want, stack.Bytes())
+		})
+	}
+}
+
+func TestStack_Truncate(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name          string
+		data          []any
+		n             int
+		want          []any
+		wantDiscarded int
+	}{
+		{name: "empty stack", n: 2, want: nil},
+		{name: "keeps the top", data: []any{1, 2, 3, 4}, n: 2, want: []any{3, 4}, wantDiscarded: 2},
+		{name: "fewer than n", data: []any{1, 2}, n: 5, want: []any{1, 2}},
+		{name: "zero", data: []any{1, 2}, n: 0, want: []any{}, wantDiscarded: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			stack := &repository.Stack{Data: tt.data}
+			assert.Equal(t, tt.wantDiscarded, stack.Truncate(tt.n))
+			assert.Equal(t, tt.want, stack.Data)
+		})
+	}
+}
+
+func TestStack_Swap(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		data    []any
+		want    []any
+		wantTop any
+		wantOK  bool
+	}{
+		{name: "empty stack", want: nil},
+		{name: "one element", data: []any{1}, want: []any{1}},
+		{name: "two elements", data: []any{1, 2}, want: []any{2, 1}, wantTop: 1, wantOK: true},
+		{name: "keeps the bottom", data: []any{1, 2, 3}, want: []any{1, 3, 2}, wantTop: 2, wantOK: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			stack := &repository.Stack{Data: tt.data}
+			top, ok := stack.Swap()
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.wantTop, top)
+			assert.Equal(t, tt.want, stack.Data)
+			assert.Equal(t, tt.wantOK, !stack.UpdatedAt.IsZero())
+		})
+	}
+}
+
+func TestStack_Dup(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		data    []any
+		want    any
+		wantErr error
+	}{
+		{name: "empty stack", wantErr: repository.ErrEmpty},
+		{name: "primitive", data: []any{1, "a"}, want: "a"},
+		{name: "map", data: []any{map[string]any{"a": []any{1.0}}}, want: map[string]any{"a": []any{1.0}}},
+		{name: "slice", data: []any{[]any{1.0, map[string]any{"b": 2.0}}}, want: []any{1.0, map[string]any{"b": 2.0}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			stack := &repository.Stack{Data: tt.data}
+			got, err := stack.Dup()
+			require.ErrorIs(t, err, tt.wantErr)
+			if err != nil {
+				assert.Empty(t, stack.Data)
+				return
+			}
+			assert.Equal(t, tt.want, got)
+			assert.Len(t, stack.Data, len(tt.data)+1)
+			assert.Equal(t, stack.Data[len(stack.Data)-2], stack.Data[len(stack.Data)-1])
+
+			// mutating the copy must not affect the original.
+			switch v := got.(type) {
+			case map[string]any:
+				v["a"].([]any)[0] = "mutated"
+				v["c"] = "added"
+			case []any:
+				v[1].(map[string]any)["b"] = "mutated"
+			default:
+				return
+			}
+			assert.Equal(t, tt.want, stack.Data[len(stack.Data)-2])
+		})
+	}
+}
+
+func TestStack_AcquireWaiter(t *testing.T) {
+	t.Parallel()
+	stack := new(repository.Stack)
+	release, ok := stack.AcquireWaiter(2)
+	require.True(t, ok)
+	_, ok = stack.AcquireWaiter(2)
+	require.True(t, ok)
+	_, ok = stack.AcquireWaiter(2)
+	require.False(t, ok, "limit reached")
+	assert.Equal(t, 2, stack.Waiters())
+
+	release()
+	release() // releasing twice must not free another slot.
+	assert.Equal(t, 1, stack.Waiters())
+	_, ok = stack.AcquireWaiter(2)
+	require.True(t, ok)
+	_, ok = stack.AcquireWaiter(0)
+	require.True(t, ok, "no limit")
+	assert.Equal(t, 3, stack.Waiters())
+}
+
+func TestStack_MaxSize(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		capacity int
+		push     func(*repository.Stack) error
+		wantErr  error
+		wantSize int
+	}{
+		{
+			name:     "push",
+			push:     func(s *repository.Stack) error { _, err := s.Push(3); return err },
+			wantErr:  repository.ErrStackFull,
+			wantSize: 2,
+		},
+		{
+			name:     "push with ID",
+			push:     func(s *repository.Stack) error { _, _, err := s.PushWithID(3); return err },
+			wantErr:  repository.ErrStackFull,
+			wantSize: 2,
+		},
+		{
+			name:     "push multi",
+			push:     func(s *repository.Stack) error { return s.PushMany([]any{3}) },
+			wantErr:  repository.ErrStackFull,
+			wantSize: 2,
+		},
+		{
+			name:     "dup",
+			push:     func(s *repository.Stack) error { _, err := s.Dup(); return err },
+			wantErr:  repository.ErrStackFull,
+			wantSize: 2,
+		},
+		{
+			name:     "ring within limit",
+			capacity: 2,
+			push:     func(s *repository.Stack) error { return s.PushMany([]any{3, 4, 5}) },
+			wantSize: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			repo := repository.New()
+			repo.SetMaxStackSize(2)
+			db, err := repo.New("test")
+			require.NoError(t, err)
+			stack, err := db.New("stack")
+			require.NoError(t, err)
+			stack.SetCapacity(tt.capacity)
+			require.NoError(t, stack.PushMany([]any{1, 2}))
+
+			require.ErrorIs(t, tt.push(stack), tt.wantErr)
+			assert.Equal(t, tt.wantSize, stack.Size())
+		})
+	}
+}
+
+func TestStack_Slice(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name          string
+		offset, limit int
+		want          []any
+	}{
+		{name: "top", limit: 2, want: []any{5, 4}},
+		{name: "all", limit: 100, want: []any{5, 4, 3, 2, 1}},
+		{name: "middle", offset: 1, limit: 2, want: []any{4, 3}},
+		{name: "bottom", offset: 3, limit: 100, want: []any{2, 1}},
+		{name: "last", offset: 4, limit: 1, want: []any{1}},
+		{name: "offset past the end", offset: 5, limit: 2, want: []any{}},
+		{name: "zero limit", limit: 0, want: []any{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			stack := &repository.Stack{Data: []any{1, 2, 3, 4, 5}}
+			got, total := stack.Slice(tt.offset, tt.limit)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, 5, total)
+			assert.Equal(t, []any{1, 2, 3, 4, 5}, stack.Data, "the stack must not change")
+			assert.False(t, stack.ReadAt.Load().IsZero(), "the read must be recorded")
+		})
+	}
+}
+
+func TestStack_Activity(t *testing.T) {
+	t.Parallel()
+	repo := repository.New()
+	db, err := repo.New("test")
+	require.NoError(t, err)
+	stack, err := db.New("stack")
+	require.NoError(t, err)
+
+	lastPushAt, lastPopAt := stack.Activity()
+	assert.True(t, lastPushAt.IsZero())
+	assert.True(t, lastPopAt.IsZero())
+	assert.True(t, stack.LastPeekAt.Load().IsZero())
+
+	_, err = stack.Push(1)
+	require.NoError(t, err)
+	stack.Peek()
+	lastPushAt, lastPopAt = stack.Activity()
+	assert.False(t, lastPushAt.IsZero(), "push must be recorded")
+	assert.True(t, lastPopAt.IsZero(), "push isn't a pop")
+	assert.False(t, stack.LastPeekAt.Load().IsZero(), "peek must be recorded")
+
+	stack.Pop()
+	stack.Pop()
+	_, lastPopAt = stack.Activity()
+	assert.False(t, lastPopAt.IsZero(), "pop must be recorded")
+
+	filename := filepath.Join(t.TempDir(), "repo")
+	require.NoError(t, repo.Persist(filename))
+	loaded := repository.New()
+	require.NoError(t, loaded.Load(filename))
+	loadedDB, err := loaded.Database("test")
+	require.NoError(t, err)
+	loadedStack, err := loadedDB.Stack("stack")
+	require.NoError(t, err)
+	gotPushAt, gotPopAt := loadedStack.Activity()
+	assert.True(t, lastPushAt.Equal(gotPushAt), "push time must be persisted")
+	assert.True(t, lastPopAt.Equal(gotPopAt), "pop time must be persisted")
+	assert.True(t, stack.LastPeekAt.Load().Equal(loadedStack.LastPeekAt.Load()), "peek time must be persisted")
+}
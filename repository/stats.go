@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync/atomic"
+)
+
+// StackStats counts the operations on a stack over its lifetime. The counters
+// are persisted with the stack.
+type StackStats struct {
+	Pushes  atomic.Int64
+	Pops    atomic.Int64
+	Peeks   atomic.Int64
+	Flushes atomic.Int64
+}
+
+func (st *StackStats) counters() []*atomic.Int64 {
+	return []*atomic.Int64{&st.Pushes, &st.Pops, &st.Peeks, &st.Flushes}
+}
+
+// Reset zeroes the counters.
+func (st *StackStats) Reset() {
+	for _, c := range st.counters() {
+		c.Store(0)
+	}
+}
+
+func (st *StackStats) GobEncode() ([]byte, error) {
+	counters := st.counters()
+	b := make([]byte, 0, len(counters)*binary.MaxVarintLen64)
+	for _, c := range counters {
+		b = binary.AppendVarint(b, c.Load())
+	}
+
+	return b, nil
+}
+
+func (st *StackStats) GobDecode(b []byte) error {
+	for _, c := range st.counters() {
+		v, n := binary.Varint(b)
+		if n <= 0 {
+			return errors.New("malformed stack stats")
+		}
+		c.Store(v)
+		b = b[n:]
+	}
+
+	return nil
+}
+
+// ResetStats zeroes the operation counters of all stacks, e.g. to not carry
+// them over from a loaded repository.
+func (r *Repository) ResetStats() {
+	r.mx.RLock()
+	defer r.mx.RUnlock()
+	for _, db := range r.Databases {
+		db.mx.RLock()
+		for _, stack := range db.Stacks {
+			stack.Stats.Reset()
+		}
+		db.mx.RUnlock()
+	}
+}
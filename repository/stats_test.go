@@ -0,0 +1,54 @@
+package repository_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jh125486/batterdb/repository"
+)
+
+func TestStackStats(t *testing.T) {
+	t.Parallel()
+	repo := repository.New()
+	db, err := repo.New("test")
+	require.NoError(t, err)
+	stack, err := db.New("stack")
+	require.NoError(t, err)
+
+	stack.Push(1)
+	stack.PushWithID(2)
+	stack.PushMany([]any{3, 4})
+	stack.Peek()
+	stack.Pop()
+	stack.PopWait(context.Background())
+	stack.Pop()
+	stack.Pop()
+	stack.Pop() // empty, still counted.
+	stack.Flush()
+	assertStats(t, stack, 4, 5, 1, 1)
+
+	filename := filepath.Join(t.TempDir(), "repo")
+	require.NoError(t, repo.Persist(filename))
+	loaded := repository.New()
+	require.NoError(t, loaded.Load(filename))
+	loadedDB, err := loaded.Database("test")
+	require.NoError(t, err)
+	loadedStack, err := loadedDB.Stack("stack")
+	require.NoError(t, err)
+	assertStats(t, loadedStack, 4, 5, 1, 1)
+
+	loaded.ResetStats()
+	assertStats(t, loadedStack, 0, 0, 0, 0)
+}
+
+func assertStats(t *testing.T, stack *repository.Stack, pushes, pops, peeks, flushes int64) {
+	t.Helper()
+	assert.Equal(t, pushes, stack.Stats.Pushes.Load(), "pushes")
+	assert.Equal(t, pops, stack.Stats.Pops.Load(), "pops")
+	assert.Equal(t, peeks, stack.Stats.Peeks.Load(), "peeks")
+	assert.Equal(t, flushes, stack.Stats.Flushes.Load(), "flushes")
+}
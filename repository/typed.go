@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// SetElementType makes pushes through DecodeElement decode elements into a
+// new value of the prototype's type, e.g. SetElementType(Event{}). A nil
+// prototype restores decoding into any. The type isn't persisted, so it must
+// be set again after loading, and persisted elements of a custom type need
+// gob.Register.
+func (s *Stack) SetElementType(prototype any) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.elementType = reflect.TypeOf(prototype)
+}
+
+// DecodeElement converts a decoded element, e.g. a map[string]any, into the
+// element type of the stack by way of its JSON encoding. Without an element
+// type the element is returned as is.
+func (s *Stack) DecodeElement(element any) (any, error) {
+	s.mx.RLock()
+	t := s.elementType
+	s.mx.RUnlock()
+	if t == nil {
+		return element, nil
+	}
+
+	b, err := json.Marshal(element)
+	if err != nil {
+		return nil, err
+	}
+	v := reflect.New(t)
+	if err := json.Unmarshal(b, v.Interface()); err != nil {
+		return nil, err
+	}
+
+	return v.Elem().Interface(), nil
+}
@@ -0,0 +1,86 @@
+package repository_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jh125486/batterdb/repository"
+)
+
+type event struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+func TestStack_DecodeElement(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		prototype any
+		element   any
+		want      any
+		wantErr   assert.ErrorAssertionFunc
+	}{
+		{
+			name:    "no type",
+			element: map[string]any{"name": "a", "count": 1.0},
+			want:    map[string]any{"name": "a", "count": 1.0},
+			wantErr: assert.NoError,
+		},
+		{
+			name:      "struct",
+			prototype: event{},
+			element:   map[string]any{"name": "a", "count": 1.0},
+			want:      event{Name: "a", Count: 1},
+			wantErr:   assert.NoError,
+		},
+		{
+			name:      "pointer",
+			prototype: &event{},
+			element:   map[string]any{"name": "a"},
+			want:      &event{Name: "a"},
+			wantErr:   assert.NoError,
+		},
+		{
+			name:      "scalar",
+			prototype: 0,
+			element:   2.0,
+			want:      2,
+			wantErr:   assert.NoError,
+		},
+		{
+			name:      "type mismatch",
+			prototype: event{},
+			element:   map[string]any{"name": "a", "count": "one"},
+			wantErr:   assert.Error,
+		},
+		{
+			name:      "not an object",
+			prototype: event{},
+			element:   "a",
+			wantErr:   assert.Error,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			stack := new(repository.Stack)
+			stack.SetElementType(tt.prototype)
+			got, err := stack.DecodeElement(tt.element)
+			tt.wantErr(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestStack_SetElementType_Reset(t *testing.T) {
+	t.Parallel()
+	stack := new(repository.Stack)
+	stack.SetElementType(event{})
+	stack.SetElementType(nil)
+	got, err := stack.DecodeElement("a")
+	require.NoError(t, err)
+	assert.Equal(t, "a", got)
+}
@@ -0,0 +1,493 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: batterdb.proto
+
+package pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	BatterDB_CreateDatabase_FullMethodName = "/batterdb.v1.BatterDB/CreateDatabase"
+	BatterDB_ListDatabases_FullMethodName  = "/batterdb.v1.BatterDB/ListDatabases"
+	BatterDB_DeleteDatabase_FullMethodName = "/batterdb.v1.BatterDB/DeleteDatabase"
+	BatterDB_CreateStack_FullMethodName    = "/batterdb.v1.BatterDB/CreateStack"
+	BatterDB_ListStacks_FullMethodName     = "/batterdb.v1.BatterDB/ListStacks"
+	BatterDB_DeleteStack_FullMethodName    = "/batterdb.v1.BatterDB/DeleteStack"
+	BatterDB_Push_FullMethodName           = "/batterdb.v1.BatterDB/Push"
+	BatterDB_Pop_FullMethodName            = "/batterdb.v1.BatterDB/Pop"
+	BatterDB_Peek_FullMethodName           = "/batterdb.v1.BatterDB/Peek"
+	BatterDB_Flush_FullMethodName          = "/batterdb.v1.BatterDB/Flush"
+)
+
+// BatterDBClient is the client API for BatterDB service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// BatterDB exposes the core database and stack operations.
+// Databases and stacks can be referenced by ID or name.
+type BatterDBClient interface {
+	// CreateDatabase creates a database.
+	CreateDatabase(ctx context.Context, in *CreateDatabaseRequest, opts ...grpc.CallOption) (*Database, error)
+	// ListDatabases lists the databases, sorted by name.
+	ListDatabases(ctx context.Context, in *ListDatabasesRequest, opts ...grpc.CallOption) (*ListDatabasesResponse, error)
+	// DeleteDatabase deletes a database.
+	DeleteDatabase(ctx context.Context, in *DatabaseRequest, opts ...grpc.CallOption) (*DeleteDatabaseResponse, error)
+	// CreateStack creates a stack in a database.
+	CreateStack(ctx context.Context, in *CreateStackRequest, opts ...grpc.CallOption) (*Stack, error)
+	// ListStacks lists the stacks of a database, sorted by name.
+	ListStacks(ctx context.Context, in *DatabaseRequest, opts ...grpc.CallOption) (*ListStacksResponse, error)
+	// DeleteStack deletes a stack from a database.
+	DeleteStack(ctx context.Context, in *StackRequest, opts ...grpc.CallOption) (*DeleteStackResponse, error)
+	// Push pushes an element on a stack.
+	Push(ctx context.Context, in *PushRequest, opts ...grpc.CallOption) (*ElementResponse, error)
+	// Pop pops the top element of a stack, the element is unset if the stack
+	// is empty.
+	Pop(ctx context.Context, in *StackRequest, opts ...grpc.CallOption) (*ElementResponse, error)
+	// Peek returns the top element of a stack, the element is unset if the
+	// stack is empty.
+	Peek(ctx context.Context, in *StackRequest, opts ...grpc.CallOption) (*ElementResponse, error)
+	// Flush removes all elements of a stack.
+	Flush(ctx context.Context, in *StackRequest, opts ...grpc.CallOption) (*Stack, error)
+}
+
+type batterDBClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewBatterDBClient(cc grpc.ClientConnInterface) BatterDBClient {
+	return &batterDBClient{cc}
+}
+
+func (c *batterDBClient) CreateDatabase(ctx context.Context, in *CreateDatabaseRequest, opts ...grpc.CallOption) (*Database, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Database)
+	err := c.cc.Invoke(ctx, BatterDB_CreateDatabase_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *batterDBClient) ListDatabases(ctx context.Context, in *ListDatabasesRequest, opts ...grpc.CallOption) (*ListDatabasesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListDatabasesResponse)
+	err := c.cc.Invoke(ctx, BatterDB_ListDatabases_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *batterDBClient) DeleteDatabase(ctx context.Context, in *DatabaseRequest, opts ...grpc.CallOption) (*DeleteDatabaseResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteDatabaseResponse)
+	err := c.cc.Invoke(ctx, BatterDB_DeleteDatabase_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *batterDBClient) CreateStack(ctx context.Context, in *CreateStackRequest, opts ...grpc.CallOption) (*Stack, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Stack)
+	err := c.cc.Invoke(ctx, BatterDB_CreateStack_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *batterDBClient) ListStacks(ctx context.Context, in *DatabaseRequest, opts ...grpc.CallOption) (*ListStacksResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListStacksResponse)
+	err := c.cc.Invoke(ctx, BatterDB_ListStacks_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *batterDBClient) DeleteStack(ctx context.Context, in *StackRequest, opts ...grpc.CallOption) (*DeleteStackResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteStackResponse)
+	err := c.cc.Invoke(ctx, BatterDB_DeleteStack_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *batterDBClient) Push(ctx context.Context, in *PushRequest, opts ...grpc.CallOption) (*ElementResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ElementResponse)
+	err := c.cc.Invoke(ctx, BatterDB_Push_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *batterDBClient) Pop(ctx context.Context, in *StackRequest, opts ...grpc.CallOption) (*ElementResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ElementResponse)
+	err := c.cc.Invoke(ctx, BatterDB_Pop_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *batterDBClient) Peek(ctx context.Context, in *StackRequest, opts ...grpc.CallOption) (*ElementResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ElementResponse)
+	err := c.cc.Invoke(ctx, BatterDB_Peek_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *batterDBClient) Flush(ctx context.Context, in *StackRequest, opts ...grpc.CallOption) (*Stack, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Stack)
+	err := c.cc.Invoke(ctx, BatterDB_Flush_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// BatterDBServer is the server API for BatterDB service.
+// All implementations must embed UnimplementedBatterDBServer
+// for forward compatibility.
+//
+// BatterDB exposes the core database and stack operations.
+// Databases and stacks can be referenced by ID or name.
+type BatterDBServer interface {
+	// CreateDatabase creates a database.
+	CreateDatabase(context.Context, *CreateDatabaseRequest) (*Database, error)
+	// ListDatabases lists the databases, sorted by name.
+	ListDatabases(context.Context, *ListDatabasesRequest) (*ListDatabasesResponse, error)
+	// DeleteDatabase deletes a database.
+	DeleteDatabase(context.Context, *DatabaseRequest) (*DeleteDatabaseResponse, error)
+	// CreateStack creates a stack in a database.
+	CreateStack(context.Context, *CreateStackRequest) (*Stack, error)
+	// ListStacks lists the stacks of a database, sorted by name.
+	ListStacks(context.Context, *DatabaseRequest) (*ListStacksResponse, error)
+	// DeleteStack deletes a stack from a database.
+	DeleteStack(context.Context, *StackRequest) (*DeleteStackResponse, error)
+	// Push pushes an element on a stack.
+	Push(context.Context, *PushRequest) (*ElementResponse, error)
+	// Pop pops the top element of a stack, the element is unset if the stack
+	// is empty.
+	Pop(context.Context, *StackRequest) (*ElementResponse, error)
+	// Peek returns the top element of a stack, the element is unset if the
+	// stack is empty.
+	Peek(context.Context, *StackRequest) (*ElementResponse, error)
+	// Flush removes all elements of a stack.
+	Flush(context.Context, *StackRequest) (*Stack, error)
+	mustEmbedUnimplementedBatterDBServer()
+}
+
+// UnimplementedBatterDBServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedBatterDBServer struct{}
+
+func (UnimplementedBatterDBServer) CreateDatabase(context.Context, *CreateDatabaseRequest) (*Database, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateDatabase not implemented")
+}
+func (UnimplementedBatterDBServer) ListDatabases(context.Context, *ListDatabasesRequest) (*ListDatabasesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListDatabases not implemented")
+}
+func (UnimplementedBatterDBServer) DeleteDatabase(context.Context, *DatabaseRequest) (*DeleteDatabaseResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteDatabase not implemented")
+}
+func (UnimplementedBatterDBServer) CreateStack(context.Context, *CreateStackRequest) (*Stack, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateStack not implemented")
+}
+func (UnimplementedBatterDBServer) ListStacks(context.Context, *DatabaseRequest) (*ListStacksResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListStacks not implemented")
+}
+func (UnimplementedBatterDBServer) DeleteStack(context.Context, *StackRequest) (*DeleteStackResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteStack not implemented")
+}
+func (UnimplementedBatterDBServer) Push(context.Context, *PushRequest) (*ElementResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Push not implemented")
+}
+func (UnimplementedBatterDBServer) Pop(context.Context, *StackRequest) (*ElementResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Pop not implemented")
+}
+func (UnimplementedBatterDBServer) Peek(context.Context, *StackRequest) (*ElementResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Peek not implemented")
+}
+func (UnimplementedBatterDBServer) Flush(context.Context, *StackRequest) (*Stack, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Flush not implemented")
+}
+func (UnimplementedBatterDBServer) mustEmbedUnimplementedBatterDBServer() {}
+func (UnimplementedBatterDBServer) testEmbeddedByValue()                  {}
+
+// UnsafeBatterDBServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to BatterDBServer will
+// result in compilation errors.
+type UnsafeBatterDBServer interface {
+	mustEmbedUnimplementedBatterDBServer()
+}
+
+func RegisterBatterDBServer(s grpc.ServiceRegistrar, srv BatterDBServer) {
+	// If the following call pancis, it indicates UnimplementedBatterDBServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&BatterDB_ServiceDesc, srv)
+}
+
+func _BatterDB_CreateDatabase_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateDatabaseRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BatterDBServer).CreateDatabase(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BatterDB_CreateDatabase_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BatterDBServer).CreateDatabase(ctx, req.(*CreateDatabaseRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BatterDB_ListDatabases_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListDatabasesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BatterDBServer).ListDatabases(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BatterDB_ListDatabases_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BatterDBServer).ListDatabases(ctx, req.(*ListDatabasesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BatterDB_DeleteDatabase_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DatabaseRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BatterDBServer).DeleteDatabase(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BatterDB_DeleteDatabase_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BatterDBServer).DeleteDatabase(ctx, req.(*DatabaseRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BatterDB_CreateStack_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateStackRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BatterDBServer).CreateStack(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BatterDB_CreateStack_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BatterDBServer).CreateStack(ctx, req.(*CreateStackRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BatterDB_ListStacks_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DatabaseRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BatterDBServer).ListStacks(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BatterDB_ListStacks_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BatterDBServer).ListStacks(ctx, req.(*DatabaseRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BatterDB_DeleteStack_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StackRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BatterDBServer).DeleteStack(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BatterDB_DeleteStack_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BatterDBServer).DeleteStack(ctx, req.(*StackRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BatterDB_Push_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PushRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BatterDBServer).Push(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BatterDB_Push_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BatterDBServer).Push(ctx, req.(*PushRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BatterDB_Pop_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StackRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BatterDBServer).Pop(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BatterDB_Pop_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BatterDBServer).Pop(ctx, req.(*StackRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BatterDB_Peek_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StackRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BatterDBServer).Peek(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BatterDB_Peek_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BatterDBServer).Peek(ctx, req.(*StackRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BatterDB_Flush_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StackRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BatterDBServer).Flush(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BatterDB_Flush_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BatterDBServer).Flush(ctx, req.(*StackRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// BatterDB_ServiceDesc is the grpc.ServiceDesc for BatterDB service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var BatterDB_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "batterdb.v1.BatterDB",
+	HandlerType: (*BatterDBServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateDatabase",
+			Handler:    _BatterDB_CreateDatabase_Handler,
+		},
+		{
+			MethodName: "ListDatabases",
+			Handler:    _BatterDB_ListDatabases_Handler,
+		},
+		{
+			MethodName: "DeleteDatabase",
+			Handler:    _BatterDB_DeleteDatabase_Handler,
+		},
+		{
+			MethodName: "CreateStack",
+			Handler:    _BatterDB_CreateStack_Handler,
+		},
+		{
+			MethodName: "ListStacks",
+			Handler:    _BatterDB_ListStacks_Handler,
+		},
+		{
+			MethodName: "DeleteStack",
+			Handler:    _BatterDB_DeleteStack_Handler,
+		},
+		{
+			MethodName: "Push",
+			Handler:    _BatterDB_Push_Handler,
+		},
+		{
+			MethodName: "Pop",
+			Handler:    _BatterDB_Pop_Handler,
+		},
+		{
+			MethodName: "Peek",
+			Handler:    _BatterDB_Peek_Handler,
+		},
+		{
+			MethodName: "Flush",
+			Handler:    _BatterDB_Flush_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "batterdb.proto",
+}
@@ -0,0 +1,333 @@
+// Package rpc exposes the repository over gRPC, see pb/batterdb.proto.
+package rpc
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative pb/batterdb.proto
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/jh125486/batterdb/repository"
+	"github.com/jh125486/batterdb/rpc/pb"
+)
+
+type (
+	// Server implements the BatterDB gRPC service on a repository.
+	Server struct {
+		pb.UnimplementedBatterDBServer
+		repo         *repository.Repository
+		push         PushFunc
+		validateName ValidateNameFunc
+		grpcOptions  []grpc.ServerOption
+	}
+	// Option configures a Server.
+	Option func(*Server)
+	// PushFunc checks an element, pushes it to the stack of the database and
+	// returns the element as pushed. Errors that aren't a gRPC status are
+	// InvalidArgument.
+	PushFunc func(db *repository.Database, stack *repository.Stack, element any) (any, error)
+	// ValidateNameFunc checks the name of a new database or stack. Errors that
+	// aren't a gRPC status are InvalidArgument.
+	ValidateNameFunc func(name string) error
+)
+
+// WithPush sets how elements are pushed, so pushes match those of the HTTP
+// API. By default elements are only decoded into the element type of the
+// stack, see repository.Stack.DecodeElement, and pushed. It isn't called for
+// counter databases.
+func WithPush(fn PushFunc) Option {
+	return func(s *Server) {
+		s.push = fn
+	}
+}
+
+// WithValidateName sets the checks of the names of new databases and stacks,
+// so they match those of the HTTP API. By default any name the repository
+// accepts is valid.
+func WithValidateName(fn ValidateNameFunc) Option {
+	return func(s *Server) {
+		s.validateName = fn
+	}
+}
+
+// WithServerOptions sets the options of the gRPC server.
+func WithServerOptions(opts ...grpc.ServerOption) Option {
+	return func(s *Server) {
+		s.grpcOptions = append(s.grpcOptions, opts...)
+	}
+}
+
+// NewServer returns a gRPC server serving the repository.
+func NewServer(repo *repository.Repository, opts ...Option) *grpc.Server {
+	s := &Server{repo: repo}
+	for _, opt := range opts {
+		opt(s)
+	}
+	srv := grpc.NewServer(s.grpcOptions...)
+	pb.RegisterBatterDBServer(srv, s)
+
+	return srv
+}
+
+func (s *Server) CreateDatabase(_ context.Context, req *pb.CreateDatabaseRequest) (*pb.Database, error) {
+	if err := s.checkName(req.GetName()); err != nil {
+		return nil, err
+	}
+	db, err := s.repo.New(req.GetName())
+	if errors.Is(err, repository.ErrAlreadyExists) {
+		return nil, status.Error(codes.AlreadyExists, "database already exists")
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return newDatabase(db), nil
+}
+
+func (s *Server) ListDatabases(_ context.Context, _ *pb.ListDatabasesRequest) (*pb.ListDatabasesResponse, error) {
+	dbs := s.repo.SortDatabases()
+	resp := &pb.ListDatabasesResponse{Databases: make([]*pb.Database, len(dbs))}
+	for i, db := range dbs {
+		resp.Databases[i] = newDatabase(db)
+	}
+
+	return resp, nil
+}
+
+func (s *Server) DeleteDatabase(_ context.Context, req *pb.DatabaseRequest) (*pb.DeleteDatabaseResponse, error) {
+	if err := s.repo.Drop(req.GetDatabase()); err != nil {
+		return nil, status.Error(codes.NotFound, "database not found")
+	}
+
+	return &pb.DeleteDatabaseResponse{}, nil
+}
+
+func (s *Server) CreateStack(_ context.Context, req *pb.CreateStackRequest) (*pb.Stack, error) {
+	if err := s.checkName(req.GetName()); err != nil {
+		return nil, err
+	}
+	db, err := s.database(req.GetDatabase())
+	if err != nil {
+		return nil, err
+	}
+	stack, err := db.New(req.GetName())
+	if errors.Is(err, repository.ErrAlreadyExists) {
+		return nil, status.Error(codes.AlreadyExists, "stack already exists")
+	}
+	if errors.Is(err, repository.ErrLimitReached) {
+		return nil, status.Error(codes.ResourceExhausted, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return newStack(stack)
+}
+
+func (s *Server) ListStacks(_ context.Context, req *pb.DatabaseRequest) (*pb.ListStacksResponse, error) {
+	db, err := s.database(req.GetDatabase())
+	if err != nil {
+		return nil, err
+	}
+	stacks := db.SortStacks()
+	resp := &pb.ListStacksResponse{Stacks: make([]*pb.Stack, len(stacks))}
+	for i, stack := range stacks {
+		if resp.Stacks[i], err = newStack(stack); err != nil {
+			return nil, err
+		}
+	}
+
+	return resp, nil
+}
+
+func (s *Server) DeleteStack(_ context.Context, req *pb.StackRequest) (*pb.DeleteStackResponse, error) {
+	db, stack, err := s.stack(req.GetDatabase(), req.GetStack())
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Drop(stack.ID.String()); err != nil {
+		return nil, status.Error(codes.NotFound, "stack not found")
+	}
+
+	return &pb.DeleteStackResponse{}, nil
+}
+
+func (s *Server) Push(_ context.Context, req *pb.PushRequest) (*pb.ElementResponse, error) {
+	db, stack, err := s.stack(req.GetDatabase(), req.GetStack())
+	if err != nil {
+		return nil, err
+	}
+	if db.IsCounter() {
+		// keep the single element invariant of counters.
+		return nil, status.Error(codes.FailedPrecondition, "can't push to a counter database")
+	}
+	element, err := s.pushElement(db, stack, req.GetElement().AsInterface())
+	if err != nil {
+		return nil, err
+	}
+
+	return newElementResponse(element)
+}
+
+func (s *Server) Pop(_ context.Context, req *pb.StackRequest) (*pb.ElementResponse, error) {
+	_, stack, err := s.stack(req.GetDatabase(), req.GetStack())
+	if err != nil {
+		return nil, err
+	}
+
+	return newElementResponse(stack.Pop())
+}
+
+func (s *Server) Peek(_ context.Context, req *pb.StackRequest) (*pb.ElementResponse, error) {
+	_, stack, err := s.stack(req.GetDatabase(), req.GetStack())
+	if err != nil {
+		return nil, err
+	}
+
+	return newElementResponse(stack.Peek())
+}
+
+func (s *Server) Flush(_ context.Context, req *pb.StackRequest) (*pb.Stack, error) {
+	_, stack, err := s.stack(req.GetDatabase(), req.GetStack())
+	if err != nil {
+		return nil, err
+	}
+	stack.Flush()
+
+	return newStack(stack)
+}
+
+// pushElement pushes an element to the stack and returns it as pushed, see
+// WithPush.
+func (s *Server) pushElement(db *repository.Database, stack *repository.Stack, element any) (any, error) {
+	if s.push == nil {
+		element, err := stack.DecodeElement(element)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "element does not match the element type of the stack")
+		}
+		if _, err := stack.Push(element); err != nil {
+			return nil, PushError(err)
+		}
+
+		return element, nil
+	}
+	element, err := s.push(db, stack, element)
+	if err != nil {
+		if _, ok := status.FromError(err); ok {
+			return nil, err
+		}
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return element, nil
+}
+
+// PushError maps an error of repository.Stack.Push to a gRPC status.
+func PushError(err error) error {
+	if errors.Is(err, repository.ErrStackFull) {
+		return status.Error(codes.ResourceExhausted, err.Error())
+	}
+
+	return status.Error(codes.Internal, err.Error())
+}
+
+func (s *Server) database(id string) (*repository.Database, error) {
+	db, err := s.repo.Database(id)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, "database not found")
+	}
+
+	return db, nil
+}
+
+func (s *Server) stack(dbID, sID string) (*repository.Database, *repository.Stack, error) {
+	db, err := s.database(dbID)
+	if err != nil {
+		return nil, nil, err
+	}
+	stack, err := db.Stack(sID)
+	if err != nil {
+		return nil, nil, status.Error(codes.NotFound, "stack not found")
+	}
+
+	return db, stack, nil
+}
+
+// checkName checks the name of a new database or stack, see WithValidateName.
+func (s *Server) checkName(name string) error {
+	if s.validateName == nil {
+		return nil
+	}
+	if err := s.validateName(name); err != nil {
+		if _, ok := status.FromError(err); ok {
+			return err
+		}
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return nil
+}
+
+func newDatabase(db *repository.Database) *pb.Database {
+	return &pb.Database{
+		Id:             db.ID.String(),
+		Name:           db.Name,
+		NumberOfStacks: int32(db.Len()),
+	}
+}
+
+func newStack(stack *repository.Stack) (*pb.Stack, error) {
+	peek, err := newValue(stack.Top())
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.Stack{
+		Id:        stack.ID.String(),
+		Name:      stack.Name,
+		Size:      int32(stack.Size()),
+		Peek:      peek,
+		CreatedAt: timestamppb.New(stack.CreatedAt),
+		UpdatedAt: timestamppb.New(stack.UpdatedAt),
+		ReadAt:    timestamppb.New(stack.ReadAt.Load()),
+	}, nil
+}
+
+func newElementResponse(element any) (*pb.ElementResponse, error) {
+	v, err := newValue(element)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.ElementResponse{Element: v}, nil
+}
+
+// newValue converts an element to a protobuf value, a nil element is unset.
+func newValue(element any) (*structpb.Value, error) {
+	if element == nil {
+		return nil, nil
+	}
+	v, err := structpb.NewValue(element)
+	if err == nil {
+		return v, nil
+	}
+	// e.g. a typed element, see repository.Stack.SetElementType.
+	b, jsonErr := json.Marshal(element)
+	if jsonErr == nil {
+		v = new(structpb.Value)
+		jsonErr = protojson.Unmarshal(b, v)
+	}
+	if jsonErr != nil {
+		return nil, status.Errorf(codes.Internal, "element can't be represented: %v", err)
+	}
+
+	return v, nil
+}
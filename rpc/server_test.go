@@ -0,0 +1,222 @@
+package rpc_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/jh125486/batterdb/repository"
+	"github.com/jh125486/batterdb/rpc"
+	"github.com/jh125486/batterdb/rpc/pb"
+)
+
+func newClient(t *testing.T, repo *repository.Repository, opts ...rpc.Option) pb.BatterDBClient {
+	t.Helper()
+	l := bufconn.Listen(1 << 20)
+	srv := rpc.NewServer(repo, opts...)
+	go func() {
+		_ = srv.Serve(l)
+	}()
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return l.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return pb.NewBatterDBClient(conn)
+}
+
+func TestServer_Databases(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	repo := repository.New()
+	client := newClient(t, repo, rpc.WithValidateName(func(name string) error {
+		if len(name) < 7 {
+			return errors.New("name must be at least 7 characters")
+		}
+		return nil
+	}))
+
+	db, err := client.CreateDatabase(ctx, &pb.CreateDatabaseRequest{Name: "dbName123"})
+	require.NoError(t, err)
+	assert.Equal(t, "dbName123", db.GetName())
+
+	_, err = client.CreateDatabase(ctx, &pb.CreateDatabaseRequest{Name: "dbName123"})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+
+	_, err = client.CreateDatabase(ctx, &pb.CreateDatabaseRequest{Name: "short"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	list, err := client.ListDatabases(ctx, &pb.ListDatabasesRequest{})
+	require.NoError(t, err)
+	require.Len(t, list.GetDatabases(), 1)
+	assert.Equal(t, db.GetId(), list.GetDatabases()[0].GetId())
+
+	_, err = client.DeleteDatabase(ctx, &pb.DatabaseRequest{Database: db.GetId()})
+	require.NoError(t, err)
+	assert.Equal(t, 0, repo.Len())
+
+	_, err = client.DeleteDatabase(ctx, &pb.DatabaseRequest{Database: "dbName123"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestServer_Stacks(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	repo := repository.New()
+	_, err := repo.New("dbName123")
+	require.NoError(t, err)
+	client := newClient(t, repo)
+
+	_, err = client.CreateStack(ctx, &pb.CreateStackRequest{Database: "dne", Name: "stackName123"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	stack, err := client.CreateStack(ctx, &pb.CreateStackRequest{Database: "dbName123", Name: "stackName123"})
+	require.NoError(t, err)
+	assert.Equal(t, "stackName123", stack.GetName())
+
+	ref := &pb.StackRequest{Database: "dbName123", Stack: "stackName123"}
+	peek, err := client.Peek(ctx, ref)
+	require.NoError(t, err)
+	assert.Nil(t, peek.GetElement(), "empty stack has no element")
+
+	for _, v := range []any{"first", map[string]any{"key": 1.0}} {
+		element, err := structpb.NewValue(v)
+		require.NoError(t, err)
+		_, err = client.Push(ctx, &pb.PushRequest{Database: "dbName123", Stack: "stackName123", Element: element})
+		require.NoError(t, err)
+	}
+
+	list, err := client.ListStacks(ctx, &pb.DatabaseRequest{Database: "dbName123"})
+	require.NoError(t, err)
+	require.Len(t, list.GetStacks(), 1)
+	assert.Equal(t, int32(2), list.GetStacks()[0].GetSize())
+
+	peek, err = client.Peek(ctx, ref)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"key": 1.0}, peek.GetElement().AsInterface())
+
+	pop, err := client.Pop(ctx, ref)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"key": 1.0}, pop.GetElement().AsInterface())
+
+	flushed, err := client.Flush(ctx, ref)
+	require.NoError(t, err)
+	assert.Equal(t, int32(0), flushed.GetSize())
+
+	_, err = client.DeleteStack(ctx, ref)
+	require.NoError(t, err)
+
+	_, err = client.Pop(ctx, ref)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestServer_Push_Hook(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	repo := repository.New()
+	db, err := repo.New("dbName123")
+	require.NoError(t, err)
+	stack, err := db.New("stackName123")
+	require.NoError(t, err)
+	client := newClient(t, repo, rpc.WithPush(func(_ *repository.Database, stack *repository.Stack, element any) (any, error) {
+		switch element {
+		case "rejected":
+			return nil, errors.New("element does not match the schema")
+		case "failed":
+			return nil, status.Error(codes.Internal, "invalid schema")
+		}
+		element = strings.ToUpper(element.(string))
+		_, err := stack.Push(element)
+		return element, err
+	}))
+
+	tests := []struct {
+		element  string
+		want     codes.Code
+		wantResp any
+	}{
+		{element: "rejected", want: codes.InvalidArgument},
+		{element: "failed", want: codes.Internal},
+		{element: "accepted", want: codes.OK, wantResp: "ACCEPTED"},
+	}
+	for _, tt := range tests {
+		resp, err := client.Push(ctx, &pb.PushRequest{Database: "dbName123", Stack: "stackName123", Element: structpb.NewStringValue(tt.element)})
+		assert.Equal(t, tt.want, status.Code(err), tt.element)
+		if err == nil {
+			// the response has the element as pushed.
+			assert.Equal(t, tt.wantResp, resp.GetElement().AsInterface())
+		}
+	}
+	assert.Equal(t, 1, stack.Size())
+	assert.Equal(t, "ACCEPTED", stack.Peek())
+}
+
+func TestServer_Push_Typed(t *testing.T) {
+	t.Parallel()
+	type event struct {
+		Kind string `json:"kind"`
+	}
+	repo := repository.New()
+	db, err := repo.New("dbName123")
+	require.NoError(t, err)
+	stack, err := db.New("stackName123")
+	require.NoError(t, err)
+	stack.SetElementType(event{})
+	client := newClient(t, repo)
+
+	element, err := structpb.NewValue(map[string]any{"kind": "click", "ignored": true})
+	require.NoError(t, err)
+	resp, err := client.Push(context.Background(), &pb.PushRequest{Database: "dbName123", Stack: "stackName123", Element: element})
+	require.NoError(t, err)
+	// the response has the element as decoded.
+	assert.Equal(t, map[string]any{"kind": "click"}, resp.GetElement().AsInterface())
+	assert.Equal(t, event{Kind: "click"}, stack.Peek())
+}
+
+func TestServer_Push_Counter(t *testing.T) {
+	t.Parallel()
+	repo := repository.New()
+	db, err := repo.New("dbName123", repository.WithMode(repository.ModeCounter))
+	require.NoError(t, err)
+	stack, err := db.New("counter123")
+	require.NoError(t, err)
+	client := newClient(t, repo)
+
+	_, err = client.Push(context.Background(), &pb.PushRequest{Database: "dbName123", Stack: "counter123", Element: structpb.NewNumberValue(1)})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	assert.Equal(t, 0, stack.Size())
+}
+
+func TestServer_Push_Full(t *testing.T) {
+	t.Parallel()
+	repo := repository.New()
+	repo.SetMaxStackSize(1)
+	db, err := repo.New("dbName123")
+	require.NoError(t, err)
+	_, err = db.New("stackName123")
+	require.NoError(t, err)
+	client := newClient(t, repo)
+
+	req := &pb.PushRequest{Database: "dbName123", Stack: "stackName123", Element: structpb.NewNumberValue(1)}
+	_, err = client.Push(context.Background(), req)
+	require.NoError(t, err)
+	_, err = client.Push(context.Background(), req)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+}